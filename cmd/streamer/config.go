@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"Rita-go-streamer/streamer"
+)
+
+// config is what the command runs: the streamer's Config and the soak
+// test or preflight check, if one was asked for.
+type config struct {
+	Streamer       streamer.Config
+	Source         inputSource
+	SoakIterations int
+	SoakPublish    time.Duration
+	Check          bool
+	CheckConnect   bool
+}
+
+// envFlags are the flags that stand in for an environment variable, the
+// room settings' and the streamer's. A flag given on the command line is set
+// in the environment before anything is read, so it wins over both the
+// environment and .env.local, including when SIGHUP rereads the file.
+var envFlags = append(slices.Clone(streamer.RoomEnvFlags), []streamer.EnvFlag{
+	{Name: "video-pipe", Env: "VIDEO_PIPE", Usage: "raw video FIFO, " + streamer.DefaultVideoPipePath + " by default"},
+	{Name: "audio-pipe", Env: "AUDIO_PIPE", Usage: "raw audio FIFO, " + streamer.DefaultAudioPipePath + " by default"},
+	{Name: "video-file", Env: "VIDEO_FILE", Usage: "raw video file to stream in place of the video pipe, needs VIDEO_SIZE"},
+	{Name: "audio-file", Env: "AUDIO_FILE", Usage: "raw audio file to stream in place of the audio pipe"},
+	{Name: "fps", Env: "VIDEO_FPS", Usage: "the producer's frame rate"},
+	{Name: "preset", Env: "ENCODER_PRESET", Usage: "video encoder -preset, overriding the profile's"},
+	{Name: "log-level", Env: "LOG_LEVEL", Usage: "debug, info (default), warn or error"},
+}...)
+
+// loadConfig parses the command line args, without the program name, and
+// the environment, falling back to .env.local for variables set in
+// neither. Every invalid or missing setting is reported in the one error.
+func loadConfig(args []string) (config, error) {
+	var c config
+	fset := flag.NewFlagSet("streamer", flag.ContinueOnError)
+	fset.IntVar(&c.SoakIterations, "soak", 0, "connect, publish a test pattern and disconnect this many times, failing on goroutine or FD leaks")
+	fset.DurationVar(&c.SoakPublish, "soak-publish", 5*time.Second, "how long each soak iteration publishes")
+	fset.BoolVar(&c.Check, "check", false, "check the settings, ffmpeg and its encoders, and the pipe directories, then exit")
+	fset.BoolVar(&c.CheckConnect, "check-connect", false, "as -check, and also test the credentials against the server")
+	if err := streamer.LoadEnv(fset, envFlags, args, ".env.local"); err != nil {
+		return config{}, err
+	}
+
+	var p envParser
+	room, err := streamer.RoomFromEnv()
+	if err != nil {
+		p.errs = append(p.errs, err)
+	}
+
+	attributes := map[string]string{"role": "agent-avatar"}
+	maps.Copy(attributes, p.attributes("PARTICIPANT_ATTRIBUTES"))
+
+	maxDuration := p.duration("MAX_SESSION_DURATION")
+	iceTimeout := p.duration("ICE_TIMEOUT")
+	encoderStall := p.duration("ENCODER_STALL_TIMEOUT")
+	encoderBacklog := p.int("ENCODER_BACKLOG")
+	encoderStop := p.duration("ENCODER_STOP_TIMEOUT")
+	pipeOpenTimeout := p.duration("PIPE_OPEN_TIMEOUT")
+	headerTimeout := p.duration("HEADER_TIMEOUT")
+	startupTimeout := p.duration("STARTUP_TIMEOUT")
+	reconnectBuffer := p.duration("RECONNECT_BUFFER")
+	keyframeInterval := p.duration("KEYFRAME_INTERVAL")
+	audioDelay := p.duration("AUDIO_PUBLISH_DELAY")
+	videoDelay := p.duration("VIDEO_PUBLISH_DELAY")
+	syncStart := p.duration("SYNC_START_TIMEOUT")
+	rejoinAttempts := p.int("MAX_REJOIN_ATTEMPTS")
+	restartLimit := p.int("ENCODER_RESTART_LIMIT")
+	width, height := p.size("VIDEO_SIZE")
+	outputWidth, outputHeight := p.size("OUTPUT_SIZE")
+	fps := p.int("VIDEO_FPS")
+	audioRate := p.int("AUDIO_SAMPLE_RATE")
+	audioChannels := p.int("AUDIO_CHANNELS")
+	keyframeBurst := p.int("KEYFRAME_BURST")
+	encoderThreads := p.int("ENCODER_THREADS")
+	encoderNice := p.int("ENCODER_NICE")
+	videoBitrate := p.int("VIDEO_BITRATE_KBPS")
+	videoMaxBitrate := p.int("VIDEO_MAX_BITRATE_KBPS")
+	audioBitrate := p.int("AUDIO_BITRATE_KBPS")
+	audioFECLoss := p.int("AUDIO_FEC_LOSS")
+
+	var adaptiveGOP streamer.AdaptiveGOP
+	if v := os.Getenv("ADAPTIVE_GOP"); v != "" {
+		lo, hi, ok := strings.Cut(v, "-")
+		var err error
+		adaptiveGOP.MinGOP, err = strconv.Atoi(lo)
+		if err == nil && ok {
+			adaptiveGOP.MaxGOP, err = strconv.Atoi(hi)
+		}
+		if err != nil || !ok {
+			p.errs = append(p.errs, fmt.Errorf("invalid ADAPTIVE_GOP %q, want MIN-MAX in frames", v))
+		}
+	}
+
+	var logSampling map[streamer.LogCategory]streamer.LogSampling
+	if perSecond := p.int("LOG_READS_PER_SECOND"); perSecond != 0 {
+		logSampling = map[streamer.LogCategory]streamer.LogSampling{
+			streamer.LogReads: {PerSecond: perSecond},
+		}
+	}
+
+	cfg := streamer.Config{
+		// LOG_LEVEL is debug, info (default), warn or error; debug adds the
+		// per-frame stats. LOG_FORMAT=text or json logs through slog's
+		// handlers instead of plain lines
+		Logger:    p.logger("LOG_LEVEL", "LOG_FORMAT"),
+		URL:       room.URL,
+		APIKey:    room.APIKey,
+		APISecret: room.APISecret,
+		RoomName:  room.RoomName,
+		// LIVEKIT_CREDENTIALS_FILE (e.g. a mounted secret) overrides the three above
+		CredentialsFile: room.CredentialsFile,
+		// LIVEKIT_PROXY overrides HTTP(S)_PROXY for signalling
+		Proxy: os.Getenv("LIVEKIT_PROXY"),
+		// FORCE_RELAY=1 sends media only through the server's TURN relays
+		ForceRelay: os.Getenv("FORCE_RELAY") != "",
+		// ICE_TIMEOUT (e.g. 5s) bounds each connection attempt, and
+		// RELAY_FALLBACK=1 retries a timed-out one through TURN
+		ICETimeout:    iceTimeout,
+		RelayFallback: os.Getenv("RELAY_FALLBACK") != "",
+		// IDENTITY pins the participant identity, e.g. to rejoin after a restart
+		Identity: room.Identity,
+		// IDENTITY_PREFIX replaces "Avatar-" ahead of the generated identity
+		IdentityFunc: room.IdentityFunc,
+		// VIDEO_PIPE and AUDIO_PIPE are the producer's FIFOs
+		VideoPipePath: os.Getenv("VIDEO_PIPE"),
+		AudioPipePath: os.Getenv("AUDIO_PIPE"),
+		// DISABLE_VIDEO=1 streams the audio alone, DISABLE_AUDIO=1 the video
+		DisableVideo: os.Getenv("DISABLE_VIDEO") != "",
+		DisableAudio: os.Getenv("DISABLE_AUDIO") != "",
+		// PIPE_OPEN_TIMEOUT (e.g. 30s) fails if the producer has not opened
+		// both pipes by then, and HEADER_TIMEOUT bounds the wait for its header
+		PipeOpenTimeout: pipeOpenTimeout,
+		HeaderTimeout:   headerTimeout,
+		// STARTUP_TIMEOUT (e.g. 60s) bounds the whole bring-up and names the
+		// stage that was stuck when it fails
+		StartupTimeout: startupTimeout,
+		// PARTICIPANT_NAME and PARTICIPANT_METADATA are shown to clients, and
+		// PARTICIPANT_ATTRIBUTES (e.g. tenant=acme,role=tutor) is merged over role=agent-avatar
+		ParticipantName:       os.Getenv("PARTICIPANT_NAME"),
+		ParticipantMetadata:   os.Getenv("PARTICIPANT_METADATA"),
+		ParticipantAttributes: attributes,
+		// VIDEO_TRACK_METADATA and AUDIO_TRACK_METADATA tag the tracks for clients
+		VideoTrackMetadata: os.Getenv("VIDEO_TRACK_METADATA"),
+		AudioTrackMetadata: os.Getenv("AUDIO_TRACK_METADATA"),
+		// ROOM_METADATA_OVERRIDES=1 applies bitrate and encoder settings from the room metadata
+		RoomMetadataOverrides: os.Getenv("ROOM_METADATA_OVERRIDES") != "",
+		// VIDEO_SIZE (e.g. 1280x720) replaces the video pipe's size header
+		DimensionsFromConfig: width != 0,
+		Width:                width,
+		Height:               height,
+		// OUTPUT_SIZE (e.g. 640x360) scales the published video to that size
+		OutputWidth:  outputWidth,
+		OutputHeight: outputHeight,
+		// VIDEO_FPS is the producer's frame rate, 25 if unset, and
+		// HEADER_FPS=1 reads it from a third uint32 in the video header
+		FrameRate:           fps,
+		FrameRateFromHeader: os.Getenv("HEADER_FPS") != "",
+		// PIXEL_FORMAT is yuv420p (default), nv12, yuva420p, rgb24, rgba or bgra
+		PixelFormat: streamer.PixelFormat(os.Getenv("PIXEL_FORMAT")),
+		// HEADER_PIXEL_FORMAT=1 reads it from a uint32 code after the rate in the video header
+		PixelFormatFromHeader: os.Getenv("HEADER_PIXEL_FORMAT") != "",
+		// ALPHA_PACKING is side-by-side or stacked, publishing the input's alpha
+		AlphaPacking: streamer.AlphaPacking(os.Getenv("ALPHA_PACKING")),
+		// AUDIO_FORMAT is s16le (default), f32le or s24le
+		AudioSampleFormat: streamer.AudioSampleFormat(os.Getenv("AUDIO_FORMAT")),
+		// AUDIO_SAMPLE_RATE is the input rate in Hz; 48000 skips resampling
+		AudioSampleRate: audioRate,
+		// AUDIO_CHANNELS is 1 (default) or 2 for interleaved stereo input
+		AudioChannels: audioChannels,
+		// TS_INPUT publishes an MPEG-TS file or URL instead of the FIFOs
+		TSInput: os.Getenv("TS_INPUT"),
+		// PRE_ROLL plays a media file before cutting to the live input
+		PreRoll: os.Getenv("PRE_ROLL"),
+		// FALLBACK_IMAGE is a still image shown while the video input stalls
+		FallbackImage: os.Getenv("FALLBACK_IMAGE"),
+		// GAP_FILL is hold or black, filling input gaps past 100ms (audio with silence)
+		GapFill: streamer.GapFill(os.Getenv("GAP_FILL")),
+		// RECONNECT_INPUT is drop (default) or block, for input during reconnects
+		ReconnectInputPolicy: streamer.ReconnectInputPolicy(os.Getenv("RECONNECT_INPUT")),
+		// RECONNECT_BUFFER (e.g. 2s) keeps that much of the dropped input and sends it once reconnected
+		ReconnectBuffer: reconnectBuffer,
+		// MAX_REJOIN_ATTEMPTS rejoins after the connection is lost, with backoff
+		MaxRejoinAttempts: rejoinAttempts,
+		// STARTUP_INPUT is buffer (default) or drop, for input before the tracks are bound
+		StartupInputPolicy: streamer.StartupInputPolicy(os.Getenv("STARTUP_INPUT")),
+		// AUTODETECT_INPUT=1 probes TS_INPUT for its codec, size and frame rate
+		AutoDetectInput: os.Getenv("AUTODETECT_INPUT") != "",
+		// INPUT_SOCKET replaces the FIFOs with a Unix domain socket
+		InputSocketPath: os.Getenv("INPUT_SOCKET"),
+		// INPUT_SOCKET_ADDR listens on a TCP host:port instead, and
+		// INPUT_SOCKET_REACCEPT=1 waits for a producer that disconnects to return
+		InputSocketAddr:     os.Getenv("INPUT_SOCKET_ADDR"),
+		InputSocketReaccept: os.Getenv("INPUT_SOCKET_REACCEPT") != "",
+		// KEYFRAME_BURST opens the stream with that many keyframes, 200ms apart
+		KeyframeBurst: keyframeBurst,
+		// KEYFRAME_INTERVAL (e.g. 2s) sets the GOP in seconds at whatever frame rate the producer sends
+		KeyframeInterval: keyframeInterval,
+		// FORCE_KEYFRAMES=1 restarts the encoder for a keyframe when a viewer subscribes
+		ForceKeyframes: os.Getenv("FORCE_KEYFRAMES") != "",
+		// ENCODER_PROFILE is one of low-latency, balanced or quality
+		Profile: os.Getenv("ENCODER_PROFILE"),
+		// VIDEO_BITRATE_KBPS and ENCODER_PRESET (e.g. p4) override the profile's
+		VideoEncoder: streamer.VideoEncoderSettings{
+			BitrateKbps: videoBitrate,
+			Preset:      os.Getenv("ENCODER_PRESET"),
+			// VIDEO_MAX_BITRATE_KBPS caps the bitrate and VIDEO_RATE_CONTROL
+			// is cbr or vbr
+			MaxBitrateKbps: videoMaxBitrate,
+			RateControl:    streamer.RateControl(os.Getenv("VIDEO_RATE_CONTROL")),
+		},
+		// PAUSE_WHEN_IDLE=1 stops encoding while no other participant is in the room
+		PauseWhenIdle: os.Getenv("PAUSE_WHEN_IDLE") != "",
+		// AUDIO_PUBLISH_DELAY and VIDEO_PUBLISH_DELAY (e.g. 500ms) stagger the tracks
+		AudioPublishDelay: audioDelay,
+		VideoPublishDelay: videoDelay,
+		// SYNC_START_TIMEOUT (e.g. 2s) waits that long at most for both encoders' first frames and publishes the tracks together
+		SyncStartTimeout: syncStart,
+		// ADAPTIVE_GOP (e.g. 30-240) varies the GOP in frames with the join rate
+		AdaptiveGOP: adaptiveGOP,
+		// VIDEO_CODEC is h264 (default) or vp8
+		VideoCodec: streamer.VideoCodec(os.Getenv("VIDEO_CODEC")),
+		// H264_ENCODER (h264_nvenc, h264_qsv, h264_videotoolbox or libx264) picks the H264 encoder
+		H264Encoder: os.Getenv("H264_ENCODER"),
+		// REQUIRE_HARDWARE=1 refuses to fall back to software encoding
+		RequireHardware: os.Getenv("REQUIRE_HARDWARE") != "",
+		// ADAPT_CODEC=1 publishes VP8 into rooms that do not allow H264
+		AdaptCodec: os.Getenv("ADAPT_CODEC") != "",
+		// ENCODER_THREADS sets -threads for the software fallback encoder
+		EncoderThreads: encoderThreads,
+		// ENCODER_NICE (e.g. 10) and ENCODER_CGROUP (a cgroup v2 directory) constrain ffmpeg
+		EncoderNice:   encoderNice,
+		EncoderCgroup: os.Getenv("ENCODER_CGROUP"),
+		// ENCODER_WARMUP=1 initializes the encoder before real frames arrive
+		Warmup: os.Getenv("ENCODER_WARMUP") != "",
+		// ENCODER_STALL_TIMEOUT (e.g. 3s) restarts an encoder that stops producing output
+		EncoderStallTimeout:   encoderStall,
+		RestartOnEncoderStall: true,
+		// ENCODER_BACKLOG (e.g. 3) drops the oldest raw frames once that many wait for a slow encoder
+		EncoderBacklog: encoderBacklog,
+		// ENCODER_RESTART_LIMIT stalls restarted within 5 minutes before giving up and exiting
+		EncoderRestartLimit: restartLimit,
+		// HOT_SWAP=1 reconfigures by running a second encoder until it takes over at a keyframe
+		HotSwapReconfigure: os.Getenv("HOT_SWAP") != "",
+		// AUDIO_BITRATE_KBPS sets the Opus target; AUDIO_CBR=1 disables VBR
+		AudioBitrateKbps: audioBitrate,
+		AudioCBR:         os.Getenv("AUDIO_CBR") != "",
+		// OPUS_APPLICATION is voip, audio or lowdelay
+		OpusApplication: streamer.OpusApplication(os.Getenv("OPUS_APPLICATION")),
+		// AUDIO_FEC_LOSS enables Opus in-band FEC for this expected packet loss percentage
+		AudioFECPacketLoss: audioFECLoss,
+		// AUDIO_DTX=1 stops sending audio packets while the avatar is silent
+		AudioDTX: os.Getenv("AUDIO_DTX") != "",
+		// AUDIO_RESAMPLER=soxr resamples voice at higher quality than the default swr
+		AudioResampler: streamer.AudioResampler(os.Getenv("AUDIO_RESAMPLER")),
+		// CLOCK_SOURCE=wall or ntp paces frames by a clock shared across streamers, and
+		// session keeps audio and video on the same wall-clock timeline
+		ClockSource: streamer.ClockSource(os.Getenv("CLOCK_SOURCE")),
+		// MAX_SESSION_DURATION (e.g. 30m) stops the session regardless of viewers
+		MaxSessionDuration: maxDuration,
+		// EVENT_LOG appends a JSONL timeline of the session to this path
+		EventLogPath: os.Getenv("EVENT_LOG"),
+		// HEALTH_ADDR serves /healthz, /stats and /metrics on a host:port or unix:/path
+		HealthAddr: os.Getenv("HEALTH_ADDR"),
+		// METRICS_NAMESPACE prefixes the /metrics names, rita_streamer by default
+		MetricsNamespace: os.Getenv("METRICS_NAMESPACE"),
+		// A shutdown stuck for longer than the default grace period exits the process
+		ExitOnShutdownTimeout: true,
+		// ENCODER_STOP_TIMEOUT (e.g. 5s) is how long ffmpeg gets to flush after SIGTERM
+		EncoderStopTimeout: encoderStop,
+		// STATS_WEBHOOK_URL receives the final stats as JSON on shutdown
+		StatsWebhookURL: os.Getenv("STATS_WEBHOOK_URL"),
+		// STATS_JSON writes the final stats as one JSON object to this path, or - for stdout
+		StatsPath: os.Getenv("STATS_JSON"),
+		// SUBSCRIBE_ONLY=1 joins as a monitor, recording tracks to RECORD_DIR
+		SubscribeOnly: os.Getenv("SUBSCRIBE_ONLY") != "",
+		RecordDir:     os.Getenv("RECORD_DIR"),
+		// DECODE_DIR decodes subscribed video to raw yuv420p files, in the video pipe's format
+		DecodeDir: os.Getenv("DECODE_DIR"),
+		// RECORD_CONTAINER is raw (default), mp4, fmp4, mkv or webm, and
+		// RECORD_MUXING=muxed writes one file per participant
+		RecordContainer: streamer.RecordContainer(os.Getenv("RECORD_CONTAINER")),
+		RecordMuxing:    streamer.RecordMuxing(os.Getenv("RECORD_MUXING")),
+		// VERIFY_PUBLISH=1 checks with a hidden subscriber that media flows
+		VerifyPublish: os.Getenv("VERIFY_PUBLISH") != "",
+		// DISABLE_VIDEO_RTX=1 stops retransmitting lost video packets to the SFU
+		DisableVideoRTX: os.Getenv("DISABLE_VIDEO_RTX") != "",
+		// E2EE_PASSPHRASE end-to-end encrypts the tracks (publishing VP8) with a key shared out of band
+		E2EEPassphrase: os.Getenv("E2EE_PASSPHRASE"),
+		// FRAME_HEADERS=1 expects a seq/timestamp header before each video frame
+		FrameHeaders: os.Getenv("FRAME_HEADERS") != "",
+		// TIMECODE_SEI=1 sends a counter and timestamp SEI before each frame
+		TimecodeSEI: os.Getenv("TIMECODE_SEI") != "",
+		// LOG_READS_PER_SECOND logs up to that many encoded-stream reads a second
+		LogSampling: logSampling,
+		// CHECK_FRAME_ALIGNMENT=1 warns when the producer's frames are not the expected size
+		CheckFrameAlignment: os.Getenv("CHECK_FRAME_ALIGNMENT") != "",
+		// FRAME_CHECKSUMS=1 logs a CRC32 per raw frame and per encoded NAL unit
+		FrameChecksums:    os.Getenv("FRAME_CHECKSUMS") != "",
+		OnTrackSubscribed: trackSubscribed,
+	}
+	// VIDEO_FILE and AUDIO_FILE stream raw files instead of the pipes
+	c.Source = pipeSource{}
+	if video, audio := os.Getenv("VIDEO_FILE"), os.Getenv("AUDIO_FILE"); video != "" || audio != "" {
+		if video != "" && width == 0 {
+			p.errs = append(p.errs, errors.New("VIDEO_FILE has no header to take the size from; set VIDEO_SIZE"))
+		}
+		c.Source = fileSource{video: video, audio: audio, width: width, height: height}
+	}
+	if err := errors.Join(p.errs...); err != nil {
+		return config{}, err
+	}
+	c.Streamer = cfg
+	return c, nil
+}
+
+// envParser parses environment variables, collecting the errors so that
+// they can all be reported at once. A variable that is unset or invalid
+// parses as zero.
+type envParser struct {
+	errs []error
+}
+
+func (p *envParser) duration(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", name, v, err))
+	}
+	return d
+}
+
+func (p *envParser) int(name string) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", name, v, err))
+	}
+	return n
+}
+
+// logger returns a logger at the level named by levelName and in the
+// format named by formatName. The default format stays on the log
+// package's lines, at that level.
+func (p *envParser) logger(levelName, formatName string) *slog.Logger {
+	var level slog.Level
+	if v := os.Getenv(levelName); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q: %w", levelName, v, err))
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch v := os.Getenv(formatName); v {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, opts))
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts))
+	case "":
+	default:
+		p.errs = append(p.errs, fmt.Errorf("invalid %s %q, want text or json", formatName, v))
+	}
+	slog.SetLogLoggerLevel(level)
+	return slog.Default()
+}
+
+// attributes parses comma-separated key=value pairs.
+func (p *envParser) attributes(name string) map[string]string {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	attrs := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			p.errs = append(p.errs, fmt.Errorf("invalid %s %q, want key=value,...", name, v))
+			return nil
+		}
+		attrs[strings.TrimSpace(key)] = value
+	}
+	return attrs
+}
+
+// size parses a WIDTHxHEIGHT size.
+func (p *envParser) size(name string) (width, height uint32) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, 0
+	}
+	w, h, ok := strings.Cut(v, "x")
+	parsedWidth, err := strconv.ParseUint(w, 10, 32)
+	var parsedHeight uint64
+	if err == nil && ok {
+		parsedHeight, err = strconv.ParseUint(h, 10, 32)
+	}
+	if err != nil || !ok {
+		p.errs = append(p.errs, fmt.Errorf("invalid %s %q, want WIDTHxHEIGHT", name, v))
+		return 0, 0
+	}
+	return uint32(parsedWidth), uint32(parsedHeight)
+}
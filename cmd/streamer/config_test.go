@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig runs loadConfig on args in a directory holding envFile as
+// .env.local, unless it is empty, with env as the only settings in the
+// environment. The environment is restored when t ends.
+func loadTestConfig(t *testing.T, envFile string, env map[string]string, args ...string) (config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if envFile != "" {
+		if err := os.WriteFile(filepath.Join(dir, ".env.local"), []byte(envFile), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	for _, f := range envFlags {
+		// Setenv restores the variable when t ends, including after the
+		// loader sets it.
+		t.Setenv(f.Env, "")
+		os.Unsetenv(f.Env)
+	}
+	for _, name := range []string{"LIVEKIT_CREDENTIALS_FILE", "ENCODER_PROFILE"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for name, v := range env {
+		t.Setenv(name, v)
+	}
+	return loadConfig(args)
+}
+
+const testEnvFile = `LIVEKIT_URL=wss://file.example
+LIVEKIT_API_KEY=file-key
+LIVEKIT_API_SECRET=file-secret
+ROOM_NAME=file-room
+ENCODER_PRESET=file-preset
+VIDEO_FPS=24
+`
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		env               map[string]string
+		args              []string
+		room, url, preset string
+		fps               int
+	}{
+		{
+			name: ".env.local alone",
+			room: "file-room", url: "wss://file.example", preset: "file-preset", fps: 24,
+		},
+		{
+			name: "environment over .env.local",
+			env:  map[string]string{"ROOM_NAME": "env-room", "VIDEO_FPS": "30"},
+			room: "env-room", url: "wss://file.example", preset: "file-preset", fps: 30,
+		},
+		{
+			name: "flags over both",
+			env:  map[string]string{"ROOM_NAME": "env-room", "VIDEO_FPS": "30"},
+			args: []string{"-room", "flag-room", "-url", "wss://flag.example", "-preset", "flag-preset", "-fps", "50"},
+			room: "flag-room", url: "wss://flag.example", preset: "flag-preset", fps: 50,
+		},
+		{
+			name: "argument over both",
+			env:  map[string]string{"ROOM_NAME": "env-room"},
+			args: []string{"arg-room"},
+			room: "arg-room", url: "wss://file.example", preset: "file-preset", fps: 24,
+		},
+		{
+			name: "-room over the argument",
+			args: []string{"-room", "flag-room", "arg-room"},
+			room: "flag-room", url: "wss://file.example", preset: "file-preset", fps: 24,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadTestConfig(t, testEnvFile, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := c.Streamer
+			if cfg.RoomName != tt.room || cfg.URL != tt.url || cfg.VideoEncoder.Preset != tt.preset || cfg.FrameRate != tt.fps {
+				t.Errorf("room %q, url %q, preset %q, %d fps, want %q, %q, %q, %d",
+					cfg.RoomName, cfg.URL, cfg.VideoEncoder.Preset, cfg.FrameRate, tt.room, tt.url, tt.preset, tt.fps)
+			}
+			if cfg.APIKey != "file-key" || cfg.APISecret != "file-secret" {
+				t.Errorf("credentials %q, %q, want those of .env.local", cfg.APIKey, cfg.APISecret)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	_, err := loadTestConfig(t, "LIVEKIT_URL=wss://file.example\n", nil)
+	if err == nil {
+		t.Fatal("loadConfig without a room or credentials succeeded")
+	}
+	// Every missing setting is reported at once.
+	for _, want := range []string{"no room", "LIVEKIT_API_KEY is not set", "LIVEKIT_API_SECRET is not set"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not say %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "LIVEKIT_URL") {
+		t.Errorf("error %q reports LIVEKIT_URL, which .env.local sets", err)
+	}
+
+	if _, err := loadTestConfig(t, "", nil, "room"); err == nil || !strings.Contains(err.Error(), ".env.local") {
+		t.Errorf("missing .env.local: %v, want it reported", err)
+	}
+	if _, err := loadTestConfig(t, testEnvFile, nil, "a", "b"); err == nil {
+		t.Error("two arguments accepted")
+	}
+}
@@ -0,0 +1,416 @@
+// Command streamer publishes a producer's raw video and audio pipes, or
+// raw files given by VIDEO_FILE and AUDIO_FILE, to a LiveKit room using
+// package streamer. It reads the environment and
+// .env.local from the working directory; the settings it honours are
+// listed in the Config literal in loadConfig, and the flags listed by -h
+// override the most common of them.
+//
+//	streamer [flags] [<room>]
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"Rita-go-streamer/streamer"
+
+	"github.com/joho/godotenv"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+func init() {
+	// Configure logger to write to stdout with timestamp
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+}
+
+func main() {
+	c, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "streamer: %v\n", err)
+		os.Exit(2)
+	}
+	cfg := c.Streamer
+
+	// SIGINT/SIGTERM end the session through the same shutdown path
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if c.Check || c.CheckConnect {
+		if !preflight(ctx, c) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if c.SoakIterations > 0 {
+		if err := soak(ctx, cfg, c.SoakIterations, c.SoakPublish); err != nil {
+			log.Printf("Soak test failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	in, err := c.Source.open()
+	if err != nil {
+		log.Fatal("Error opening input: ", err)
+	}
+	in.apply(&cfg)
+	s := streamer.New(cfg)
+
+	participants := s.Participants()
+	participants.OnParticipantConnected(func(rp *lksdk.RemoteParticipant, count int) {
+		log.Printf("Participant %s connected (%d in room)", rp.Identity(), count)
+	})
+	participants.OnParticipantDisconnected(func(rp *lksdk.RemoteParticipant, count int) {
+		log.Printf("Participant %s disconnected (%d in room)", rp.Identity(), count)
+	})
+
+	if err := s.Start(ctx); err != nil {
+		log.Fatal("Error starting streamer: ", err)
+	}
+	go func() {
+		for err := range s.Errors() {
+			log.Printf("Streamer error: %v", err)
+		}
+	}()
+
+	// Runtime controls, registered here rather than in the library so an
+	// embedding program keeps its signals:
+	//   SIGUSR1 logs the session stats and dumps WebRTC stats to
+	//           WEBRTC_STATS_FILE, or the log if unset
+	//   SIGUSR2 requests a video keyframe, coalesced like any other request
+	//   SIGHUP  rereads .env.local and applies what can change live; see
+	//           reloadConfig
+	controlSignals := make(chan os.Signal, 1)
+	signal.Notify(controlSignals, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	envFile, _ := godotenv.Read(".env.local")
+	go func() {
+		for sig := range controlSignals {
+			switch sig {
+			case syscall.SIGUSR1:
+				dumpStats(s)
+				dumpWebRTCStats(s, os.Getenv("WEBRTC_STATS_FILE"))
+			case syscall.SIGUSR2:
+				log.Printf("SIGUSR2 received, requesting a keyframe")
+				s.RequestKeyframe("SIGUSR2")
+			case syscall.SIGHUP:
+				log.Printf("SIGHUP received, reloading .env.local")
+				envFile = reloadConfig(s, envFile, cfg.AdaptiveGOP.MinGOP != 0)
+			}
+		}
+	}()
+
+	// Run until a signal, an empty room for 3 seconds, or an encoder
+	// failure; video without a frame for 5 seconds restarts the encoder
+	err = s.Run(ctx, streamer.LifecyclePolicy{
+		IdleTimeout:    3 * time.Second,
+		StallTimeout:   5 * time.Second,
+		RestartOnStall: true,
+	})
+	switch {
+	case err == nil:
+		log.Printf("Signal received, exiting...")
+	case errors.Is(err, streamer.ErrRoomIdle):
+		log.Printf("No remote participants for 3 seconds, exiting...")
+	default:
+		log.Printf("Session ended: %v", err)
+	}
+
+	// Clean up
+	s.Stop()
+	if err != nil && !errors.Is(err, streamer.ErrRoomIdle) && !errors.Is(err, streamer.ErrMaxSessionDuration) {
+		os.Exit(1)
+	}
+}
+
+// liveSettings are the .env.local settings reloadConfig applies to the
+// running session. Everything else is read once at startup: VIDEO_FPS, for
+// one, is the rate the producer writes at, not an encoder setting.
+var liveSettings = map[string]bool{
+	"ENCODER_PROFILE":    true,
+	"VIDEO_BITRATE_KBPS": true,
+}
+
+// reloadConfig rereads .env.local and applies the changes to liveSettings
+// since prev, the file as last applied, by reconfiguring the video
+// encoder; other changes are logged as needing a restart. As at startup,
+// a variable set in the environment takes precedence over the file. The
+// new values are validated before anything is applied, and on any error
+// the session keeps running as it was and prev is returned.
+func reloadConfig(s *streamer.Streamer, prev map[string]string, adaptiveGOP bool) map[string]string {
+	next, err := godotenv.Read(".env.local")
+	if err != nil {
+		log.Printf("Error reloading .env.local, keeping the running config: %v", err)
+		return prev
+	}
+	var live, restart, ignored []string
+	for key := range prev {
+		if _, ok := next[key]; !ok {
+			next[key] = ""
+		}
+	}
+	for key, value := range next {
+		if value == prev[key] {
+			continue
+		}
+		switch {
+		case os.Getenv(key) != prev[key]:
+			ignored = append(ignored, key)
+		case liveSettings[key]:
+			live = append(live, key)
+		default:
+			restart = append(restart, key)
+		}
+	}
+	sort.Strings(live)
+	sort.Strings(restart)
+	sort.Strings(ignored)
+
+	if len(live) > 0 {
+		value := func(key string) string {
+			if slices.Contains(live, key) {
+				return next[key]
+			}
+			return os.Getenv(key)
+		}
+		var bitrate int
+		if v := value("VIDEO_BITRATE_KBPS"); v != "" {
+			if bitrate, err = strconv.Atoi(v); err != nil || bitrate < 0 {
+				log.Printf("Invalid VIDEO_BITRATE_KBPS %q, keeping the running config", v)
+				return prev
+			}
+		}
+		enc := s.EncoderConfig()
+		settings, err := streamer.ResolveVideoSettings(value("ENCODER_PROFILE"), streamer.VideoEncoderSettings{
+			BitrateKbps:    bitrate,
+			Preset:         os.Getenv("ENCODER_PRESET"),
+			MaxBitrateKbps: enc.Settings.MaxBitrateKbps,
+			RateControl:    enc.Settings.RateControl,
+		})
+		if err != nil {
+			log.Printf("Error reloading .env.local, keeping the running config: %v", err)
+			return prev
+		}
+		if adaptiveGOP {
+			// ADAPTIVE_GOP owns the GOP
+			settings.GOP = enc.Settings.GOP
+		}
+		enc.Settings = settings
+		if err := s.Reconfigure(enc); err != nil {
+			log.Printf("Error applying .env.local, keeping the running config: %v", err)
+			return prev
+		}
+	}
+
+	for _, key := range append(live, restart...) {
+		os.Setenv(key, next[key])
+	}
+	switch {
+	case len(live) == 0 && len(restart) == 0 && len(ignored) == 0:
+		log.Printf("No changes in .env.local")
+	case len(live) > 0:
+		log.Printf("Applied from .env.local: %s", strings.Join(live, ", "))
+	}
+	if len(restart) > 0 {
+		log.Printf("Changed in .env.local but only applied on restart: %s", strings.Join(restart, ", "))
+	}
+	if len(ignored) > 0 {
+		log.Printf("Changed in .env.local but overridden by the environment: %s", strings.Join(ignored, ", "))
+	}
+	return next
+}
+
+func dumpStats(s *streamer.Streamer) {
+	b, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+	if err != nil {
+		log.Printf("Error dumping stats: %v", err)
+		return
+	}
+	log.Printf("Stats:\n%s", b)
+}
+
+func dumpWebRTCStats(s *streamer.Streamer, path string) {
+	if path == "" {
+		var buf bytes.Buffer
+		if err := s.DumpWebRTCStats(&buf); err != nil {
+			log.Printf("Error dumping WebRTC stats: %v", err)
+			return
+		}
+		log.Printf("WebRTC stats:\n%s", buf.String())
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("Error dumping WebRTC stats: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := s.DumpWebRTCStats(f); err != nil {
+		log.Printf("Error dumping WebRTC stats: %v", err)
+		return
+	}
+	log.Printf("WebRTC stats written to %s", path)
+}
+
+// preflight runs the streamer's preflight checks on c, with the input it
+// selects opened, logging each failure, and reports whether all passed.
+func preflight(ctx context.Context, c config) bool {
+	cfg := c.Streamer
+	in, err := c.Source.open()
+	if err != nil {
+		log.Printf("Check failed: input: %v", err)
+		return false
+	}
+	defer in.close()
+	in.apply(&cfg)
+	err = cfg.Preflight(ctx, c.CheckConnect)
+	if err == nil {
+		log.Printf("All checks passed")
+		return true
+	}
+	var failed []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		failed = joined.Unwrap()
+	} else {
+		failed = []error{err}
+	}
+	for _, err := range failed {
+		log.Printf("Check failed: %v", err)
+	}
+	return false
+}
+
+// Leeway over the first iteration's goroutine and open file counts before
+// the soak test calls it a leak. The SDK and net/http keep some idle
+// goroutines and connections around between sessions.
+const (
+	soakGoroutineSlack = 20
+	soakFDSlack        = 10
+)
+
+// soak runs iterations sessions of cfg back to back, each publishing a
+// test pattern for publish, and fails once the goroutines or open files
+// left after a session grow past those left after the first.
+func soak(ctx context.Context, cfg streamer.Config, iterations int, publish time.Duration) error {
+	cfg.DimensionsFromConfig, cfg.Width, cfg.Height = true, 640, 360
+	cfg.FrameRateFromHeader, cfg.PixelFormatFromHeader = false, false
+	cfg.PixelFormat, cfg.AudioSampleFormat = streamer.PixelFormatYUV420P, streamer.AudioFormatS16LE
+	cfg.AudioSampleRate, cfg.AudioChannels = streamer.DefaultAudioSampleRate, 1
+	cfg.AlphaPacking = streamer.AlphaPackingOff
+	cfg.TSInput, cfg.InputSocketPath, cfg.InputSocketAddr, cfg.PreRoll = "", "", "", ""
+	cfg.SubscribeOnly, cfg.FrameHeaders = false, false
+	if cfg.VideoPipePath == "" {
+		cfg.VideoPipePath = streamer.DefaultVideoPipePath
+	}
+	if cfg.AudioPipePath == "" {
+		cfg.AudioPipePath = streamer.DefaultAudioPipePath
+	}
+
+	var baseGoroutines, baseFDs int
+	for i := 1; i <= iterations; i++ {
+		if err := soakIteration(ctx, cfg, publish); err != nil {
+			return fmt.Errorf("iteration %d: %w", i, err)
+		}
+		// Let connections and goroutines from the session wind down.
+		time.Sleep(time.Second)
+		runtime.GC()
+		goroutines, fds := runtime.NumGoroutine(), openFDs()
+		log.Printf("Soak iteration %d/%d: %d goroutines, %d open files", i, iterations, goroutines, fds)
+		if i == 1 {
+			baseGoroutines, baseFDs = goroutines, fds
+			continue
+		}
+		if goroutines > baseGoroutines+soakGoroutineSlack {
+			return fmt.Errorf("goroutines grew from %d to %d over %d iterations", baseGoroutines, goroutines, i)
+		}
+		if fds > baseFDs+soakFDSlack {
+			return fmt.Errorf("open files grew from %d to %d over %d iterations", baseFDs, fds, i)
+		}
+	}
+	log.Printf("Soak test passed after %d iterations", iterations)
+	return nil
+}
+
+// soakIteration publishes an ffmpeg test pattern and tone for publish.
+func soakIteration(ctx context.Context, cfg streamer.Config, publish time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The streamer makes the FIFOs; ffmpeg must not start before them or
+	// it writes regular files.
+	producer := make(chan *exec.Cmd, 1)
+	go func() {
+		defer close(producer)
+		for !isFIFO(cfg.VideoPipePath) || !isFIFO(cfg.AudioPipePath) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-re",
+			"-f", "lavfi", "-i", fmt.Sprintf("testsrc=size=%dx%d:rate=25", cfg.Width, cfg.Height),
+			"-f", "lavfi", "-i", "sine=frequency=440:sample_rate=16000",
+			"-map", "0:v", "-f", "rawvideo", "-pix_fmt", "yuv420p", cfg.VideoPipePath,
+			"-map", "1:a", "-ac", "1", "-f", "s16le", cfg.AudioPipePath)
+		if err := cmd.Start(); err != nil {
+			log.Printf("Starting soak producer: %v", err)
+			return
+		}
+		producer <- cmd
+	}()
+
+	s := streamer.New(cfg)
+	err := s.Start(ctx)
+	if err == nil {
+		select {
+		case <-time.After(publish):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	s.Stop()
+	cancel()
+	if cmd := <-producer; cmd != nil {
+		cmd.Wait()
+	}
+	return err
+}
+
+func isFIFO(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeNamedPipe != 0
+}
+
+// openFDs counts this process's open file descriptors.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+func trackSubscribed(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+	fmt.Printf("Track subscribed: %s from participant %s\n", track.ID(), rp.Identity())
+}
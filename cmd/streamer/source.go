@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"Rita-go-streamer/streamer"
+)
+
+// inputSource is where the session's raw video and audio come from,
+// chosen by loadConfig: the producer's pipes, or files given by VIDEO_FILE
+// and AUDIO_FILE.
+type inputSource interface {
+	// open returns the input to stream.
+	open() (input, error)
+}
+
+// input is an opened inputSource.
+type input struct {
+	// video and audio are read in place of the pipes; nil leaves that
+	// track to its pipe.
+	video, audio io.ReadCloser
+	// width and height are the video's size, zero to read it from the
+	// video header.
+	width, height uint32
+	// paced is false for input that arrives faster than real time and
+	// has to be read at the frame rate.
+	paced bool
+}
+
+// apply sets up cfg to stream in.
+func (in input) apply(cfg *streamer.Config) {
+	cfg.VideoInput, cfg.AudioInput = in.video, in.audio
+	if in.width != 0 {
+		cfg.DimensionsFromConfig, cfg.Width, cfg.Height = true, in.width, in.height
+	}
+	if !in.paced {
+		cfg.LimitInputRate = true
+	}
+}
+
+// close closes the readers that were opened.
+func (in input) close() {
+	if in.video != nil {
+		in.video.Close()
+	}
+	if in.audio != nil {
+		in.audio.Close()
+	}
+}
+
+// pipeSource is the producer writing to the named pipes, which the
+// library creates and opens itself. The video starts with its header
+// unless VIDEO_SIZE is set.
+type pipeSource struct{}
+
+func (pipeSource) open() (input, error) {
+	return input{paced: true}, nil
+}
+
+// fileSource plays raw files once, such as the ones a producer would
+// write to the pipes: video frames, at VIDEO_SIZE as they have no header,
+// and audio PCM. Either may be left empty for its pipe. The video is read
+// at the frame rate; the audio is held back by the track's own pacing.
+type fileSource struct {
+	video, audio  string
+	width, height uint32
+}
+
+func (f fileSource) open() (input, error) {
+	in := input{width: f.width, height: f.height}
+	var err error
+	if f.video != "" {
+		if in.video, err = os.Open(f.video); err != nil {
+			return input{}, fmt.Errorf("opening video file: %w", err)
+		}
+	}
+	if f.audio != "" {
+		if in.audio, err = os.Open(f.audio); err != nil {
+			in.close()
+			return input{}, fmt.Errorf("opening audio file: %w", err)
+		}
+	}
+	return in, nil
+}
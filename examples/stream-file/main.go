@@ -0,0 +1,268 @@
+// Command stream-file is a demo that encodes video.i420 (512x512 yuv420p
+// at 25 fps) and audio.raw (16 kHz mono s16le) from the working directory
+// with ffmpeg processes of its own and publishes them to a room with a
+// streamer.Publisher, rather than through the raw pipeline of
+// streamer.Streamer. VIDEO_INPUT names another video file, and an H264
+// Annex-B one is published without re-encoding. The room and LiveKit
+// settings are read as cmd/streamer reads them, from the flags listed by
+// -h, the environment and .env.local.
+//
+//	stream-file [flags] [<room>]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+
+	"Rita-go-streamer/streamer"
+)
+
+func init() {
+	// Configure logger to write to stdout with timestamp
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+}
+
+func main() {
+	if err := run(); err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatal(err)
+	}
+}
+
+// run streams the demo files until MAX_SESSION_DURATION (60 seconds by
+// default) elapses or the process is signalled. Everything it starts is torn
+// down before it returns, whether or not it succeeded.
+func run() error {
+	// The room and LiveKit settings come from the flags, the environment
+	// and .env.local, in that order, as for cmd/streamer
+	fset := flag.NewFlagSet("stream-file", flag.ContinueOnError)
+	if err := streamer.LoadEnv(fset, streamer.RoomEnvFlags, os.Args[1:], ".env.local"); err != nil {
+		return err
+	}
+	settings, err := streamer.RoomFromEnv()
+	if err != nil {
+		return err
+	}
+	hostURL, apiKey, apiSecret, err := settings.Connection()
+	if err != nil {
+		return err
+	}
+	identity, err := settings.ParticipantIdentity()
+	if err != nil {
+		return err
+	}
+	roomName := settings.RoomName
+
+	// LOG_LEVEL=debug adds the video stream's reads and start codes and
+	// the per-frame stats
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("parsing LOG_LEVEL %q: %w", v, err)
+		}
+	}
+	slog.SetLogLoggerLevel(level)
+
+	roomCB := &lksdk.RoomCallback{
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnTrackSubscribed: trackSubscribed,
+		},
+	}
+
+	room, err := lksdk.ConnectToRoom(hostURL, lksdk.ConnectInfo{
+		APIKey:              apiKey,
+		APISecret:           apiSecret,
+		RoomName:            roomName,
+		ParticipantIdentity: identity,
+	}, roomCB)
+	if err != nil {
+		return fmt.Errorf("connecting to room %s: %w", roomName, err)
+	}
+	defer room.Disconnect()
+
+	// VIDEO_INPUT (video.i420 by default) is encoded with ffmpeg, unless it
+	// is already H264 in an Annex-B file (.h264 or .264), which is
+	// published as it is without an encode pass
+	videoInput := os.Getenv("VIDEO_INPUT")
+	if videoInput == "" {
+		videoInput = "video.i420"
+	}
+	// OUTPUT_SIZE (e.g. 256x256) scales the encode, which is 512x512 like
+	// the input otherwise
+	width, height := 512, 512
+	var scale []string
+	if v := os.Getenv("OUTPUT_SIZE"); v != "" {
+		if _, err := fmt.Sscanf(v, "%dx%d", &width, &height); err != nil {
+			return fmt.Errorf("parsing OUTPUT_SIZE %q, want WIDTHxHEIGHT: %w", v, err)
+		}
+		if err := streamer.ValidateDimensions(uint32(width), uint32(height), streamer.DefaultMinDimension, streamer.DefaultMaxDimension); err != nil {
+			return fmt.Errorf("OUTPUT_SIZE: %w", err)
+		}
+		scale = []string{"-vf", fmt.Sprintf("scale=%d:%d", width, height)}
+	}
+
+	var videoCmd *exec.Cmd
+	var videoOut io.ReadCloser
+	if streamer.IsAnnexBPath(videoInput) {
+		if scale != nil {
+			return errors.New("OUTPUT_SIZE needs VIDEO_INPUT to be re-encoded, not an H264 file")
+		}
+		if videoOut, err = streamer.OpenAnnexBFile(videoInput); err != nil {
+			return err
+		}
+		log.Printf("Publishing %s without re-encoding", videoInput)
+	} else {
+		// Start ffmpeg process for video encoding
+		args := []string{
+			"-f", "rawvideo",
+			"-pix_fmt", "yuv420p",
+			"-s", "512x512",
+			"-r", "25",
+			"-i", videoInput,
+		}
+		args = append(args, scale...)
+		// H264_ENCODER (h264_nvenc by default) is probed as the streamer
+		// command does, falling back to libx264
+		encoder, err := streamer.SelectH264Encoder(context.Background(), os.Getenv("H264_ENCODER"), false, nil)
+		if err != nil {
+			return err
+		}
+		args = append(args, streamer.VideoEncoderArgs(encoder)...)
+		// Keyframe every 2 seconds: a 50-frame GOP at 25 fps
+		args = append(args, streamer.KeyframeIntervalArgs(25, 2*time.Second)...)
+		args = append(args,
+			"-keyint_min", "1", // Allow keyframe at the very first frame
+			"-bf", "0", // Disable B-frames for safer streaming
+			"-max_delay", "0",
+			"-f", "h264",
+			"-")
+		videoCmd = exec.Command("ffmpeg", args...)
+		if videoOut, err = videoCmd.StdoutPipe(); err != nil {
+			return fmt.Errorf("creating video encoder output: %w", err)
+		}
+	}
+
+	// Start ffmpeg process for audio encoding
+	audioCmd := exec.Command("ffmpeg",
+		"-f", "s16le",
+		"-ar", "16000",
+		"-ac", "1",
+		"-i", "audio.raw",
+		"-c:a", "libopus",
+		"-ar", "48000", // Resample to 48kHz for WebRTC
+		"-page_duration", "20000",
+		"-application", "voip", // Optimize for real-time communication
+		"-packet_loss", "10", // Handle packet loss better
+		"-f", "ogg",
+		"-")
+
+	audioPipe, err := audioCmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("creating audio encoder output: %w", err)
+	}
+
+	// ENCODER_STOP_TIMEOUT (3s by default) is how long ffmpeg gets to flush
+	// its last packets after SIGTERM
+	grace := 3 * time.Second
+	if v := os.Getenv("ENCODER_STOP_TIMEOUT"); v != "" {
+		if grace, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("parsing ENCODER_STOP_TIMEOUT %q: %w", v, err)
+		}
+	}
+
+	// Tear down in one place however run returns: stop the encoders, then
+	// unpublish the tracks; the room is disconnected last
+	publisher := streamer.NewPublisher(room, streamer.PublisherOptions{FrameRate: 25})
+	defer func() {
+		stopEncoders(grace, videoCmd, audioCmd)
+		publisher.Close()
+	}()
+
+	// Start the ffmpeg processes
+	if videoCmd != nil {
+		if err := videoCmd.Start(); err != nil {
+			return fmt.Errorf("starting video ffmpeg: %w", err)
+		}
+	}
+	if err := audioCmd.Start(); err != nil {
+		return fmt.Errorf("starting audio ffmpeg: %w", err)
+	}
+
+	// Publish the encoders' output, splitting the video into NAL units
+	h264 := streamer.NewH264Reader(videoOut, "Video")
+	h264.SetSampling(streamer.LogSampling{PerSecond: 1}, streamer.LogSampling{PerSecond: 1})
+	if err := publisher.PublishVideo(h264, width, height); err != nil {
+		return err
+	}
+	if err := publisher.PublishAudio(audioPipe); err != nil {
+		return err
+	}
+
+	// Stream until MAX_SESSION_DURATION (60s by default) or a signal
+	maxDuration := 60 * time.Second
+	if v := os.Getenv("MAX_SESSION_DURATION"); v != "" {
+		if maxDuration, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("parsing MAX_SESSION_DURATION %q: %w", v, err)
+		}
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if maxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, maxDuration)
+		defer cancel()
+	}
+	<-ctx.Done()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("Maximum session duration of %v reached, stopping", maxDuration)
+	}
+
+	return nil
+}
+
+// stopEncoders sends each started ffmpeg SIGTERM, so it flushes its last
+// packets, and waits for them all, killing any that has not exited within
+// grace.
+func stopEncoders(grace time.Duration, cmds ...*exec.Cmd) {
+	var wg sync.WaitGroup
+	for _, cmd := range cmds {
+		if cmd == nil || cmd.Process == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exited := make(chan struct{})
+			go func() {
+				cmd.Wait()
+				close(exited)
+			}()
+			cmd.Process.Signal(syscall.SIGTERM)
+			select {
+			case <-exited:
+			case <-time.After(grace):
+				log.Printf("%s did not exit within %v of SIGTERM, killing it", cmd.Path, grace)
+				cmd.Process.Kill()
+				<-exited
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func trackSubscribed(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+	log.Printf("Track subscribed: %s from participant %s", track.ID(), rp.Identity())
+}
@@ -0,0 +1,79 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// checkFrameLayout asserts at startup that frames of the session's size
+// and PixelFormat are what ffmpeg will slice the input into: for yuv420p
+// and nv12, width*height*3/2 bytes with both dimensions even, since chroma
+// is subsampled by two in each direction, and for yuva420p the same plus a
+// width*height alpha plane.
+func (s *Streamer) checkFrameLayout() error {
+	w, h := int(s.frameWidth), int(s.frameHeight)
+	want := w * h * 3 / 2
+	switch s.cfg.PixelFormat {
+	case PixelFormatYUV420P, PixelFormatNV12:
+	case PixelFormatYUVA420P:
+		want += w * h
+	default:
+		return nil
+	}
+	if w%2 != 0 || h%2 != 0 {
+		return fmt.Errorf("frame dimensions %dx%d must be even for %s", w, h, s.cfg.PixelFormat)
+	}
+	if size := s.frameSize(); size != want {
+		return fmt.Errorf("%s frame size %d bytes, want %d for %dx%d", s.cfg.PixelFormat, size, want, w, h)
+	}
+	return nil
+}
+
+// alignmentChecker watches the raw video pipe for input that does not
+// come in whole frames of unit bytes, the sign of a producer that pads
+// rows to a stride or writes the wrong size. It cannot see the producer's
+// writes, so it samples the points where the pipe ran dry: a read that
+// waited at least gap for data starts where a write started, and a
+// real-time producer writes whole frames. If such a point, or the end of
+// the input, falls inside a frame, the first one is logged with its
+// offset. A producer that writes a frame in pieces with pauses between
+// them can also trip it.
+type alignmentChecker struct {
+	r    io.Reader
+	unit int
+	gap  time.Duration
+
+	total  int64
+	warned bool
+	log    logger
+}
+
+func newAlignmentChecker(r io.Reader, unit int, gap time.Duration, log logger) *alignmentChecker {
+	return &alignmentChecker{r: r, unit: unit, gap: gap, log: log}
+}
+
+func (a *alignmentChecker) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := a.r.Read(p)
+	if n > 0 && time.Since(start) >= a.gap {
+		a.check("a pause in the input")
+	}
+	a.total += int64(n)
+	if errors.Is(err, io.EOF) {
+		a.check("the end of the input")
+	}
+	return n, err
+}
+
+// check logs the first point found inside a frame.
+func (a *alignmentChecker) check(what string) {
+	into := a.total % int64(a.unit)
+	if into == 0 || a.warned {
+		return
+	}
+	a.warned = true
+	a.log.warnf("[Video] Input misaligned, %s came %d bytes into frame %d (offset %d, %d-byte frames); check the producer's frame size and row stride",
+		what, into, a.total/int64(a.unit), a.total, a.unit)
+}
@@ -0,0 +1,64 @@
+package streamer
+
+import "fmt"
+
+// AlphaPacking publishes the input's alpha channel next to its colour in
+// one opaque frame, for clients that composite the video over their own
+// background. WebRTC video has no alpha: the RTP payload formats of VP8,
+// VP9 and H264 carry only the colour planes, and no browser decodes the
+// WebM alpha side channel on a track received over WebRTC, so a yuva420p
+// encode would lose it on the way. Packing survives any codec and every
+// client, at the cost of the client unpacking it, typically in a WebGL
+// shader that samples the colour half and takes the alpha from the luma
+// of the other half, white being opaque.
+//
+// The packed frame has twice the pixels, so encoding costs about twice the
+// CPU or NVENC time. The alpha half is mostly flat and compresses well, so
+// around 30 to 50% more bitrate keeps the colour at its former quality.
+// Mind the codec's size limits: NVENC's H264 encoder takes at most 4096
+// pixels either way, so 1080p side by side fits and 4K does not.
+type AlphaPacking string
+
+const (
+	AlphaPackingOff        AlphaPacking = ""
+	AlphaPackingSideBySide AlphaPacking = "side-by-side" // colour left, alpha right
+	AlphaPackingStacked    AlphaPacking = "stacked"      // colour top, alpha bottom
+)
+
+// AlphaPackingAttribute is the participant attribute announcing the
+// packing of the video track, so clients know to unpack it.
+const AlphaPackingAttribute = "video.alpha_packing"
+
+func (a AlphaPacking) validate(format PixelFormat) error {
+	switch a {
+	case AlphaPackingOff:
+		return nil
+	case AlphaPackingSideBySide, AlphaPackingStacked:
+		if !format.hasAlpha() {
+			return fmt.Errorf("alpha packing %s needs a pixel format with alpha, not %s", a, format)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown alpha packing %q (want side-by-side or stacked)", string(a))
+}
+
+// packedSize returns the size of a packed frame of width x height colour.
+func (a AlphaPacking) packedSize(width, height uint32) (uint32, uint32) {
+	switch a {
+	case AlphaPackingSideBySide:
+		return 2 * width, height
+	case AlphaPackingStacked:
+		return width, 2 * height
+	}
+	return width, height
+}
+
+// filter splits each frame into its colour and its alpha as a grey
+// picture, both converted to yuv420p, and joins them.
+func (a AlphaPacking) filter() string {
+	stack := "hstack"
+	if a == AlphaPackingStacked {
+		stack = "vstack"
+	}
+	return "split[color][alpha];[color]format=yuv420p[c];[alpha]alphaextract,format=yuv420p[a];[c][a]" + stack
+}
@@ -0,0 +1,43 @@
+package streamer
+
+import "fmt"
+
+// AudioSampleFormat is the sample layout of the raw audio the producer
+// writes to the audio pipe, named as ffmpeg names it, channels interleaved.
+//
+// ffmpeg converts the samples to what libopus takes, 16-bit or float,
+// before encoding: f32le is passed through as float and s24le is
+// converted at a negligible cost. Other formats are rejected, mostly
+// because their sample size would make the input ambiguous.
+type AudioSampleFormat string
+
+const (
+	AudioFormatS16LE AudioSampleFormat = "s16le"
+	AudioFormatF32LE AudioSampleFormat = "f32le"
+	AudioFormatS24LE AudioSampleFormat = "s24le"
+)
+
+func (f AudioSampleFormat) validate() error {
+	switch f {
+	case AudioFormatS16LE, AudioFormatF32LE, AudioFormatS24LE:
+		return nil
+	}
+	return fmt.Errorf("unsupported audio sample format %q (want s16le, f32le or s24le)", string(f))
+}
+
+// sampleSize returns the size in bytes of one sample in this format.
+func (f AudioSampleFormat) sampleSize() int {
+	switch f {
+	case AudioFormatF32LE:
+		return 4
+	case AudioFormatS24LE:
+		return 3
+	}
+	return 2
+}
+
+// chunkSize returns the size in bytes of one 20 ms Opus frame's worth of
+// input of channels at rate in this format.
+func (f AudioSampleFormat) chunkSize(rate, channels int) int {
+	return rate / 50 * channels * f.sampleSize()
+}
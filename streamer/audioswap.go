@@ -0,0 +1,135 @@
+package streamer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// startAudioProcess starts an audio ffmpeg encoding as p describes. Like
+// startVideoEncoder's, its stdin and stdout are plain pipes owned by the
+// caller, so a replacement can take over both.
+func (s *Streamer) startAudioProcess(p audioEncoderParams) (cmd *exec.Cmd, stdin, stdout *os.File, err error) {
+	cmd = audioEncoderCommand(p)
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("creating audio encoder input: %w", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, nil, nil, fmt.Errorf("creating audio encoder output: %w", err)
+	}
+	cmd.Stdin, cmd.Stdout = inR, outW
+
+	err = cmd.Start()
+	// The child has its own copies of these ends.
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, nil, nil, fmt.Errorf("starting audio ffmpeg: %w", err)
+	}
+	if err := s.prioritize(cmd, "audio"); err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, nil, nil, err
+	}
+	return cmd, inW, outR, nil
+}
+
+// restartAudioEncoder replaces the audio encoder with a fresh one, as
+// restartVideoEncoder does the video encoder: the new process is fed from
+// the next chunk and its output spliced into the track once the old one's
+// ends, with the old process killed if it does not exit in time. The new
+// stream's Opus headers are skipped by the track. A failure is reported as
+// well as returned.
+func (s *Streamer) restartAudioEncoder(reason string) error {
+	cmd, stdin, stdout, err := s.startAudioProcess(s.audioEncoderParams())
+	if err != nil {
+		s.log.errorf("Restarting audio encoder (%s): %v", reason, err)
+		s.reportError(fmt.Errorf("restarting audio encoder: %w", err), false)
+		return err
+	}
+	s.audioMu.Lock()
+	old, oldExited := s.audioCmd, s.audioExited
+	s.retired.Store(old, true)
+	s.audioCmd = cmd
+	s.audioExited = s.watchProcess("audio", cmd)
+	s.audioMu.Unlock()
+
+	s.audioOut.queue(&oggPageReader{r: stdout})
+	s.audioFeed.swap(stdin)
+	s.reapRetired(old, oldExited)
+	s.log.infof("Restarted audio encoder (%s)", reason)
+	return nil
+}
+
+// oggPageReader passes an Ogg stream on one whole page at a time. A page
+// cut short by the end of the stream, as when a stalled encoder is killed
+// mid-write, is dropped, so that the output spliced in after it starts on
+// a page boundary.
+type oggPageReader struct {
+	r    io.ReadCloser
+	page []byte // the unread rest of the current page
+}
+
+// oggPageHeaderLen is the fixed part of an Ogg page header, up to and
+// including its segment count.
+const oggPageHeaderLen = 27
+
+func (o *oggPageReader) Read(p []byte) (int, error) {
+	if len(o.page) == 0 {
+		page, err := readOggPage(o.r)
+		if err != nil {
+			return 0, err
+		}
+		o.page = page
+	}
+	n := copy(p, o.page)
+	o.page = o.page[n:]
+	return n, nil
+}
+
+func (o *oggPageReader) Close() error {
+	return o.r.Close()
+}
+
+// readOggPage reads one page from r, returning io.EOF for a page the
+// stream ends within.
+func readOggPage(r io.Reader) ([]byte, error) {
+	header := make([]byte, oggPageHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, truncatedAsEOF(err)
+	}
+	if !bytes.HasPrefix(header, []byte("OggS")) {
+		return nil, fmt.Errorf("audio encoder output is not Ogg: page starts % x", header[:4])
+	}
+	segments := make([]byte, header[oggPageHeaderLen-1])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return nil, truncatedAsEOF(err)
+	}
+	size := 0
+	for _, n := range segments {
+		size += int(n)
+	}
+	page := make([]byte, 0, oggPageHeaderLen+len(segments)+size)
+	page = append(append(page, header...), segments...)
+	body := page[len(page) : len(page)+size]
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, truncatedAsEOF(err)
+	}
+	return page[:cap(page)], nil
+}
+
+func truncatedAsEOF(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package streamer
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBitrateWindow is the window the outbound bitrate is measured and
+// logged over when Config.BitrateWindow is zero.
+const DefaultBitrateWindow = 10 * time.Second
+
+// bitrateSampleInterval is how often the byte counts are sampled.
+const bitrateSampleInterval = time.Second
+
+// bitrateMeter counts the bytes handed to a track and turns them into a
+// rate over a sliding window of per-second samples.
+type bitrateMeter struct {
+	total atomic.Int64
+
+	mu      sync.Mutex
+	samples []bitrateSample // oldest first, spanning at most the window
+}
+
+type bitrateSample struct {
+	at    time.Time
+	total int64
+}
+
+func (m *bitrateMeter) add(n int) {
+	m.total.Add(int64(n))
+}
+
+// sample records the running total at now and drops samples that fell
+// out of window, keeping the newest one beyond it as the window's start.
+func (m *bitrateMeter) sample(now time.Time, window time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, bitrateSample{at: now, total: m.total.Load()})
+	i := 0
+	for i+1 < len(m.samples) && now.Sub(m.samples[i+1].at) >= window {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+// kbps is the rate over the sampled window, zero until two samples exist.
+func (m *bitrateMeter) kbps() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) < 2 {
+		return 0
+	}
+	first, last := m.samples[0], m.samples[len(m.samples)-1]
+	elapsed := last.at.Sub(first.at)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.total-first.total) * 8 / 1000 / elapsed.Seconds()
+}
+
+// measureBitrate samples the outbound bitrate of both tracks every second
+// until shutdown and logs it, against the configured target, once per
+// Config.BitrateWindow.
+func (s *Streamer) measureBitrate() {
+	window := s.cfg.BitrateWindow
+	ticker := time.NewTicker(bitrateSampleInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	s.videoBitrate.sample(start, window)
+	s.audioBitrate.sample(start, window)
+	lastLog := start
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.videoBitrate.sample(now, window)
+			s.audioBitrate.sample(now, window)
+			if now.Sub(lastLog) < window {
+				continue
+			}
+			lastLog = now
+			target := "encoder default"
+			s.encMu.Lock()
+			if kbps := s.videoSettings.BitrateKbps; kbps > 0 {
+				target = fmt.Sprintf("%d kbps", kbps)
+			}
+			s.encMu.Unlock()
+			switch {
+			case s.cfg.DisableVideo:
+				target = "disabled"
+			case s.videoFeed == nil:
+				target = "TS input"
+			}
+			s.log.debugf("[Bitrate] Sent over the last %v: video %.0f kbps (target %s), audio %.0f kbps (target %d kbps)",
+				window, s.videoBitrate.kbps(), target, s.audioBitrate.kbps(), s.cfg.AudioBitrateKbps)
+		}
+	}
+}
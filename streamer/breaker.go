@@ -0,0 +1,117 @@
+package streamer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults for the encoder restart breaker, used when
+// Config.EncoderRestartLimit and Config.EncoderRestartWindow are zero.
+const (
+	DefaultEncoderRestartLimit  = 3
+	DefaultEncoderRestartWindow = 5 * time.Minute
+)
+
+// restartBreaker counts the encoder restarts made to recover from a
+// stall. Once Config.EncoderRestartLimit of them fall within
+// Config.EncoderRestartWindow it opens, and stays open for the session.
+type restartBreaker struct {
+	mu       sync.Mutex
+	restarts []time.Time // within the window, oldest first
+	total    int
+	open     bool
+}
+
+// allow records a restart at now and reports whether it may go ahead.
+// When limit restarts already fall within window it opens the breaker
+// instead, reporting tripped; once open it refuses every restart.
+func (b *restartBreaker) allow(now time.Time, limit int, window time.Duration) (ok, tripped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		return false, false
+	}
+	kept := b.restarts[:0]
+	for _, t := range b.restarts {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	b.restarts = kept
+	if len(b.restarts) >= limit {
+		b.open = true
+		return false, true
+	}
+	b.restarts = append(b.restarts, now)
+	b.total++
+	return true, false
+}
+
+func (b *restartBreaker) fill(st *Stats) {
+	b.mu.Lock()
+	st.EncoderRestarts, st.EncoderBreakerOpen = b.total, b.open
+	b.mu.Unlock()
+}
+
+// recoverVideoEncoder restarts the video encoder after a stall, unless the
+// restarts are not helping; see recoverEncoder.
+func (s *Streamer) recoverVideoEncoder(reason string) {
+	s.recoverEncoder("video", reason, func() error {
+		// The frames given to the stalled encoder since its last output
+		// go down with it.
+		var stuck int64
+		if s.videoFeed != nil {
+			stuck = s.videoFeed.frames.Load() - s.videoOutput.fed.Load()
+		}
+		if err := s.restartVideoEncoder(reason); err != nil {
+			return err
+		}
+		s.videoDrops.add(DropEncoderStall, stuck)
+		s.stats.videoRestarted()
+		return nil
+	})
+}
+
+// recoverAudioEncoder is recoverVideoEncoder for the audio encoder.
+func (s *Streamer) recoverAudioEncoder(reason string) {
+	s.recoverEncoder("audio", reason, func() error {
+		stuck := s.audioFeed.frames.Load() - s.audioOutput.fed.Load()
+		if err := s.restartAudioEncoder(reason); err != nil {
+			return err
+		}
+		s.audioDrops.add(DropEncoderStall, stuck)
+		s.stats.audioRestarted()
+		return nil
+	})
+}
+
+// recoverEncoder calls restart to replace the kind encoder after a stall,
+// unless the restarts are not helping. Both encoders count against the
+// one breaker. An encoder that keeps stalling is taken to be beyond
+// recovery, as when the GPU is lost: rather than restarting it forever the
+// breaker opens, OnEncoderFatal is called and the session fails with
+// ErrEncoderFailed, so Run returns it.
+func (s *Streamer) recoverEncoder(kind, reason string, restart func() error) {
+	ok, tripped := s.breaker.allow(time.Now(), s.cfg.EncoderRestartLimit, s.cfg.EncoderRestartWindow)
+	if ok {
+		s.log.warnf("Restarting %s encoder after %s", kind, reason)
+		restart()
+		return
+	}
+	if !tripped {
+		return
+	}
+	err := fmt.Errorf("%w: %s %s after %d restarts within %v", ErrEncoderFailed, kind, reason, s.cfg.EncoderRestartLimit, s.cfg.EncoderRestartWindow)
+	s.log.errorf("Not restarting %s encoder again: %v", kind, err)
+	s.emit(EventEncoderBreakerOpen, map[string]any{
+		"track":    kind,
+		"reason":   reason,
+		"restarts": s.cfg.EncoderRestartLimit,
+		"window":   s.cfg.EncoderRestartWindow.String(),
+	})
+	if s.cfg.OnEncoderFatal != nil {
+		s.cfg.OnEncoderFatal(err)
+	}
+	s.reportError(err, true)
+}
@@ -0,0 +1,136 @@
+package streamer
+
+import (
+	"hash"
+	"hash/crc32"
+	"io"
+	"log/slog"
+)
+
+// RawChecksumReader logs a CRC32 for every fixed-size raw frame read
+// through it, at Info, as NALChecksumReader does for NAL units. Checksum
+// logging is a debug aid for locating where corruption is introduced. It
+// hashes every byte that passes through, so only enable it while
+// investigating. Each line has the form
+//
+//	[crc] <stream> raw seq=<n> size=<bytes> crc32=<hex>
+//	[crc] <stream> nal seq=<n> type=<nal type> size=<bytes> crc32=<hex>
+//
+// where seq starts at 0 and counts frames (raw) or NAL units (nal)
+// independently per stream. Raw checksums cover exactly one input frame.
+// NAL checksums cover the NAL unit payload without its Annex-B start code,
+// matching what a receiver sees after depacketization.
+type RawChecksumReader struct {
+	r         io.Reader
+	name      string
+	frameSize int
+
+	crc    hash.Hash32
+	filled int
+	seq    uint64
+	log    logger
+}
+
+func NewRawChecksumReader(r io.Reader, name string, frameSize int) *RawChecksumReader {
+	return &RawChecksumReader{r: r, name: name, frameSize: frameSize, crc: crc32.NewIEEE()}
+}
+
+// SetLogger logs the checksums through l rather than through
+// slog.Default().
+func (c *RawChecksumReader) SetLogger(l *slog.Logger) {
+	c.log = logger{l}
+}
+
+func (c *RawChecksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	buf := p[:n]
+	for len(buf) > 0 {
+		chunk := c.frameSize - c.filled
+		if chunk > len(buf) {
+			chunk = len(buf)
+		}
+		c.crc.Write(buf[:chunk])
+		c.filled += chunk
+		buf = buf[chunk:]
+
+		if c.filled == c.frameSize {
+			c.log.infof("[crc] %s raw seq=%d size=%d crc32=%08x", c.name, c.seq, c.frameSize, c.crc.Sum32())
+			c.seq++
+			c.filled = 0
+			c.crc.Reset()
+		}
+	}
+	return n, err
+}
+
+// NALChecksumReader logs a CRC32 for every Annex-B NAL unit read through
+// it, at Info, in the format given for RawChecksumReader. Start codes that
+// straddle reads are handled.
+type NALChecksumReader struct {
+	r    io.ReadCloser
+	name string
+
+	crc          hash.Hash32
+	size         int
+	nalType      byte
+	inNAL        bool
+	expectHeader bool
+	zeros        int
+	seq          uint64
+	log          logger
+}
+
+func NewNALChecksumReader(r io.ReadCloser, name string) *NALChecksumReader {
+	return &NALChecksumReader{r: r, name: name, crc: crc32.NewIEEE()}
+}
+
+// SetLogger is RawChecksumReader.SetLogger.
+func (c *NALChecksumReader) SetLogger(l *slog.Logger) {
+	c.log = logger{l}
+}
+
+func (c *NALChecksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for _, b := range p[:n] {
+		if b == 0 {
+			c.zeros++
+			continue
+		}
+		if b == 1 && c.zeros >= 2 {
+			c.emit()
+			c.inNAL, c.expectHeader, c.zeros = true, true, 0
+			continue
+		}
+		if !c.inNAL {
+			c.zeros = 0
+			continue
+		}
+		for ; c.zeros > 0; c.zeros-- {
+			c.crc.Write([]byte{0})
+			c.size++
+		}
+		if c.expectHeader {
+			c.nalType = b & 0x1f
+			c.expectHeader = false
+		}
+		c.crc.Write([]byte{b})
+		c.size++
+	}
+	if err == io.EOF {
+		c.emit()
+	}
+	return n, err
+}
+
+func (c *NALChecksumReader) Close() error {
+	return c.r.Close()
+}
+
+func (c *NALChecksumReader) emit() {
+	if c.size > 0 {
+		c.log.infof("[crc] %s nal seq=%d type=%d size=%d crc32=%08x", c.name, c.seq, c.nalType, c.size, c.crc.Sum32())
+		c.seq++
+	}
+	c.size = 0
+	c.crc.Reset()
+}
@@ -0,0 +1,197 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ClockSource selects the time base frame timestamps are derived from.
+//
+// With ClockMonotonic (the default) every frame advances the track clock by
+// the nominal frame duration, measured from when this process started
+// sending. Two streamers started at different moments produce unrelated
+// timelines.
+//
+// With ClockWall or ClockNTP, each frame advances the track clock to its
+// slot on a grid of frame-duration slots on a clock shared between
+// processes, so streamers on different hosts pace their frames alike: a
+// frame that comes in late skips ahead to its slot instead of delaying
+// every frame after it. Only the pacing is shared. The samples carry a
+// duration, not a timestamp, and the SDK starts each track's RTP
+// timestamps at a random value, so frame N of two avatars does not carry
+// the same RTP timestamp and a receiver cannot line them up by it. The
+// pacing follows the shared clock to within the agreement between hosts
+// plus one frame interval: typically 1-10 ms with NTP on a LAN and well
+// under 1 ms with PTP.
+//
+// With ClockSession, frame timestamps are snapped to a grid of
+// frame-duration slots measured from the session's start, one start shared
+// by the video and audio tracks. A track whose frames come in slower than
+// their nominal rate, as video does while the encoder falls behind, skips
+// ahead to the slot of the time each frame is sent instead of falling
+// further behind the other track with every frame, so audio does not drift
+// ahead of video over a long session.
+type ClockSource string
+
+const (
+	ClockMonotonic ClockSource = "monotonic"
+	// ClockWall uses the system clock as-is. Use it when the host clock is
+	// already disciplined by chrony, ntpd or ptp4l.
+	ClockWall ClockSource = "wall"
+	// ClockNTP corrects the system clock by an offset measured against
+	// Config.NTPServer once at startup.
+	ClockNTP ClockSource = "ntp"
+	// ClockSession uses the system clock from the session's start, keeping
+	// the tracks in sync with each other rather than with other streamers.
+	ClockSession ClockSource = "session"
+)
+
+const DefaultNTPServer = "pool.ntp.org:123"
+
+// Clock is a source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// offsetClock is the system clock shifted by a fixed offset.
+type offsetClock struct {
+	offset time.Duration
+}
+
+func (c offsetClock) Now() time.Time { return time.Now().Add(c.offset) }
+
+func newClock(source ClockSource, ntpServer string) (Clock, error) {
+	switch source {
+	case "", ClockMonotonic, ClockWall, ClockSession:
+		return systemClock{}, nil
+	case ClockNTP:
+		if ntpServer == "" {
+			ntpServer = DefaultNTPServer
+		}
+		offset, err := queryNTPOffset(ntpServer, 3*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("measuring NTP offset against %s: %w", ntpServer, err)
+		}
+		return offsetClock{offset: offset}, nil
+	}
+	return nil, fmt.Errorf("unknown clock source %q", source)
+}
+
+// ntpEpochOffset is the number of seconds between 1900 and 1970.
+const ntpEpochOffset = 2208988800
+
+// queryNTPOffset performs a single SNTP exchange and returns how far the
+// local clock is behind the server.
+func queryNTPOffset(server string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI=0, VN=4, Mode=3 (client)
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	if _, err := conn.Read(resp); err != nil {
+		return 0, err
+	}
+	t4 := time.Now()
+
+	t2 := ntpTime(resp[32:40])
+	t3 := ntpTime(resp[40:48])
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(secs, frac*int64(time.Second)>>32)
+}
+
+// frameStamper decides how far the track clock advances for each frame.
+type frameStamper struct {
+	clock         Clock
+	frameDuration time.Duration
+	aligned       bool
+	// origin, for ClockSession, is where the grid of slots starts rather
+	// than the zero time.
+	origin time.Time
+	last   time.Time
+
+	// captured, when set, supplies producer capture timestamps that take
+	// precedence over the clock.
+	captured    <-chan time.Duration
+	lastCapture time.Duration
+	haveCapture bool
+}
+
+// newFrameStamper returns a stamper for frames of frameDuration. origin is
+// the session's start, which ClockSession stamps from.
+func newFrameStamper(source ClockSource, clock Clock, frameDuration time.Duration, origin time.Time) *frameStamper {
+	f := &frameStamper{
+		clock:         clock,
+		frameDuration: frameDuration,
+		aligned:       source == ClockWall || source == ClockNTP || source == ClockSession,
+	}
+	if source == ClockSession {
+		f.origin = origin
+	}
+	return f
+}
+
+// advance returns the duration to add to the track clock for the frame that
+// has just been read. Aligned stampers place the frame in its slot on the
+// shared clock's frame grid, never reusing a slot.
+func (f *frameStamper) advance() time.Duration {
+	if f.captured != nil {
+		return f.advanceCaptured()
+	}
+	if !f.aligned {
+		return f.frameDuration
+	}
+	var pts time.Time
+	if now := f.clock.Now(); f.origin.IsZero() {
+		pts = now.Truncate(f.frameDuration)
+	} else {
+		pts = f.origin.Add(now.Sub(f.origin).Truncate(f.frameDuration))
+	}
+	if f.last.IsZero() {
+		f.last = pts
+		return f.frameDuration
+	}
+	if !pts.After(f.last) {
+		pts = f.last.Add(f.frameDuration)
+	}
+	d := pts.Sub(f.last)
+	f.last = pts
+	return d
+}
+
+// advanceCaptured spaces frames by the difference between consecutive
+// capture timestamps. Frames without a timestamp, or whose timestamp does
+// not move forward, get the nominal frame duration.
+func (f *frameStamper) advanceCaptured() time.Duration {
+	var ts time.Duration
+	select {
+	case ts = <-f.captured:
+	default:
+		return f.frameDuration
+	}
+	d := f.frameDuration
+	if f.haveCapture && ts > f.lastCapture {
+		d = ts - f.lastCapture
+	}
+	f.lastCapture, f.haveCapture = ts, true
+	return d
+}
@@ -0,0 +1,50 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock that reads whatever time it was last set to.
+type manualClock struct{ now time.Time }
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+// TestClockSessionSlowVideo feeds a video track whose frames come in at
+// 20 fps rather than its nominal 25, next to audio at its nominal 50 pages
+// a second, and compares how far each track's clock has advanced.
+func TestClockSessionSlowVideo(t *testing.T) {
+	const session = 10 * time.Second
+	for _, tt := range []struct {
+		source ClockSource
+		// minDrift and maxDrift bound how far audio ends ahead of video.
+		minDrift, maxDrift time.Duration
+	}{
+		// Audio stays within a video frame of video.
+		{ClockSession, 0, 50 * time.Millisecond},
+		// Every late video frame puts audio further ahead.
+		{ClockMonotonic, time.Second, session},
+	} {
+		t.Run(string(tt.source), func(t *testing.T) {
+			origin := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := &manualClock{now: origin}
+			video := newFrameStamper(tt.source, clock, 40*time.Millisecond, origin)
+			audio := newFrameStamper(tt.source, clock, 20*time.Millisecond, origin)
+			var videoPos, audioPos time.Duration
+			for elapsed := time.Duration(0); elapsed < session; elapsed += 10 * time.Millisecond {
+				clock.now = origin.Add(elapsed)
+				if elapsed%(20*time.Millisecond) == 0 {
+					audioPos += audio.advance()
+				}
+				if elapsed%(50*time.Millisecond) == 0 {
+					videoPos += video.advance()
+				}
+			}
+			drift := audioPos - videoPos
+			if drift < tt.minDrift || drift > tt.maxDrift {
+				t.Errorf("audio at %v, video at %v after %v: drift %v, want %v to %v",
+					audioPos, videoPos, session, drift, tt.minDrift, tt.maxDrift)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package streamer
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// VideoCodec is the codec the video track is published in.
+type VideoCodec string
+
+const (
+	// VideoCodecH264, the default, is encoded with Config.H264Encoder.
+	VideoCodecH264 VideoCodec = "h264"
+	// VideoCodecVP8 is encoded in software with VP8VideoEncoder, for
+	// clients that decode VP8 more reliably than H264.
+	VideoCodecVP8 VideoCodec = "vp8"
+)
+
+func (c VideoCodec) validate() error {
+	switch c {
+	case VideoCodecH264, VideoCodecVP8:
+		return nil
+	}
+	return fmt.Errorf("unknown video codec %q (want h264 or vp8)", string(c))
+}
+
+// mimeType is the WebRTC codec of a track in c.
+func (c VideoCodec) mimeType() string {
+	if c == VideoCodecVP8 {
+		return webrtc.MimeTypeVP8
+	}
+	return webrtc.MimeTypeH264
+}
+
+// CodecOverride replaces the RTP parameters a published track advertises.
+// It is an escape hatch for receivers that do not follow RFC 6184 (H264,
+// 90 kHz) or RFC 7587 (Opus, 48 kHz); standard receivers, including the
+// LiveKit SFU's own forwarding, expect the defaults. Zero fields keep the
+// default.
+//
+// The payload type cannot be overridden: the SDK binds each track to the
+// payload type negotiated in SDP.
+type CodecOverride struct {
+	ClockRate uint32
+}
+
+// opusClockRates are the sample rates Opus can operate at.
+var opusClockRates = []uint32{8000, 12000, 16000, 24000, 48000}
+
+// validate checks o against the codec it will be applied to.
+func (o CodecOverride) validate(mime string) error {
+	if o.ClockRate == 0 {
+		return nil
+	}
+	switch mime {
+	case webrtc.MimeTypeOpus:
+		if !slices.Contains(opusClockRates, o.ClockRate) {
+			return fmt.Errorf("opus clock rate %d is not one of %v", o.ClockRate, opusClockRates)
+		}
+	case webrtc.MimeTypeH264:
+		// Frame timestamps need at least millisecond resolution.
+		if o.ClockRate < 1000 {
+			return fmt.Errorf("h264 clock rate %d is below 1000 Hz", o.ClockRate)
+		}
+	}
+	return nil
+}
+
+// apply sets the overridden fields on codec.
+func (o CodecOverride) apply(codec *webrtc.RTPCodecCapability) {
+	if o.ClockRate != 0 {
+		codec.ClockRate = o.ClockRate
+	}
+}
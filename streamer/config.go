@@ -0,0 +1,944 @@
+package streamer
+
+import (
+	"io"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	DefaultVideoPipePath = "/tmp/video_pipe.yuv"
+	DefaultAudioPipePath = "/tmp/audio_pipe.raw"
+
+	// DefaultFrameRate is the raw video frame rate when Config.FrameRate
+	// is zero.
+	DefaultFrameRate = 25
+)
+
+// Config describes a single streaming session.
+type Config struct {
+	// LiveKit connection settings
+	URL       string
+	APIKey    string
+	APISecret string
+	RoomName  string
+	Identity  string
+
+	// CredentialsFile, when set, is read for URL, APIKey and APISecret
+	// before every join, keeping the secret out of the environment. It is
+	// either a file of LIVEKIT_URL=..., LIVEKIT_API_KEY=... and
+	// LIVEKIT_API_SECRET=... lines or a directory with one file per key,
+	// such as a mounted Kubernetes secret. Keys it sets replace the fields
+	// above; the rest keep their configured values. Since it is re-read on
+	// each join, a rotated secret takes effect on the next Rejoin or
+	// restart.
+	CredentialsFile string
+
+	// Identity must be unique within the room: LiveKit disconnects an
+	// existing participant when another joins with the same identity. A
+	// fixed Identity lets a restarted streamer take over its own slot.
+	// When it is empty, IdentityFunc is called once at Start, for example
+	// to embed a tenant ID; it must not return an identity that another
+	// live streamer in the room may hold. Without either, DefaultIdentity
+	// is used.
+	IdentityFunc func() (string, error)
+
+	// ParticipantName is the display name clients show, ParticipantMetadata
+	// an opaque string such as JSON for them to read, and
+	// ParticipantAttributes key-value pairs, such as a tenant or role, they
+	// can filter participants by. All are set in the join token. The
+	// attributes the streamer publishes itself, TrackMetadataAttribute and
+	// AlphaPackingAttribute, replace configured ones of the same name.
+	ParticipantName       string
+	ParticipantMetadata   string
+	ParticipantAttributes map[string]string
+
+	// VideoTrackMetadata and AudioTrackMetadata, such as JSON describing
+	// the avatar or voice, are published for clients under
+	// TrackMetadataAttribute and can be changed with SetTrackMetadata.
+	VideoTrackMetadata string
+	AudioTrackMetadata string
+
+	// RoomMetadataOverrides reads per-session settings from the room
+	// metadata on joining, so an orchestrator can tune each session
+	// without restarting the streamer. The metadata is a JSON object whose
+	// recognised keys replace the matching fields here before anything is
+	// encoded: profile, video_bitrate_kbps, gop, audio_bitrate_kbps, and
+	// width and height, which only apply with DimensionsFromConfig as the
+	// header decides them otherwise. Other keys are logged and ignored.
+	// Later metadata changes are not applied. Not applied to TSInput.
+	RoomMetadataOverrides bool
+
+	// Proxy routes signalling through an http, https or socks5 proxy URL,
+	// or "direct" for none. Empty honours HTTP_PROXY/HTTPS_PROXY. Media is
+	// never proxied; it needs a direct or TURN path to the server.
+	Proxy string
+
+	// ForceRelay restricts ICE to TURN relay candidates, for networks that
+	// block direct and STUN-derived paths. The STUN and TURN servers
+	// themselves come from the LiveKit server in the join response (its
+	// turn and rtc.stun_servers settings); the server SDK offers no way to
+	// supply them from the client.
+	ForceRelay bool
+
+	// ConnectTimeout bounds joining the room, DefaultConnectTimeout if
+	// zero. Start fails with ErrConnectTimeout when it elapses.
+	ConnectTimeout time.Duration
+
+	// ICETimeout, when shorter than ConnectTimeout, bounds each attempt to
+	// join and get an ICE connection, failing it with ErrICETimeout. The
+	// SDK does not report signalling and ICE separately, so the bound
+	// covers both. It cuts short the SDK's own 15 s wait for ICE, whose
+	// expiry also fails the attempt with ErrICETimeout.
+	//
+	// RelayFallback retries an attempt that failed with ErrICETimeout once
+	// more, restricted to TURN relay candidates as with ForceRelay and
+	// under the same bounds. The LiveKit server's TURN over TLS
+	// on 443 and over TCP reach through firewalls that block UDP. ICE-TCP
+	// straight to the server is tried in the first attempt whenever the
+	// server offers it; the SDK has no settings for client candidates.
+	// The transport that connected is logged once the tracks are
+	// published.
+	ICETimeout    time.Duration
+	RelayFallback bool
+
+	// Named pipes the producer writes raw video and audio to. The
+	// video pipe starts with a width/height header unless
+	// DimensionsFromConfig is set. Both are opened for reading at once,
+	// so the producer may open them for writing in either order without
+	// deadlocking against the streamer.
+	VideoPipePath string
+	AudioPipePath string
+
+	// VideoInput and AudioInput, when set, are read in place of the
+	// matching pipe, which is then neither created nor opened: the same
+	// raw stream, header and all, from a reader such as NewTestPattern's
+	// or a producer in the same process. They are closed on shutdown.
+	// Not with the input socket or TSInput.
+	VideoInput io.ReadCloser
+	AudioInput io.ReadCloser
+
+	// DisableVideo streams audio alone, such as TTS output, and
+	// DisableAudio video alone: the other track's pipe is neither created
+	// nor opened, its encoder is not started and its track is not
+	// published, and the stats and supervision cover the one track. With
+	// DisableVideo there is no video header to read. Raw input through
+	// the pipes only, not the input socket or TSInput, and not both.
+	DisableVideo bool
+	DisableAudio bool
+
+	// DimensionsFromConfig takes the frame size from Width and Height and
+	// skips the header read, for producers that write only raw frames.
+	DimensionsFromConfig bool
+	Width                uint32
+	Height               uint32
+
+	// OutputWidth and OutputHeight, if set, scale the video to that size
+	// after any crop and VideoFilter, so the track carries it whatever
+	// size the producer writes or a crop cuts out, and the publication
+	// advertises it. Both are set together and even, within MinDimension
+	// and MaxDimension. Not applied to TSInput.
+	OutputWidth  uint32
+	OutputHeight uint32
+
+	// TSInput, when set, publishes an MPEG-TS stream instead of raw input:
+	// any file, FIFO or URL ffmpeg can read. The video must be H264 and is
+	// forwarded without re-encoding; the first audio stream may be AAC,
+	// MP2, AC-3 or anything else ffmpeg decodes, and is transcoded to Opus.
+	// TSFrameRate is the video's frame rate. If zero it is probed with
+	// AutoDetectInput, falling back to DefaultTSFrameRate.
+	TSInput     string
+	TSFrameRate float64
+
+	// AutoDetectInput probes TSInput with ffprobe before demuxing, to check
+	// that the video is H264 and learn its frame rate and dimensions. Raw
+	// pipe input carries no format information to probe, so it still
+	// needs the size header or DimensionsFromConfig and PixelFormat.
+	AutoDetectInput bool
+
+	// InputSocketPath, when set, replaces the two pipes with a Unix domain
+	// socket the producer connects to and sends video, audio and control
+	// messages over; see SocketMessageVideo for the framing. The socket
+	// file is removed on shutdown. InputSocketAddr is the same on a TCP
+	// host:port, or unix:/path, in place of InputSocketPath.
+	// OnSocketControl receives the producer's control messages, and
+	// Streamer.SendControl replies.
+	InputSocketPath string
+	InputSocketAddr string
+	OnSocketControl func(payload []byte)
+	// InputSocketReaccept waits for the producer to connect again when its
+	// connection ends, for up to PipeOpenTimeout, instead of ending the
+	// input. A reconnected producer sends the same video header first,
+	// which is checked and dropped, and a frame or sample cut short by the
+	// disconnection is completed with zeros. Meanwhile the input has a
+	// gap, which GapFill and FallbackImage can cover.
+	InputSocketReaccept bool
+
+	// ReconnectInputPolicy decides whether raw input is dropped
+	// (ReconnectInputDrop, the default) or left unread
+	// (ReconnectInputBlock) while the room reconnects; see
+	// ReconnectInputPolicy for the tradeoff.
+	ReconnectInputPolicy ReconnectInputPolicy
+
+	// ReconnectBuffer, under ReconnectInputDrop, keeps the most recent
+	// ReconnectBuffer of raw input of each track while the room
+	// reconnects and encodes it, oldest first, once reconnected, so a
+	// short outage delays the media instead of losing it. Input older
+	// than that is dropped and counted under DropReconnect as before.
+	// The encoder sees the kept frames straight after the ones it
+	// encoded before the outage, so they continue its GOP and need no
+	// keyframe. Raw video is large: 2s of 1280x720 yuv420p at 25 fps
+	// holds 69 MB, against 384 KB for 2s of 48 kHz stereo s16le audio.
+	// Zero, the default, drops all of it.
+	ReconnectBuffer time.Duration
+
+	// MaxRejoinAttempts, if positive, rejoins the room when the SDK gives
+	// up reconnecting and the connection is lost, as when the server
+	// restarts, keeping the encoders running as Park does and publishing
+	// the tracks again. Attempts are RejoinBackoff (DefaultRejoinBackoff
+	// if zero) apart, doubling up to MaxRejoinBackoff, each with jitter.
+	// Once they all fail, Run returns ErrDisconnected with the last
+	// failure. Zero, the default, does not rejoin.
+	MaxRejoinAttempts int
+	RejoinBackoff     time.Duration
+
+	// StartupInputPolicy decides whether raw input that arrives before its
+	// track is bound is buffered (StartupInputBuffer, the default) or
+	// dropped (StartupInputDrop); see StartupInputPolicy for the tradeoff.
+	StartupInputPolicy StartupInputPolicy
+
+	// PipeOpenTimeout bounds how long Start waits for the producer to open
+	// both pipes or connect to the input socket, failing with
+	// ErrProducerTimeout. Zero waits indefinitely, until Start's context
+	// is done.
+	PipeOpenTimeout time.Duration
+
+	// HeaderTimeout bounds how long Start waits for the complete
+	// width/height header once the pipes are open. Zero uses
+	// DefaultHeaderTimeout.
+	HeaderTimeout time.Duration
+
+	// StartupTimeout bounds all of Start, from joining the room and
+	// opening the pipes to the tracks being published and, with
+	// VerifyPublish, verified. When it elapses Start logs the StartupStage
+	// that was pending and fails with ErrStartupTimeout. Zero leaves each
+	// stage to its own timeout, and opening the pipes to PipeOpenTimeout.
+	StartupTimeout time.Duration
+
+	// PixelFormat is the layout of raw video frames. It defaults to
+	// yuv420p; nv12 is encoded as it is, and yuva420p, rgb24, rgba and
+	// bgra are converted by ffmpeg at some CPU cost.
+	PixelFormat PixelFormat
+	// PixelFormatFromHeader expects a further uint32 in the video header,
+	// after the frame rate if FrameRateFromHeader is set too: the
+	// HeaderCode of the PixelFormat the producer sends, which replaces
+	// PixelFormat unless it is zero. As with FrameRateFromHeader, producers
+	// that do not send the field must leave it unset.
+	PixelFormatFromHeader bool
+	// AlphaPacking publishes the alpha channel of a PixelFormat that has
+	// one, packed beside or below the colour; see AlphaPacking. Not
+	// applied to TSInput.
+	AlphaPacking AlphaPacking
+	// AudioSampleFormat is the layout of raw audio samples. It defaults to
+	// s16le; f32le and s24le suit producers such as TTS engines that emit
+	// those.
+	AudioSampleFormat AudioSampleFormat
+	// AudioSampleRate is the rate of the raw audio input in Hz,
+	// DefaultAudioSampleRate if zero. A producer that can emit 48000,
+	// Opus's own rate, saves the resampling stage and its CPU and delay.
+	AudioSampleRate int
+	// AudioChannels is the channel count of the raw audio input, 1 (the
+	// default if zero) or 2 with the samples interleaved. Stereo input is
+	// encoded and published as stereo Opus, still at 48 kHz.
+	AudioChannels int
+
+	// FrameRate is the rate the producer writes raw frames at, which paces
+	// the track and the encoder. DefaultFrameRate if zero.
+	FrameRate int
+	// FrameRateFromHeader expects a third little-endian uint32 in the
+	// video header, the frame rate, which replaces FrameRate unless it is
+	// zero. Producers that write the plain eight-byte header must leave it
+	// unset, as the first four bytes of their first frame would be taken
+	// for the rate.
+	FrameRateFromHeader bool
+
+	// VideoSource and AudioSource tag the publications so clients can lay
+	// them out, e.g. a face as Camera and a shared board as ScreenShare.
+	// They default to Camera and Microphone.
+	VideoSource livekit.TrackSource
+	AudioSource livekit.TrackSource
+
+	// MinDimension and MaxDimension bound the width and height accepted
+	// from the video pipe header. They default to 16 and 7680.
+	MinDimension uint32
+	MaxDimension uint32
+
+	// Profile selects a named set of video encoder settings: "low-latency",
+	// "balanced" or "quality". See profiles.go for what each one sets.
+	// Empty keeps the streamer's historical settings.
+	Profile string
+	// VideoEncoder overrides individual profile settings. Zero fields keep
+	// the profile's value.
+	VideoEncoder VideoEncoderSettings
+
+	// AudioBitrateKbps is the Opus target bitrate. Zero uses
+	// DefaultAudioBitrateKbps, which is plenty for voice. Opus is VBR by
+	// default; AudioCBR holds the bitrate constant, which suits links with
+	// strict bandwidth caps at some cost in quality.
+	AudioBitrateKbps int
+	AudioCBR         bool
+
+	// OpusApplication tunes Opus for speech (voip, the default), music
+	// (audio) or latency (lowdelay).
+	OpusApplication OpusApplication
+
+	// AudioFECPacketLoss enables Opus in-band forward error correction,
+	// tuned for the expected packet loss in percent; zero disables it.
+	// Each packet then carries a low-bitrate copy of the previous frame,
+	// which a receiver that loses a packet decodes in its place. Browser
+	// and LiveKit client decoders use it, and it needs no negotiation
+	// beyond the useinbandfec the Opus codec already advertises.
+	// The copy is taken out of AudioBitrateKbps rather than added to it,
+	// so the bandwidth is unchanged and quality drops the more loss is
+	// expected. It needs OpusApplication voip or audio; lowdelay cannot
+	// carry it.
+	//
+	// RED (RFC 2198), which resends whole earlier frames at the cost of
+	// roughly doubling the audio bandwidth per redundant frame, is not
+	// offered: the SDK neither registers the audio/red codec nor lets a
+	// publication opt into it.
+	AudioFECPacketLoss int
+
+	// AudioDTX enables Opus discontinuous transmission, for a mostly
+	// silent avatar: during silence the encoder sends only a comfort noise
+	// update every 400 ms, and the frames in between are not sent at all,
+	// so the audio costs next to no bandwidth or packets until speech
+	// resumes. Receivers play comfort noise over the gap. The frames not
+	// sent reach neither OnAudioFrame nor the audio stats, whose intervals
+	// then span the silences. It needs an ffmpeg whose libopus wrapper
+	// takes -dtx.
+	AudioDTX bool
+
+	// AudioResampler converts the input to 48 kHz: ResamplerSWR, the
+	// default, or the higher-fidelity ResamplerSoxr at
+	// AudioResamplePrecision bits (zero for soxr's default of 20). See
+	// AudioResampler for the CPU cost. Neither applies to input at 48 kHz,
+	// which is not resampled.
+	AudioResampler         AudioResampler
+	AudioResamplePrecision int
+
+	// PauseWhenIdle stops feeding the encoders while the room has no
+	// remote participants, so neither GPU nor bandwidth is spent on a
+	// stream nobody receives. Raw input is read and dropped meanwhile. The
+	// first participant to join resumes it with a restarted video encoder,
+	// whose stream opens with an IDR frame. It applies to raw input only,
+	// not TSInput.
+	//
+	// Participants stand in for subscribers. The SDK reports when a
+	// local track is first subscribed to, but neither who subscribes nor
+	// when they unsubscribe, so there is no subscriber count to go by. A
+	// participant in the room that has not subscribed, such as another
+	// agent or a recorder that ignores video, keeps encoding running.
+	//
+	// This stands in for LiveKit's dynacast, which the Go server SDK does
+	// not implement: it ignores the SFU's subscribed-quality updates, and
+	// with a single published layer there is nothing to switch off short
+	// of the whole track.
+	PauseWhenIdle bool
+
+	// AudioPublishDelay and VideoPublishDelay stagger the publications
+	// for an entrance, such as a voice heard just before the picture
+	// appears: each track is published that long after both are ready to
+	// go, at most MaxPublishDelay, and Start returns once the later one is
+	// published. Until then the track's encoded output is dropped, so it
+	// opens on live media. If the producer has not started writing the
+	// later track's input by then, GapFill can supply black or silence
+	// until it does. Zero publishes at once, audio first. Rejoin publishes
+	// both at once.
+	AudioPublishDelay time.Duration
+	VideoPublishDelay time.Duration
+
+	// SyncStartTimeout holds publishing until both encoders have produced
+	// their first frame, for at most this long and at most
+	// MaxPublishDelay, and then publishes the two tracks together, so
+	// receivers start them in step rather than with the audio trailing by
+	// its encoder's later start. A track still without a frame at the
+	// timeout is published anyway and starts once it has one. The publish
+	// delays count from the end of the wait. Zero publishes as soon as the
+	// tracks are created.
+	SyncStartTimeout time.Duration
+
+	// AdaptiveGOP shortens the keyframe interval while participants join
+	// often and lengthens it while the room is stable; see AdaptiveGOP.
+	// It applies to raw input only, not TSInput.
+	AdaptiveGOP AdaptiveGOP
+
+	// EncoderNice and EncoderCgroup let operators running many streamers
+	// on one host share it fairly. They apply to every ffmpeg the session
+	// encodes with: the video and audio encoders, their replacements, the
+	// TS demuxer and the pre-roll decoders, but not recorders.
+	//
+	// EncoderNice, between MinEncoderNice and MaxEncoderNice, is set with
+	// setpriority(2) right after each process starts; zero keeps the
+	// streamer's own. Raising it is always allowed, while a negative value
+	// needs CAP_SYS_NICE or a high enough RLIMIT_NICE.
+	//
+	// EncoderCgroup is a cgroup v2 directory, such as
+	// /sys/fs/cgroup/avatars/a1, whose cpu.max, cpu.weight or memory.max
+	// the operator has set up; each process is moved into it by writing
+	// its PID to cgroup.procs. The streamer needs write access to that
+	// file and to the cgroup.procs of the closest common ancestor of its
+	// own cgroup and EncoderCgroup, as for any delegated subtree.
+	//
+	// Both are Linux-only: each thread is reniced through /proc, and
+	// cgroups exist nowhere else. A process that cannot be reniced or
+	// moved is killed, and the start or restart that began it fails.
+	EncoderNice   int
+	EncoderCgroup string
+
+	// VideoCodec is the codec the video is published in, VideoCodecH264
+	// if empty. VP8 is encoded to IVF with the same GOP and keyframe
+	// settings, and is what end-to-end encryption always publishes.
+	VideoCodec VideoCodec
+	// H264Encoder is the ffmpeg encoder of H264 video: HardwareVideoEncoder
+	// (the default), QSVVideoEncoder, VideoToolboxVideoEncoder or
+	// SoftwareVideoEncoder. Start checks that ffmpeg lists it and that a
+	// test encode works, and otherwise falls back to libx264.
+	H264Encoder string
+	// RequireHardware makes Start fail when the hardware H264Encoder is
+	// unusable instead of falling back to software encoding with libx264.
+	RequireHardware bool
+	// AdaptCodec publishes VP8, encoded with VP8VideoEncoder, when the
+	// room allows VP8 but not H264, instead of failing with
+	// ErrCodecNotAllowed. It does not apply to TSInput, whose H264 is
+	// passed through.
+	AdaptCodec bool
+
+	// Warmup feeds the video encoder black frames at startup until it
+	// produces output, so NVENC's lazy initialization is paid before the
+	// first subscriber rather than delaying their first keyframe. The
+	// stream then opens with those few black frames.
+	Warmup bool
+
+	// EncoderStallTimeout, unless zero, is how long the video or audio
+	// encoder may go without producing output while input is still being
+	// written to it before it counts as stalled, as when the GPU wedges;
+	// the input is fine, unlike the stalls LifecyclePolicy.StallTimeout
+	// catches. Each stall emits EventEncoderStalled, reports a recoverable
+	// error and calls OnEncoderStall with the time since the last output,
+	// and with RestartOnEncoderStall the encoder is replaced by a fresh one
+	// whose output the track carries on with, its gap left out of the
+	// frame timing. Stats.VideoEncoderOutputAgo and AudioEncoderOutputAgo
+	// show the time since output either way. Not applied to TSInput, which
+	// is not re-encoded.
+	EncoderStallTimeout   time.Duration
+	RestartOnEncoderStall bool
+	OnEncoderStall        func(since time.Duration)
+
+	// EncoderRestartLimit and EncoderRestartWindow bound the encoder
+	// restarts of RestartOnEncoderStall and LifecyclePolicy.RestartOnStall,
+	// video and audio together:
+	// once EncoderRestartLimit (DefaultEncoderRestartLimit if zero)
+	// restarts fall within EncoderRestartWindow
+	// (DefaultEncoderRestartWindow if zero), the next stall is not
+	// restarted. The breaker opens for the rest of the session, emitting
+	// EventEncoderBreakerOpen and calling OnEncoderFatal, and Run returns
+	// ErrEncoderFailed. Stats.EncoderBreakerOpen shows the state.
+	EncoderRestartLimit  int
+	EncoderRestartWindow time.Duration
+	OnEncoderFatal       func(err error)
+
+	// HotSwapReconfigure makes Reconfigure, and so AdaptiveGOP and the
+	// changes built on it, start the new video encoder alongside the
+	// running one and switch the track over at a keyframe, without the
+	// gap of a cold restart. Both encoders run for HotSwapLead
+	// (DefaultHotSwapLead if zero), which costs a second NVENC session or
+	// the CPU of a second encode meanwhile, and the new one needs a slot
+	// of its own under SetEncoderLimit. Restarts after a stall stay cold,
+	// as the stalled encoder has nothing to hand over.
+	HotSwapReconfigure bool
+	HotSwapLead        time.Duration
+
+	// EncoderThreads is the -threads count for the software encoder, used
+	// when H264Encoder is libx264 or unavailable. Zero uses GOMAXPROCS.
+	// With the zerolatency tune x264 splits each frame into one slice per
+	// thread, which costs a little bitrate but no latency; more threads
+	// than cores only adds scheduling jitter. Hardware encoding ignores it.
+	EncoderThreads int
+
+	// VideoCodecOverride and AudioCodecOverride change the RTP clock rate
+	// the tracks advertise. Leave them zero unless a receiver requires it.
+	VideoCodecOverride CodecOverride
+	AudioCodecOverride CodecOverride
+
+	// VideoFilter and AudioFilter are ffmpeg filtergraphs applied before
+	// encoding, passed as -vf and -af. The track is still paced at FrameRate
+	// and published with the header dimensions, so fps and scale filters
+	// should keep those unchanged.
+	VideoFilter string
+	AudioFilter string
+
+	// PreRoll is a media file, in any format ffmpeg reads, played on the
+	// video and audio tracks before the live input. Its video is scaled to
+	// the header dimensions and converted to FrameRate and PixelFormat, and
+	// its audio resampled to the input's AudioSampleRate, so it goes through
+	// the same encoders; a clip without audio leaves the live audio playing
+	// from the start. Each track cuts to the live input when the clip's
+	// stream of that kind ends, and a keyframe is requested at the video
+	// cut. Not applied to TSInput.
+	//
+	// The live input is not read during the pre-roll, so to avoid a gap at
+	// the cut the producer should start writing as soon as the pipes open:
+	// its first frames then wait in the pipe and follow the clip's last
+	// frame directly. A producer that drops frames when the pipe is full
+	// loses that much of its start instead. Give the clip audio and video
+	// of the same length, so both tracks cut together.
+	PreRoll string
+
+	// FallbackImage is a still image, PNG, JPEG or anything else ffmpeg
+	// decodes, published in place of the live video once the input has
+	// gone without a frame for FallbackAfter (DefaultFallbackAfter if
+	// zero), until the input delivers again. It is scaled to the header
+	// dimensions and encoded like live frames, at FrameRate, and a
+	// keyframe is requested at each transition. Time the input is held
+	// back on purpose, while idle or reconnecting, does not count. Since
+	// frames keep flowing, Run does not see such a stall. Not applied to
+	// TSInput.
+	FallbackImage string
+	FallbackAfter time.Duration
+
+	// GapFill keeps both tracks continuous through brief gaps in the raw
+	// input without pausing: once an input has gone without data for
+	// GapFillAfter (DefaultGapFillAfter if zero), the video is filled at
+	// FrameRate with the last frame (GapFillHold) or black (GapFillBlack),
+	// and the audio with silence, until the input delivers again.
+	// Subscribers see a held or black picture instead of a freeze, and
+	// since the filled audio advances at the real rate, audio and video
+	// stay in sync when the input resumes. Data the producer writes late
+	// is still published after the filler, so a producer that catches up
+	// after a gap adds latency instead. Time the input is held back on
+	// purpose, while idle, parked or reconnecting, is not filled. With
+	// FallbackImage, the image takes over after FallbackAfter. Not
+	// applied to TSInput or with FrameHeaders.
+	GapFill      GapFill
+	GapFillAfter time.Duration
+
+	// ClockSource selects how frame timestamps are derived. Use ClockWall or
+	// ClockNTP to pace several streamers' frames by a shared clock, or
+	// ClockSession to keep the video and audio tracks from drifting apart
+	// over a long session; see clock.go.
+	// NTPServer is the host:port queried for ClockNTP.
+	ClockSource ClockSource
+	NTPServer   string
+
+	// KeyframeDebounce is the window within which keyframe requests from
+	// PLI, reconnects and forced intervals collapse into one. Zero uses
+	// DefaultKeyframeDebounce.
+	KeyframeDebounce time.Duration
+
+	// ForceKeyframes lets keyframe requests force an IDR frame where they
+	// are otherwise left to the next GOP keyframe, and requests one each
+	// time a viewer subscribes to the video, so a latecomer need not wait
+	// out the GOP. ffmpeg cannot be asked for an IDR mid-stream, so each
+	// forced keyframe restarts the video encoder as Reconfigure does, hot
+	// swapping it with HotSwapReconfigure, at most once per
+	// KeyframeDebounce; the GOP keyframes carry on as the fallback. Not
+	// applied to TSInput, which is not re-encoded.
+	ForceKeyframes bool
+
+	// KeyframeBurst, when positive, makes each video encoder open with
+	// that many keyframes, KeyframeBurstInterval apart (default
+	// DefaultKeyframeBurstInterval), before settling into the GOP, so that
+	// one getting lost does not hold back the first picture. Every encoder
+	// start bursts, including the restart on leaving PauseWhenIdle when a
+	// viewer joins and after Reconfigure. Each extra IDR costs several
+	// delta frames' worth of bits, a few hundred KB over the burst at
+	// 1080p. Not applied to TSInput, which is not re-encoded.
+	KeyframeBurst         int
+	KeyframeBurstInterval time.Duration
+	// KeyframeInterval, when positive, sets the video GOP in seconds
+	// rather than frames: once the frame rate is known at stream start,
+	// from FrameRate or the video header, the GOP becomes FrameRate ×
+	// KeyframeInterval frames in place of the profile's or VideoEncoder's,
+	// and keyframes are also forced at each multiple of KeyframeInterval
+	// (see KeyframeIntervalArgs), so the cadence is the same whatever rate
+	// the producer sends. A KeyframeBurst, or the keyframe a hot swap
+	// forces, takes the place of the forced keyframes for that encoder,
+	// leaving the cadence to the GOP. It cannot be combined with
+	// AdaptiveGOP. Not applied to TSInput, which is not re-encoded.
+	KeyframeInterval time.Duration
+
+	// StatsSmoothing is the weight, in (0, 1], of each new frame interval
+	// in the smoothed stats; smaller is smoother. Zero uses
+	// DefaultStatsSmoothing.
+	StatsSmoothing float64
+
+	// UsageSampleInterval is how often the encoders' CPU and GPU usage is
+	// sampled into Stats. Zero uses DefaultUsageSampleInterval.
+	UsageSampleInterval time.Duration
+
+	// BitrateWindow is the sliding window over which the bitrate actually
+	// sent on each track is measured into Stats and logged, once per
+	// window, next to the configured target. Zero uses
+	// DefaultBitrateWindow.
+	BitrateWindow time.Duration
+	// DriftWarning is how far the published video may fall behind real
+	// time, as Stats.VideoDrift, before a warning is logged and
+	// EventVideoBehind emitted. Zero uses DefaultDriftWarning.
+	DriftWarning time.Duration
+
+	// FrameHeaders expects a sidecar header before every raw video frame
+	// (see FrameHeaderMagic) and publishes frames spaced by the producer's
+	// capture timestamps. Without it the video input is headerless raw
+	// frames.
+	FrameHeaders bool
+	// InputAnomalyThreshold is how many missing, duplicate or out-of-order
+	// frames the sidecar sequence numbers may show in a minute before a
+	// warning is logged. Zero uses DefaultInputAnomalyThreshold.
+	InputAnomalyThreshold int
+
+	// TimecodeSEI inserts an SEI message with a picture counter and
+	// wall-clock timestamp ahead of every published video frame, for
+	// frame-accurate sync with external systems. See TimecodeSEIUUID for
+	// the payload format.
+	TimecodeSEI bool
+
+	// LimitInputRate reads raw video from the pipe no faster than FrameRate.
+	// Enable it for producers that write faster than real time, such as a
+	// file dumped into the pipe; real-time producers do not need it.
+	LimitInputRate bool
+
+	// EncoderBacklog, unless zero, queues at most that many raw frames
+	// ahead of the video encoder, read from the input as they arrive.
+	// While the encoder cannot keep up and the queue is full, each new
+	// frame drops the oldest queued one, counted as DropEncoderBacklog, so
+	// the latency stays bounded at the cost of smoothness rather than
+	// growing with the backlog. VideoStats reports the queue depth and the
+	// frames dropped. Not applied to TSInput, and it cannot be combined
+	// with FrameHeaders.
+	EncoderBacklog int
+
+	// Logger receives the streamer's messages: per-read and per-frame ones
+	// at Debug, connection, publish and encoder events at Info, degraded
+	// media at Warn and failures at Error. Nil logs through slog.Default(),
+	// whose handler drops Debug.
+	Logger *slog.Logger
+
+	// LogSampling enables and thins out high-frequency debug messages per
+	// category. With a LogReads entry every encoded-stream read is logged
+	// at Debug, subject to the sampling; without one reads are not logged.
+	LogSampling map[LogCategory]LogSampling
+
+	// FrameChecksums logs a CRC32 per raw frame and per encoded NAL unit,
+	// at Info, so they are logged at the default level. See
+	// RawChecksumReader for the log format.
+	FrameChecksums bool
+
+	// CheckFrameAlignment warns, once, when the raw video does not arrive
+	// in whole frames of the expected size, which catches producers that
+	// pad rows to a stride. Only the points where the pipe runs dry are
+	// checked; see alignmentChecker.
+	CheckFrameAlignment bool
+
+	// MaxSessionDuration stops the session that long after Start, whether
+	// or not anyone is watching; zero means no limit. OnMaxDurationReached
+	// is called just before the shutdown it triggers.
+	MaxSessionDuration   time.Duration
+	OnMaxDurationReached func()
+
+	// OnResolutionChanged is called when Reconfigure changes the size of
+	// the encoded video, e.g. by cropping, or RepublishVideo that of the
+	// input. After Reconfigure the publication keeps the dimensions it was
+	// published with; see Streamer.VideoSize.
+	OnResolutionChanged func(width, height uint32)
+
+	// OnError receives every failure reported after Start returns, as the
+	// Errors channel does. fatal is true when the stream cannot continue,
+	// e.g. an encoder exited, so the caller should alert or restart; other
+	// errors, such as frames the producer dropped or a late keyframe, are
+	// recoverable. It runs on the pipeline's goroutines and must not block.
+	OnError func(err error, fatal bool)
+
+	// OnEvent receives every entry of the session timeline (connect,
+	// publish, participant joins and leaves, keyframe requests, stalls,
+	// errors, shutdown) and EventLogPath, if set, appends them to a file
+	// as JSON lines.
+	OnEvent      func(Event)
+	EventLogPath string
+
+	// HealthAddr, if set, serves /healthz, /stats and /metrics over HTTP
+	// on it, a host:port or unix:/path, from Start until Stop, for a
+	// liveness probe, a look at the frame timing and a Prometheus scrape;
+	// see HealthStats and WriteMetrics. MetricsNamespace prefixes the
+	// metric names, DefaultMetricsNamespace if empty.
+	HealthAddr       string
+	MetricsNamespace string
+
+	// ShutdownTimeout bounds Stop, DefaultShutdownTimeout if zero. When it
+	// elapses the phase that is stuck is logged, the encoders are killed
+	// and Stop returns; with ExitOnShutdownTimeout the process exits with
+	// status 1 instead, so an orchestrator always sees it terminate.
+	ShutdownTimeout       time.Duration
+	ExitOnShutdownTimeout bool
+	// EncoderStopTimeout is how long Stop, and the swap of a replaced
+	// encoder, give an ffmpeg encoder to flush its last packets and exit
+	// after SIGTERM before killing it; DefaultEncoderStopTimeout if zero.
+	// It counts against ShutdownTimeout.
+	EncoderStopTimeout time.Duration
+
+	// OnShutdown receives the final stats once Stop has torn the pipeline
+	// down. StatsWebhookURL, if set, additionally POSTs them as JSON, and
+	// StatsPath writes them as one JSON object to a file, or to stdout if
+	// it is "-"; see NewStatsFile.
+	OnShutdown      func(Stats) error
+	StatsWebhookURL string
+	StatsPath       string
+
+	// SubscribeOnly joins the room without publishing, as a monitor. No
+	// pipes or encoders are started. With RecordDir set, every subscribed
+	// track is recorded there.
+	SubscribeOnly bool
+	RecordDir     string
+
+	// DecodeDir, with SubscribeOnly, decodes every subscribed video track
+	// through ffmpeg to raw PixelFormatYUV420P frames in the dimensions it
+	// was published with, written to <identity>-<track SID>.yuv in
+	// DecodeDir. A file starts with a VideoHeader, as the video pipe does,
+	// so it can be fed back to a streamer; a FIFO of that name created
+	// beforehand is written to instead, blocking until it is read.
+	// OnDecodedFrame is handed each frame as well, or instead if DecodeDir
+	// is empty; it runs on the track's decode goroutine and holds up the
+	// decoder while it runs.
+	DecodeDir      string
+	OnDecodedFrame func(DecodedFrame)
+
+	// RecordContainer is the format tracks are recorded in, RecordRaw if
+	// empty. Anything else is muxed by ffmpeg without re-encoding; pick
+	// RecordFragmentedMP4 for recordings that survive being interrupted.
+	// RecordMuxing chooses between a file per track (RecordSeparate, the
+	// default) and one per participant (RecordMuxed).
+	RecordContainer RecordContainer
+	RecordMuxing    RecordMuxing
+
+	// Sink, if set, takes the encoded samples in place of a room, which
+	// is not joined: the raw pipeline runs as in a session, from the pipes
+	// through the encoders, and each track's samples go to the Sink
+	// instead of being published. NullSink and RecordingSink suit tests
+	// and trying the pipeline without a server. Raw input only, without
+	// PauseWhenIdle or VerifyPublish, which need participants, and Park is
+	// refused. With nobody in the room, Run's IdleTimeout ends the session
+	// once it elapses.
+	Sink Sink
+
+	// VerifyPublish makes Start join the room a second time as a hidden
+	// participant, subscribe to the published tracks and wait for RTP on
+	// each, failing with ErrPublishFailed if none arrives. It catches
+	// publishes that succeed without media reaching the SFU.
+	VerifyPublish bool
+
+	// OnRTPSent observes every RTP packet sent on the published tracks. It
+	// runs on the send path for each packet, so it must return quickly.
+	OnRTPSent func(SentRTPPacket)
+
+	// OnVideoFrame and OnAudioFrame observe every frame handed to the
+	// video and audio tracks, after the session's own stats have counted
+	// it. They run on the track's send path, so they must return quickly;
+	// a slow hook holds back the frames behind it.
+	OnVideoFrame func(FrameInfo)
+	OnAudioFrame func(FrameInfo)
+
+	// DisableVideoRTX stops the streamer retransmitting lost video packets
+	// when the SFU NACKs them. Retransmission repairs a loss within about
+	// one round trip, so without it a lost packet corrupts the picture
+	// until the next GOP keyframe, since PLIs cannot force one mid-GOP
+	// without ForceKeyframes (see RequestKeyframe); a short VideoEncoder
+	// GOP bounds the damage. That trades visible glitches under loss for
+	// never spending bandwidth or delay on late packets, which suits
+	// ultra-low-latency use on clean links. The video has no FEC to fall
+	// back on, so a warning is logged. It covers only the hop to the SFU,
+	// which still retransmits to subscribers from its own buffer. Audio is
+	// never retransmitted; see AudioFECPacketLoss.
+	DisableVideoRTX bool
+
+	// E2EEPassphrase or E2EEKey, if set, end-to-end encrypts the tracks
+	// with AES-GCM under a key shared with the subscribers, as the LiveKit
+	// client SDKs' ExternalE2EEKeyProvider does with setKey and a string or
+	// raw bytes; set at most one. The key is not distributed by the
+	// streamer or the server: subscribers must be given the same key out
+	// of band, and any without it receive media they cannot decode. The
+	// SDK can only encrypt Opus, and the H264 frame layout the clients
+	// expect cannot be produced one NAL unit at a time, so video is
+	// encoded as VP8 with VP8VideoEncoder, in software; the room must
+	// allow VP8, and RequireHardware and TSInput are rejected.
+	E2EEPassphrase string
+	E2EEKey        []byte
+
+	// OnTrackSubscribed is called when we subscribe to a remote track.
+	OnTrackSubscribed func(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant)
+
+	// OnTrackSubscriptionFailed is called when a remote track could not be
+	// subscribed to; see subscriptionFailureReason for what that covers.
+	OnTrackSubscriptionFailed func(trackSID string, rp *lksdk.RemoteParticipant)
+
+	// OnDataReceived is called with the payload of every data message sent
+	// to the room, reliable or lossy, such as a controller's commands. rp
+	// is the sender, nil for messages sent through the server API. It is
+	// called from the SDK's goroutine, so a slow handler holds up the
+	// messages after it.
+	OnDataReceived func(data []byte, rp *lksdk.RemoteParticipant)
+}
+
+// inputSocketAddr is the address of the input socket for listenAddr, or
+// "" for the pipes.
+func (c *Config) inputSocketAddr() string {
+	if c.InputSocketPath != "" {
+		return unixAddrPrefix + c.InputSocketPath
+	}
+	return c.InputSocketAddr
+}
+
+// headerFields are the optional fields the video header carries.
+func (c *Config) headerFields() headerFields {
+	return headerFields{rate: c.FrameRateFromHeader, format: c.PixelFormatFromHeader}
+}
+
+// frameInterval is the time between raw frames at FrameRate.
+func (c *Config) frameInterval() time.Duration {
+	return time.Second / time.Duration(c.FrameRate)
+}
+
+func (c *Config) setDefaults() {
+	if c.MetricsNamespace == "" {
+		c.MetricsNamespace = DefaultMetricsNamespace
+	}
+	if c.VideoPipePath == "" {
+		c.VideoPipePath = DefaultVideoPipePath
+	}
+	if c.AudioPipePath == "" {
+		c.AudioPipePath = DefaultAudioPipePath
+	}
+	if c.PixelFormat == "" {
+		c.PixelFormat = PixelFormatYUV420P
+	}
+	if c.VideoCodec == "" {
+		c.VideoCodec = VideoCodecH264
+	}
+	if c.H264Encoder == "" {
+		c.H264Encoder = HardwareVideoEncoder
+	}
+	if c.AudioSampleFormat == "" {
+		c.AudioSampleFormat = AudioFormatS16LE
+	}
+	if c.AudioSampleRate == 0 {
+		c.AudioSampleRate = DefaultAudioSampleRate
+	}
+	if c.AudioChannels == 0 {
+		c.AudioChannels = 1
+	}
+	if c.RecordContainer == "" {
+		c.RecordContainer = RecordRaw
+	}
+	if c.RecordMuxing == "" {
+		c.RecordMuxing = RecordSeparate
+	}
+	if c.FrameRate == 0 {
+		c.FrameRate = DefaultFrameRate
+	}
+	if c.VideoSource == livekit.TrackSource_UNKNOWN {
+		c.VideoSource = livekit.TrackSource_CAMERA
+	}
+	if c.AudioSource == livekit.TrackSource_UNKNOWN {
+		c.AudioSource = livekit.TrackSource_MICROPHONE
+	}
+	if c.MinDimension == 0 {
+		c.MinDimension = DefaultMinDimension
+	}
+	if c.MaxDimension == 0 {
+		c.MaxDimension = DefaultMaxDimension
+	}
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = DefaultConnectTimeout
+	}
+	if c.HeaderTimeout == 0 {
+		c.HeaderTimeout = DefaultHeaderTimeout
+	}
+	if c.KeyframeDebounce == 0 {
+		c.KeyframeDebounce = DefaultKeyframeDebounce
+	}
+	if c.InputAnomalyThreshold == 0 {
+		c.InputAnomalyThreshold = DefaultInputAnomalyThreshold
+	}
+	if c.KeyframeBurstInterval == 0 {
+		c.KeyframeBurstInterval = DefaultKeyframeBurstInterval
+	}
+	if c.AudioResampler == "" {
+		c.AudioResampler = ResamplerSWR
+	}
+	if c.OpusApplication == "" {
+		c.OpusApplication = OpusVoIP
+	}
+	if c.AudioBitrateKbps == 0 {
+		c.AudioBitrateKbps = DefaultAudioBitrateKbps
+	}
+	if c.StatsSmoothing == 0 {
+		c.StatsSmoothing = DefaultStatsSmoothing
+	}
+	if c.UsageSampleInterval == 0 {
+		c.UsageSampleInterval = DefaultUsageSampleInterval
+	}
+	if c.BitrateWindow == 0 {
+		c.BitrateWindow = DefaultBitrateWindow
+	}
+	if c.AdaptiveGOP.enabled() {
+		if c.AdaptiveGOP.Window == 0 {
+			c.AdaptiveGOP.Window = DefaultAdaptiveGOPWindow
+		}
+		if c.AdaptiveGOP.Joins == 0 {
+			c.AdaptiveGOP.Joins = DefaultAdaptiveGOPJoins
+		}
+	}
+	if c.EncoderRestartLimit == 0 {
+		c.EncoderRestartLimit = DefaultEncoderRestartLimit
+	}
+	if c.EncoderRestartWindow == 0 {
+		c.EncoderRestartWindow = DefaultEncoderRestartWindow
+	}
+	if c.HotSwapLead == 0 {
+		c.HotSwapLead = DefaultHotSwapLead
+	}
+	if c.GapFillAfter == 0 {
+		c.GapFillAfter = DefaultGapFillAfter
+	}
+	if c.FallbackAfter == 0 {
+		c.FallbackAfter = DefaultFallbackAfter
+	}
+	if c.DriftWarning == 0 {
+		c.DriftWarning = DefaultDriftWarning
+	}
+	if c.RejoinBackoff == 0 {
+		c.RejoinBackoff = DefaultRejoinBackoff
+	}
+	if c.ReconnectInputPolicy == "" {
+		c.ReconnectInputPolicy = ReconnectInputDrop
+	}
+	if c.StartupInputPolicy == "" {
+		c.StartupInputPolicy = StartupInputBuffer
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if c.EncoderStopTimeout == 0 {
+		c.EncoderStopTimeout = DefaultEncoderStopTimeout
+	}
+	if c.EncoderThreads == 0 {
+		c.EncoderThreads = runtime.GOMAXPROCS(0)
+	}
+	if c.ParticipantName == "" {
+		c.ParticipantName = "Avatar"
+	}
+}
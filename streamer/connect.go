@@ -0,0 +1,123 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// DefaultConnectTimeout bounds joining the room when Config.ConnectTimeout
+// is zero.
+const DefaultConnectTimeout = 15 * time.Second
+
+// ErrConnectTimeout is returned, wrapped along with ErrConnectFailed, when
+// the room could not be joined within Config.ConnectTimeout.
+var ErrConnectTimeout = errors.New("timed out connecting to room")
+
+// ErrICETimeout is returned, wrapped along with ErrConnectFailed, when a
+// connection attempt did not complete within Config.ICETimeout, or the SDK
+// gave up waiting for ICE to connect. It usually means no candidate pair
+// works, as on networks that block UDP.
+var ErrICETimeout = errors.New("no ICE connection")
+
+// connectRoom runs dial, which the SDK cannot cancel, under the configured
+// timeout. A connection that completes after the caller has given up is
+// disconnected rather than leaked.
+func (s *Streamer) connectRoom(dial func() (*lksdk.Room, error)) (*lksdk.Room, error) {
+	if err := applyProxy(s.cfg.Proxy); err != nil {
+		return nil, err
+	}
+
+	timeout, timeoutErr := s.cfg.ConnectTimeout, ErrConnectTimeout
+	if t := s.cfg.ICETimeout; t > 0 && t < timeout {
+		timeout, timeoutErr = t, ErrICETimeout
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		room *lksdk.Room
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		room, err := dial()
+		done <- result{room, err}
+	}()
+
+	select {
+	case r := <-done:
+		if errors.Is(r.err, lksdk.ErrConnectionTimeout) {
+			return nil, fmt.Errorf("%w %s: %w: %w", ErrConnectFailed, s.cfg.RoomName, ErrICETimeout, r.err)
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrConnectFailed, s.cfg.RoomName, r.err)
+		}
+		return r.room, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.room != nil {
+				s.log.warnf("Connection to room %s completed after timeout, disconnecting", s.cfg.RoomName)
+				r.room.Disconnect()
+			}
+		}()
+		if s.ctx.Err() != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrConnectFailed, s.cfg.RoomName, s.ctx.Err())
+		}
+		return nil, fmt.Errorf("%w %s: %w after %v", ErrConnectFailed, s.cfg.RoomName, timeoutErr, timeout)
+	}
+}
+
+// iceTransportWait bounds how long logICETransport waits for the
+// publisher connection to select a candidate pair.
+const iceTransportWait = 10 * time.Second
+
+// logICETransport logs, once the publisher connection has settled on a
+// candidate pair, whether media goes over UDP or TCP and directly or
+// through a TURN relay.
+func (s *Streamer) logICETransport() {
+	if s.room == nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		deadline := time.After(iceTransportWait)
+		for {
+			if pair := s.selectedCandidatePair(); pair != nil {
+				s.log.infof("ICE transport: %s %s candidate %s:%d to %s %s candidate %s:%d",
+					pair.Local.Protocol, pair.Local.Typ, pair.Local.Address, pair.Local.Port,
+					pair.Remote.Protocol, pair.Remote.Typ, pair.Remote.Address, pair.Remote.Port)
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-deadline:
+				s.log.warnf("ICE transport: publisher selected no candidate pair within %v", iceTransportWait)
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// selectedCandidatePair returns the publisher connection's selected
+// candidate pair, or nil before there is one.
+func (s *Streamer) selectedCandidatePair() *webrtc.ICECandidatePair {
+	pc := s.room.LocalParticipant.GetPublisherPeerConnection()
+	if pc == nil || pc.SCTP() == nil {
+		return nil
+	}
+	pair, err := pc.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil || pair.Local == nil || pair.Remote == nil {
+		return nil
+	}
+	return pair
+}
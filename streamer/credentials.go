@@ -0,0 +1,81 @@
+package streamer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Keys of the LiveKit connection settings in Config.CredentialsFile, the
+// same names the example programs read from the environment.
+const (
+	CredentialURLKey       = "LIVEKIT_URL"
+	CredentialAPIKeyKey    = "LIVEKIT_API_KEY"
+	CredentialAPISecretKey = "LIVEKIT_API_SECRET"
+)
+
+// readCredentials reads the connection settings from path: a file of
+// KEY=value lines, or a directory holding one file per key, which is how
+// a Kubernetes secret is mounted. Keys that are absent come back empty.
+func readCredentials(path string) (url, apiKey, apiSecret string, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", "", "", fmt.Errorf("reading credentials: %w", err)
+	}
+	values := map[string]string{}
+	if fi.IsDir() {
+		for _, key := range []string{CredentialURLKey, CredentialAPIKeyKey, CredentialAPISecretKey} {
+			b, err := os.ReadFile(filepath.Join(path, key))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return "", "", "", fmt.Errorf("reading credentials: %w", err)
+			}
+			values[key] = strings.TrimSpace(string(b))
+		}
+	} else if values, err = godotenv.Read(path); err != nil {
+		// The parser's errors may quote the line, secret included.
+		return "", "", "", fmt.Errorf("reading credentials from %s: malformed file", path)
+	}
+	return values[CredentialURLKey], values[CredentialAPIKeyKey], values[CredentialAPISecretKey], nil
+}
+
+// loadCredentials applies Config.CredentialsFile, if set, over the
+// configured connection settings. It runs before every join, so a secret
+// rotated in the file is picked up by the next Rejoin or restart; the SDK's
+// own reconnects resume with the token the server refreshes. The secret is
+// never logged.
+func (s *Streamer) loadCredentials() error {
+	if s.cfg.CredentialsFile == "" {
+		return nil
+	}
+	url, apiKey, apiSecret, err := readCredentials(s.cfg.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if url == "" && apiKey == "" && apiSecret == "" {
+		return fmt.Errorf("%w: credentials file %s sets none of %s, %s and %s", ErrInvalidConfig,
+			s.cfg.CredentialsFile, CredentialURLKey, CredentialAPIKeyKey, CredentialAPISecretKey)
+	}
+	rotated := s.credentialsLoaded && (apiKey != "" && apiKey != s.cfg.APIKey || apiSecret != "" && apiSecret != s.cfg.APISecret)
+	if url != "" {
+		s.cfg.URL = url
+	}
+	if apiKey != "" {
+		s.cfg.APIKey = apiKey
+	}
+	if apiSecret != "" {
+		s.cfg.APISecret = apiSecret
+	}
+	if rotated {
+		s.log.infof("Credentials in %s changed, joining with API key %s", s.cfg.CredentialsFile, s.cfg.APIKey)
+	} else if !s.credentialsLoaded {
+		s.log.infof("Using credentials from %s (API key %s)", s.cfg.CredentialsFile, s.cfg.APIKey)
+	}
+	s.credentialsLoaded = true
+	return nil
+}
@@ -0,0 +1,60 @@
+package streamer
+
+import "fmt"
+
+// CropRect is a region of the raw video frame, in pixels from the top-left
+// corner. The zero value means the whole frame.
+type CropRect struct {
+	X, Y          uint32
+	Width, Height uint32
+}
+
+// IsZero reports whether r is the zero value, i.e. no crop.
+func (r CropRect) IsZero() bool {
+	return r == CropRect{}
+}
+
+func (r CropRect) String() string {
+	if r.IsZero() {
+		return "none"
+	}
+	return fmt.Sprintf("%dx%d+%d+%d", r.Width, r.Height, r.X, r.Y)
+}
+
+// validate checks that r lies within a width x height frame. Every edge
+// must be even, as yuv420p subsamples chroma by two in both directions.
+func (r CropRect) validate(width, height uint32) error {
+	if r.Width == 0 || r.Height == 0 {
+		return fmt.Errorf("crop %s is empty", r)
+	}
+	if r.X%2 != 0 || r.Y%2 != 0 || r.Width%2 != 0 || r.Height%2 != 0 {
+		return fmt.Errorf("crop %s must have even offsets and dimensions", r)
+	}
+	if uint64(r.X)+uint64(r.Width) > uint64(width) || uint64(r.Y)+uint64(r.Height) > uint64(height) {
+		return fmt.Errorf("crop %s exceeds the %dx%d frame", r, width, height)
+	}
+	return nil
+}
+
+func (r CropRect) filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", r.Width, r.Height, r.X, r.Y)
+}
+
+// SetCrop publishes just rect of each raw frame from now on, or the whole
+// frame again for the zero CropRect, through Reconfigure. The cropped
+// stream opens with an IDR frame whose SPS carries the new size, so
+// subscribers' decoders resize to it. The publication keeps advertising
+// the input dimensions, which LiveKit only uses for simulcast layer
+// selection.
+func (s *Streamer) SetCrop(rect CropRect) error {
+	cfg := s.EncoderConfig()
+	cfg.Crop = rect
+	return s.Reconfigure(cfg)
+}
+
+// Crop reports the crop currently applied to the video.
+func (s *Streamer) Crop() CropRect {
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	return s.crop
+}
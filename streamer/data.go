@@ -0,0 +1,18 @@
+package streamer
+
+import (
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// dataReceived hands the payload of a user data packet to
+// Config.OnDataReceived. Reliable and lossy packets arrive the same way,
+// as the SDK does not say which kind a packet was sent as; the other
+// packet types, such as transcriptions and RPC, are not user data.
+func (s *Streamer) dataReceived(packet lksdk.DataPacket, params lksdk.DataReceiveParams) {
+	user, ok := packet.(*lksdk.UserDataPacket)
+	if !ok || s.cfg.OnDataReceived == nil {
+		return
+	}
+	s.log.debugf("Received %d bytes of data from %q on topic %q", len(user.Payload), params.SenderIdentity, user.Topic)
+	s.cfg.OnDataReceived(user.Payload, params.Sender)
+}
@@ -0,0 +1,167 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// DecodedFrame is one raw video frame decoded from a subscribed track by
+// Config.OnDecodedFrame.
+type DecodedFrame struct {
+	Participant string // identity of the publisher
+	TrackSID    string
+	// Index numbers the track's decoded frames from 0.
+	Index  int
+	Width  uint32
+	Height uint32
+	// Data is the frame in PixelFormatYUV420P. It is reused for the next
+	// frame once the callback returns.
+	Data []byte
+}
+
+// decodes reports whether subscribed video tracks are decoded.
+func (c *Config) decodes() bool {
+	return c.DecodeDir != "" || c.OnDecodedFrame != nil
+}
+
+// decodeDimensions are the dimensions a track is decoded to: those it was
+// published with, rounded down to even for yuv420p. Every frame is scaled
+// to them, so simulcast layer switches and resolution changes do not
+// change the frame size mid-stream.
+func decodeDimensions(publication *lksdk.RemoteTrackPublication) (uint32, uint32, error) {
+	info := publication.TrackInfo()
+	width, height := info.GetWidth()&^1, info.GetHeight()&^1
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("track %s was published without its dimensions", publication.SID())
+	}
+	return width, height, nil
+}
+
+// decoderCommand decodes a newStreamWriter stream of codec mime from its
+// standard input into raw yuv420p frames of width by height on its
+// standard output, one for each frame received.
+func decoderCommand(mime string, width, height uint32) *exec.Cmd {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, muxerInputArgs(mime, "pipe:0")...)
+	args = append(args,
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+		"-pix_fmt", string(PixelFormatYUV420P),
+		"-fps_mode", "passthrough",
+		"-f", "rawvideo", "pipe:1")
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// trackDecoder feeds a subscribed video track to its decoder. Closing it
+// ends the input and waits for the decoded frames to be delivered.
+type trackDecoder struct {
+	rtpWriter
+	stdin io.Closer
+	cmd   *exec.Cmd
+	done  chan struct{}
+}
+
+func (d *trackDecoder) Close() error {
+	d.rtpWriter.Close()
+	d.stdin.Close()
+	<-d.done
+	return d.cmd.Wait()
+}
+
+// newTrackDecoder starts decoding track for Config.DecodeDir and
+// Config.OnDecodedFrame, returning the file the frames are written to, if
+// any.
+func (s *Streamer) newTrackDecoder(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) (rtpWriter, string, error) {
+	mime := track.Codec().MimeType
+	width, height, err := decodeDimensions(publication)
+	if err != nil {
+		return nil, "", err
+	}
+	var path string
+	if s.cfg.DecodeDir != "" {
+		path = filepath.Join(s.cfg.DecodeDir, fmt.Sprintf("%s-%s.yuv", rp.Identity(), publication.SID()))
+	}
+	cmd := decoderCommand(mime, width, height)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	w, err := newStreamWriter(stdin, mime)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("starting decoder: %w", err)
+	}
+	d := &trackDecoder{rtpWriter: w, stdin: stdin, cmd: cmd, done: make(chan struct{})}
+	frame := DecodedFrame{
+		Participant: rp.Identity(),
+		TrackSID:    publication.SID(),
+		Width:       width,
+		Height:      height,
+	}
+	go func() {
+		defer close(d.done)
+		if err := s.deliverDecoded(stdout, path, frame); err != nil {
+			s.log.errorf("Decoding track %s from %s failed: %v", publication.SID(), rp.Identity(), err)
+			s.reportError(fmt.Errorf("decoding track %s: %w", publication.SID(), err), false)
+			// Unblock the track's writes into ffmpeg.
+			cmd.Process.Kill()
+			io.Copy(io.Discard, stdout)
+		}
+	}()
+	return d, path, nil
+}
+
+// deliverDecoded reads whole frames of the decoder's output, hands each
+// to Config.OnDecodedFrame and writes them to path, if set, after a
+// VideoHeader, so the file is what a producer writes to the video pipe. A
+// FIFO at path is written to like a file once something opens it for
+// reading.
+func (s *Streamer) deliverDecoded(r io.Reader, path string, frame DecodedFrame) error {
+	var out *os.File
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		var header [videoHeaderSize]byte
+		binary.LittleEndian.PutUint32(header[0:], frame.Width)
+		binary.LittleEndian.PutUint32(header[4:], frame.Height)
+		if _, err := f.Write(header[:]); err != nil {
+			return err
+		}
+		out = f
+	}
+	frame.Data = make([]byte, PixelFormatYUV420P.frameSize(int(frame.Width), int(frame.Height)))
+	for ; ; frame.Index++ {
+		if _, err := io.ReadFull(r, frame.Data); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if s.cfg.OnDecodedFrame != nil {
+			s.cfg.OnDecodedFrame(frame)
+		}
+		if out != nil {
+			if _, err := out.Write(frame.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
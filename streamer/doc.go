@@ -0,0 +1,61 @@
+// Package streamer publishes avatar video and audio into a LiveKit room.
+//
+// A session is configured with a Config, started, supervised and stopped:
+//
+//	s := streamer.New(streamer.Config{
+//		URL:       os.Getenv("LIVEKIT_URL"),
+//		APIKey:    os.Getenv("LIVEKIT_API_KEY"),
+//		APISecret: os.Getenv("LIVEKIT_API_SECRET"),
+//		RoomName:  "my-room",
+//	})
+//	if err := s.Start(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer s.Stop()
+//	err := s.Run(ctx, streamer.LifecyclePolicy{IdleTimeout: time.Minute})
+//
+// Start returns once the tracks are published. Meanwhile the producer
+// writes a width/height header (see VideoHeader) and then raw frames,
+// yuv420p unless Config.PixelFormat says otherwise, to
+// DefaultVideoPipePath, and PCM, mono and 16 kHz unless
+// Config.AudioChannels and Config.AudioSampleRate say otherwise, to
+// DefaultAudioPipePath. Config.VideoInput and Config.AudioInput take
+// the same streams from readers instead, and with NewTestPattern's
+// generated video and a NullSink in place of the room a test runs the
+// encode path without a producer or a server.
+// cmd/streamer is a complete program built this way. A caller that runs
+// its own encoders can instead publish their output into a room it has
+// joined with a Publisher, as examples/stream-file does. A Publisher
+// takes any number of video tracks, such as several camera angles each
+// from an encoder of their own, under distinct names.
+//
+// # Codecs and layers
+//
+// Video is published as a single H264 layer and audio as Opus. Neither
+// simulcast nor SVC is offered. Simulcast would send several independent
+// encodes at different resolutions; SVC (VP9, AV1) would send one encode
+// whose spatial and temporal layers the SFU can strip per subscriber,
+// which is cheaper to encode but decodable only by clients with VP9/AV1
+// SVC support, mainly Chromium-based browsers. SVC is not implemented
+// because neither piece of the pipeline can produce it: NVENC's H264
+// encoder has no SVC mode and ffmpeg's libvpx-vp9 and libaom wrappers do
+// not emit spatial layers, and samples written through the server SDK
+// carry no layer or dependency-descriptor metadata for the SFU to act on.
+//
+// # Degradation preference
+//
+// There is no degradation preference to configure. In WebRTC it is a
+// parameter of the sender's own encoder, telling a browser whether to drop
+// frames or resolution when CPU or bandwidth runs short; it is never sent
+// to the SFU, and the server SDK's publication options have no such field.
+// Here ffmpeg encodes ahead of the SDK, which only packetizes, so nothing
+// would act on it. The effective preference is maintain-framerate and
+// resolution both: every input frame is encoded at the header dimensions,
+// and the fixed bitrate is met by lowering quality instead. That suits a
+// talking head, whose motion matters more than detail. With a single layer
+// there is no simulcast for the SFU to fall back on, and without dynacast
+// (see Config.PauseWhenIdle) the layer is sent whatever subscribers ask
+// for; a subscriber short of bandwidth gets the same layer late or not at
+// all. Lower the bitrate with Config.VideoEncoder, or the dimensions at
+// the producer, when subscribers are constrained.
+package streamer
@@ -0,0 +1,190 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReconnectInputPolicy decides what happens to raw input while the room
+// connection is being re-established.
+//
+// Block stops reading the pipes, so nothing is lost or buffered by the
+// streamer but the producer stalls once the pipe buffer (64 KiB on Linux)
+// fills; a producer that cannot tolerate blocking writes may fall behind
+// or drop frames itself. Drop keeps reading and discards whole frames
+// before they are encoded, so the producer never notices the outage but
+// the media from it is gone, unless Config.ReconnectBuffer keeps the
+// latest of it. Without that the streamer's memory use stays flat either
+// way; what differs is who pays for the outage.
+type ReconnectInputPolicy string
+
+const (
+	ReconnectInputDrop  ReconnectInputPolicy = "drop" // the default
+	ReconnectInputBlock ReconnectInputPolicy = "block"
+)
+
+func (p ReconnectInputPolicy) validate() error {
+	switch p {
+	case ReconnectInputDrop, ReconnectInputBlock:
+		return nil
+	}
+	return fmt.Errorf("unknown reconnect input policy %q (want drop or block)", string(p))
+}
+
+// inputGate passes reads through while open. While paused it either
+// blocks reads until resumed or reads and discards whole units of input,
+// frames for video and 20 ms chunks for audio, counting them. A unit that
+// is part way through when the gate pauses is passed through to its end
+// first, so downstream never sees a torn frame. With keepLatest, a
+// dropping gate keeps the most recent units instead and passes them on,
+// oldest first, once resumed, counting only those it evicts as dropped.
+type inputGate struct {
+	r    io.Reader
+	unit int
+	drop bool
+	done <-chan struct{}
+
+	mu      sync.Mutex
+	resumed chan struct{} // nil while open
+	offset  int           // bytes passed through of the current unit
+	buf     []byte
+	kept    *frameBuffer // nil unless keepLatest
+
+	dropped atomic.Int64
+	// drops, if set, counts the dropped units under reason as well.
+	drops  *dropCounts
+	reason DropReason
+}
+
+func newInputGate(r io.Reader, unit int, drop bool, done <-chan struct{}) *inputGate {
+	return &inputGate{r: r, unit: unit, drop: drop, done: done}
+}
+
+// countAs has the units g drops counted in d under reason.
+func (g *inputGate) countAs(d *dropCounts, reason DropReason) *inputGate {
+	g.drops, g.reason = d, reason
+	return g
+}
+
+// keepLatest has a dropping gate keep up to max units while paused.
+func (g *inputGate) keepLatest(max int) *inputGate {
+	if g.drop && max > 0 {
+		g.kept = newFrameBuffer(max)
+	}
+	return g
+}
+
+func (g *inputGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *inputGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// paused reports whether input is being held back.
+func (g *inputGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+func (g *inputGate) Read(p []byte) (int, error) {
+	for {
+		g.mu.Lock()
+		resumed, offset := g.resumed, g.offset
+		g.mu.Unlock()
+
+		// A kept unit part way through is read to its end even if the
+		// gate has paused again.
+		if g.kept != nil && g.kept.len() > 0 && (resumed == nil || g.kept.off > 0) {
+			n := g.kept.read(p)
+			g.mu.Lock()
+			g.offset = (g.offset + n) % g.unit
+			g.mu.Unlock()
+			return n, nil
+		}
+		if resumed == nil || offset != 0 {
+			if resumed != nil && len(p) > g.unit-offset {
+				p = p[:g.unit-offset]
+			}
+			n, err := g.r.Read(p)
+			g.mu.Lock()
+			g.offset = (g.offset + n) % g.unit
+			g.mu.Unlock()
+			return n, err
+		}
+
+		if !g.drop {
+			select {
+			case <-resumed:
+				continue
+			case <-g.done:
+				return 0, io.EOF
+			}
+		}
+		if g.buf == nil {
+			g.buf = make([]byte, g.unit)
+		}
+		if _, err := io.ReadFull(g.r, g.buf); err != nil {
+			return 0, err
+		}
+		if g.kept != nil && !g.kept.push(g.buf) {
+			continue
+		}
+		g.dropped.Add(1)
+		if g.drops != nil {
+			g.drops.add(g.reason, 1)
+		}
+	}
+}
+
+// unitsIn is the number of units of length unit that cover d.
+func unitsIn(d, unit time.Duration) int {
+	if d <= 0 || unit <= 0 {
+		return 0
+	}
+	return int((d + unit - 1) / unit)
+}
+
+// droppedSoFar is the count of dropped units, zero for the gate of a
+// disabled track.
+func (g *inputGate) droppedSoFar() int64 {
+	if g == nil {
+		return 0
+	}
+	return g.dropped.Load()
+}
+
+// pauseInput applies Config.ReconnectInputPolicy while the room reconnects.
+func (s *Streamer) pauseInput() {
+	for _, g := range []*inputGate{s.videoGate, s.audioGate} {
+		if g != nil {
+			g.pause()
+		}
+	}
+}
+
+func (s *Streamer) resumeInput() {
+	for _, g := range []*inputGate{s.videoGate, s.audioGate} {
+		if g != nil {
+			g.resume()
+		}
+	}
+	if s.cfg.ReconnectInputPolicy == ReconnectInputDrop && (s.videoGate != nil || s.audioGate != nil) {
+		s.log.infof("Reconnected; %d video frames and %d audio chunks dropped while reconnecting so far",
+			s.videoGate.droppedSoFar(), s.audioGate.droppedSoFar())
+	}
+}
@@ -0,0 +1,49 @@
+package streamer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestInputGateKeepsLatestWhileReconnecting(t *testing.T) {
+	const unit = 4
+	frame := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, unit) }
+
+	pr, pw := io.Pipe()
+	var drops dropCounts
+	g := newInputGate(pr, unit, true, nil).countAs(&drops, DropReconnect).keepLatest(3)
+	g.pause()
+
+	got := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 5*unit)
+		_, err := io.ReadFull(g, buf)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- buf
+	}()
+	// Frames 0 to 4 arrive while reconnecting, and frame 5 is part read
+	// before the gate is resumed.
+	for i := range 5 {
+		pw.Write(frame(i))
+	}
+	pw.Write(frame(5)[:2])
+	g.resume()
+	pw.Write(frame(5)[2:])
+	for i := 6; i < 8; i++ {
+		pw.Write(frame(i))
+	}
+
+	want := bytes.Join([][]byte{frame(3), frame(4), frame(5), frame(6), frame(7)}, nil)
+	if b := <-got; !bytes.Equal(b, want) {
+		t.Fatalf("read %v after reconnecting, want the latest three frames then live input %v", b, want)
+	}
+	if n := g.droppedSoFar(); n != 3 {
+		t.Errorf("dropped %d frames, want the 3 evicted", n)
+	}
+	if n := drops.load(DropReconnect); n != 3 {
+		t.Errorf("counted %d reconnect drops, want 3", n)
+	}
+}
@@ -0,0 +1,88 @@
+package streamer
+
+import "sync"
+
+// DropReason says why media was dropped rather than published, keying
+// Stats.DroppedVideoFrames and Stats.DroppedAudioChunks.
+type DropReason string
+
+const (
+	// DropBackpressure counts frames the producer skipped, going by the
+	// sidecar sequence numbers of Config.FrameHeaders, as a producer that
+	// drops frames on a full pipe does while the streamer is behind.
+	// Without FrameHeaders they cannot be seen and it stays zero.
+	DropBackpressure DropReason = "backpressure"
+	// DropReconnect counts raw input discarded while the room
+	// reconnected, under ReconnectInputDrop, and encoded output discarded
+	// while rejoining for Config.MaxRejoinAttempts.
+	DropReconnect DropReason = "reconnect"
+	// DropPaused counts raw input discarded while encoding was paused for
+	// Config.PauseWhenIdle, and encoded output discarded while parked.
+	DropPaused DropReason = "paused"
+	// DropEncoderStall counts the frames or chunks a stalled encoder had
+	// been given but not yet produced when it was restarted to recover.
+	DropEncoderStall DropReason = "encoder_stall"
+	// DropEncoderBacklog counts the raw frames dropped ahead of a video
+	// encoder that fell behind, under Config.EncoderBacklog.
+	DropEncoderBacklog DropReason = "encoder_backlog"
+	// DropStartup counts raw input discarded before the tracks were bound,
+	// under StartupInputDrop, and encoded output discarded while waiting
+	// out Config.VideoPublishDelay or Config.AudioPublishDelay.
+	DropStartup DropReason = "startup"
+	// DropNoParameterSets counts the encoded pictures dropped ahead of the
+	// first IDR picture whose SPS and PPS are known, which no receiver
+	// could decode.
+	DropNoParameterSets DropReason = "no_parameter_sets"
+)
+
+// dropReasons lists every DropReason, in the order they are reported.
+var dropReasons = []DropReason{DropBackpressure, DropReconnect, DropPaused, DropEncoderStall, DropEncoderBacklog, DropStartup, DropNoParameterSets}
+
+// dropCounts counts the media of one track dropped for each reason.
+type dropCounts struct {
+	mu sync.Mutex
+	n  map[DropReason]int64
+}
+
+// add counts n more drops for reason, or takes back -n.
+func (d *dropCounts) add(reason DropReason, n int64) {
+	if n == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.n == nil {
+		d.n = make(map[DropReason]int64)
+	}
+	d.n[reason] += n
+}
+
+// reset clears every count.
+func (d *dropCounts) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n = nil
+}
+
+func (d *dropCounts) load(reason DropReason) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n[reason]
+}
+
+// snapshot returns the counts of every reason, zeros included.
+func (d *dropCounts) snapshot() map[DropReason]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[DropReason]int64, len(dropReasons))
+	for _, reason := range dropReasons {
+		out[reason] = d.n[reason]
+	}
+	return out
+}
+
+// fillDropped adds the drop breakdowns to st.
+func (s *Streamer) fillDropped(st *Stats) {
+	st.DroppedVideoFrames = s.videoDrops.snapshot()
+	st.DroppedAudioChunks = s.audioDrops.snapshot()
+}
@@ -0,0 +1,117 @@
+package streamer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// Bytes at the start of a VP8 frame left in the clear by LiveKit's frame
+// encryption, so the SFU and receivers can still parse the frame tag:
+// the keyframe header, or the frame tag alone on other frames.
+const (
+	vp8KeyframeClearBytes = 10
+	vp8DeltaClearBytes    = 3
+)
+
+// e2ee reports whether the tracks are end-to-end encrypted.
+func (c *Config) e2ee() bool {
+	return c.E2EEPassphrase != "" || len(c.E2EEKey) > 0
+}
+
+// encryption is the encryption to announce on the publications.
+func (c *Config) encryption() livekit.Encryption_Type {
+	if c.e2ee() {
+		return livekit.Encryption_GCM
+	}
+	return livekit.Encryption_NONE
+}
+
+func (c *Config) validateE2EE() error {
+	if !c.e2ee() {
+		return nil
+	}
+	if c.E2EEPassphrase != "" && len(c.E2EEKey) > 0 {
+		return errors.New("set one of E2EE passphrase and E2EE key, not both")
+	}
+	if c.RequireHardware {
+		return fmt.Errorf("end-to-end encryption publishes %s, which is not hardware encoded", webrtc.MimeTypeVP8)
+	}
+	return nil
+}
+
+// e2eeCipher derives the frame key from Config.E2EEPassphrase or
+// Config.E2EEKey as the LiveKit client SDKs do from the shared key, or
+// returns nil without E2EE.
+func (s *Streamer) e2eeCipher() (cipher.Block, error) {
+	if !s.cfg.e2ee() {
+		return nil, nil
+	}
+	var key []byte
+	var err error
+	if s.cfg.E2EEPassphrase != "" {
+		key, err = lksdk.DeriveKeyFromString(s.cfg.E2EEPassphrase)
+	} else {
+		key, err = lksdk.DeriveKeyFromBytes(s.cfg.E2EEKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("deriving the E2EE key: %w", err)
+	}
+	return aes.NewCipher(key)
+}
+
+// frameEncryptor returns the trackHooks.encrypt function for a track of
+// codec mime, or nil without E2EE. Opus frames are encrypted by the SDK;
+// it has nothing for video, so VP8 frames are encrypted here in the same
+// layout, which is what the client SDKs expect of VP8. H264 frames are
+// encrypted by the clients per access unit, parameter sets and all, which
+// a track fed one NAL unit at a time cannot reproduce, so it is refused.
+func (s *Streamer) frameEncryptor(mime string) (func([]byte) ([]byte, error), error) {
+	block, err := s.e2eeCipher()
+	if err != nil || block == nil {
+		return nil, err
+	}
+	switch mime {
+	case webrtc.MimeTypeOpus:
+		return func(frame []byte) ([]byte, error) {
+			return lksdk.EncryptGCMAudioSampleCustomCipher(frame, 0, block)
+		}, nil
+	case webrtc.MimeTypeVP8:
+		return func(frame []byte) ([]byte, error) {
+			clearLen := vp8DeltaClearBytes
+			// Bit 0 of the VP8 frame tag is clear on keyframes.
+			if len(frame) > 0 && frame[0]&0x01 == 0 {
+				clearLen = vp8KeyframeClearBytes
+			}
+			return encryptGCMFrame(frame, min(clearLen, len(frame)), block)
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s tracks cannot be end-to-end encrypted", ErrInvalidConfig, mime)
+}
+
+// encryptGCMFrame is lksdk.EncryptGCMAudioSampleCustomCipher with clear
+// leading bytes in place of the one byte of an audio frame: they are
+// authenticated but not encrypted, and the IV and key index follow the
+// ciphertext.
+func encryptGCMFrame(frame []byte, clearLen int, block cipher.Block) ([]byte, error) {
+	iv := make([]byte, lksdk.LIVEKIT_IV_LENGTH)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.Join(lksdk.ErrUnableGenerateIV, err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, lksdk.LIVEKIT_IV_LENGTH)
+	if err != nil {
+		return nil, err
+	}
+	header := frame[:clearLen]
+	out := make([]byte, 0, len(frame)+gcm.Overhead()+len(iv)+2)
+	out = append(out, header...)
+	out = gcm.Seal(out, iv, frame[clearLen:], header)
+	out = append(out, iv...)
+	return append(out, lksdk.LIVEKIT_IV_LENGTH, 0), nil
+}
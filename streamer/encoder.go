@@ -0,0 +1,424 @@
+package streamer
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkFFmpeg fails with ErrFFmpegNotFound when there is no ffmpeg to run
+// the encoders with.
+func checkFFmpeg() error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("%w: %w", ErrFFmpegNotFound, err)
+	}
+	return nil
+}
+
+// videoEncoderParams describes the raw input and encoder settings of a
+// video ffmpeg process.
+type videoEncoderParams struct {
+	Width       int
+	Height      int
+	PixelFormat PixelFormat
+	FrameRate   int
+	Encoder     string
+	Settings    VideoEncoderSettings
+	Filter      string
+	// Threads is passed to software encoders as -threads; NVENC ignores it.
+	Threads int
+	// Crop, unless zero, is cut out of each frame before any other filter.
+	Crop CropRect
+	// ScaleWidth and ScaleHeight, unless zero, scale each frame after the
+	// crop and Filter.
+	ScaleWidth  int
+	ScaleHeight int
+	// AlphaPacking, if set, packs the alpha channel into the frame last.
+	AlphaPacking AlphaPacking
+	// KeyframeBurst keyframes, KeyframeBurstInterval apart, open the stream.
+	KeyframeBurst         int
+	KeyframeBurstInterval time.Duration
+	// KeyframeAt, if positive, forces a keyframe on that input frame.
+	KeyframeAt int
+	// KeyframeInterval, if positive and neither KeyframeAt nor
+	// KeyframeBurst is, forces a keyframe at each multiple of it.
+	KeyframeInterval time.Duration
+}
+
+// VP8VideoEncoder is the libvpx encoder of VP8 tracks published with
+// ReplaceVideoTrack.
+const VP8VideoEncoder = "libvpx"
+
+// videoEncoderCommand builds the ffmpeg process that encodes raw frames
+// read from stdin into an H264 Annex-B stream on stdout, or an IVF stream
+// with VP8VideoEncoder.
+func videoEncoderCommand(p videoEncoderParams) *exec.Cmd {
+	settings := p.Settings
+	args := []string{
+		"-f", "rawvideo",
+		"-pix_fmt", string(p.PixelFormat),
+		"-s", fmt.Sprintf("%dx%d", p.Width, p.Height),
+		"-r", strconv.Itoa(p.FrameRate), // Match sender's VIDEO_FPS
+		"-i", "pipe:0", // Read from stdin
+	}
+	if filter := videoFilterChain(p); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	codecArgs, format := videoCodecArgs(p)
+	args = append(args, codecArgs...)
+	args = append(args, rateControlArgs(p)...)
+	switch {
+	case p.KeyframeAt > 0:
+		args = append(args, "-force_key_frames", fmt.Sprintf("expr:eq(n,%d)", p.KeyframeAt))
+	case p.KeyframeBurst > 0:
+		args = append(args, "-force_key_frames", keyframeBurstExpr(p.KeyframeBurst, p.KeyframeBurstInterval))
+	case p.KeyframeInterval > 0:
+		args = append(args, "-force_key_frames", keyframeIntervalExpr(p.KeyframeInterval))
+	}
+	args = append(args,
+		"-g", strconv.Itoa(settings.GOP),
+		"-keyint_min", "1",
+		"-bf", strconv.Itoa(settings.BFrames),
+		"-max_delay", "0",
+		"-f", format,
+		"-")
+	return encoderCommand(args...)
+}
+
+// VideoEncoderArgs are the ffmpeg flags that select encoder, with the
+// low-latency options and default settings the streamer encodes with, for
+// callers that run ffmpeg themselves with an encoder from
+// SelectH264Encoder.
+func VideoEncoderArgs(encoder string) []string {
+	args, _ := videoCodecArgs(videoEncoderParams{Encoder: encoder, Settings: defaultVideoSettings})
+	return args
+}
+
+// videoCodecArgs selects p.Encoder with the options that tune it for low
+// latency, and returns them with the output format it is muxed as. The
+// presets and tunings of VideoEncoderSettings are NVENC's; the other
+// encoders get their own lowest-latency equivalents.
+func videoCodecArgs(p videoEncoderParams) ([]string, string) {
+	settings := p.Settings
+	args := []string{"-c:v", p.Encoder}
+	format := "h264"
+	switch p.Encoder {
+	case SoftwareVideoEncoder:
+		args = append(args, "-preset", "ultrafast", "-tune", "zerolatency")
+		if p.Threads > 0 {
+			args = append(args, "-threads", strconv.Itoa(p.Threads))
+		}
+	case QSVVideoEncoder:
+		// No lookahead, and each frame handed back as soon as it is done.
+		args = append(args, "-preset", "veryfast", "-look_ahead", "0", "-async_depth", "1")
+	case VideoToolboxVideoEncoder:
+		args = append(args, "-realtime", "1")
+	case VP8VideoEncoder:
+		// Realtime with no lookahead, and error resilient as libvpx
+		// recommends for lossy real-time links.
+		args = append(args, "-deadline", "realtime", "-cpu-used", "8", "-lag-in-frames", "0", "-error-resilient", "1")
+		if p.Threads > 0 {
+			args = append(args, "-threads", strconv.Itoa(p.Threads))
+		}
+		format = "ivf"
+	default:
+		if settings.Preset != "" {
+			args = append(args, "-preset", settings.Preset)
+		}
+		if settings.Tune != "" {
+			args = append(args, "-tune", settings.Tune)
+		}
+	}
+	if settings.H264Profile != "" && p.Encoder != VP8VideoEncoder {
+		args = append(args, "-profile:v", settings.H264Profile)
+	}
+	return args, format
+}
+
+// videoFilterChain joins the crop, user filter and scale with the
+// conversions the input format needs. The crop runs first since its
+// rectangle is in input pixels, and conversion runs last so user filters
+// see the source format; alpha packing takes the place of the conversion.
+func videoFilterChain(p videoEncoderParams) string {
+	var filters []string
+	if !p.Crop.IsZero() {
+		filters = append(filters, p.Crop.filter())
+	}
+	if p.Filter != "" {
+		filters = append(filters, p.Filter)
+	}
+	if p.ScaleWidth > 0 {
+		filters = append(filters, fmt.Sprintf("scale=%d:%d", p.ScaleWidth, p.ScaleHeight))
+	}
+	switch {
+	case p.AlphaPacking != AlphaPackingOff:
+		filters = append(filters, p.AlphaPacking.filter())
+	case p.PixelFormat.needsConversion():
+		filters = append(filters, "format=yuv420p")
+	}
+	return strings.Join(filters, ",")
+}
+
+// Opus bitrate limits for the stream we encode.
+const (
+	DefaultAudioBitrateKbps = 32
+	MinAudioBitrateKbps     = 6
+	MaxAudioBitrateKbps     = 256
+)
+
+// OpusApplication is the libopus -application mode.
+//
+// voip and audio may use the SILK layer, which is what in-band FEC is
+// carried in; lowdelay is CELT-only, so it forgoes FEC in exchange for
+// the lowest algorithmic delay. All three work with the 20 ms frames the
+// streamer encodes; lowdelay would also allow frames as short as 2.5 ms.
+type OpusApplication string
+
+const (
+	OpusVoIP     OpusApplication = "voip"     // speech intelligibility
+	OpusAudio    OpusApplication = "audio"    // music and ambient sound
+	OpusLowDelay OpusApplication = "lowdelay" // minimum latency, no FEC
+)
+
+func (a OpusApplication) validate() error {
+	switch a {
+	case OpusVoIP, OpusAudio, OpusLowDelay:
+		return nil
+	}
+	return fmt.Errorf("unknown opus application %q (want voip, audio or lowdelay)", string(a))
+}
+
+// fecArgs returns the libopus flags for in-band FEC tuned to lossPercent
+// expected packet loss, or none when lossPercent is zero.
+func fecArgs(lossPercent int) []string {
+	if lossPercent == 0 {
+		return nil
+	}
+	return []string{"-fec", "1", "-packet_loss", strconv.Itoa(lossPercent)}
+}
+
+// opusArgs returns the libopus flags for p: the bitrate and its mode, the
+// application, 20 ms frames, and in-band FEC and DTX if enabled.
+func opusArgs(p audioEncoderParams) []string {
+	vbr := "on"
+	if p.CBR {
+		vbr = "off"
+	}
+	args := []string{
+		"-b:a", fmt.Sprintf("%dk", p.BitrateKbps),
+		"-vbr", vbr,
+		"-application", string(p.Application),
+		"-frame_duration", "20",
+	}
+	args = append(args, fecArgs(p.PacketLoss)...)
+	if p.DTX {
+		args = append(args, "-dtx", "1")
+	}
+	return args
+}
+
+// opusDTXFrame reports whether packet is one a DTX encoder marks as not
+// to be sent: libopus encodes the silent frames between its comfort noise
+// updates as packets of at most two bytes.
+func opusDTXFrame(packet []byte) bool {
+	return len(packet) <= 2
+}
+
+// validateAudioFEC checks Config.AudioFECPacketLoss against the Opus
+// application, since lowdelay cannot carry FEC.
+func validateAudioFEC(lossPercent int, app OpusApplication) error {
+	if lossPercent < 0 || lossPercent > 100 {
+		return fmt.Errorf("audio FEC packet loss %d%% outside 0-100%%", lossPercent)
+	}
+	if lossPercent > 0 && app == OpusLowDelay {
+		return fmt.Errorf("audio FEC needs opus application %s or %s, not %s", OpusVoIP, OpusAudio, OpusLowDelay)
+	}
+	return nil
+}
+
+// DefaultAudioSampleRate is the rate of the raw audio input when
+// Config.AudioSampleRate is zero.
+const DefaultAudioSampleRate = 16000
+
+// audioOutputRate is the sample rate of the Opus stream.
+const audioOutputRate = 48000
+
+// validateAudioSampleRate checks that rate is one ffmpeg can take and that
+// a 20 ms chunk of it is a whole number of samples.
+func validateAudioSampleRate(rate int) error {
+	if rate < 8000 || rate > audioOutputRate || rate%50 != 0 {
+		return fmt.Errorf("audio sample rate %d Hz must be 8000-%d Hz and a multiple of 50", rate, audioOutputRate)
+	}
+	return nil
+}
+
+// validateAudioChannels checks that the input is mono or stereo, the
+// layouts a WebRTC Opus track carries.
+func validateAudioChannels(channels int) error {
+	if channels != 1 && channels != 2 {
+		return fmt.Errorf("audio channels %d must be 1 (mono) or 2 (stereo)", channels)
+	}
+	return nil
+}
+
+// AudioResampler is the ffmpeg resampler that converts the input to Opus's
+// 48 kHz. Input already at 48 kHz is not resampled at all.
+//
+// ResamplerSWR, the default, is ffmpeg's own and the cheapest. ResamplerSoxr
+// uses libsoxr, whose steeper filter keeps sibilants cleaner and avoids
+// the faint imaging alias swr leaves above 8 kHz; it needs an ffmpeg built
+// with --enable-libsoxr. For one 16 kHz mono voice soxr costs a few times
+// what swr does, still a small fraction of a core, and raising
+// Config.AudioResamplePrecision to 28 (very high quality) roughly doubles
+// that again.
+type AudioResampler string
+
+const (
+	ResamplerSWR  AudioResampler = "swr"
+	ResamplerSoxr AudioResampler = "soxr"
+)
+
+// Bounds of the soxr precision, in bits, that ffmpeg accepts.
+const (
+	MinSoxrPrecision = 15
+	MaxSoxrPrecision = 33
+)
+
+func (r AudioResampler) validate(precision int) error {
+	switch r {
+	case ResamplerSWR:
+		if precision != 0 {
+			return fmt.Errorf("resample precision only applies to the %s resampler", ResamplerSoxr)
+		}
+	case ResamplerSoxr:
+		if precision != 0 && (precision < MinSoxrPrecision || precision > MaxSoxrPrecision) {
+			return fmt.Errorf("soxr precision %d outside %d-%d bits", precision, MinSoxrPrecision, MaxSoxrPrecision)
+		}
+	default:
+		return fmt.Errorf("unknown audio resampler %q (want swr or soxr)", string(r))
+	}
+	return nil
+}
+
+// resampleFilter is the aresample filter for r, or empty when ffmpeg's
+// automatic conversion already does the job: with swr, or when the input
+// is at the output rate and there is nothing to resample.
+func (r AudioResampler) resampleFilter(precision, inputRate int) string {
+	if r != ResamplerSoxr || inputRate == audioOutputRate {
+		return ""
+	}
+	filter := fmt.Sprintf("aresample=%d:resampler=soxr", audioOutputRate)
+	if precision != 0 {
+		filter += fmt.Sprintf(":precision=%d", precision)
+	}
+	return filter
+}
+
+// audioEncoderParams describes the Opus encode of the input.
+type audioEncoderParams struct {
+	SampleRate  int // of the input
+	Channels    int // of the input and the Opus stream, 1 or 2
+	BitrateKbps int
+	CBR         bool
+	Application OpusApplication
+	Filter      string
+	Resampler   AudioResampler
+	Precision   int // soxr precision in bits, zero for ffmpeg's default
+	Format      AudioSampleFormat
+	PacketLoss  int // expected loss in percent for in-band FEC, zero for none
+	DTX         bool
+}
+
+// validateAudioBitrate checks kbps against what libopus accepts for a
+// the stream.
+func validateAudioBitrate(kbps int) error {
+	if kbps < MinAudioBitrateKbps || kbps > MaxAudioBitrateKbps {
+		return fmt.Errorf("audio bitrate %d kbps outside %d-%d kbps for Opus",
+			kbps, MinAudioBitrateKbps, MaxAudioBitrateKbps)
+	}
+	return nil
+}
+
+// resamples reports whether the encode converts the input's sample rate.
+func (p audioEncoderParams) resamples() bool {
+	return p.SampleRate != audioOutputRate
+}
+
+// audioEncoderCommand builds the ffmpeg process that encodes PCM of
+// p.Channels at p.SampleRate in p.Format read from stdin into Ogg/Opus of
+// as many channels on stdout, always at 48 kHz. Input already at 48 kHz
+// goes to the encoder without a resampling stage.
+func audioEncoderCommand(p audioEncoderParams) *exec.Cmd {
+	args := []string{
+		"-fflags", "nobuffer",
+		"-flush_packets", "1",
+		"-f", string(p.Format),
+		"-ar", strconv.Itoa(p.SampleRate),
+		"-ac", strconv.Itoa(p.Channels),
+		"-i", "pipe:0",
+	}
+	// The resampler runs after user filters, which see the input rate.
+	var filters []string
+	if p.Filter != "" {
+		filters = append(filters, p.Filter)
+	}
+	if f := p.Resampler.resampleFilter(p.Precision, p.SampleRate); f != "" {
+		filters = append(filters, f)
+	}
+	if len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+	args = append(args, "-c:a", AudioEncoder)
+	if p.resamples() {
+		args = append(args, "-ar", strconv.Itoa(audioOutputRate))
+	}
+	args = append(args, opusArgs(p)...)
+	args = append(args,
+		"-page_duration", "20000",
+		"-bufsize", "0",
+		"-f", "ogg",
+		"-")
+	return encoderCommand(args...)
+}
+
+// restrictedFilters read from or write to places other than the encoder's
+// own input and output, or take commands at runtime. They are rejected in
+// user-supplied filter strings.
+var restrictedFilters = []string{"movie", "amovie", "sendcmd", "asendcmd", "zmq", "azmq", "ffmpeg"}
+
+// validateFilter checks a user-supplied -vf/-af filtergraph. The string is
+// passed to ffmpeg as a single argument, so it cannot add flags, but it
+// must not masquerade as one or pull in other inputs.
+func validateFilter(kind, filter string) error {
+	if filter == "" {
+		return nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(filter), "-") {
+		return fmt.Errorf("%s filter %q looks like a command-line flag", kind, filter)
+	}
+	if strings.ContainsAny(filter, "\x00\n\r") {
+		return fmt.Errorf("%s filter contains control characters", kind)
+	}
+	for _, chain := range strings.FieldsFunc(filter, func(r rune) bool { return r == ',' || r == ';' }) {
+		name := strings.TrimSpace(chain)
+		// Strip leading [label] pads.
+		for strings.HasPrefix(name, "[") {
+			end := strings.Index(name, "]")
+			if end < 0 {
+				break
+			}
+			name = strings.TrimSpace(name[end+1:])
+		}
+		if i := strings.IndexAny(name, "=@["); i >= 0 {
+			name = name[:i]
+		}
+		for _, bad := range restrictedFilters {
+			if name == bad {
+				return fmt.Errorf("%s filter %q is not allowed", kind, bad)
+			}
+		}
+	}
+	return nil
+}
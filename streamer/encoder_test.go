@@ -0,0 +1,152 @@
+package streamer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAudioEncoderCommand(t *testing.T) {
+	base := audioEncoderParams{BitrateKbps: 32, Application: OpusVoIP, Format: AudioFormatS16LE}
+	opus := "-b:a 32k -vbr on -application voip -frame_duration 20 -page_duration 20000 -bufsize 0 -f ogg -"
+	for _, tt := range []struct {
+		name      string
+		rate, ch  int
+		resampler AudioResampler
+		want      string
+	}{
+		{"16 kHz mono", 16000, 1, "",
+			"-fflags nobuffer -flush_packets 1 -f s16le -ar 16000 -ac 1 -i pipe:0 " +
+				"-c:a libopus -ar 48000 " + opus},
+		{"24 kHz stereo with soxr", 24000, 2, ResamplerSoxr,
+			"-fflags nobuffer -flush_packets 1 -f s16le -ar 24000 -ac 2 -i pipe:0 " +
+				"-af aresample=48000:resampler=soxr " +
+				"-c:a libopus -ar 48000 " + opus},
+		// 48 kHz input is encoded as it is.
+		{"48 kHz stereo", 48000, 2, "",
+			"-fflags nobuffer -flush_packets 1 -f s16le -ar 48000 -ac 2 -i pipe:0 -c:a libopus " + opus},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := base
+			p.SampleRate, p.Channels, p.Resampler = tt.rate, tt.ch, tt.resampler
+			args := audioEncoderCommand(p).Args[1:]
+			// encoderCommand puts its logging flags first.
+			i := slices.Index(args, "-fflags")
+			if got := strings.Join(args[i:], " "); got != tt.want {
+				t.Errorf("args\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAudioInput(t *testing.T) {
+	for _, rate := range []int{8000, 16000, 22050, 24000, 44100, 48000} {
+		if err := validateAudioSampleRate(rate); err != nil {
+			t.Errorf("%d Hz: %v", rate, err)
+		}
+	}
+	for _, rate := range []int{0, 7999, 96000, 11025} {
+		if err := validateAudioSampleRate(rate); err == nil {
+			t.Errorf("%d Hz accepted", rate)
+		}
+	}
+	for ch, ok := range map[int]bool{0: false, 1: true, 2: true, 6: false} {
+		if err := validateAudioChannels(ch); (err == nil) != ok {
+			t.Errorf("%d channels: %v, want ok %v", ch, err, ok)
+		}
+	}
+}
+
+func TestOpusArgs(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		p    audioEncoderParams
+		want string
+	}{
+		{"default", audioEncoderParams{BitrateKbps: 32, Application: OpusVoIP},
+			"-b:a 32k -vbr on -application voip -frame_duration 20"},
+		{"cbr music", audioEncoderParams{BitrateKbps: 96, CBR: true, Application: OpusAudio},
+			"-b:a 96k -vbr off -application audio -frame_duration 20"},
+		{"fec", audioEncoderParams{BitrateKbps: 24, Application: OpusVoIP, PacketLoss: 10},
+			"-b:a 24k -vbr on -application voip -frame_duration 20 -fec 1 -packet_loss 10"},
+		{"dtx", audioEncoderParams{BitrateKbps: 32, Application: OpusVoIP, DTX: true},
+			"-b:a 32k -vbr on -application voip -frame_duration 20 -dtx 1"},
+		{"fec and dtx", audioEncoderParams{BitrateKbps: 16, Application: OpusAudio, PacketLoss: 25, DTX: true},
+			"-b:a 16k -vbr on -application audio -frame_duration 20 -fec 1 -packet_loss 25 -dtx 1"},
+		{"lowdelay", audioEncoderParams{BitrateKbps: 64, Application: OpusLowDelay},
+			"-b:a 64k -vbr on -application lowdelay -frame_duration 20"},
+	} {
+		if got := strings.Join(opusArgs(tt.p), " "); got != tt.want {
+			t.Errorf("%s: opusArgs = %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAudioFEC(t *testing.T) {
+	for _, tt := range []struct {
+		loss int
+		app  OpusApplication
+		ok   bool
+	}{
+		{0, OpusLowDelay, true},
+		{10, OpusVoIP, true},
+		{100, OpusAudio, true},
+		{10, OpusLowDelay, false},
+		{-1, OpusVoIP, false},
+		{101, OpusVoIP, false},
+	} {
+		if err := validateAudioFEC(tt.loss, tt.app); (err == nil) != tt.ok {
+			t.Errorf("validateAudioFEC(%d, %s) = %v, want ok %v", tt.loss, tt.app, err, tt.ok)
+		}
+	}
+}
+
+func TestOpusDTXFrame(t *testing.T) {
+	for _, tt := range []struct {
+		packet []byte
+		dtx    bool
+	}{
+		{nil, true},
+		{[]byte{0xf8}, true},
+		{[]byte{0xf8, 0xff}, true},
+		{[]byte{0xf8, 0xff, 0xfe}, false},
+	} {
+		if got := opusDTXFrame(tt.packet); got != tt.dtx {
+			t.Errorf("opusDTXFrame(% x) = %v, want %v", tt.packet, got, tt.dtx)
+		}
+	}
+}
+
+func TestVideoEncoderCommandKeyframePriority(t *testing.T) {
+	base := videoEncoderParams{
+		Width: 640, Height: 360, PixelFormat: PixelFormatYUV420P, FrameRate: 25,
+		Encoder: SoftwareVideoEncoder, Settings: defaultVideoSettings,
+		KeyframeInterval: 2 * time.Second,
+	}
+	burst := keyframeBurstExpr(3, DefaultKeyframeBurstInterval)
+	for _, tt := range []struct {
+		name  string
+		at    int
+		burst int
+		want  string
+	}{
+		{"interval", 0, 0, "expr:gte(t,n_forced*2)"},
+		{"burst over interval", 0, 3, burst},
+		{"at over interval", 40, 0, "expr:eq(n,40)"},
+		{"at over burst and interval", 40, 3, "expr:eq(n,40)"},
+	} {
+		p := base
+		p.KeyframeAt, p.KeyframeBurst, p.KeyframeBurstInterval = tt.at, tt.burst, DefaultKeyframeBurstInterval
+		args := videoEncoderCommand(p).Args
+		var forced []string
+		for i, arg := range args[:len(args)-1] {
+			if arg == "-force_key_frames" {
+				forced = append(forced, args[i+1])
+			}
+		}
+		if !slices.Equal(forced, []string{tt.want}) {
+			t.Errorf("%s: -force_key_frames %q, want only %q", tt.name, forced, tt.want)
+		}
+	}
+}
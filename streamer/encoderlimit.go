@@ -0,0 +1,81 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// encoderSlots bounds the video encoders running in the process, across
+// every Streamer; see SetEncoderLimit.
+var encoderSlots = &encoderLimit{freed: make(chan struct{})}
+
+type encoderLimit struct {
+	mu      sync.Mutex
+	max     int
+	wait    bool
+	running int
+	freed   chan struct{} // closed and replaced whenever a slot is freed
+}
+
+// SetEncoderLimit bounds the video ffmpeg encoders running at once across
+// every Streamer in the process to max, such as the NVENC session limit of
+// the GPU, so that running out is reported as ErrEncoderLimitReached
+// rather than as NVENC failing to open a session. Software encoders count
+// too, as a session may fall back to one or be reconfigured onto the GPU.
+// Audio encoders and the brief test encodes that probe an encoder are not
+// counted. Zero, the default, removes the limit.
+//
+// When the limit is reached, Start fails with ErrEncoderLimitReached, or
+// with wait set queues until an encoder exits or the session is stopped.
+// An encoder replacing a running one, for Reconfigure, a restart or
+// ReplaceVideoTrack, runs alongside it until it takes over, so it needs a
+// slot of its own and never waits for one: the call fails and the running
+// encoder carries on. Lowering the limit stops no running encoder.
+func SetEncoderLimit(max int, wait bool) {
+	encoderSlots.mu.Lock()
+	defer encoderSlots.mu.Unlock()
+	encoderSlots.max, encoderSlots.wait = max, wait
+	// A raised limit may admit queued starts.
+	close(encoderSlots.freed)
+	encoderSlots.freed = make(chan struct{})
+}
+
+// RunningEncoders reports the video encoders counted by SetEncoderLimit
+// that are running in the process.
+func RunningEncoders() int {
+	encoderSlots.mu.Lock()
+	defer encoderSlots.mu.Unlock()
+	return encoderSlots.running
+}
+
+// acquire takes a slot for a new encoder. A replacement never waits; any
+// other start waits for a slot in wait mode until ctx is done.
+func (l *encoderLimit) acquire(ctx context.Context, replacement bool) error {
+	for {
+		l.mu.Lock()
+		if l.max <= 0 || l.running < l.max {
+			l.running++
+			l.mu.Unlock()
+			return nil
+		}
+		running, wait, freed := l.running, l.wait && !replacement, l.freed
+		l.mu.Unlock()
+		if !wait {
+			return fmt.Errorf("%w: %d video encoders running", ErrEncoderLimitReached, running)
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: stopped while waiting for a slot", ErrEncoderLimitReached)
+		}
+	}
+}
+
+func (l *encoderLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
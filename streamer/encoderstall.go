@@ -0,0 +1,98 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// encoderStallTick is how often the encoder output watchdog checks.
+const encoderStallTick = 250 * time.Millisecond
+
+// outputWatch records when an encoder last produced output and, if input
+// is set, how many frames it had been given by then.
+type outputWatch struct {
+	last  atomic.Int64 // UnixNano of the last read that returned data
+	input func() int64
+	fed   atomic.Int64 // input at the last read that returned data
+}
+
+// reader wraps an encoder's output so that reads from it are recorded.
+func (w *outputWatch) reader(r io.ReadCloser) io.ReadCloser {
+	return &watchedReader{ReadCloser: r, watch: w}
+}
+
+// since is how long ago the encoder last produced output, measured from
+// start if it has produced none yet.
+func (w *outputWatch) since(now, start time.Time) time.Duration {
+	last := w.last.Load()
+	if last == 0 {
+		return now.Sub(start)
+	}
+	return now.Sub(time.Unix(0, last))
+}
+
+type watchedReader struct {
+	io.ReadCloser
+	watch *outputWatch
+}
+
+func (r *watchedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.watch.last.Store(time.Now().UnixNano())
+		if r.watch.input != nil {
+			r.watch.fed.Store(r.watch.input())
+		}
+	}
+	return n, err
+}
+
+// watchEncoderOutput reports the encoder of track, "Video" or "Audio", as
+// stalled when out has seen no output for Config.EncoderStallTimeout
+// although feed wrote input to it in that time: the input is flowing, so
+// the encoder, not the producer, is stuck, as when the GPU wedges. Each
+// stall is reported once, with EventEncoderStalled, a recoverable error
+// and Config.OnEncoderStall, and with Config.RestartOnEncoderStall the
+// encoder is replaced by restart. Input held back while idle or
+// reconnecting is not written, so it does not count as flowing.
+func (s *Streamer) watchEncoderOutput(track string, out *outputWatch, feed *videoFeeder, restart func(reason string)) {
+	ticker := time.NewTicker(encoderStallTick)
+	defer ticker.Stop()
+	start := time.Now()
+	stalled := false
+	for {
+		var now time.Time
+		select {
+		case <-s.ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		since := out.since(now, start)
+		lastInput := feed.lastWrite()
+		if since < s.cfg.EncoderStallTimeout || lastInput.IsZero() ||
+			now.Sub(lastInput) >= s.cfg.EncoderStallTimeout {
+			if stalled && since < s.cfg.EncoderStallTimeout {
+				s.log.infof("[%s] Encoder output resumed", track)
+				stalled = false
+			}
+			continue
+		}
+		if stalled {
+			continue
+		}
+		stalled = true
+		kind := strings.ToLower(track)
+		s.log.warnf("[%s] Encoder produced no output for %v while receiving input, encoder has stalled", track, since.Round(time.Millisecond))
+		s.emit(EventEncoderStalled, map[string]any{"track": kind, "since_last_output": since.String(), "restart": s.cfg.RestartOnEncoderStall})
+		s.reportError(fmt.Errorf("%s encoder stalled, no output for %v", kind, since.Round(time.Millisecond)), false)
+		if s.cfg.OnEncoderStall != nil {
+			s.cfg.OnEncoderStall(since)
+		}
+		if s.cfg.RestartOnEncoderStall {
+			restart("encoder stall")
+		}
+	}
+}
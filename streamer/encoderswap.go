@@ -0,0 +1,606 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// videoFeeder copies whole raw frames from the video input to the current
+// encoder's stdin. Swapping encoders hands the next frame to the new
+// process and closes the old one's stdin, so the old encoder finishes
+// every frame it was given and then exits. A tee gives an extra encoder a
+// copy of every frame until it is promoted to current or dropped, and a
+// handover does the same for a set number of frames and then swaps.
+// Replacing its input, for RepublishVideo, starts it over on frames of
+// another size for another encoder. The audio encoder is fed by one too,
+// a 20 ms chunk to the frame.
+type videoFeeder struct {
+	mu      sync.Mutex
+	in      *feederInput
+	cur     io.WriteCloser
+	next    io.WriteCloser
+	extra   io.WriteCloser
+	pending *feederHandover
+
+	written atomic.Int64 // UnixNano of the last frame written to cur
+	frames  atomic.Int64 // written to any encoder
+}
+
+func newVideoFeeder(src io.Reader, frameSize int, w io.WriteCloser) *videoFeeder {
+	return &videoFeeder{in: &feederInput{src: src, frameSize: frameSize}, cur: w}
+}
+
+// feederInput is what a videoFeeder reads, frameSize bytes to the frame.
+type feederInput struct {
+	src       io.Reader
+	frameSize int
+}
+
+// feederHandover is a pending handover: w is given a copy of every frame
+// until left reaches zero, and then becomes the destination.
+type feederHandover struct {
+	w      io.WriteCloser
+	left   int
+	onSwap func()
+	done   chan bool // receives whether the handover happened
+}
+
+// handover gives w a copy of every frame from the next one on and, once at
+// frames have been written to it, swaps to w as swap does, calling onSwap
+// first. The returned channel then receives true, or false if the
+// handover is cancelled first, by cancelHandover, swap, promote, another
+// handover or the input ending, which closes w.
+func (f *videoFeeder) handover(w io.WriteCloser, at int, onSwap func()) <-chan bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelHandoverLocked()
+	f.pending = &feederHandover{w: w, left: at, onSwap: onSwap, done: make(chan bool, 1)}
+	return f.pending.done
+}
+
+// cancelHandover cancels the handover to w if it is still pending.
+func (f *videoFeeder) cancelHandover(w io.WriteCloser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending != nil && f.pending.w == w {
+		f.cancelHandoverLocked()
+	}
+}
+
+func (f *videoFeeder) cancelHandoverLocked() {
+	if f.pending != nil {
+		f.pending.w.Close()
+		f.pending.done <- false
+		f.pending = nil
+	}
+}
+
+// swap makes w the destination from the next frame on.
+func (f *videoFeeder) swap(w io.WriteCloser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelHandoverLocked()
+	if f.next != nil {
+		f.next.Close()
+	}
+	f.next = w
+}
+
+// tee copies every frame to w as well, from the next frame on.
+func (f *videoFeeder) tee(w io.WriteCloser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.extra != nil {
+		f.extra.Close()
+	}
+	f.extra = w
+}
+
+// untee stops and closes the tee.
+func (f *videoFeeder) untee() {
+	f.tee(nil)
+}
+
+// promote swaps to the tee as if it had been passed to swap.
+func (f *videoFeeder) promote() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelHandoverLocked()
+	if f.next != nil {
+		f.next.Close()
+	}
+	f.next, f.extra = f.extra, nil
+}
+
+// replaceInput makes the feeder read frames of frameSize from src and write
+// them to w alone from now on, closing the encoder inputs it had. A frame
+// of the old input still being read when it is replaced is dropped rather
+// than written to w, as is the error the old input fails with once it is
+// closed.
+func (f *videoFeeder) replaceInput(src io.Reader, frameSize int, w io.WriteCloser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelHandoverLocked()
+	for _, old := range []io.WriteCloser{f.cur, f.next, f.extra} {
+		if old != nil {
+			old.Close()
+		}
+	}
+	f.in = &feederInput{src: src, frameSize: frameSize}
+	f.cur, f.next, f.extra = w, nil, nil
+}
+
+// replaced reports whether the input is no longer in.
+func (f *videoFeeder) replaced(in *feederInput) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.in != in
+}
+
+// lastWrite is when a frame was last written to the current encoder,
+// zero before the first.
+func (f *videoFeeder) lastWrite() time.Time {
+	if t := f.written.Load(); t != 0 {
+		return time.Unix(0, t)
+	}
+	return time.Time{}
+}
+
+// run copies frames until the input fails, then closes the encoder inputs.
+func (f *videoFeeder) run() {
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.cancelHandoverLocked()
+		f.cur.Close()
+		for _, w := range []io.WriteCloser{f.next, f.extra} {
+			if w != nil {
+				w.Close()
+			}
+		}
+	}()
+
+	var buf []byte
+	for {
+		f.mu.Lock()
+		in := f.in
+		f.mu.Unlock()
+		if len(buf) != in.frameSize {
+			buf = make([]byte, in.frameSize)
+		}
+		_, err := io.ReadFull(in.src, buf)
+		f.mu.Lock()
+		if f.in != in {
+			f.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			f.mu.Unlock()
+			return
+		}
+		if f.next != nil {
+			f.cur.Close()
+			f.cur, f.next = f.next, nil
+		}
+		w, extra, pending := f.cur, f.extra, f.pending
+		f.mu.Unlock()
+
+		if _, err := w.Write(buf); err != nil {
+			// Writing races replaceInput closing w.
+			if f.replaced(in) {
+				continue
+			}
+			return
+		}
+		f.written.Store(time.Now().UnixNano())
+		f.frames.Add(1)
+		// A failing tee is dropped; the current encoder carries on.
+		if extra != nil {
+			if _, err := extra.Write(buf); err != nil {
+				f.mu.Lock()
+				if f.extra == extra {
+					f.extra = nil
+					extra.Close()
+				}
+				f.mu.Unlock()
+			}
+		}
+		if pending != nil {
+			_, err := pending.w.Write(buf)
+			f.mu.Lock()
+			if f.pending == pending {
+				pending.left--
+				switch {
+				case err != nil:
+					f.cancelHandoverLocked()
+				case pending.left <= 0:
+					f.pending = nil
+					pending.onSwap()
+					if f.next != nil {
+						f.next.Close()
+					}
+					f.next = pending.w
+					pending.done <- true
+				}
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// spliceReader reads the encoded output of one encoder after another. When
+// the current output ends and another has been queued, reading carries on
+// from the queued one, so the track sees a single Annex-B stream in which
+// the new encoder's SPS, PPS and IDR follow the old encoder's last frame,
+// or a single Ogg stream in which the new Opus headers follow the old
+// encoder's last page.
+type spliceReader struct {
+	mu   sync.Mutex
+	cur  io.ReadCloser
+	next io.ReadCloser
+}
+
+func newSpliceReader(r io.ReadCloser) *spliceReader {
+	return &spliceReader{cur: r}
+}
+
+// queue makes r the output to continue with once the current one ends.
+func (s *spliceReader) queue(r io.ReadCloser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next != nil {
+		s.next.Close()
+	}
+	s.next = r
+}
+
+func (s *spliceReader) Read(p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		r := s.cur
+		s.mu.Unlock()
+
+		n, err := r.Read(p)
+		if !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		s.mu.Lock()
+		next := s.next
+		if next != nil {
+			s.cur.Close()
+			s.cur, s.next = next, nil
+		}
+		s.mu.Unlock()
+
+		if next == nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (s *spliceReader) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next != nil {
+		s.next.Close()
+	}
+	return s.cur.Close()
+}
+
+// startVideoEncoder starts a video ffmpeg encoding as enc describes. Its
+// stdin and stdout are plain pipes owned by the caller rather than exec's,
+// so that reaping the process never closes output the track has yet to
+// read. A positive keyframeAt forces a keyframe on that input frame, for a
+// hot swap, in place of Config.KeyframeBurst.
+func (s *Streamer) startVideoEncoder(enc EncoderConfig, replacement bool, keyframeAt int) (cmd *exec.Cmd, stdin, stdout *os.File, err error) {
+	if err := encoderSlots.acquire(s.ctx, replacement); err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			encoderSlots.release()
+		}
+	}()
+	burst := s.cfg.KeyframeBurst
+	if keyframeAt > 0 {
+		burst = 0
+	}
+	scaleWidth, scaleHeight := s.outputScale(enc.Crop)
+	cmd = videoEncoderCommand(videoEncoderParams{
+		Width:       int(s.frameWidth),
+		Height:      int(s.frameHeight),
+		PixelFormat: s.cfg.PixelFormat,
+		FrameRate:   s.cfg.FrameRate,
+		Encoder:     enc.Encoder,
+		Settings:    enc.Settings,
+		Filter:      s.cfg.VideoFilter,
+		Threads:     s.cfg.EncoderThreads,
+		Crop:        enc.Crop,
+		ScaleWidth:  scaleWidth,
+		ScaleHeight: scaleHeight,
+
+		AlphaPacking: s.cfg.AlphaPacking,
+
+		KeyframeBurst:         burst,
+		KeyframeBurstInterval: s.cfg.KeyframeBurstInterval,
+		KeyframeAt:            keyframeAt,
+		KeyframeInterval:      s.cfg.KeyframeInterval,
+	})
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("creating video encoder input: %w", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, nil, nil, fmt.Errorf("creating video encoder output: %w", err)
+	}
+	cmd.Stdin, cmd.Stdout = inR, outW
+
+	err = cmd.Start()
+	// The child has its own copies of these ends.
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, nil, nil, fmt.Errorf("starting video ffmpeg: %w", err)
+	}
+	if err := s.prioritize(cmd, "video"); err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, nil, nil, err
+	}
+	s.encoderSlots.Store(cmd, true)
+	return cmd, inW, outR, nil
+}
+
+// EncoderConfig is the part of the video encode that can change while
+// the session runs.
+type EncoderConfig struct {
+	// Encoder is one of the H264 encoders of Config.H264Encoder, or
+	// VP8VideoEncoder on a VP8 track.
+	Encoder string
+	// Settings are the resolved encoder settings; unlike
+	// Config.VideoEncoder, zero fields are not filled from a profile.
+	Settings VideoEncoderSettings
+	// Crop is the region of the raw frame to publish, zero for all of it.
+	Crop CropRect
+}
+
+// EncoderConfig reports the video encode currently in use.
+func (s *Streamer) EncoderConfig() EncoderConfig {
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	return EncoderConfig{Encoder: s.videoEncoder, Settings: s.videoSettings, Crop: s.crop}
+}
+
+// Reconfigure restarts the video ffmpeg with cfg while keeping the track,
+// its publication and the connection, so subscribers do not renegotiate.
+// The new process is fed from the next frame and its output spliced into
+// the track once the old one has drained and exited; it opens with an IDR
+// frame, so the change doubles as a forced keyframe. With
+// Config.HotSwapReconfigure the new process instead runs alongside the old
+// one and takes over at a keyframe without a gap; see hotSwapVideoEncoder.
+// A new encoder is test-encoded first, and the running one is left
+// untouched if anything fails. SetEncoder and SetCrop are shorthands for
+// common changes.
+func (s *Streamer) Reconfigure(cfg EncoderConfig) error {
+	if err := checkVideoEncoder(s.VideoCodec(), cfg.Encoder); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if err := cfg.Settings.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if !cfg.Crop.IsZero() {
+		if err := cfg.Crop.validate(s.frameWidth, s.frameHeight); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	if s.videoFeed == nil || s.ctx.Err() != nil {
+		return fmt.Errorf("%w: no video pipeline", ErrNotRunning)
+	}
+	if cfg.Encoder != s.ActiveEncoder() {
+		if err := probeVideoEncoder(s.ctx, cfg.Encoder); err != nil {
+			return fmt.Errorf("%w: %w", ErrEncoderUnavailable, err)
+		}
+	}
+	// A hot swap waits out its lead, so it runs before encMu is taken.
+	hot := s.cfg.HotSwapReconfigure && cfg != s.EncoderConfig()
+	if hot {
+		if err := s.hotSwapVideoEncoder(cfg); err != nil {
+			return err
+		}
+	}
+
+	// OnResolutionChanged runs once encMu is released, so that it may
+	// call back into the Streamer.
+	var width, height uint32
+	resized := false
+	defer func() {
+		if resized && s.cfg.OnResolutionChanged != nil {
+			s.cfg.OnResolutionChanged(width, height)
+		}
+	}()
+
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	prevWidth, prevHeight := s.videoSize()
+	prev := EncoderConfig{Encoder: s.videoEncoder, Settings: s.videoSettings, Crop: s.crop}
+	if cfg == prev {
+		return nil
+	}
+	s.videoSettings, s.crop = cfg.Settings, cfg.Crop
+	if !hot {
+		if err := s.replaceVideoEncoder(cfg.Encoder); err != nil {
+			s.videoSettings, s.crop = prev.Settings, prev.Crop
+			return err
+		}
+	}
+	s.videoEncoder, s.hardwareEncoding = cfg.Encoder, isHardwareEncoder(cfg.Encoder)
+	s.keyframes.setExpected(time.Duration(cfg.Settings.GOP) * s.cfg.frameInterval())
+
+	if cfg.Encoder != prev.Encoder {
+		s.log.infof("Switching video encoder from %s to %s", prev.Encoder, cfg.Encoder)
+		s.emit(EventEncoderSwitched, map[string]any{"from": prev.Encoder, "to": cfg.Encoder})
+	}
+	if cfg.Crop != prev.Crop {
+		s.log.infof("Video crop changed from %s to %s", prev.Crop, cfg.Crop)
+		s.emit(EventCropChanged, map[string]any{"from": prev.Crop.String(), "to": cfg.Crop.String()})
+	}
+	if cfg.Settings != prev.Settings {
+		s.log.infof("Video encoder settings changed from %+v to %+v", prev.Settings, cfg.Settings)
+		s.emit(EventEncoderReconfigured, map[string]any{"from": prev.Settings, "to": cfg.Settings})
+	}
+	if width, height = s.videoSize(); width != prevWidth || height != prevHeight {
+		s.resolutionChanged(prevWidth, prevHeight, width, height)
+		resized = true
+	}
+	return nil
+}
+
+// VideoSize reports the dimensions of the video being encoded: the output
+// size if Config.OutputWidth is set, else the crop if one is set, else the
+// raw frame, doubled by Config.AlphaPacking.
+func (s *Streamer) VideoSize() (width, height uint32) {
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	return s.videoSize()
+}
+
+// videoSize is VideoSize with encMu held.
+func (s *Streamer) videoSize() (width, height uint32) {
+	return s.cfg.AlphaPacking.packedSize(s.encodedSize(s.crop))
+}
+
+// encodedSize is the size of the colour picture encoded with crop, before
+// any alpha packing.
+func (s *Streamer) encodedSize(crop CropRect) (width, height uint32) {
+	switch {
+	case s.cfg.OutputWidth != 0:
+		return s.cfg.OutputWidth, s.cfg.OutputHeight
+	case !crop.IsZero():
+		return crop.Width, crop.Height
+	}
+	return s.frameWidth, s.frameHeight
+}
+
+// outputScale is the scale to Config.OutputWidth a frame cut to crop
+// needs, zero when it is that size already.
+func (s *Streamer) outputScale(crop CropRect) (width, height int) {
+	sourceWidth, sourceHeight := s.frameWidth, s.frameHeight
+	if !crop.IsZero() {
+		sourceWidth, sourceHeight = crop.Width, crop.Height
+	}
+	if s.cfg.OutputWidth == 0 || s.cfg.OutputWidth == sourceWidth && s.cfg.OutputHeight == sourceHeight {
+		return 0, 0
+	}
+	return int(s.cfg.OutputWidth), int(s.cfg.OutputHeight)
+}
+
+// resolutionChanged logs and emits a change in the encoded video size. The
+// server SDK offers no signal request that updates a published track's
+// dimensions; the only way to change them is to unpublish and publish a
+// new track, which would make every subscriber renegotiate and defeat
+// Reconfigure's purpose. Subscribers' decoders follow the new size from
+// the SPS of the IDR frame the new encoder opens with, so only the
+// layout hint in the track info is stale.
+func (s *Streamer) resolutionChanged(fromWidth, fromHeight, width, height uint32) {
+	s.log.warnf("Video resolution changed from %dx%d to %dx%d; the publication still advertises %dx%d",
+		fromWidth, fromHeight, width, height, s.frameWidth, s.frameHeight)
+	s.emit(EventResolutionChanged, map[string]any{
+		"from": fmt.Sprintf("%dx%d", fromWidth, fromHeight),
+		"to":   fmt.Sprintf("%dx%d", width, height),
+	})
+}
+
+// SetEncoder switches the video encoder to name, such as
+// HardwareVideoEncoder or SoftwareVideoEncoder, through Reconfigure.
+func (s *Streamer) SetEncoder(name string) error {
+	cfg := s.EncoderConfig()
+	cfg.Encoder = name
+	return s.Reconfigure(cfg)
+}
+
+// replaceVideoEncoder starts encoder with the current settings and hands
+// it the next frame while the running encoder drains and exits. The new
+// stream opens with an IDR frame. encMu must be held.
+func (s *Streamer) replaceVideoEncoder(encoder string) error {
+	cmd, stdin, stdout, err := s.startVideoEncoder(EncoderConfig{Encoder: encoder, Settings: s.videoSettings, Crop: s.crop}, true, 0)
+	if err != nil {
+		return err
+	}
+	old, oldExited := s.videoCmd, s.videoExited
+	s.retired.Store(old, true)
+
+	s.videoCmd = cmd
+	s.videoExited = s.watchProcess("video", cmd)
+	if s.videoCodec == webrtc.MimeTypeVP8 {
+		// The track's reader has had its IVF header already.
+		s.videoOut.queue(&ivfBodyReader{ReadCloser: stdout})
+	} else {
+		s.videoOut.queue(stdout)
+	}
+	s.videoFeed.swap(stdin)
+	s.reapRetired(old, oldExited)
+	return nil
+}
+
+// reapRetired waits for a replaced encoder, which exits once its input is
+// closed and it has flushed, and kills it if it takes too long.
+func (s *Streamer) reapRetired(old *exec.Cmd, exited <-chan struct{}) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		select {
+		case <-exited:
+		case <-time.After(s.cfg.EncoderStopTimeout):
+			old.Process.Kill()
+		}
+	}()
+}
+
+// checkVideoEncoder checks that encoder produces codec.
+func checkVideoEncoder(codec, encoder string) error {
+	switch codec {
+	case webrtc.MimeTypeH264:
+		switch encoder {
+		case HardwareVideoEncoder, QSVVideoEncoder, VideoToolboxVideoEncoder, SoftwareVideoEncoder:
+			return nil
+		}
+	case webrtc.MimeTypeVP8:
+		if encoder == VP8VideoEncoder {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported video codec %q", codec)
+	}
+	return fmt.Errorf("video encoder %q cannot produce %s", encoder, codec)
+}
+
+// VideoCodec reports the MIME type of the published video track.
+func (s *Streamer) VideoCodec() string {
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	return s.videoCodec
+}
+
+// ActiveEncoder reports the ffmpeg video encoder currently in use.
+func (s *Streamer) ActiveEncoder() string {
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	return s.videoEncoder
+}
@@ -0,0 +1,116 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// startTestVideoPipeline runs the video half of startEncoders for a
+// 64x48 raw input on the fake ffmpeg. Frames written to the returned
+// pipe are encoded, and the encoded stream, spliced across encoder
+// restarts, is returned on out once the input is closed.
+func startTestVideoPipeline(t *testing.T, s *Streamer) (raw *os.File, out <-chan []byte) {
+	t.Helper()
+	s.ctx, s.cancel = context.WithCancel(t.Context())
+	s.frameWidth, s.frameHeight = 64, 48
+	s.videoEncoder, s.videoSettings = SoftwareVideoEncoder, defaultVideoSettings
+
+	videoCmd, videoStdin, videoStdout, err := s.startVideoEncoder(s.EncoderConfig(), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.videoCmd = videoCmd
+	s.videoExited = s.watchProcess("video", videoCmd)
+
+	rawIn, rawOut, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.videoFeed = newVideoFeeder(rawIn, s.frameSize(), videoStdin)
+	s.videoOut = newSpliceReader(videoStdout)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.videoFeed.run()
+	}()
+
+	encoded := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(s.videoOut)
+		encoded <- data
+	}()
+	t.Cleanup(func() {
+		s.cancel()
+		rawOut.Close()
+		s.wg.Wait()
+		rawIn.Close()
+	})
+	return rawOut, encoded
+}
+
+func TestSetCropResolutionChanged(t *testing.T) {
+	var mu sync.Mutex
+	var sizes [][2]uint32
+	var events []Event
+	s := New(Config{
+		OnResolutionChanged: func(width, height uint32) {
+			mu.Lock()
+			defer mu.Unlock()
+			sizes = append(sizes, [2]uint32{width, height})
+		},
+		OnEvent: func(ev Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			if ev.Type == EventResolutionChanged {
+				events = append(events, ev)
+			}
+		},
+	})
+	raw, out := startTestVideoPipeline(t, s)
+	frame := make([]byte, s.frameSize())
+	writeFrames := func(n int) {
+		t.Helper()
+		for range n {
+			if _, err := raw.Write(frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	writeFrames(2)
+	if err := s.SetCrop(CropRect{X: 16, Y: 8, Width: 32, Height: 24}); err != nil {
+		t.Fatal(err)
+	}
+	if w, h := s.VideoSize(); w != 32 || h != 24 {
+		t.Errorf("VideoSize after crop = %dx%d, want 32x24", w, h)
+	}
+	// The same crop again changes nothing.
+	if err := s.SetCrop(CropRect{X: 16, Y: 8, Width: 32, Height: 24}); err != nil {
+		t.Fatal(err)
+	}
+	writeFrames(2)
+	if err := s.SetCrop(CropRect{}); err != nil {
+		t.Fatal(err)
+	}
+	writeFrames(2)
+	raw.Close()
+
+	// Frames queued before a restart may reach any of the encoders, but
+	// the stream must carry on into one that opens with an SPS.
+	if data := <-out; !bytes.Contains(data, []byte{0, 0, 0, 1, 0x67}) {
+		t.Errorf("encoded stream has no SPS: % x", data)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := [][2]uint32{{32, 24}, {64, 48}}; !slices.Equal(sizes, want) {
+		t.Errorf("OnResolutionChanged got %v, want %v", sizes, want)
+	}
+	if len(events) != 2 || events[0].Fields["from"] != "64x48" || events[0].Fields["to"] != "32x24" {
+		t.Errorf("resolution events %+v, want 64x48 to 32x24 and back", events)
+	}
+}
@@ -0,0 +1,133 @@
+package streamer
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// EnvFlag is a command line flag that stands in for an environment
+// variable, for LoadEnv.
+type EnvFlag struct {
+	Name, Env, Usage string
+}
+
+// RoomEnvFlags are the flags of the settings RoomFromEnv reads.
+var RoomEnvFlags = []EnvFlag{
+	{"room", "ROOM_NAME", "room to join, also the first argument"},
+	{"identity", "IDENTITY", "participant identity"},
+	{"identity-prefix", "IDENTITY_PREFIX", `prefix of the generated identity, "Avatar-" by default`},
+	{"url", "LIVEKIT_URL", "LiveKit server URL"},
+	{"api-key", "LIVEKIT_API_KEY", "LiveKit API key"},
+	{"api-secret", "LIVEKIT_API_SECRET", "LiveKit API secret"},
+}
+
+// LoadEnv defines flags on fset, parses args, the command line without the
+// program name, and sets every flag given in the environment, so that it
+// wins over both the environment and envFile. One argument may follow the
+// flags, the room name, which -room overrides. envFile, a file of
+// KEY=value lines such as .env.local, is then loaded for the variables set
+// in neither; it may be absent when LIVEKIT_CREDENTIALS_FILE supplies the
+// secrets.
+func LoadEnv(fset *flag.FlagSet, flags []EnvFlag, args []string, envFile string) error {
+	values := make(map[string]*string, len(flags))
+	for _, f := range flags {
+		values[f.Name] = fset.String(f.Name, "", f.Usage+" ($"+f.Env+")")
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments after the room name: %q", fset.Args()[1:])
+	}
+	if room := fset.Arg(0); room != "" {
+		v, ok := values["room"]
+		if !ok {
+			return fmt.Errorf("unexpected argument %q", room)
+		}
+		if *v == "" {
+			*v = room
+		}
+	}
+	for _, f := range flags {
+		if v := *values[f.Name]; v != "" {
+			os.Setenv(f.Env, v)
+		}
+	}
+	if err := godotenv.Load(envFile); err != nil && (os.Getenv("LIVEKIT_CREDENTIALS_FILE") == "" || !errors.Is(err, fs.ErrNotExist)) {
+		return fmt.Errorf("loading %s: %w", envFile, err)
+	}
+	return nil
+}
+
+// RoomSettings are the settings of the room to join, as RoomFromEnv reads
+// them. They are the Config fields of the same names.
+type RoomSettings struct {
+	URL, APIKey, APISecret string
+	CredentialsFile        string
+	RoomName               string
+	Identity               string
+	IdentityFunc           func() (string, error)
+}
+
+// RoomFromEnv reads the room settings from the environment: ROOM_NAME,
+// LIVEKIT_URL, LIVEKIT_API_KEY and LIVEKIT_API_SECRET, which are required
+// unless LIVEKIT_CREDENTIALS_FILE names a file to read the last three
+// from, IDENTITY, and IDENTITY_PREFIX, which replaces "Avatar-" ahead of
+// a generated identity. Every missing setting is reported in the one
+// error.
+func RoomFromEnv() (RoomSettings, error) {
+	r := RoomSettings{
+		URL:             os.Getenv(CredentialURLKey),
+		APIKey:          os.Getenv(CredentialAPIKeyKey),
+		APISecret:       os.Getenv(CredentialAPISecretKey),
+		CredentialsFile: os.Getenv("LIVEKIT_CREDENTIALS_FILE"),
+		RoomName:        os.Getenv("ROOM_NAME"),
+		Identity:        os.Getenv("IDENTITY"),
+	}
+	if prefix := os.Getenv("IDENTITY_PREFIX"); prefix != "" {
+		r.IdentityFunc = PrefixedIdentity(prefix)
+	}
+	var errs []error
+	if r.RoomName == "" {
+		errs = append(errs, errors.New("no room: pass it as the first argument, -room or ROOM_NAME"))
+	}
+	if r.CredentialsFile == "" {
+		for _, name := range []string{CredentialURLKey, CredentialAPIKeyKey, CredentialAPISecretKey} {
+			if os.Getenv(name) == "" {
+				errs = append(errs, fmt.Errorf("%s is not set, and no LIVEKIT_CREDENTIALS_FILE is", name))
+			}
+		}
+	}
+	return r, errors.Join(errs...)
+}
+
+// Connection returns the connection settings, those CredentialsFile sets
+// taking precedence, for a caller that joins the room itself rather than
+// through a Streamer.
+func (r RoomSettings) Connection() (url, apiKey, apiSecret string, err error) {
+	url, apiKey, apiSecret = r.URL, r.APIKey, r.APISecret
+	if r.CredentialsFile == "" {
+		return url, apiKey, apiSecret, nil
+	}
+	fileURL, fileKey, fileSecret, err := readCredentials(r.CredentialsFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	return cmp.Or(fileURL, url), cmp.Or(fileKey, apiKey), cmp.Or(fileSecret, apiSecret), nil
+}
+
+// ParticipantIdentity picks the identity to join as, as a Streamer does:
+// Identity, then one from IdentityFunc, then DefaultIdentity.
+func (r RoomSettings) ParticipantIdentity() (string, error) {
+	c := Config{Identity: r.Identity, IdentityFunc: r.IdentityFunc}
+	if err := c.resolveIdentity(); err != nil {
+		return "", err
+	}
+	return c.Identity, nil
+}
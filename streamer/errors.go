@@ -0,0 +1,53 @@
+package streamer
+
+import "errors"
+
+// Errors returned by Start, SetEncoder and the other Streamer methods wrap
+// one of the sentinels below, so callers can tell failure categories apart
+// with errors.Is:
+//
+//   - ErrInvalidConfig: the Config was rejected before anything started.
+//   - ErrFFmpegNotFound: no ffmpeg binary on PATH.
+//   - ErrEncoderUnavailable: the requested video encoder cannot encode on
+//     this machine, e.g. NVENC with RequireHardware set.
+//   - ErrEncoderLimitReached: SetEncoderLimit's video encoders are all
+//     running in the process.
+//   - ErrConnectFailed: the room could not be joined. ErrConnectTimeout is
+//     additionally wrapped when Config.ConnectTimeout elapsed.
+//   - ErrProducerTimeout: the producer did not open the pipes or connect to
+//     the input socket within Config.PipeOpenTimeout.
+//   - ErrStartupTimeout: Start did not finish within Config.StartupTimeout.
+//     The message names the StartupStage that was pending, and the stage's
+//     own failure is wrapped too.
+//   - ErrBadHeader: the video header was malformed, incomplete or out of
+//     bounds. For the first two, errors.As with *HeaderError gives the
+//     bytes received.
+//   - ErrCodecNotAllowed: the room does not allow a codec the streamer
+//     publishes; the message lists the codecs it does allow.
+//   - ErrPublishFailed: a track could not be published.
+//   - ErrNotRunning: the method needs a running session.
+//
+// Run returns ErrEncoderExited when an ffmpeg process exits mid-session,
+// quoting the last lines it wrote to stderr. It also returns
+// ErrEncoderFailed once the video encoder has been restarted
+// Config.EncoderRestartLimit times within Config.EncoderRestartWindow and
+// stalled again, and ErrDisconnected once the connection is lost for good
+// and Config.MaxRejoinAttempts rejoins have failed.
+//
+// ErrMaxSessionDuration is not returned but is the context cause when
+// Config.MaxSessionDuration ends a session.
+var (
+	ErrInvalidConfig       = errors.New("invalid config")
+	ErrFFmpegNotFound      = errors.New("ffmpeg not found")
+	ErrEncoderUnavailable  = errors.New("video encoder unavailable")
+	ErrEncoderLimitReached = errors.New("video encoder limit reached")
+	ErrConnectFailed       = errors.New("could not join room")
+	ErrProducerTimeout     = errors.New("timed out waiting for producer")
+	ErrStartupTimeout      = errors.New("startup timed out")
+	ErrCodecNotAllowed     = errors.New("codec not allowed in room")
+	ErrPublishFailed       = errors.New("could not publish track")
+	ErrNotRunning          = errors.New("streamer is not running")
+	ErrEncoderFailed       = errors.New("video encoder keeps failing")
+	ErrEncoderExited       = errors.New("encoder exited")
+	ErrDisconnected        = errors.New("disconnected from room")
+)
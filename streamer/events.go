@@ -0,0 +1,107 @@
+package streamer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventType names an entry in the session timeline.
+type EventType string
+
+const (
+	EventConnected           EventType = "connected"
+	EventReconnecting        EventType = "reconnecting"
+	EventReconnected         EventType = "reconnected"
+	EventParked              EventType = "parked"
+	EventRejoined            EventType = "rejoined"
+	EventDisconnected        EventType = "disconnected"
+	EventPublished           EventType = "published"
+	EventParticipantJoined   EventType = "participant_joined"
+	EventParticipantLeft     EventType = "participant_left"
+	EventKeyframeRequested   EventType = "keyframe_requested"
+	EventKeyframeOverdue     EventType = "keyframe_overdue"
+	EventVideoStalled        EventType = "video_stalled"
+	EventEncoderStalled      EventType = "encoder_stalled"
+	EventEncoderBreakerOpen  EventType = "encoder_breaker_open"
+	EventVideoBehind         EventType = "video_behind"
+	EventFallbackShown       EventType = "fallback_shown"
+	EventFallbackCleared     EventType = "fallback_cleared"
+	EventEncodingPaused      EventType = "encoding_paused"
+	EventEncodingResumed     EventType = "encoding_resumed"
+	EventSourceSwitched      EventType = "source_switched"
+	EventEncoderSwitched     EventType = "encoder_switched"
+	EventGOPChanged          EventType = "gop_changed"
+	EventCropChanged         EventType = "crop_changed"
+	EventResolutionChanged   EventType = "resolution_changed"
+	EventEncoderReconfigured EventType = "encoder_reconfigured"
+	EventTrackReplaced       EventType = "track_replaced"
+	EventVideoRepublished    EventType = "video_republished"
+	EventMaxDuration         EventType = "max_duration_reached"
+	EventSubscriptionFailed  EventType = "subscription_failed"
+	EventError               EventType = "error"
+	EventShutdown            EventType = "shutdown"
+)
+
+// Event is one entry in the session timeline. Fields carries the details
+// specific to Type, such as the participant identity for joins.
+type Event struct {
+	Time   time.Time      `json:"time"`
+	Type   EventType      `json:"type"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// eventLog appends events to a file, one JSON object per line.
+type eventLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	log logger
+}
+
+func openEventLog(path string, log logger) (*eventLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening event log: %w", err)
+	}
+	return &eventLog{f: f, enc: json.NewEncoder(f), log: log}, nil
+}
+
+func (l *eventLog) write(ev Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	if err := l.enc.Encode(ev); err != nil {
+		l.log.errorf("Writing event log: %v", err)
+	}
+}
+
+func (l *eventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// emit records an event in the timeline: it is passed to Config.OnEvent and
+// appended to the event log, if either is configured.
+func (s *Streamer) emit(t EventType, fields map[string]any) {
+	if s.cfg.OnEvent == nil && s.events == nil {
+		return
+	}
+	ev := Event{Time: time.Now(), Type: t, Fields: fields}
+	if s.cfg.OnEvent != nil {
+		s.cfg.OnEvent(ev)
+	}
+	if s.events != nil {
+		s.events.write(ev)
+	}
+}
@@ -0,0 +1,149 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultFallbackAfter is how long the video input may go without a frame
+// before Config.FallbackImage is shown, when Config.FallbackAfter is zero.
+const DefaultFallbackAfter = time.Second
+
+// decodeFallbackImage converts Config.FallbackImage into one raw frame in
+// the session's dimensions and pixel format.
+func (s *Streamer) decodeFallbackImage() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, probeTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-i", s.cfg.FallbackImage,
+		"-vf", fmt.Sprintf("scale=%d:%d", s.frameWidth, s.frameHeight),
+		"-pix_fmt", string(s.cfg.PixelFormat),
+		"-frames:v", "1",
+		"-f", "rawvideo", "pipe:1")
+	cmd.Stderr = &stderr
+	frame, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("decoding fallback image %s: %w: %s", s.cfg.FallbackImage, err, strings.TrimSpace(stderr.String()))
+	}
+	if len(frame) != s.frameSize() {
+		return nil, fmt.Errorf("fallback image %s decoded to %d bytes, want %d", s.cfg.FallbackImage, len(frame), s.frameSize())
+	}
+	return frame, nil
+}
+
+// fallbackReader watches the video input and, once it has gone without a
+// frame for after, repeats a placeholder frame every interval until the
+// input delivers again. The input is read by its own goroutine so a
+// producer blocked mid-write cannot hold up the placeholder.
+type fallbackReader struct {
+	frames chan []byte // whole frames read from the input
+	free   chan []byte // buffers for the input goroutine to fill
+	err    error       // why the input ended, once frames is closed
+
+	image    []byte
+	after    time.Duration
+	interval time.Duration
+	paused   func() bool // input deliberately held back, not stalled
+	onChange func(showing bool)
+
+	showing bool
+	cur     []byte // rest of the frame being read out
+	buf     []byte // input buffer cur is in, or nil for the image
+}
+
+func newFallbackReader(src io.Reader, frameSize int, image []byte, after, interval time.Duration, paused func() bool, onChange func(bool)) *fallbackReader {
+	f := &fallbackReader{
+		frames:   make(chan []byte),
+		free:     make(chan []byte, 2),
+		image:    image,
+		after:    after,
+		interval: interval,
+		paused:   paused,
+		onChange: onChange,
+	}
+	for range cap(f.free) {
+		f.free <- make([]byte, frameSize)
+	}
+	go func() {
+		defer close(f.frames)
+		for buf := range f.free {
+			if _, err := io.ReadFull(src, buf); err != nil {
+				f.err = err
+				return
+			}
+			f.frames <- buf
+		}
+	}()
+	return f
+}
+
+func (f *fallbackReader) Read(p []byte) (int, error) {
+	if len(f.cur) == 0 {
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.cur)
+	f.cur = f.cur[n:]
+	if len(f.cur) == 0 && f.buf != nil {
+		f.free <- f.buf
+		f.buf = nil
+	}
+	return n, nil
+}
+
+// next selects the frame to read out: the next input frame, or the
+// placeholder if none arrives in time.
+func (f *fallbackReader) next() error {
+	wait := f.after
+	if f.showing {
+		wait = f.interval
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case buf, ok := <-f.frames:
+			if !ok {
+				return f.err
+			}
+			if f.showing {
+				f.showing = false
+				f.onChange(false)
+			}
+			f.cur, f.buf = buf, buf
+			return nil
+		case <-timer.C:
+			if f.paused() {
+				timer.Reset(f.after)
+				continue
+			}
+			if !f.showing {
+				f.showing = true
+				f.onChange(true)
+			}
+			f.cur = f.image
+			return nil
+		}
+	}
+}
+
+// fallbackChanged logs and reports a switch between the live input and
+// Config.FallbackImage, and requests a keyframe so the new picture is
+// clean for every viewer.
+func (s *Streamer) fallbackChanged(showing bool) {
+	if showing {
+		s.log.warnf("[Video] No input frame for %v, showing fallback image %s", s.cfg.FallbackAfter, s.cfg.FallbackImage)
+		s.emit(EventFallbackShown, map[string]any{"image": s.cfg.FallbackImage})
+	} else {
+		s.log.infof("[Video] Input resumed, leaving fallback image")
+		s.emit(EventFallbackCleared, nil)
+	}
+	s.RequestKeyframe("fallback image")
+}
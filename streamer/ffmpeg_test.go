@@ -0,0 +1,145 @@
+package streamer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeFFmpegEnv configures the fake ffmpeg the tests run, a comma-separated
+// list of:
+//
+//	fail=ENCODER  the test encode with ENCODER fails
+//	stall         encoders read their input but put nothing out
+const fakeFFmpegEnv = "STREAMER_TEST_FFMPEG"
+
+// TestMain puts a fake ffmpeg first on PATH, the test binary itself under
+// that name, so that the tests run the encode paths without a real ffmpeg
+// and with output they can check. Run as ffmpeg, the binary is the fake.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "ffmpeg" {
+		os.Exit(fakeFFmpeg(os.Args[1:]))
+	}
+	dir, err := os.MkdirTemp("", "streamer-test-ffmpeg")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	exe, err := os.Executable()
+	if err == nil {
+		err = os.Symlink(exe, filepath.Join(dir, "ffmpeg"))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	// A race-enabled fake otherwise sleeps a second on exit, which each
+	// probe of an encoder waits out.
+	os.Setenv("GORACE", strings.TrimSpace(os.Getenv("GORACE")+" atexit_sleep_ms=0"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setFakeFFmpeg sets the options of the fake ffmpeg for the rest of t.
+func setFakeFFmpeg(t *testing.T, opts ...string) {
+	t.Setenv(fakeFFmpegEnv, strings.Join(opts, ","))
+}
+
+// fakeEndOfStream is the unit the fake ffmpeg flushes on SIGTERM, an H264
+// end of stream NAL unit.
+var fakeEndOfStream = []byte{0, 0, 0, 1, 0x0b}
+
+// fakeFFmpeg is the fake ffmpeg's main. It lists the encoders the streamer
+// can use, passes their test encodes, and encodes raw video into fake
+// H264: SPS, PPS and an IDR slice every -g frames and a non-IDR slice for
+// the others, each slice carrying the frame index in decimal. Audio is
+// read and dropped. At the end of its input, or on SIGTERM with exit
+// status 255, it flushes, as ffmpeg does, writing fakeEndOfStream.
+func fakeFFmpeg(args []string) int {
+	opts := strings.Split(os.Getenv(fakeFFmpegEnv), ",")
+	arg := func(name string) string {
+		if i := slices.Index(args, name); i >= 0 && i+1 < len(args) {
+			return args[i+1]
+		}
+		return ""
+	}
+	// A write to a closed stdout fails rather than killing the process, so
+	// that it can be reported as ffmpeg does.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE)
+	write := func(b []byte) bool {
+		if _, err := os.Stdout.Write(b); err != nil {
+			fmt.Fprintf(os.Stderr, "av_interleaved_write_frame(): Broken pipe\n")
+			return false
+		}
+		return true
+	}
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM)
+	go func() {
+		<-term
+		if !write(fakeEndOfStream) {
+			os.Exit(1)
+		}
+		os.Exit(255)
+	}()
+
+	switch {
+	case slices.Contains(args, "-encoders"):
+		fmt.Println("Encoders:\n V..... = Video\n A..... = Audio\n ------")
+		for _, enc := range knownEncoders {
+			fmt.Printf(" %s....D %-20s fake %s\n", strings.ToUpper(enc.Kind[:1]), enc.Name, enc.Name)
+		}
+		return 0
+	case arg("-f") == "lavfi":
+		encoder := arg("-c:v") + arg("-c:a")
+		if slices.Contains(opts, "fail="+encoder) {
+			fmt.Fprintf(os.Stderr, "Cannot load %s\n", encoder)
+			return 1
+		}
+		return 0
+	case arg("-c:a") != "" || slices.Contains(opts, "stall"):
+		io.Copy(io.Discard, os.Stdin)
+		return 0
+	}
+
+	var width, height int
+	if _, err := fmt.Sscanf(arg("-s"), "%dx%d", &width, &height); err != nil {
+		fmt.Fprintf(os.Stderr, "bad -s %q\n", arg("-s"))
+		return 1
+	}
+	gop := 25
+	if g, err := strconv.Atoi(arg("-g")); err == nil && g > 0 {
+		gop = g
+	}
+	frame := make([]byte, PixelFormat(arg("-pix_fmt")).frameSize(width, height))
+	in := bufio.NewReader(os.Stdin)
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(in, frame); err != nil {
+			if !write(fakeEndOfStream) {
+				return 1
+			}
+			return 0
+		}
+		var out []byte
+		slice := byte(0x41)
+		if i%gop == 0 {
+			out = append(out, 0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xce)
+			slice = 0x65
+		}
+		out = append(out, 0, 0, 0, 1, slice, 0x80)
+		out = strconv.AppendInt(out, int64(i), 10)
+		if !write(out) {
+			return 1
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package streamer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fifoWriterGrace is how long after the pipes open the streamer checks
+// that a producer still holds their write ends.
+const fifoWriterGrace = 5 * time.Second
+
+// createFIFO makes a FIFO at path. A FIFO that already exists there, left
+// behind by an earlier run or made concurrently by another instance, is
+// reused; anything else at path is an error rather than being replaced.
+// reused reports which happened.
+func createFIFO(path string) (reused bool, err error) {
+	err = syscall.Mkfifo(path, 0666)
+	if !errors.Is(err, syscall.EEXIST) {
+		return false, err
+	}
+	fi, statErr := os.Lstat(path)
+	if statErr != nil {
+		return false, fmt.Errorf("checking existing %s: %w", path, statErr)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return false, fmt.Errorf("%s already exists and is not a FIFO", path)
+	}
+	return true, nil
+}
+
+// openFIFOs opens the read end of every path concurrently. Opening a FIFO
+// for reading blocks until a writer opens it, so opening them one after
+// another deadlocks against a producer that opens them in a different
+// order. timeout bounds the wait for all of them together; zero waits
+// until ctx is done.
+func openFIFOs(ctx context.Context, timeout time.Duration, paths ...string) ([]*os.File, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		i   int
+		f   *os.File
+		err error
+	}
+	results := make(chan result, len(paths))
+	for i, path := range paths {
+		go func() {
+			f, err := os.OpenFile(path, os.O_RDONLY, 0666)
+			results <- result{i, f, err}
+		}()
+	}
+
+	files := make([]*os.File, len(paths))
+	var firstErr error
+	for remaining := len(paths); remaining > 0; remaining-- {
+		select {
+		case r := <-results:
+			if r.err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("opening %s: %w", paths[r.i], r.err)
+			}
+			files[r.i] = r.f
+			continue
+		case <-ctx.Done():
+		}
+
+		// Release the opens that are still waiting for a writer so their
+		// goroutines exit, then collect them.
+		if firstErr == nil {
+			firstErr = fmt.Errorf("waiting for producer to open pipes: %w", producerWaitError(ctx))
+		}
+		for i, f := range files {
+			if f == nil {
+				unblockFIFO(paths[i])
+			}
+		}
+		for ; remaining > 0; remaining-- {
+			r := <-results
+			files[r.i] = r.f
+		}
+	}
+
+	if firstErr != nil {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+		return nil, firstErr
+	}
+	return files, nil
+}
+
+// producerWaitError describes why ctx ended a wait for the producer. It is
+// ErrProducerTimeout when the wait's own timeout elapsed, rather than the
+// session ending.
+func producerWaitError(ctx context.Context) error {
+	if context.Cause(ctx) == context.DeadlineExceeded {
+		return ErrProducerTimeout
+	}
+	return ctx.Err()
+}
+
+// unblockFIFO briefly opens the write end of path, which completes any
+// open of the read end that is waiting for a writer.
+func unblockFIFO(path string) {
+	fd, err := syscall.Open(path, syscall.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err == nil {
+		syscall.Close(fd)
+	}
+}
+
+// fifoHasWriter reports whether a process other than this one has path
+// open for writing, by looking through /proc for its descriptors. Only
+// processes the streamer may inspect are seen, which are those of the
+// same user unless it runs as root; an error means /proc is unavailable.
+func fifoHasWriter(path string) (bool, error) {
+	fifo, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, err
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil || p.Name() == self {
+			continue
+		}
+		dir := filepath.Join("/proc", p.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			fi, err := os.Stat(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !os.SameFile(fi, fifo) {
+				continue
+			}
+			if fdWritable(filepath.Join(dir, "fdinfo", fd.Name())) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// fdWritable reports whether the descriptor described by the fdinfo file
+// was opened for writing.
+func fdWritable(fdinfo string) bool {
+	f, err := os.Open(fdinfo)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		v, ok := strings.CutPrefix(sc.Text(), "flags:")
+		if !ok {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(v), 8, 64)
+		if err != nil {
+			return false
+		}
+		mode := flags & syscall.O_ACCMODE
+		return mode == syscall.O_WRONLY || mode == syscall.O_RDWR
+	}
+	return false
+}
+
+// inputPipe is the raw input pipe of one track.
+type inputPipe struct {
+	kind, path string
+}
+
+// pipes lists the input pipes of the tracks streamed, without the one
+// DisableVideo or DisableAudio leaves out.
+func (s *Streamer) pipes() []inputPipe {
+	var pipes []inputPipe
+	if !s.cfg.DisableVideo && s.cfg.VideoInput == nil {
+		pipes = append(pipes, inputPipe{"video", s.cfg.VideoPipePath})
+	}
+	if !s.cfg.DisableAudio && s.cfg.AudioInput == nil {
+		pipes = append(pipes, inputPipe{"audio", s.cfg.AudioPipePath})
+	}
+	return pipes
+}
+
+// checkFIFOWriters warns, fifoWriterGrace after the pipes opened, about a
+// pipe no producer holds for writing. An open read end only proves a
+// writer opened it once; with no writer left the producer has exited or
+// crashed and the input will read as ended, whereas a writer that is
+// present but silent is a producer that has not started sending.
+func (s *Streamer) checkFIFOWriters() {
+	select {
+	case <-s.ctx.Done():
+		return
+	case <-time.After(fifoWriterGrace):
+	}
+	for _, pipe := range s.pipes() {
+		ok, err := fifoHasWriter(pipe.path)
+		switch {
+		case err != nil:
+			s.log.warnf("Cannot check for a writer on the %s pipe: %v", pipe.kind, err)
+			return
+		case !ok:
+			s.log.warnf("No process has the %s pipe %s open for writing %v after it opened; the producer appears to have exited", pipe.kind, pipe.path, fifoWriterGrace)
+		}
+	}
+}
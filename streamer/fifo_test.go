@@ -0,0 +1,100 @@
+package streamer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeTestFIFOs creates a FIFO for each name in a temporary directory.
+func makeTestFIFOs(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err := createFIFO(path); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestCreateFIFOExisting(t *testing.T) {
+	path := makeTestFIFOs(t, "video")[0]
+	if reused, err := createFIFO(path); err != nil || !reused {
+		t.Errorf("createFIFO on an existing FIFO = %v, %v, want it reused", reused, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "video")
+	if err := os.WriteFile(file, []byte("frames"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := createFIFO(file)
+	if err == nil || !strings.Contains(err.Error(), "not a FIFO") {
+		t.Fatalf("createFIFO on a regular file = %v, want a not-a-FIFO error", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "frames" {
+		t.Errorf("regular file changed to %q", data)
+	}
+}
+
+func TestOpenFIFOsReversedOrder(t *testing.T) {
+	paths := makeTestFIFOs(t, "video", "audio")
+	// The producer opens the audio pipe first and only then the video
+	// pipe, the reverse of the order openFIFOs is given them in.
+	written := make(chan error, 1)
+	go func() {
+		var files []*os.File
+		defer func() {
+			for _, f := range files {
+				f.Close()
+			}
+		}()
+		for _, path := range []string{paths[1], paths[0]} {
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				written <- err
+				return
+			}
+			files = append(files, f)
+			if _, err := f.Write([]byte(filepath.Base(path))); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+
+	files, err := openFIFOs(t.Context(), 5*time.Second, paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range files {
+		defer f.Close()
+		want := filepath.Base(paths[i])
+		buf := make([]byte, len(want))
+		if _, err := f.Read(buf); err != nil || string(buf) != want {
+			t.Errorf("read %q, %v from the %s pipe", buf, err, want)
+		}
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenFIFOsTimeout(t *testing.T) {
+	paths := makeTestFIFOs(t, "video", "audio")
+	start := time.Now()
+	_, err := openFIFOs(t.Context(), 100*time.Millisecond, paths...)
+	if !errors.Is(err, ErrProducerTimeout) {
+		t.Fatalf("openFIFOs with no producer = %v, want ErrProducerTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timed out after %v, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,51 @@
+package streamer
+
+// frameBuffer keeps the most recent whole units of raw input, frames for
+// video and 20 ms chunks for audio, up to max of them. It is filled by a
+// paused inputGate under Config.ReconnectBuffer and read back, oldest
+// first, once the gate is resumed. It is only used from the goroutine
+// reading the gate, so it needs no lock.
+type frameBuffer struct {
+	max   int
+	units [][]byte
+	free  [][]byte // evicted and replayed units, reused by push
+	off   int      // bytes of units[0] already read
+}
+
+func newFrameBuffer(max int) *frameBuffer {
+	return &frameBuffer{max: max}
+}
+
+// push keeps a copy of unit, evicting the oldest unit once full, and
+// reports whether it did.
+func (b *frameBuffer) push(unit []byte) (evicted bool) {
+	var kept []byte
+	if n := len(b.free); n > 0 {
+		kept, b.free = b.free[n-1], b.free[:n-1]
+	} else {
+		kept = make([]byte, len(unit))
+	}
+	copy(kept, unit)
+	if len(b.units) == b.max {
+		b.free = append(b.free, b.units[0])
+		b.units = b.units[1:]
+		evicted = true
+	}
+	b.units = append(b.units, kept)
+	return evicted
+}
+
+// read copies from the oldest unit into p, moving on to the next unit
+// once it has all been read, and returns the number of bytes copied.
+func (b *frameBuffer) read(p []byte) int {
+	n := copy(p, b.units[0][b.off:])
+	b.off += n
+	if b.off == len(b.units[0]) {
+		b.free = append(b.free, b.units[0])
+		b.units = b.units[1:]
+		b.off = 0
+	}
+	return n
+}
+
+func (b *frameBuffer) len() int { return len(b.units) }
@@ -0,0 +1,104 @@
+package streamer
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// frameQueue reads whole raw frames from src as they arrive into a queue
+// of at most limit frames, for Config.EncoderBacklog, and hands them to its
+// reader in order. While the reader, the video encoder's feeder, falls
+// behind and the queue is full, each new frame drops the oldest queued
+// one, so the frames waiting for the encoder never cover more than limit
+// frame intervals.
+type frameQueue struct {
+	src       io.Reader
+	frameSize int
+	limit     int
+	onDrop    func()
+
+	mu      sync.Mutex
+	ready   *sync.Cond // signalled when frames or err change
+	frames  [][]byte   // oldest first
+	free    [][]byte   // buffers to reuse
+	err     error      // from src, returned once the queue is empty
+	dropped atomic.Int64
+
+	cur []byte // the rest of the frame being read out
+	buf []byte // cur's buffer, freed once it is read out
+}
+
+func newFrameQueue(src io.Reader, frameSize, limit int, onDrop func()) *frameQueue {
+	q := &frameQueue{src: src, frameSize: frameSize, limit: limit, onDrop: onDrop}
+	q.ready = sync.NewCond(&q.mu)
+	return q
+}
+
+// run fills the queue until src fails.
+func (q *frameQueue) run() {
+	for {
+		q.mu.Lock()
+		var buf []byte
+		if n := len(q.free); n > 0 {
+			buf, q.free = q.free[n-1], q.free[:n-1]
+		} else {
+			buf = make([]byte, q.frameSize)
+		}
+		q.mu.Unlock()
+
+		_, err := io.ReadFull(q.src, buf)
+
+		q.mu.Lock()
+		if err != nil {
+			q.err = err
+			q.ready.Broadcast()
+			q.mu.Unlock()
+			return
+		}
+		dropped := len(q.frames) >= q.limit
+		if dropped {
+			q.free = append(q.free, q.frames[0])
+			q.frames = q.frames[1:]
+			q.dropped.Add(1)
+		}
+		q.frames = append(q.frames, buf)
+		q.ready.Signal()
+		q.mu.Unlock()
+		if dropped && q.onDrop != nil {
+			q.onDrop()
+		}
+	}
+}
+
+func (q *frameQueue) Read(p []byte) (int, error) {
+	if len(q.cur) == 0 {
+		q.mu.Lock()
+		if q.buf != nil {
+			q.free = append(q.free, q.buf)
+			q.buf = nil
+		}
+		for len(q.frames) == 0 && q.err == nil {
+			q.ready.Wait()
+		}
+		if len(q.frames) == 0 {
+			err := q.err
+			q.mu.Unlock()
+			return 0, err
+		}
+		q.buf = q.frames[0]
+		q.frames = q.frames[1:]
+		q.mu.Unlock()
+		q.cur = q.buf
+	}
+	n := copy(p, q.cur)
+	q.cur = q.cur[n:]
+	return n, nil
+}
+
+// depth is how many whole frames are queued for the encoder.
+func (q *frameQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.frames)
+}
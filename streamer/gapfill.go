@@ -0,0 +1,185 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GapFill selects what is published while the raw input has a brief gap;
+// see Config.GapFill.
+type GapFill string
+
+const (
+	GapFillOff   GapFill = ""      // publish nothing until the input resumes
+	GapFillHold  GapFill = "hold"  // repeat the last video frame
+	GapFillBlack GapFill = "black" // publish black video frames
+)
+
+// DefaultGapFillAfter is how long an input may go without data before
+// Config.GapFill starts filling, when Config.GapFillAfter is zero.
+const DefaultGapFillAfter = 100 * time.Millisecond
+
+func (g GapFill) validate() error {
+	switch g {
+	case GapFillOff, GapFillHold, GapFillBlack:
+		return nil
+	}
+	return fmt.Errorf("unknown gap fill %q (want hold or black)", string(g))
+}
+
+// gapFiller passes an input through unit by unit and, once it has gone
+// without a unit for after, supplies a filler unit every interval until
+// the input delivers again. Like fallbackReader, it reads the input in its
+// own goroutine, started on the first Read so nothing is read early, as
+// during a pre-roll.
+type gapFiller struct {
+	src  io.Reader
+	unit int
+	once sync.Once
+
+	units chan []byte // whole units read from the input
+	free  chan []byte // buffers for the input goroutine to fill
+	err   error       // why the input ended, once units is closed
+
+	fill     []byte // the filler unit; the last unit read if hold
+	hold     bool
+	after    time.Duration
+	interval time.Duration
+	paused   func() bool // input deliberately held back, not stalled
+	name     string      // for the log
+	log      logger
+
+	filling   bool
+	gapStart  time.Time
+	gapFilled int
+	filled    atomic.Int64
+
+	cur []byte // rest of the unit being read out
+	buf []byte // input buffer cur is in, or nil for fill
+}
+
+func newGapFiller(src io.Reader, unit int, fill []byte, hold bool, after, interval time.Duration, paused func() bool, name string, log logger) *gapFiller {
+	g := &gapFiller{
+		src:      src,
+		unit:     unit,
+		units:    make(chan []byte),
+		free:     make(chan []byte, 2),
+		fill:     fill,
+		hold:     hold,
+		after:    after,
+		interval: interval,
+		paused:   paused,
+		name:     name,
+		log:      log,
+	}
+	for range cap(g.free) {
+		g.free <- make([]byte, unit)
+	}
+	return g
+}
+
+func (g *gapFiller) readInput() {
+	defer close(g.units)
+	for buf := range g.free {
+		if _, err := io.ReadFull(g.src, buf); err != nil {
+			g.err = err
+			return
+		}
+		g.units <- buf
+	}
+}
+
+func (g *gapFiller) Read(p []byte) (int, error) {
+	g.once.Do(func() { go g.readInput() })
+	if len(g.cur) == 0 {
+		if err := g.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, g.cur)
+	g.cur = g.cur[n:]
+	if len(g.cur) == 0 && g.buf != nil {
+		if g.hold {
+			copy(g.fill, g.buf)
+		}
+		g.free <- g.buf
+		g.buf = nil
+	}
+	return n, nil
+}
+
+// next selects the unit to read out: the next input unit, or the filler
+// if none arrives in time.
+func (g *gapFiller) next() error {
+	wait := g.after
+	if g.filling {
+		wait = g.interval
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case buf, ok := <-g.units:
+			if !ok {
+				return g.err
+			}
+			if g.filling {
+				g.filling = false
+				g.log.infof("[%s] Input resumed after a %v gap, %d filler unit(s) sent",
+					g.name, time.Since(g.gapStart).Round(time.Millisecond), g.gapFilled)
+			}
+			g.cur, g.buf = buf, buf
+			return nil
+		case <-timer.C:
+			if g.paused() {
+				g.filling = false
+				timer.Reset(g.after)
+				continue
+			}
+			if !g.filling {
+				g.filling = true
+				g.gapStart, g.gapFilled = time.Now().Add(-g.after), 0
+			}
+			g.gapFilled++
+			g.filled.Add(1)
+			g.cur = g.fill
+			return nil
+		}
+	}
+}
+
+// gapFillVideo wraps the video input in the filler of Config.GapFill.
+func (s *Streamer) gapFillVideo(r io.Reader) io.Reader {
+	if s.cfg.GapFill == GapFillOff {
+		return r
+	}
+	// Hold starts from black in case the input gaps before its first frame.
+	black := s.cfg.PixelFormat.blackFrame(int(s.frameWidth), int(s.frameHeight))
+	s.videoFill = newGapFiller(r, s.frameSize(), black, s.cfg.GapFill == GapFillHold,
+		s.cfg.GapFillAfter, s.cfg.frameInterval(), s.videoPaused, "Video", s.log)
+	return s.videoFill
+}
+
+// gapFillAudio wraps the audio input so its gaps are filled with silence,
+// which is all zero bytes in every AudioSampleFormat.
+func (s *Streamer) gapFillAudio(r io.Reader) io.Reader {
+	if s.cfg.GapFill == GapFillOff {
+		return r
+	}
+	chunk := s.cfg.AudioSampleFormat.chunkSize(s.cfg.AudioSampleRate, s.cfg.AudioChannels)
+	s.audioFill = newGapFiller(r, chunk, make([]byte, chunk), false,
+		s.cfg.GapFillAfter, 20*time.Millisecond, s.audioPaused, "Audio", s.log)
+	return s.audioFill
+}
+
+func (s *Streamer) fillGapFilled(st *Stats) {
+	if s.videoFill != nil {
+		st.GapFilledVideoFrames = s.videoFill.filled.Load()
+	}
+	if s.audioFill != nil {
+		st.GapFilledAudioChunks = s.audioFill.filled.Load()
+	}
+}
@@ -0,0 +1,130 @@
+package streamer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults for AdaptiveGOP fields left zero.
+const (
+	DefaultAdaptiveGOPWindow = time.Minute
+	DefaultAdaptiveGOPJoins  = 3
+)
+
+// AdaptiveGOP varies the video keyframe interval with how often remote
+// participants join. A joiner sees nothing until the next keyframe, so a
+// long GOP makes every joiner wait up to that long, while in a room nobody
+// is joining it saves bitrate: keyframes cost several times a P-frame, so
+// halving the GOP at a given bitrate leaves noticeably fewer bits for the
+// frames in between. When at least Joins participants have joined within
+// Window, the GOP is halved, down to MinGOP; when nobody has joined for a
+// whole Window it is doubled, up to MaxGOP. The GOP changes at most once
+// per Window.
+//
+// Each change restarts the video encoder through Reconfigure, which opens
+// the new stream with an IDR frame, so a shortened GOP also serves the
+// joiners that caused it at once. The zero value, with MaxGOP zero, keeps
+// the GOP fixed.
+type AdaptiveGOP struct {
+	MinGOP, MaxGOP int           // bounds, in frames
+	Window         time.Duration // DefaultAdaptiveGOPWindow if zero
+	Joins          int           // DefaultAdaptiveGOPJoins if zero
+}
+
+func (a AdaptiveGOP) enabled() bool {
+	return a.MaxGOP > 0
+}
+
+func (a AdaptiveGOP) validate() error {
+	if !a.enabled() {
+		return nil
+	}
+	if a.MinGOP <= 0 || a.MinGOP > a.MaxGOP {
+		return fmt.Errorf("adaptive GOP bounds %d..%d must be positive and ordered", a.MinGOP, a.MaxGOP)
+	}
+	if a.Window < 0 || a.Joins < 0 {
+		return fmt.Errorf("adaptive GOP window %v and joins %d must not be negative", a.Window, a.Joins)
+	}
+	return nil
+}
+
+// joinRate keeps the join times within the adaptation window.
+type joinRate struct {
+	mu    sync.Mutex
+	joins []time.Time
+	kick  chan struct{} // signalled on each join
+}
+
+func newJoinRate() *joinRate {
+	return &joinRate{kick: make(chan struct{}, 1)}
+}
+
+func (j *joinRate) join(now time.Time) {
+	j.mu.Lock()
+	j.joins = append(j.joins, now)
+	j.mu.Unlock()
+	select {
+	case j.kick <- struct{}{}:
+	default:
+	}
+}
+
+// recent returns the number of joins since since and the time of the
+// latest, dropping older ones.
+func (j *joinRate) recent(since time.Time) (int, time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	i := 0
+	for i < len(j.joins) && j.joins[i].Before(since) {
+		i++
+	}
+	j.joins = j.joins[i:]
+	if len(j.joins) == 0 {
+		return 0, time.Time{}
+	}
+	return len(j.joins), j.joins[len(j.joins)-1]
+}
+
+// adaptGOP adjusts the GOP to the join rate until the session ends.
+func (s *Streamer) adaptGOP() {
+	a := s.cfg.AdaptiveGOP
+	ticker := time.NewTicker(a.Window / 4)
+	defer ticker.Stop()
+	changed := time.Now() // the starting GOP gets a full window too
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.joinRate.kick:
+		case <-ticker.C:
+		}
+		now := time.Now()
+		if now.Sub(changed) < a.Window {
+			continue
+		}
+		cur := s.EncoderConfig()
+		gop := cur.Settings.GOP
+		joins, last := s.joinRate.recent(now.Add(-a.Window))
+		switch {
+		case joins >= a.Joins:
+			gop = max(gop/2, a.MinGOP)
+		case last.IsZero() || now.Sub(last) >= a.Window:
+			gop = min(gop*2, a.MaxGOP)
+		}
+		if gop == cur.Settings.GOP {
+			continue
+		}
+		from := cur.Settings.GOP
+		cur.Settings.GOP = gop
+		if err := s.Reconfigure(cur); err != nil {
+			s.log.warnf("[Video] Adapting GOP from %d to %d frames: %v", from, gop, err)
+			changed = now
+			continue
+		}
+		changed = now
+		s.log.infof("[Video] %d joins in the last %v, GOP %d -> %d frames (%v)",
+			joins, a.Window, from, gop, time.Duration(gop)*s.cfg.frameInterval())
+		s.emit(EventGOPChanged, map[string]any{"from": from, "to": gop, "joins": joins})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !nvml
+
+package streamer
+
+// gpuUsage is unavailable without the nvml build tag.
+func gpuUsage(pid int) (gpuProcessUsage, bool) {
+	return gpuProcessUsage{}, false
+}
@@ -0,0 +1,45 @@
+//go:build nvml
+
+package streamer
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// gpuUsage reports the SM and NVENC utilisation of pid as seen by NVML,
+// queried through nvidia-smi so the build needs no CGO. It returns false
+// when nvidia-smi is unavailable or pid is not on any GPU.
+func gpuUsage(pid int) (gpuProcessUsage, bool) {
+	out, err := exec.Command("nvidia-smi", "pmon", "-c", "1", "-s", "u").Output()
+	if err != nil {
+		return gpuProcessUsage{}, false
+	}
+	// # gpu   pid  type  sm  mem  enc  dec  ...  command
+	want := strconv.Itoa(pid)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[1] != want {
+			continue
+		}
+		return gpuProcessUsage{SM: pmonPercent(fields[3]), Encoder: pmonPercent(fields[5])}, true
+	}
+	return gpuProcessUsage{}, false
+}
+
+// pmonPercent parses a pmon column, which is "-" when not applicable.
+func pmonPercent(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,335 @@
+package streamer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// DefaultMaxNALSize bounds the NAL units of an H264Reader unless
+// SetMaxNALSize says otherwise. It is well above the largest IDR slice of
+// a 4K stream at broadcast bitrates.
+const DefaultMaxNALSize = 4 << 20
+
+// h264ReadSize is how much an H264Reader reads from its source at a time.
+const h264ReadSize = 32 << 10
+
+// H264Reader splits an H264 Annex-B stream into its NAL units, returning
+// one per Read, start code included, and logs the start codes it finds.
+// A unit larger than the buffer passed to Read is returned over as many
+// calls, and the next Read after its last byte begins the next unit.
+// Ahead of an IDR picture that came without its SPS and PPS, Read returns
+// the latest of them the stream sent, as the H264 track does, so a
+// receiver can start decoding at any keyframe.
+type H264Reader struct {
+	reader io.ReadCloser
+	name   string
+
+	// buffer holds bytes not yet known not to begin a start code, so codes
+	// split across reads of any size, down to one byte, are still found.
+	buffer    bytes.Buffer
+	offset    int64 // stream offset of the first byte in buffer
+	lastStart int64 // stream offset of the previous start code, or -1
+	scratch   []byte
+
+	// nal collects the current NAL unit, units holds complete ones not
+	// yet read, ahead the next ones Read returns, a unit and the parameter
+	// sets resent before it, and pending the rest of the one being read.
+	// dropping is set from the point a unit overran maxNAL until the next
+	// start code.
+	maxNAL   int
+	nal      bytes.Buffer
+	units    [][]byte
+	ahead    [][]byte
+	pending  []byte
+	dropping bool
+	err      error
+	params   h264ParamSets
+
+	// reads and startCodes sample the per-read and start code messages.
+	// quiet drops them for a track's reader, whose reads its DebugReader
+	// already logs.
+	reads, startCodes *logSampler
+	quiet             bool
+	log               logger
+	ctx               context.Context
+}
+
+func NewH264Reader(r io.ReadCloser, name string) *H264Reader {
+	return &H264Reader{reader: r, name: name, lastStart: -1, maxNAL: DefaultMaxNALSize}
+}
+
+// SetSampling thins out the per-read and start code messages, which are
+// otherwise all logged. Call it before the first Read.
+func (h *H264Reader) SetSampling(reads, startCodes LogSampling) {
+	h.reads, h.startCodes = newLogSampler(reads), newLogSampler(startCodes)
+}
+
+// SetLogger logs through l, at Debug for the per-read and start code
+// messages, rather than through slog.Default(). Call it before the first
+// Read.
+func (h *H264Reader) SetLogger(l *slog.Logger) {
+	h.log = logger{l}
+}
+
+// SetContext ends the stream once ctx is done, as DebugReader.SetContext
+// does. The unit being collected is dropped rather than returned cut
+// short. Call it before the first Read.
+func (h *H264Reader) SetContext(ctx context.Context) {
+	h.ctx = ctx
+	cancelReads(ctx, h.reader)
+}
+
+// SetMaxNALSize bounds the size of a NAL unit, start code included, to
+// max, or to DefaultMaxNALSize if it is zero. Each unit is held until the
+// next start code shows where it ends, so a unit that grows past max, as
+// in a stream that has lost its start codes, is logged and dropped, and
+// reading resumes at the next start code. Call it before the first Read.
+func (h *H264Reader) SetMaxNALSize(max int) {
+	if max == 0 {
+		max = DefaultMaxNALSize
+	}
+	h.maxNAL = max
+}
+
+// Read returns the next NAL unit, or as much of it as fits in p.
+func (h *H264Reader) Read(p []byte) (int, error) {
+	for len(h.pending) == 0 {
+		if canceled(h.ctx) {
+			return 0, io.EOF
+		}
+		if len(h.ahead) > 0 {
+			h.pending, h.ahead = h.ahead[0], h.ahead[1:]
+			break
+		}
+		if len(h.units) > 0 {
+			unit := h.units[0]
+			h.units = h.units[1:]
+			h.ahead = append(h.resend(unit), unit)
+			continue
+		}
+		if h.err != nil {
+			return 0, h.err
+		}
+		h.fill()
+	}
+	n := copy(p, h.pending)
+	h.pending = h.pending[n:]
+	return n, nil
+}
+
+// resend returns the cached parameter sets to return ahead of unit, each
+// with a start code, and caches unit if it is one itself.
+func (h *H264Reader) resend(unit []byte) [][]byte {
+	nal := stripStartCode(unit)
+	if len(nal) == 0 || h.params.cache(nal) {
+		return nil
+	}
+	start, idr := h264PictureStart(nal)
+	if !start {
+		return nil
+	}
+	var units [][]byte
+	for _, ps := range h.params.picture(idr) {
+		units = append(units, append([]byte{0, 0, 0, 1}, ps...))
+	}
+	return units
+}
+
+// NextNAL returns the next NAL unit whole, without its start code, as
+// pion's h264reader does, skipping empty units. Unlike Read it resends no
+// parameter sets, which is left to the track's h264Assembler. Use it or
+// Read, not both.
+func (h *H264Reader) NextNAL() ([]byte, error) {
+	for {
+		if canceled(h.ctx) {
+			return nil, io.EOF
+		}
+		if len(h.units) > 0 {
+			nal := stripStartCode(h.units[0])
+			h.units = h.units[1:]
+			if len(nal) > 0 {
+				return nal, nil
+			}
+			continue
+		}
+		if h.err != nil {
+			return nil, h.err
+		}
+		h.fill()
+	}
+}
+
+// fill reads from the source and splits what it can.
+func (h *H264Reader) fill() {
+	if h.scratch == nil {
+		h.scratch = make([]byte, h264ReadSize)
+	}
+	n, err := h.reader.Read(h.scratch)
+	if n > 0 {
+		h.buffer.Write(h.scratch[:n])
+		h.scan()
+		if ok, suppressed := h.reads.allow(); ok && !h.quiet {
+			h.log.debugf("[%s] Read %d bytes%s", h.name, n, sampledSuffix(suppressed))
+		}
+	}
+	if err != nil && canceled(h.ctx) {
+		h.err = io.EOF
+		return
+	}
+	if err != nil {
+		// The held-back bytes end the last unit.
+		h.collect(h.buffer.Bytes())
+		h.buffer.Reset()
+		h.flushNAL()
+		h.err = err
+	}
+}
+
+// scan splits the buffer at the start codes (0x00 0x00 0x00 0x01 or 0x00
+// 0x00 0x01) in it, keeping the last few bytes back until it is known
+// whether they begin one.
+func (h *H264Reader) scan() {
+	b := h.buffer.Bytes()
+	i, from := 0, 0
+	for i+4 <= len(b) {
+		switch {
+		case b[i] == 0 && b[i+1] == 0 && b[i+2] == 0 && b[i+3] == 1:
+			h.nalBoundary(b, &from, i)
+			h.startCode(h.offset + int64(i))
+			i += 4
+		case b[i] == 0 && b[i+1] == 0 && b[i+2] == 1:
+			h.nalBoundary(b, &from, i)
+			h.startCode(h.offset + int64(i))
+			i += 3
+		default:
+			i++
+		}
+	}
+	h.collect(b[from:i])
+	h.buffer.Next(i)
+	h.offset += int64(i)
+}
+
+// nalBoundary handles a start code at b[i]: the unit before it is
+// complete, and the one it begins is collected from i.
+func (h *H264Reader) nalBoundary(b []byte, from *int, i int) {
+	h.collect(b[*from:i])
+	h.flushNAL()
+	if h.dropping {
+		h.dropping = false
+		h.log.infof("[%s] Resynchronised on start code at offset %d", h.name, h.offset+int64(i))
+	}
+	*from = i
+}
+
+// collect adds b to the current NAL unit, dropping the unit once it
+// exceeds maxNAL.
+func (h *H264Reader) collect(b []byte) {
+	if h.dropping {
+		return
+	}
+	h.nal.Write(b)
+	if h.nal.Len() > h.maxNAL {
+		h.log.errorf("[%s] NAL unit exceeds %d bytes without a start code, dropping it until the next one",
+			h.name, h.maxNAL)
+		h.nal.Reset()
+		h.dropping = true
+	}
+}
+
+// flushNAL queues the collected NAL unit for Read.
+func (h *H264Reader) flushNAL() {
+	if h.nal.Len() > 0 {
+		h.units = append(h.units, bytes.Clone(h.nal.Bytes()))
+	}
+	h.nal.Reset()
+}
+
+func (h *H264Reader) startCode(at int64) {
+	if h.lastStart >= 0 {
+		if ok, suppressed := h.startCodes.allow(); ok && !h.quiet {
+			h.log.debugf("[%s] Found start code at offset %d, previous chunk size: %d%s",
+				h.name, at, at-h.lastStart, sampledSuffix(suppressed))
+		}
+	}
+	h.lastStart = at
+}
+
+func (h *H264Reader) Close() error {
+	return h.reader.Close()
+}
+
+// stripStartCode returns unit without its start code, or nil for the bytes
+// ahead of a stream's first start code, which are not a unit.
+func stripStartCode(unit []byte) []byte {
+	switch {
+	case bytes.HasPrefix(unit, []byte{0, 0, 0, 1}):
+		return unit[4:]
+	case bytes.HasPrefix(unit, []byte{0, 0, 1}):
+		return unit[3:]
+	}
+	return nil
+}
+
+// annexBSniffSize is how much of a stream CheckAnnexB is given.
+const annexBSniffSize = 16
+
+// CheckAnnexB checks that head, the first bytes of a stream, is H264 in
+// Annex-B form, beginning with a start code after any leading zero bytes.
+// The two forms most often mistaken for it, an MP4 file and AVCC NAL units
+// prefixed with their length as MP4 stores them, are named in the error,
+// as a track fed either finds no start codes to split on.
+func CheckAnnexB(head []byte) error {
+	zeros := 0
+	for zeros < len(head) && head[zeros] == 0 {
+		zeros++
+	}
+	switch {
+	case zeros >= 2 && zeros < len(head) && head[zeros] == 1:
+		return nil
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return errors.New("input is an MP4 file, not an H264 Annex-B stream; extract it with ffmpeg -i in.mp4 -c:v copy -bsf:v h264_mp4toannexb -f h264 out.h264")
+	case len(head) >= 5 && isAVCCStart(head):
+		return errors.New("input has AVCC length-prefixed NAL units, not H264 Annex-B start codes; convert it with ffmpeg's h264_mp4toannexb bitstream filter")
+	}
+	return errors.New("input does not begin with an H264 Annex-B start code")
+}
+
+// isAVCCStart reports whether head looks like a NAL unit prefixed with its
+// 4-byte length: a plausible length followed by a NAL header with the
+// forbidden bit clear and a type in use.
+func isAVCCStart(head []byte) bool {
+	n := binary.BigEndian.Uint32(head)
+	nalType := head[4] & 0x1f
+	return n > 1 && n < 1<<26 && head[4]&0x80 == 0 && nalType >= 1 && nalType <= 12
+}
+
+// OpenAnnexBFile opens an H264 Annex-B file, such as one ffmpeg wrote with
+// -f h264, after checking its first bytes with CheckAnnexB.
+func OpenAnnexBFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	head, err := r.Peek(annexBSniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := CheckAnnexB(head); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
@@ -0,0 +1,249 @@
+package streamer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pieceReader returns its data in reads of the given sizes, the last size
+// repeating.
+type pieceReader struct {
+	data  []byte
+	sizes []int
+}
+
+func (c *pieceReader) Read(p []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := min(c.sizes[0], len(c.data), len(p))
+	if len(c.sizes) > 1 {
+		c.sizes = c.sizes[1:]
+	}
+	copy(p, c.data[:n])
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func (c *pieceReader) Close() error { return nil }
+
+// newTestH264Reader is an H264Reader of data in reads of the given sizes
+// that logs nothing.
+func newTestH264Reader(data []byte, sizes ...int) *H264Reader {
+	h := NewH264Reader(&pieceReader{data: data, sizes: sizes}, "test")
+	h.SetLogger(slog.New(slog.DiscardHandler))
+	return h
+}
+
+// readNALs reads h to the end, one unit per Read.
+func readNALs(t *testing.T, h *H264Reader) [][]byte {
+	t.Helper()
+	var nals [][]byte
+	buf := make([]byte, 1<<16)
+	for {
+		n, err := h.Read(buf)
+		if errors.Is(err, io.EOF) {
+			return nals
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		nals = append(nals, bytes.Clone(buf[:n]))
+	}
+}
+
+func equalNALs(a, b [][]byte) bool {
+	return slices.EqualFunc(a, b, bytes.Equal)
+}
+
+// stutterReader returns one byte of r per Read, with an empty Read before
+// each.
+type stutterReader struct {
+	r     io.Reader
+	empty bool
+}
+
+func (s *stutterReader) Read(p []byte) (int, error) {
+	if s.empty = !s.empty; s.empty {
+		return 0, nil
+	}
+	return s.r.Read(p[:min(len(p), 1)])
+}
+
+var startCodeLine = regexp.MustCompile(`Found start code at offset (\d+)`)
+
+// readStartCodes reads r through an H264Reader and returns what it read and
+// the offsets of the start codes it reported.
+func readStartCodes(t *testing.T, r io.Reader) ([]byte, []int) {
+	t.Helper()
+	var log bytes.Buffer
+	h := NewH264Reader(io.NopCloser(r), "test")
+	h.SetLogger(slog.New(slog.NewTextHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	data, err := io.ReadAll(h)
+	if err != nil {
+		t.Error(err)
+	}
+	var offsets []int
+	for _, m := range startCodeLine.FindAllStringSubmatch(log.String(), -1) {
+		n, _ := strconv.Atoi(m[1])
+		offsets = append(offsets, n)
+	}
+	return data, offsets
+}
+
+func TestH264ReaderTinyReads(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		{0, 0, 0, 1, 0x67, 0x42},
+		{0, 0, 1, 0x68},
+		{0, 0, 0, 1, 0x65, 0x88, 0, 0, 2},
+	}, nil)
+	// Every start code but the first is reported with the chunk before
+	// it, however the reads split it.
+	want := []int{6, 10}
+	for name, r := range map[string]io.Reader{
+		"whole":       bytes.NewReader(stream),
+		"one byte":    &pieceReader{data: stream, sizes: []int{1}},
+		"two bytes":   &pieceReader{data: stream, sizes: []int{2}},
+		"empty reads": &stutterReader{r: bytes.NewReader(stream)},
+	} {
+		data, offsets := readStartCodes(t, r)
+		if !bytes.Equal(data, stream) {
+			t.Errorf("%s: read % x, want the stream % x", name, data, stream)
+		}
+		if !slices.Equal(offsets, want) {
+			t.Errorf("%s: start codes at %v, want %v", name, offsets, want)
+		}
+	}
+}
+
+func TestH264ReaderMaxNALSize(t *testing.T) {
+	sps := []byte{0, 0, 0, 1, 0x67, 0x42}
+	// The IDR slice runs on for 100 bytes, as if the start code of the
+	// slice after it had been lost.
+	runaway := append([]byte{0, 0, 0, 1, 0x65}, bytes.Repeat([]byte{0xaa}, 100)...)
+	slice := []byte{0, 0, 1, 0x41, 0x9a}
+	stream := bytes.Join([][]byte{sps, runaway, slice}, nil)
+
+	for _, size := range []int{1, 7, len(stream)} {
+		var log syncBuffer
+		h := NewH264Reader(&pieceReader{data: stream, sizes: []int{size}}, "test")
+		h.SetLogger(slog.New(slog.NewTextHandler(&log, nil)))
+		h.SetMaxNALSize(32)
+		// The oversized unit is dropped and reading resumes at the next
+		// start code.
+		if got, want := readNALs(t, h), [][]byte{sps, slice}; !equalNALs(got, want) {
+			t.Errorf("reads of %d: units = % x\nwant % x", size, got, want)
+		}
+		out := log.String()
+		if !strings.Contains(out, "exceeds 32 bytes") || !strings.Contains(out, "Resynchronised") {
+			t.Errorf("reads of %d: log %q does not report the drop and resync", size, out)
+		}
+	}
+}
+
+func TestH264ReaderChunks(t *testing.T) {
+	// Each unit's payload is distinct so that a misplaced split shows.
+	sps := []byte{0, 0, 0, 1, 0x67, 0x42, 0xc0, 0x1e}
+	pps := []byte{0, 0, 1, 0x68, 0xce, 0x3c, 0x80}
+	idr := []byte{0, 0, 0, 1, 0x65, 0x88, 0x84, 0x21, 0xa0}
+	slice := []byte{0, 0, 1, 0x41, 0x9a, 0x02}
+	stream := bytes.Join([][]byte{sps, pps, idr, slice}, nil)
+	want := [][]byte{sps, pps, idr, slice}
+
+	for _, tt := range []struct {
+		name  string
+		sizes []int
+	}{
+		{"whole", []int{len(stream)}},
+		{"one byte", []int{1}},
+		{"two bytes", []int{2}},
+		{"three bytes", []int{3}},
+		{"odd", []int{5, 7, 3}},
+		// The SPS ends at 8, so its read ends on its last byte and the
+		// next begins with the PPS start code.
+		{"on boundary", []int{len(sps), len(pps), len(idr), len(slice)}},
+		// 00 00 00 ends one read, 01 begins the next.
+		{"split four-byte code", []int{len(sps) + len(pps) + 3, 1, 100}},
+		// 00 00 ends one read, 01 begins the next.
+		{"split three-byte code", []int{len(sps) + 2, 1, 100}},
+		// 00 ends one read, 00 01 begins the next.
+		{"split after first zero", []int{len(sps) + len(pps) + 1, 100}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readNALs(t, newTestH264Reader(stream, tt.sizes...))
+			if !equalNALs(got, want) {
+				t.Errorf("units = % x\nwant % x", got, want)
+			}
+		})
+	}
+}
+
+func TestH264ReaderShortBuffer(t *testing.T) {
+	idr := []byte{0, 0, 0, 1, 0x65, 1, 2, 3, 4, 5, 6, 7}
+	slice := []byte{0, 0, 0, 1, 0x41, 9}
+	h := newTestH264Reader(append(bytes.Clone(idr), slice...), 100)
+	// A unit larger than p is returned over several reads, and the next
+	// read after it begins the next unit.
+	var got []int
+	buf := make([]byte, 5)
+	for {
+		n, err := h.Read(buf)
+		if err != nil {
+			break
+		}
+		got = append(got, n)
+	}
+	if want := []int{5, 5, 2, 5, 1}; !slices.Equal(got, want) {
+		t.Errorf("read sizes %v, want %v", got, want)
+	}
+}
+
+func TestH264ReaderNextNAL(t *testing.T) {
+	stream := []byte{
+		0xff, 0xfe, // not a unit
+		0, 0, 0, 1, 0x67, 0x42,
+		0, 0, 1, 0x68, 0xce,
+		0, 0, 0, 1, // empty
+		0, 0, 1, 0x65, 0x88, 0,
+	}
+	want := [][]byte{{0x67, 0x42}, {0x68, 0xce}, {0x65, 0x88, 0}}
+	for _, size := range []int{1, 3, len(stream)} {
+		h := newTestH264Reader(stream, size)
+		var got [][]byte
+		for {
+			nal, err := h.NextNAL()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, nal)
+		}
+		if !equalNALs(got, want) {
+			t.Errorf("reads of %d: NextNAL = % x, want % x", size, got, want)
+		}
+	}
+}
+
+func TestH264ReaderResendsParameterSets(t *testing.T) {
+	code := func(nal []byte) []byte { return append([]byte{0, 0, 0, 1}, nal...) }
+	sps, pps, idr, slice := code(testSPS), code(testPPS), code(testIDR), code(testSlice)
+	// The SPS and PPS first come mid-stream, the second IDR without them.
+	stream := bytes.Join([][]byte{slice, sps, pps, idr, slice, idr, slice}, nil)
+	// Read passes the stream through, the pictures before the parameter
+	// sets included, and returns the cached ones ahead of the second IDR.
+	want := [][]byte{slice, sps, pps, idr, slice, sps, pps, idr, slice}
+	for _, size := range []int{1, 5, len(stream)} {
+		if got := readNALs(t, newTestH264Reader(stream, size)); !equalNALs(got, want) {
+			t.Errorf("reads of %d: units = % x\nwant % x", size, got, want)
+		}
+	}
+}
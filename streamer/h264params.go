@@ -0,0 +1,140 @@
+package streamer
+
+import (
+	"bytes"
+
+	"github.com/pion/webrtc/v4/pkg/media/h264reader"
+)
+
+// h264Unit is one NAL unit as the H264 track sends it.
+type h264Unit struct {
+	data     []byte
+	isFrame  bool
+	keyframe bool
+}
+
+// h264ParamSets caches the latest SPS and PPS of an H264 stream, so that
+// they can be sent again ahead of an IDR picture the stream sent without
+// them. Only the latest of each is kept, which covers the encoders the
+// streamer runs; a stream switching between several by ID is beyond it.
+// It is shared by h264Assembler and H264Reader.Read.
+type h264ParamSets struct {
+	sps, pps []byte
+	// spsSent and ppsSent are set when the picture being assembled had
+	// its parameter sets in the stream.
+	spsSent, ppsSent bool
+}
+
+// cache keeps nal, a NAL unit without its start code, if it is an SPS or
+// PPS, and reports whether it was.
+func (c *h264ParamSets) cache(nal []byte) bool {
+	switch h264reader.NalUnitType(nal[0] & 0x1f) {
+	case h264reader.NalUnitTypeSPS:
+		c.sps, c.spsSent = bytes.Clone(nal), true
+	case h264reader.NalUnitTypePPS:
+		c.pps, c.ppsSent = bytes.Clone(nal), true
+	default:
+		return false
+	}
+	return true
+}
+
+// known reports whether both an SPS and a PPS have been seen.
+func (c *h264ParamSets) known() bool {
+	return c.sps != nil && c.pps != nil
+}
+
+// picture is called as a picture starts, an IDR one if idr, and returns
+// the cached parameter sets an IDR picture did not bring with it, SPS
+// first.
+func (c *h264ParamSets) picture(idr bool) [][]byte {
+	spsSent, ppsSent := c.spsSent, c.ppsSent
+	c.spsSent, c.ppsSent = false, false
+	if !idr {
+		return nil
+	}
+	var resend [][]byte
+	if !spsSent && c.sps != nil {
+		resend = append(resend, c.sps)
+	}
+	if !ppsSent && c.pps != nil {
+		resend = append(resend, c.pps)
+	}
+	return resend
+}
+
+// h264PictureStart reports whether nal, a NAL unit without its start
+// code, is a slice that starts a new picture, and whether that picture is
+// an IDR one. A slice whose first_mb_in_slice is 0, a leading 1 bit in its
+// ue(v) code, starts one; the rest are the picture's other slices and data
+// partitions.
+func h264PictureStart(nal []byte) (start, idr bool) {
+	switch h264reader.NalUnitType(nal[0] & 0x1f) {
+	case h264reader.NalUnitTypeCodedSliceIdr:
+		idr = true
+	case h264reader.NalUnitTypeCodedSliceNonIdr:
+	default:
+		return false, false
+	}
+	return len(nal) >= 2 && nal[1]&0x80 != 0, idr
+}
+
+// h264Assembler orders an H264 stream's NAL units for the track, so that
+// every IDR picture a receiver gets can be decoded on its own. It sends
+// the cached SPS and PPS again ahead of each IDR picture that does not
+// already bring its own, whether the encoder repeats them or not, and
+// drops the pictures before the first IDR that follows both being known:
+// a receiver cannot decode those, and one that starts on them may fail to
+// decode the first seconds of the stream.
+type h264Assembler struct {
+	params h264ParamSets
+	// decodable is set from the first IDR picture with both known.
+	decodable bool
+	// dropping is set while the pictures of the current one are dropped.
+	dropping bool
+	hooks    trackHooks
+}
+
+// units returns what to send for nal, a NAL unit without its start code,
+// in order: nal itself, preceded by the cached parameter sets and the SEI
+// hook's message when it starts a picture, or nothing when its picture is
+// dropped.
+func (a *h264Assembler) units(nal []byte) []h264Unit {
+	if a.params.cache(nal) {
+		return []h264Unit{{data: nal}}
+	}
+	unitType := h264reader.NalUnitType(nal[0] & 0x1f)
+	if unitType < h264reader.NalUnitTypeCodedSliceNonIdr || unitType > h264reader.NalUnitTypeCodedSliceIdr {
+		// SEI and delimiters share the timestamp of the slice that
+		// follows them.
+		return []h264Unit{{data: nal}}
+	}
+	start, idr := h264PictureStart(nal)
+	if !start {
+		if a.dropping {
+			return nil
+		}
+		return []h264Unit{{data: nal, isFrame: true}}
+	}
+	if idr && a.params.known() {
+		a.decodable = true
+	}
+	resend := a.params.picture(idr)
+	if a.dropping = !a.decodable; a.dropping {
+		if a.hooks.onDrop != nil {
+			a.hooks.onDrop(DropNoParameterSets)
+		}
+		if a.hooks.onKeyframeRequest != nil {
+			a.hooks.onKeyframeRequest("missing parameter sets")
+		}
+		return nil
+	}
+	var units []h264Unit
+	for _, ps := range resend {
+		units = append(units, h264Unit{data: ps})
+	}
+	if a.hooks.sei != nil {
+		units = append(units, h264Unit{data: a.hooks.sei()})
+	}
+	return append(units, h264Unit{data: nal, isFrame: true, keyframe: idr})
+}
@@ -0,0 +1,44 @@
+package streamer
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// Units of a stream whose parameter sets arrive mid-stream, without start
+// codes, a leading 0x80 making each slice start a picture.
+var (
+	testSPS   = []byte{0x67, 0x42, 0xc0, 0x1e}
+	testPPS   = []byte{0x68, 0xce, 0x3c, 0x80}
+	testIDR   = []byte{0x65, 0x88, 0x84}
+	testSlice = []byte{0x41, 0x9a, 0x02}
+)
+
+func TestH264AssemblerMidStreamParameterSets(t *testing.T) {
+	var drops []DropReason
+	a := &h264Assembler{hooks: trackHooks{onDrop: func(r DropReason) { drops = append(drops, r) }}}
+	// A picture before any parameter sets, then the SPS and PPS with the
+	// first IDR, a picture after it, and a second IDR without them.
+	var got []h264Unit
+	for _, nal := range [][]byte{testSlice, testSPS, testPPS, testIDR, testSlice, testIDR} {
+		got = append(got, a.units(nal)...)
+	}
+	want := []h264Unit{
+		{data: testSPS},
+		{data: testPPS},
+		{data: testIDR, isFrame: true, keyframe: true},
+		{data: testSlice, isFrame: true},
+		{data: testSPS},
+		{data: testPPS},
+		{data: testIDR, isFrame: true, keyframe: true},
+	}
+	if !slices.EqualFunc(got, want, func(a, b h264Unit) bool {
+		return bytes.Equal(a.data, b.data) && a.isFrame == b.isFrame && a.keyframe == b.keyframe
+	}) {
+		t.Errorf("units = %+v\nwant %+v", got, want)
+	}
+	if !slices.Equal(drops, []DropReason{DropNoParameterSets}) {
+		t.Errorf("drops = %v, want the one picture before the parameter sets", drops)
+	}
+}
@@ -0,0 +1,320 @@
+//go:build streamertest
+
+package streamer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// HarnessConfig describes the video a Harness carries.
+type HarnessConfig struct {
+	// FrameSize is the size of one raw frame.
+	FrameSize int
+	// FrameRate is the input frame rate, DefaultFrameRate if zero. It
+	// sets the sample durations and, with LimitInputRate, the pacing.
+	FrameRate int
+	// GOP is the number of frames per keyframe of the fake encoder, 25
+	// if zero.
+	GOP int
+	// LimitInputRate paces the input to FrameRate, as
+	// Config.LimitInputRate does.
+	LimitInputRate bool
+	// ClockSource and Clock stamp the samples as in a session; zero
+	// values use ClockMonotonic and the system clock.
+	ClockSource ClockSource
+	Clock       Clock
+	// BindDelay holds off the track writer, as a slow negotiation holds
+	// off the track being bound, and StartupInputPolicy decides what
+	// happens to the frames written meanwhile. The pipes in a Harness
+	// hold no more than the frame being written, so StartupInputBuffer
+	// blocks Write instead of queueing.
+	BindDelay          time.Duration
+	StartupInputPolicy StartupInputPolicy
+}
+
+// HarnessSample is one sample the fake track writer took from the
+// provider.
+type HarnessSample struct {
+	// Frame is the index of the input frame the sample encodes, or -1
+	// for the parameter sets sent ahead of each keyframe.
+	Frame    int
+	Keyframe bool
+	// Duration is how far the sample advances the track clock, zero
+	// for anything but a picture.
+	Duration time.Duration
+	Size     int
+	// Received is when the writer took the sample.
+	Received time.Time
+}
+
+// Harness runs the core video data path in process, for tests of the
+// pipeline in CI: there is no FIFO, ffmpeg or room. Frames written to it
+// are read in FrameSize pieces as from the video pipe, encoded by a fake
+// encoder that echoes each frame into an H264 NAL unit, and published
+// through the same sample provider, stamper and hooks as a real track to a
+// fake track writer, which records what it receives. Only built with the
+// streamertest tag.
+type Harness struct {
+	cfg    HarnessConfig
+	in     *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu        sync.Mutex
+	samples   []HarnessSample
+	pictures  int // samples with a Frame
+	frames    int // counted by the track hooks
+	keyframes int
+	err       error
+}
+
+// NewHarness starts the encoder and track writer of a Harness.
+func NewHarness(cfg HarnessConfig) (*Harness, error) {
+	if cfg.FrameSize <= 0 {
+		return nil, fmt.Errorf("%w: frame size %d must be positive", ErrInvalidConfig, cfg.FrameSize)
+	}
+	if cfg.FrameRate == 0 {
+		cfg.FrameRate = DefaultFrameRate
+	}
+	if cfg.GOP == 0 {
+		cfg.GOP = 25
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = systemClock{}
+	}
+	if cfg.StartupInputPolicy == "" {
+		cfg.StartupInputPolicy = StartupInputBuffer
+	}
+	if err := cfg.StartupInputPolicy.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	interval := time.Second / time.Duration(cfg.FrameRate)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rawR, rawW := io.Pipe()
+	var raw io.Reader = rawR
+	var gate *inputGate
+	if cfg.StartupInputPolicy == StartupInputDrop {
+		gate = newInputGate(raw, cfg.FrameSize, true, ctx.Done())
+		gate.pause()
+		raw = gate
+	}
+	if cfg.LimitInputRate {
+		raw = newFrameRateLimiter(raw, cfg.FrameSize, interval)
+	}
+	encR, encW := io.Pipe()
+	go func() {
+		err := fakeEncode(raw, encW, cfg.FrameSize, cfg.GOP)
+		encW.CloseWithError(err)
+		if err == nil {
+			err = io.ErrClosedPipe
+		}
+		// Do not leave the producer blocked on a pipeline that has stopped.
+		rawR.CloseWithError(err)
+	}()
+
+	h := &Harness{cfg: cfg, in: rawW, cancel: cancel, done: make(chan struct{})}
+	stamper := newFrameStamper(cfg.ClockSource, cfg.Clock, interval, time.Time{})
+	hooks := trackHooks{
+		onFrame: func(FrameInfo) {
+			h.mu.Lock()
+			h.frames++
+			h.mu.Unlock()
+		},
+		onKeyframe: func() {
+			h.mu.Lock()
+			h.keyframes++
+			h.mu.Unlock()
+		},
+	}
+	_, provider, err := newEncodedTrack(encR, webrtc.MimeTypeH264, CodecOverride{}, stamper, hooks)
+	if err != nil {
+		cancel()
+		rawW.Close()
+		encR.Close()
+		return nil, err
+	}
+	go h.write(ctx, provider, gate)
+	return h, nil
+}
+
+// fakeEncode stands in for the video ffmpeg: each whole frame read from r
+// is written to w as one slice NAL unit, with an SPS and a PPS NAL ahead
+// of every gop-th frame, which is an IDR slice. A slice carries the frame
+// index followed by the frame, with emulation prevention bytes inserted.
+func fakeEncode(r io.Reader, w io.Writer, frameSize, gop int) error {
+	frame := make([]byte, frameSize)
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, frame); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		// first_mb_in_slice is 0, a leading 1 bit, so each slice starts
+		// a picture.
+		header := []byte{0x41, 0x80}
+		if i%gop == 0 {
+			if _, err := w.Write([]byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xce}); err != nil {
+				return err
+			}
+			header[0] = 0x65
+		}
+		payload := binary.BigEndian.AppendUint32(nil, uint32(i))
+		payload = append(payload, frame...)
+		nal := append([]byte{0, 0, 0, 1}, header...)
+		if _, err := w.Write(escapeNAL(nal, payload)); err != nil {
+			return err
+		}
+	}
+}
+
+// escapeNAL appends payload to nal, inserting an emulation prevention byte
+// wherever two zero bytes would be followed by one of 0 to 3.
+func escapeNAL(nal, payload []byte) []byte {
+	zeros := 0
+	for _, b := range payload {
+		if zeros == 2 && b <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		nal = append(nal, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	if zeros > 0 {
+		// A trailing zero would be taken for part of the next start code.
+		nal = append(nal, 3)
+	}
+	return nal
+}
+
+// unescapeNAL removes the emulation prevention bytes escapeNAL inserted.
+func unescapeNAL(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros == 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// write takes samples from the provider as the SDK's track writer would,
+// without pacing them, from BindDelay on until the stream ends, opening
+// the startup gate as the track's binding does.
+func (h *Harness) write(ctx context.Context, provider *encodedSampleProvider, gate *inputGate) {
+	defer close(h.done)
+	defer provider.Close()
+	select {
+	case <-time.After(h.cfg.BindDelay):
+	case <-ctx.Done():
+		return
+	}
+	openStartupGate(gate, "Harness", "frames", logger{})
+	for {
+		sample, err := provider.NextSample(ctx)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+				h.mu.Lock()
+				h.err = err
+				h.mu.Unlock()
+			}
+			return
+		}
+		s := HarnessSample{Frame: -1, Duration: sample.Duration, Size: len(sample.Data), Received: h.cfg.Clock.Now()}
+		if len(sample.Data) > 0 {
+			switch sample.Data[0] & 0x1f {
+			case 5:
+				s.Keyframe = true
+				fallthrough
+			case 1:
+				if payload := unescapeNAL(sample.Data[2:]); len(payload) >= 4 {
+					s.Frame = int(binary.BigEndian.Uint32(payload))
+				}
+			}
+		}
+		h.mu.Lock()
+		h.samples = append(h.samples, s)
+		if s.Frame >= 0 {
+			h.pictures++
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Write feeds raw video to the pipeline, as a producer writes to the
+// video pipe. It blocks while the pipeline is behind.
+func (h *Harness) Write(p []byte) (int, error) {
+	return h.in.Write(p)
+}
+
+// WaitFrames waits until the track writer has taken n pictures or timeout
+// elapses, and returns the samples taken so far.
+func (h *Harness) WaitFrames(n int, timeout time.Duration) ([]HarnessSample, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		h.mu.Lock()
+		frames, err := h.pictures, h.err
+		h.mu.Unlock()
+		if err != nil {
+			return h.Samples(), err
+		}
+		if frames >= n {
+			return h.Samples(), nil
+		}
+		select {
+		case <-h.done:
+			return h.Samples(), fmt.Errorf("stream ended after %d of %d frames", frames, n)
+		default:
+		}
+		if time.Now().After(deadline) {
+			return h.Samples(), fmt.Errorf("timed out after %d of %d frames", frames, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Samples returns a copy of the samples taken so far.
+func (h *Harness) Samples() []HarnessSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]HarnessSample(nil), h.samples...)
+}
+
+// Counts reports the pictures and keyframes the track hooks have seen.
+func (h *Harness) Counts() (frames, keyframes int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.frames, h.keyframes
+}
+
+// Close ends the input, waits for the pipeline to drain, and returns the
+// first error the track writer hit.
+func (h *Harness) Close() error {
+	h.in.Close()
+	<-h.done
+	h.cancel()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
@@ -0,0 +1,96 @@
+//go:build streamertest
+
+package streamer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// writeHarnessFrames writes n frames of h, frame i filled with byte i so
+// that a frame mixed up with another shows in its payload. It runs in its
+// own goroutine, so a failure is reported with Errorf.
+func writeHarnessFrames(t *testing.T, h *Harness, frameSize, n int) {
+	for i := range n {
+		if _, err := h.Write(bytes.Repeat([]byte{byte(i)}, frameSize)); err != nil {
+			t.Errorf("writing frame %d: %v", i, err)
+			return
+		}
+	}
+}
+
+func TestHarnessFrames(t *testing.T) {
+	const frameSize, frames, gop = 96, 20, 8
+	h, err := NewHarness(HarnessConfig{FrameSize: frameSize, FrameRate: 25, GOP: gop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeHarnessFrames(t, h, frameSize, frames)
+	// Closing the input drains the pipeline, the last frame included.
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	samples := h.Samples()
+
+	next := 0
+	for _, s := range samples {
+		if s.Frame < 0 {
+			if s.Duration != 0 {
+				t.Errorf("parameter set advances the clock by %v", s.Duration)
+			}
+			continue
+		}
+		if s.Frame != next {
+			t.Fatalf("got frame %d, want %d", s.Frame, next)
+		}
+		if s.Keyframe != (s.Frame%gop == 0) {
+			t.Errorf("frame %d keyframe %v", s.Frame, s.Keyframe)
+		}
+		if s.Duration != 40*time.Millisecond {
+			t.Errorf("frame %d lasts %v, want 40ms at 25 fps", s.Frame, s.Duration)
+		}
+		next++
+	}
+	if next != frames {
+		t.Errorf("got %d frames, want %d", next, frames)
+	}
+	if n, keyframes := h.Counts(); n != frames || keyframes != 3 {
+		t.Errorf("hooks counted %d frames and %d keyframes, want %d and 3", n, keyframes, frames)
+	}
+}
+
+func TestHarnessLimitInputRate(t *testing.T) {
+	const frameSize, frames = 16, 10
+	h, err := NewHarness(HarnessConfig{FrameSize: frameSize, FrameRate: 50, LimitInputRate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	// A unit ends at the start code of the next, so one more frame is
+	// written than waited for.
+	wrote := make(chan struct{})
+	go func() {
+		defer close(wrote)
+		writeHarnessFrames(t, h, frameSize, frames+1)
+	}()
+	samples, err := h.WaitFrames(frames, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-wrote
+	// Written as fast as the pipe takes them, the frames still come out
+	// 20ms apart.
+	var first, last time.Time
+	for _, s := range samples {
+		if s.Frame == 0 {
+			first = s.Received
+		}
+		if s.Frame == frames-1 {
+			last = s.Received
+		}
+	}
+	if elapsed, want := last.Sub(first), (frames-1)*20*time.Millisecond; elapsed < want*8/10 {
+		t.Errorf("%d frames took %v, want about %v", frames, elapsed, want)
+	}
+}
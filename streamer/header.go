@@ -0,0 +1,215 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+const (
+	DefaultMinDimension = 16
+	DefaultMaxDimension = 7680
+
+	// DefaultHeaderTimeout is how long Start waits for the full video
+	// header when Config.HeaderTimeout is zero.
+	DefaultHeaderTimeout = 10 * time.Second
+
+	videoHeaderSize = 8
+
+	// VideoHeaderMagic may lead the video header, written as a uint32 in
+	// the byte order of the fields after it, so the header's byte order
+	// can be told from its first four bytes: "RITA" big-endian, "ATIR"
+	// little-endian. A header without it is little-endian; no width comes
+	// near the magic's value, so the two cannot be confused.
+	VideoHeaderMagic     uint32 = 0x52495441
+	videoHeaderMagicSize        = 4
+)
+
+// ErrBadHeader matches, via errors.Is, every HeaderError.
+var ErrBadHeader = errors.New("bad video header")
+
+// HeaderError reports a video header that did not arrive in full.
+type HeaderError struct {
+	// Received is how many of the Size header bytes were read: eight,
+	// four more each with Config.FrameRateFromHeader and
+	// Config.PixelFormatFromHeader, and four more after VideoHeaderMagic.
+	Received int
+	Size     int
+	Err      error
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("reading video header: got %d of %d bytes: %v", e.Received, e.Size, e.Err)
+}
+
+func (e *HeaderError) Unwrap() []error {
+	return []error{ErrBadHeader, e.Err}
+}
+
+// headerRetryInterval is the pause between reads while the producer has
+// closed its end of the pipe and a new writer may yet open it.
+const headerRetryInterval = 10 * time.Millisecond
+
+// VideoHeader is the preamble the producer writes to the video pipe ahead of
+// the first frame: width and height as uint32s, followed with
+// Config.FrameRateFromHeader by the frame rate, zero for Config.FrameRate,
+// and then with Config.PixelFormatFromHeader by the PixelFormat's
+// HeaderCode, zero for Config.PixelFormat. They are little-endian unless
+// VideoHeaderMagic leads them in another byte order.
+type VideoHeader struct {
+	Width       uint32
+	Height      uint32
+	FrameRate   uint32
+	PixelFormat uint32
+	// ByteOrder is the order VideoHeaderMagic was read in, nil for a
+	// header without it.
+	ByteOrder binary.ByteOrder
+}
+
+// headerFields says which of the optional fields follow the dimensions in
+// the video header, in the order they are listed.
+type headerFields struct {
+	rate   bool // Config.FrameRateFromHeader
+	format bool // Config.PixelFormatFromHeader
+}
+
+// size is the size of the header with these fields, without the magic.
+func (f headerFields) size() int {
+	size := videoHeaderSize
+	if f.rate {
+		size += 4
+	}
+	if f.format {
+		size += 4
+	}
+	return size
+}
+
+// order is the byte order of h's fields.
+func (h VideoHeader) order() binary.ByteOrder {
+	if h.ByteOrder == nil {
+		return binary.LittleEndian
+	}
+	return h.ByteOrder
+}
+
+// readVideoHeader reads the header, tolerating a producer that writes it
+// in pieces or reopens the pipe part way through. It keeps reading until
+// all the bytes of fields arrive or timeout elapses; zero waits
+// indefinitely. The timeout interrupts a blocked read only when
+// r supports read deadlines, as FIFOs do. The fields are decoded in the
+// byte order VideoHeaderMagic gives, if the header opens with it.
+func readVideoHeader(r io.Reader, timeout time.Duration, fields headerFields) (VideoHeader, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+		if d, ok := r.(interface{ SetReadDeadline(time.Time) error }); ok {
+			if d.SetReadDeadline(deadline) == nil {
+				defer d.SetReadDeadline(time.Time{})
+			}
+		}
+	}
+
+	size := fields.size()
+	buf := make([]byte, size, videoHeaderMagicSize+size)
+	// The first four bytes are either the magic or the width, so the rest
+	// is known to be four bytes longer only once they are in.
+	received := 0
+	var h VideoHeader
+	for received < len(buf) {
+		n, err := r.Read(buf[received:])
+		if received < videoHeaderMagicSize && received+n >= videoHeaderMagicSize {
+			switch VideoHeaderMagic {
+			case binary.BigEndian.Uint32(buf):
+				h.ByteOrder = binary.BigEndian
+			case binary.LittleEndian.Uint32(buf):
+				h.ByteOrder = binary.LittleEndian
+			}
+			if h.ByteOrder != nil {
+				buf = buf[:videoHeaderMagicSize+size]
+			}
+		}
+		received += n
+		if received == len(buf) {
+			break
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = errors.New("timed out")
+			}
+			return VideoHeader{}, &HeaderError{Received: received, Size: len(buf), Err: err}
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			time.Sleep(headerRetryInterval)
+		default:
+			return VideoHeader{}, &HeaderError{Received: received, Size: len(buf), Err: err}
+		}
+	}
+	if h.ByteOrder != nil {
+		buf = buf[videoHeaderMagicSize:]
+	}
+	order := h.order()
+	h.Width, h.Height = order.Uint32(buf[0:]), order.Uint32(buf[4:])
+	buf = buf[videoHeaderSize:]
+	if fields.rate {
+		h.FrameRate, buf = order.Uint32(buf), buf[4:]
+	}
+	if fields.format {
+		h.PixelFormat = order.Uint32(buf)
+	}
+	return h, nil
+}
+
+// encode returns h as the producer sends it, with the optional fields of
+// fields and led by VideoHeaderMagic if it was.
+func (h VideoHeader) encode(fields headerFields) []byte {
+	values := []uint32{h.Width, h.Height}
+	if fields.rate {
+		values = append(values, h.FrameRate)
+	}
+	if fields.format {
+		values = append(values, h.PixelFormat)
+	}
+	if h.ByteOrder != nil {
+		values = append([]uint32{VideoHeaderMagic}, values...)
+	}
+	order := h.order()
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		order.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// dump describes h, as read, for an error about a header that made no
+// sense: its bytes in hex and, when a header without VideoHeaderMagic
+// makes sensible dimensions read big-endian, a hint that the producer
+// writes big-endian and should lead with the magic.
+func (h VideoHeader) dump(fields headerFields, min, max uint32) string {
+	d := fmt.Sprintf("header bytes % x", h.encode(fields))
+	if h.ByteOrder != nil {
+		return d
+	}
+	width, height := bits.ReverseBytes32(h.Width), bits.ReverseBytes32(h.Height)
+	if ValidateDimensions(width, height, min, max) == nil {
+		d += fmt.Sprintf("; read big-endian they are %dx%d, so the producer may be big-endian and should send VideoHeaderMagic first", width, height)
+	}
+	return d
+}
+
+// ValidateDimensions checks that width and height are within [min, max]
+// and even, as yuv420p subsamples chroma by two in both directions.
+func ValidateDimensions(width, height, min, max uint32) error {
+	if width < min || width > max || height < min || height > max {
+		return fmt.Errorf("frame dimensions %dx%d outside allowed range %d..%d", width, height, min, max)
+	}
+	if width%2 != 0 || height%2 != 0 {
+		return fmt.Errorf("frame dimensions %dx%d must be even for yuv420p", width, height)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestValidateDimensions(t *testing.T) {
+	for _, tt := range []struct {
+		width, height uint32
+		ok            bool
+	}{
+		{DefaultMinDimension, DefaultMinDimension, true},
+		{DefaultMaxDimension, DefaultMaxDimension, true},
+		{DefaultMinDimension - 2, DefaultMinDimension, false},
+		{DefaultMinDimension, DefaultMaxDimension + 2, false},
+		{0, 0, false},
+		{65535, 65535, false},
+		{640, 361, false},
+		{641, 360, false},
+		{640, 360, true},
+	} {
+		err := ValidateDimensions(tt.width, tt.height, DefaultMinDimension, DefaultMaxDimension)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateDimensions(%d, %d) = %v, want ok %v", tt.width, tt.height, err, tt.ok)
+		}
+	}
+}
+
+// testHeader is the video header the producer sends for width and height.
+func testHeader(width, height uint32) []byte {
+	return binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, width), height)
+}
+
+// readTestHeader runs Start's header read on header as the video pipe.
+func readTestHeader(t *testing.T, cfg Config, header []byte) (*Streamer, error) {
+	t.Helper()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pr.Close() })
+	if _, err := pw.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	s := New(cfg)
+	s.rawVideo = pr
+	return s, s.readHeader()
+}
+
+func TestReadHeaderRejectsDimensions(t *testing.T) {
+	for _, size := range [][2]uint32{{0, 0}, {65535, 65535}, {641, 480}, {8, 8}} {
+		if _, err := readTestHeader(t, Config{}, testHeader(size[0], size[1])); err == nil {
+			t.Errorf("%dx%d header accepted", size[0], size[1])
+		}
+	}
+	s, err := readTestHeader(t, Config{}, testHeader(640, 480))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.frameWidth != 640 || s.frameHeight != 480 {
+		t.Errorf("read %dx%d, want 640x480", s.frameWidth, s.frameHeight)
+	}
+	// The range is the configured one.
+	if _, err := readTestHeader(t, Config{MinDimension: 64, MaxDimension: 320}, testHeader(640, 480)); err == nil {
+		t.Error("640x480 header accepted with a maximum of 320")
+	}
+}
+
+func TestReadVideoHeaderTruncated(t *testing.T) {
+	_, err := readVideoHeader(bytes.NewReader(testHeader(640, 480)[:5]), 100*time.Millisecond, headerFields{})
+	var herr *HeaderError
+	if !errors.As(err, &herr) || !errors.Is(err, ErrBadHeader) {
+		t.Fatalf("truncated header: %v, want a HeaderError", err)
+	}
+	if herr.Received != 5 || herr.Size != videoHeaderSize {
+		t.Errorf("got %d of %d bytes, want 5 of %d", herr.Received, herr.Size, videoHeaderSize)
+	}
+}
+
+func TestReadVideoHeaderInPieces(t *testing.T) {
+	h, err := readVideoHeader(iotest.OneByteReader(bytes.NewReader(testHeader(640, 480))), time.Second, headerFields{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Width != 640 || h.Height != 480 {
+		t.Errorf("read %dx%d, want 640x480", h.Width, h.Height)
+	}
+}
+
+func TestReadVideoHeaderByteOrder(t *testing.T) {
+	// 640x480 at 30 fps, written out by hand so that a fault in encode
+	// cannot hide one in readVideoHeader.
+	little := []byte{0x80, 0x02, 0, 0, 0xe0, 0x01, 0, 0, 30, 0, 0, 0}
+	big := []byte{0, 0, 0x02, 0x80, 0, 0, 0x01, 0xe0, 0, 0, 0, 30}
+	for _, tt := range []struct {
+		name   string
+		header []byte
+		order  binary.ByteOrder
+	}{
+		{"little-endian", little, nil},
+		{"little-endian with magic", append([]byte("ATIR"), little...), binary.LittleEndian},
+		{"big-endian with magic", append([]byte("RITA"), big...), binary.BigEndian},
+	} {
+		// Reads of one, two and three bytes split the magic across reads.
+		for _, size := range []int{1, 2, 3, len(tt.header)} {
+			r := &pieceReader{data: bytes.Clone(tt.header), sizes: []int{size}}
+			h, err := readVideoHeader(r, time.Second, headerFields{rate: true})
+			if err != nil {
+				t.Errorf("%s in reads of %d: %v", tt.name, size, err)
+				continue
+			}
+			if h.Width != 640 || h.Height != 480 || h.FrameRate != 30 || h.ByteOrder != tt.order {
+				t.Errorf("%s in reads of %d: read %dx%d at %d fps in %v, want 640x480 at 30 in %v",
+					tt.name, size, h.Width, h.Height, h.FrameRate, h.ByteOrder, tt.order)
+			}
+		}
+	}
+
+	// Without the magic a big-endian header reads as nonsense, which
+	// readHeader rejects with a hint at the byte order.
+	_, err := readTestHeader(t, Config{}, big[:videoHeaderSize])
+	if !errors.Is(err, ErrBadHeader) || !strings.Contains(err.Error(), "640x480") {
+		t.Errorf("big-endian header without the magic: %v, want ErrBadHeader naming 640x480", err)
+	}
+}
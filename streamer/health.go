@@ -0,0 +1,128 @@
+package streamer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// healthShutdownTimeout bounds waiting for in-flight health requests when
+// the streamer stops.
+const healthShutdownTimeout = time.Second
+
+// HealthStats is the body of the health server's /stats.
+type HealthStats struct {
+	Video FrameStats `json:"video"`
+	Audio FrameStats `json:"audio"`
+	// Participants counts the remote participants, as
+	// Stats.RemoteParticipants does.
+	Participants int `json:"participants"`
+	// ConnectionState is the room connection's lksdk.ConnectionState,
+	// "disconnected" while parked or before joining.
+	ConnectionState lksdk.ConnectionState `json:"connection_state"`
+	Published       bool                  `json:"published"`
+	// EncoderBreakerOpen is Stats.EncoderBreakerOpen.
+	EncoderBreakerOpen bool `json:"encoder_breaker_open"`
+	// RTP is Streamer.RTPStats, what was sent on the wire.
+	RTP map[string]RTPSendStats `json:"rtp,omitempty"`
+	// Reconnects counts the SDK's reconnections to the room, and
+	// RejoinAttempts the streamer's own attempts to rejoin it after the
+	// connection was lost for good, for Config.MaxRejoinAttempts.
+	Reconnects     int64 `json:"reconnects"`
+	RejoinAttempts int64 `json:"rejoin_attempts"`
+	// DroppedVideoFrames and DroppedAudioChunks are Stats'.
+	DroppedVideoFrames map[DropReason]int64 `json:"dropped_video_frames"`
+	DroppedAudioChunks map[DropReason]int64 `json:"dropped_audio_chunks"`
+	// Startup is the stage Start is in, StartupDone once it has succeeded.
+	Startup StartupStage `json:"startup_stage"`
+}
+
+// HealthStats returns what the health server's /stats reports.
+func (s *Streamer) HealthStats() HealthStats {
+	var st Stats
+	s.breaker.fill(&st)
+	s.fillDropped(&st)
+	h := HealthStats{
+		Video:              s.VideoStats(),
+		Audio:              s.AudioStats(),
+		Participants:       s.participants.ParticipantCount(),
+		ConnectionState:    lksdk.ConnectionStateDisconnected,
+		Published:          s.published(),
+		EncoderBreakerOpen: st.EncoderBreakerOpen,
+		RTP:                s.RTPStats(),
+		Reconnects:         s.reconnects.Load(),
+		RejoinAttempts:     s.rejoinAttempts.Load(),
+		DroppedVideoFrames: st.DroppedVideoFrames,
+		DroppedAudioChunks: st.DroppedAudioChunks,
+		Startup:            s.startup.get(),
+	}
+	if room := s.room; room != nil {
+		h.ConnectionState = room.ConnectionState()
+	}
+	return h
+}
+
+// published reports whether the tracks are published, both unless
+// DisableVideo or DisableAudio leaves one out, which they are not while
+// parked.
+func (s *Streamer) published() bool {
+	if s.cfg.Sink != nil {
+		return (s.sinkVideo.Load() || s.cfg.DisableVideo) && (s.sinkAudio.Load() || s.cfg.DisableAudio)
+	}
+	s.encMu.Lock()
+	video := s.videoPub != nil
+	s.encMu.Unlock()
+	return (video || s.cfg.DisableVideo) && (s.audioPub != nil || s.cfg.DisableAudio) && !s.parked.Load()
+}
+
+// startHealthServer serves Config.HealthAddr until the streamer stops:
+// /healthz answers 200 while the tracks are published and the encoder
+// restart breaker is closed, and 503 otherwise, for a liveness probe,
+// /stats answers HealthStats as JSON and /metrics the same in the
+// Prometheus text format.
+func (s *Streamer) startHealthServer() error {
+	l, err := listenAddr(s.cfg.HealthAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		h := s.HealthStats()
+		if !h.Published || h.EncoderBreakerOpen {
+			http.Error(w, "not publishing", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.HealthStats())
+	})
+	mux.Handle("GET /metrics", s.MetricsHandler())
+	s.health = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.health.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.errorf("Health server on %s failed: %v", s.cfg.HealthAddr, err)
+			s.reportError(err, false)
+		}
+	}()
+	s.log.infof("Health server listening on %s", s.cfg.HealthAddr)
+	return nil
+}
+
+// stopHealthServer shuts the health server down, letting requests in
+// flight finish for up to healthShutdownTimeout.
+func (s *Streamer) stopHealthServer() {
+	if s.health == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	defer cancel()
+	s.health.Shutdown(ctx)
+}
@@ -0,0 +1,216 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/h264reader"
+)
+
+// DefaultHotSwapLead is how long both encoders run before a hot swap hands
+// over when Config.HotSwapLead is zero.
+const DefaultHotSwapLead = time.Second
+
+// hotSwapFrames is the number of frames the new encoder of a hot swap is
+// given alongside the old one: Config.HotSwapLead at the frame rate.
+func (s *Streamer) hotSwapFrames() int {
+	return max(1, int(s.cfg.HotSwapLead/s.cfg.frameInterval()))
+}
+
+// hotSwapVideoEncoder starts an encoder for enc next to the running one
+// for Config.HotSwapReconfigure. Both are fed every frame for
+// Config.HotSwapLead, long enough for the new one to have opened its NVENC
+// session and caught up, and the new one is forced to make a keyframe of
+// the frame after that. The old encoder is given every frame up to there
+// and then its input is closed, and the track carries on from that
+// keyframe with the new encoder's output, whose earlier frames duplicate
+// the old one's and are discarded. The track sees no gap, where a cold
+// swap waits out the new process's start after the old one has drained.
+//
+// The new encoder needs a slot of its own under SetEncoderLimit, for the
+// whole lead instead of the moment of a cold swap, and never waits for
+// one. If it cannot start, exits or the swap is cancelled by another
+// encoder change before the handover, it is stopped and the running
+// encoder carries on.
+func (s *Streamer) hotSwapVideoEncoder(enc EncoderConfig) error {
+	at := s.hotSwapFrames()
+	cmd, stdin, stdout, err := s.startVideoEncoder(enc, true, at)
+	if err != nil {
+		return err
+	}
+	// Until it takes over, the new encoder exiting is this call's failure
+	// rather than the session's.
+	s.retired.Store(cmd, true)
+	exited := s.watchProcess("video", cmd)
+	out := newHandoverReader(stdout, s.VideoCodec(), at, s.log)
+	done := s.videoFeed.handover(stdin, at, func() { s.videoOut.queue(out) })
+
+	var cause error
+	swapped := false
+	select {
+	case swapped = <-done:
+	case <-exited:
+		cause = errors.New("new video encoder exited before taking over")
+	case <-time.After(s.cfg.HotSwapLead + warmupTimeout):
+		cause = errors.New("new video encoder was not fed in time")
+	case <-s.ctx.Done():
+		cause = fmt.Errorf("%w: stopped during a hot swap", ErrNotRunning)
+	}
+	if cause != nil {
+		// The feeder may have handed over meanwhile, in which case the
+		// new encoder is live and is kept.
+		s.videoFeed.cancelHandover(stdin)
+		swapped = <-done
+	}
+	if !swapped {
+		if cause == nil {
+			cause = errors.New("cancelled by another encoder change")
+		}
+		out.Close()
+		cmd.Process.Kill()
+		return fmt.Errorf("hot swapping the video encoder: %w", cause)
+	}
+
+	s.encMu.Lock()
+	old, oldExited := s.videoCmd, s.videoExited
+	s.retired.Store(old, true)
+	s.retired.Delete(cmd)
+	s.videoCmd, s.videoExited = cmd, exited
+	s.encMu.Unlock()
+	s.reapRetired(old, oldExited)
+	s.log.infof("[Video] New encoder took over after %d frame(s) alongside the old one", at)
+	return nil
+}
+
+// handoverReader is the output of an encoder taking over a stream in a hot
+// swap. The pictures before the handover duplicate what the old encoder
+// published and are read and discarded as they come, so the encoder is
+// never held up by its output; reads then return the stream from the
+// first keyframe at or after picture at, with the parameter sets ahead of
+// it for H264, or without the file header for VP8, as spliced after the
+// old encoder's output.
+type handoverReader struct {
+	src   io.ReadCloser
+	ready chan struct{} // closed once r or err is set
+	r     io.Reader
+	err   error
+}
+
+func newHandoverReader(src io.ReadCloser, mime string, at int, log logger) *handoverReader {
+	h := &handoverReader{src: src, ready: make(chan struct{})}
+	go func() {
+		defer close(h.ready)
+		if mime == webrtc.MimeTypeVP8 {
+			h.r, h.err = skipIVFFrames(src, at, log)
+		} else {
+			h.r, h.err = skipH264Pictures(src, at, log)
+		}
+	}()
+	return h
+}
+
+func (h *handoverReader) Read(p []byte) (int, error) {
+	<-h.ready
+	if h.err != nil {
+		return 0, h.err
+	}
+	return h.r.Read(p)
+}
+
+func (h *handoverReader) Close() error {
+	return h.src.Close()
+}
+
+// skipH264Pictures discards the first at pictures of an Annex-B stream and
+// any up to the next IDR, returning the stream from that IDR's parameter
+// sets on.
+func skipH264Pictures(r io.Reader, at int, log logger) (io.Reader, error) {
+	nals, err := h264reader.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var held []byte // the NAL units since the last slice
+	pictures := 0
+	for {
+		nal, err := nals.NextNAL()
+		if err != nil {
+			return nil, err
+		}
+		slice := nal.UnitType == h264reader.NalUnitTypeCodedSliceNonIdr || nal.UnitType == h264reader.NalUnitTypeCodedSliceIdr
+		if !slice {
+			held = appendAnnexB(held, nal.Data)
+			continue
+		}
+		// A slice whose first_mb_in_slice is 0 starts a picture.
+		if len(nal.Data) > 1 && nal.Data[1]&0x80 != 0 {
+			if pictures >= at {
+				if nal.UnitType == h264reader.NalUnitTypeCodedSliceIdr {
+					return io.MultiReader(bytes.NewReader(appendAnnexB(held, nal.Data)), &annexBReader{nals: nals}), nil
+				}
+				if pictures == at {
+					log.infof("[Video] Hot swap picture %d is not a keyframe, handing over at the next one", at)
+				}
+			}
+			pictures++
+		}
+		held = held[:0]
+	}
+}
+
+func appendAnnexB(b, nal []byte) []byte {
+	return append(append(b, 0, 0, 0, 1), nal...)
+}
+
+// annexBReader writes the NAL units of an h264reader.H264Reader back out as
+// an Annex-B stream.
+type annexBReader struct {
+	nals *h264reader.H264Reader
+	buf  []byte
+}
+
+func (a *annexBReader) Read(p []byte) (int, error) {
+	for len(a.buf) == 0 {
+		nal, err := a.nals.NextNAL()
+		if err != nil {
+			return 0, err
+		}
+		a.buf = appendAnnexB(a.buf[:0], nal.Data)
+	}
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	return n, nil
+}
+
+// skipIVFFrames discards the file header and first at frames of an IVF
+// stream and any up to the next keyframe, returning the stream from that
+// keyframe's frame header on.
+func skipIVFFrames(r io.Reader, at int, log logger) (io.Reader, error) {
+	ivf, err := NewIVFReader(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		frame, pts, err := ivf.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		if i < at {
+			continue
+		}
+		// Bit 0 of the VP8 frame tag is clear on keyframes.
+		if len(frame) > 0 && frame[0]&0x01 == 0 {
+			hdr := make([]byte, ivfFrameHeaderSize, ivfFrameHeaderSize+len(frame))
+			binary.LittleEndian.PutUint32(hdr[0:], uint32(len(frame)))
+			binary.LittleEndian.PutUint64(hdr[4:], pts)
+			return io.MultiReader(bytes.NewReader(append(hdr, frame...)), r), nil
+		}
+		if i == at {
+			log.infof("[Video] Hot swap frame %d is not a keyframe, handing over at the next one", at)
+		}
+	}
+}
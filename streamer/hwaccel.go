@@ -0,0 +1,212 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// H264 encoders the streamer can drive, chosen with Config.H264Encoder.
+// NVENC is the default; the software encoder is used when the chosen one
+// is unusable and Config.RequireHardware is not set.
+const (
+	HardwareVideoEncoder     = "h264_nvenc"
+	QSVVideoEncoder          = "h264_qsv"          // Intel Quick Sync
+	VideoToolboxVideoEncoder = "h264_videotoolbox" // macOS
+	SoftwareVideoEncoder     = "libx264"
+)
+
+// isHardwareEncoder reports whether encoder runs on a GPU or media engine.
+func isHardwareEncoder(encoder string) bool {
+	for _, enc := range knownEncoders {
+		if enc.Name == encoder {
+			return enc.Hardware
+		}
+	}
+	return false
+}
+
+// ffmpegEncoders lists the encoders of the host's ffmpeg build, read from
+// ffmpeg -encoders once per process.
+var ffmpegEncoders = sync.OnceValues(func() (map[string]bool, error) {
+	out, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing ffmpeg encoders: %w", err)
+	}
+	return parseEncoderList(string(out)), nil
+})
+
+// parseEncoderList reads the encoder names out of the output of ffmpeg
+// -encoders: a legend ending in a line of dashes, then a line per encoder
+// of its flags and its name.
+func parseEncoderList(out string) map[string]bool {
+	listed := make(map[string]bool)
+	table := false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case !table:
+			// The line of dashes is a single field, so it is checked
+			// before the encoder lines' two.
+			table = strings.HasPrefix(fields[0], "---")
+		case len(fields) >= 2:
+			listed[fields[1]] = true
+		}
+	}
+	return listed
+}
+
+// probeTimeout bounds the test encode. Creating an NVENC session takes a
+// few hundred milliseconds on a healthy GPU.
+const probeTimeout = 10 * time.Second
+
+// probeVideoEncoder checks that ffmpeg lists encoder and encodes a single
+// blank frame with it. ffmpeg lists the hardware encoders whenever it was
+// built with them, so only a real encode shows whether a usable GPU and
+// driver are present; the listing saves the encode on builds without
+// them.
+func probeVideoEncoder(ctx context.Context, encoder string) error {
+	if listed, err := ffmpegEncoders(); err == nil && !listed[encoder] {
+		return fmt.Errorf("ffmpeg does not list %s", encoder)
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "color=black:s=256x256:d=0.04",
+		"-frames:v", "1",
+		"-c:v", encoder,
+		"-f", "null", "-").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s test encode failed: %w: %s", encoder, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// selectVideoEncoder picks the codec and encoder for the session,
+// probing Config.H264Encoder for H264.
+func (s *Streamer) selectVideoEncoder() error {
+	if s.cfg.e2ee() {
+		// VP8 is the only video the streamer can encrypt.
+		if err := probeVideoEncoder(s.ctx, VP8VideoEncoder); err != nil {
+			return fmt.Errorf("%w: end-to-end encryption needs %s: %w", ErrEncoderUnavailable, VP8VideoEncoder, err)
+		}
+		s.videoCodec, s.videoEncoder, s.hardwareEncoding = webrtc.MimeTypeVP8, VP8VideoEncoder, false
+		s.log.infof("End-to-end encrypting the tracks; publishing %s with %s", webrtc.MimeTypeVP8, VP8VideoEncoder)
+		return nil
+	}
+	if s.cfg.VideoCodec == VideoCodecVP8 {
+		if err := probeVideoEncoder(s.ctx, VP8VideoEncoder); err != nil {
+			return fmt.Errorf("%w: %w", ErrEncoderUnavailable, err)
+		}
+		s.videoCodec, s.videoEncoder, s.hardwareEncoding = webrtc.MimeTypeVP8, VP8VideoEncoder, false
+		s.log.infof("Publishing %s with %s", webrtc.MimeTypeVP8, VP8VideoEncoder)
+		return nil
+	}
+	encoder, err := selectH264Encoder(s.ctx, s.cfg.H264Encoder, s.cfg.RequireHardware, s.log)
+	if err != nil {
+		return err
+	}
+	s.videoEncoder, s.hardwareEncoding = encoder, isHardwareEncoder(encoder)
+	return nil
+}
+
+// SelectH264Encoder picks the H264 encoder as Start does for
+// Config.H264Encoder, for callers that run ffmpeg themselves: want,
+// HardwareVideoEncoder if empty, when ffmpeg lists it and a test encode
+// with it succeeds, and otherwise SoftwareVideoEncoder unless
+// requireHardware is set. The choice is logged to log, slog.Default() if
+// nil. VideoEncoderArgs gives the flags to encode with it.
+func SelectH264Encoder(ctx context.Context, want string, requireHardware bool, log *slog.Logger) (string, error) {
+	if want == "" {
+		want = HardwareVideoEncoder
+	}
+	return selectH264Encoder(ctx, want, requireHardware, logger{log})
+}
+
+func selectH264Encoder(ctx context.Context, want string, requireHardware bool, log logger) (string, error) {
+	err := probeVideoEncoder(ctx, want)
+	switch {
+	case err == nil && isHardwareEncoder(want):
+		log.infof("Hardware encoding active (%s)", want)
+		return want, nil
+	case err == nil:
+		log.infof("Software encoding with %s", want)
+		return want, nil
+	case want == SoftwareVideoEncoder:
+		return "", fmt.Errorf("%w: %w", ErrEncoderUnavailable, err)
+	case requireHardware:
+		return "", fmt.Errorf("%w: hardware encoding required: %w", ErrEncoderUnavailable, err)
+	}
+	log.warnf("%s unavailable, falling back to %s; expect high CPU use: %v",
+		want, SoftwareVideoEncoder, err)
+	return SoftwareVideoEncoder, nil
+}
+
+// AudioEncoder is the ffmpeg encoder of the Opus audio track.
+const AudioEncoder = "libopus"
+
+// EncoderInfo describes an ffmpeg encoder the streamer can publish with.
+type EncoderInfo struct {
+	Name     string `json:"name"`      // ffmpeg encoder name
+	Kind     string `json:"kind"`      // "video" or "audio"
+	MimeType string `json:"mime_type"` // WebRTC codec of the track it feeds
+	Hardware bool   `json:"hardware"`
+}
+
+// knownEncoders are the encoders the streamer can drive, in order of
+// preference within each codec.
+var knownEncoders = []EncoderInfo{
+	{Name: HardwareVideoEncoder, Kind: "video", MimeType: webrtc.MimeTypeH264, Hardware: true},
+	{Name: QSVVideoEncoder, Kind: "video", MimeType: webrtc.MimeTypeH264, Hardware: true},
+	{Name: VideoToolboxVideoEncoder, Kind: "video", MimeType: webrtc.MimeTypeH264, Hardware: true},
+	{Name: SoftwareVideoEncoder, Kind: "video", MimeType: webrtc.MimeTypeH264},
+	{Name: VP8VideoEncoder, Kind: "video", MimeType: webrtc.MimeTypeVP8},
+	{Name: AudioEncoder, Kind: "audio", MimeType: webrtc.MimeTypeOpus},
+}
+
+// AvailableEncoders returns the encoders the streamer supports that work
+// with this host's ffmpeg. Each that ffmpeg lists is checked with a test
+// encode, as ffmpeg lists encoders it was built with whether or not the
+// hardware is there, so the call can take a few seconds. Why an encoder is
+// unusable is logged to log, as Config.Logger is, slog.Default() if nil.
+func AvailableEncoders(log *slog.Logger) ([]EncoderInfo, error) {
+	if err := checkFFmpeg(); err != nil {
+		return nil, err
+	}
+	var usable []EncoderInfo
+	for _, enc := range knownEncoders {
+		probe := probeVideoEncoder
+		if enc.Kind == "audio" {
+			probe = probeAudioEncoder
+		}
+		if err := probe(context.Background(), enc.Name); err != nil {
+			logger{log}.infof("Encoder %s unavailable: %v", enc.Name, err)
+			continue
+		}
+		usable = append(usable, enc)
+	}
+	return usable, nil
+}
+
+// probeAudioEncoder encodes a single frame of silence with encoder.
+func probeAudioEncoder(ctx context.Context, encoder string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "anullsrc=r=48000:cl=mono:d=0.02",
+		"-c:a", encoder,
+		"-f", "null", "-").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s test encode failed: %w: %s", encoder, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
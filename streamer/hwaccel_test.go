@@ -0,0 +1,66 @@
+package streamer
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseEncoderList(t *testing.T) {
+	out := `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ A....D libopus              libopus Opus (codec opus)
+`
+	got := slices.Sorted(maps.Keys(parseEncoderList(out)))
+	want := []string{"h264_nvenc", "libopus", "libx264"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseEncoderList = %v, want %v", got, want)
+	}
+	// The legend's entries must not be taken for encoders.
+	if listed := parseEncoderList(" V..... = Video\n"); len(listed) != 0 {
+		t.Errorf("legend without dashes listed %v", slices.Collect(maps.Keys(listed)))
+	}
+}
+
+func TestAvailableEncoders(t *testing.T) {
+	setFakeFFmpeg(t, "fail="+HardwareVideoEncoder)
+	var buf bytes.Buffer
+	encoders, err := AvailableEncoders(slog.New(slog.NewTextHandler(&buf, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, enc := range encoders {
+		names = append(names, enc.Name)
+	}
+	if slices.Contains(names, HardwareVideoEncoder) || !slices.Contains(names, SoftwareVideoEncoder) ||
+		!slices.Contains(names, AudioEncoder) {
+		t.Errorf("AvailableEncoders = %v, want all but %s", names, HardwareVideoEncoder)
+	}
+	// The failure is logged through the logger passed in.
+	if !strings.Contains(buf.String(), "Encoder "+HardwareVideoEncoder+" unavailable") {
+		t.Errorf("log %q does not report %s unavailable", buf.String(), HardwareVideoEncoder)
+	}
+}
+
+func TestSelectH264Encoder(t *testing.T) {
+	setFakeFFmpeg(t, "fail="+HardwareVideoEncoder)
+	ctx := t.Context()
+	if enc, err := SelectH264Encoder(ctx, "", false, nil); err != nil || enc != SoftwareVideoEncoder {
+		t.Errorf("unusable default = %q, %v, want the %s fallback", enc, err, SoftwareVideoEncoder)
+	}
+	if enc, err := SelectH264Encoder(ctx, QSVVideoEncoder, false, nil); err != nil || enc != QSVVideoEncoder {
+		t.Errorf("usable %s = %q, %v", QSVVideoEncoder, enc, err)
+	}
+	if _, err := SelectH264Encoder(ctx, HardwareVideoEncoder, true, nil); !errors.Is(err, ErrEncoderUnavailable) {
+		t.Errorf("unusable encoder with hardware required = %v, want ErrEncoderUnavailable", err)
+	}
+}
@@ -0,0 +1,47 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DefaultIdentity returns "Avatar-" followed by a random version 4 UUID.
+// With 122 random bits it is safe to use across any number of streamers.
+func DefaultIdentity() (string, error) {
+	return PrefixedIdentity("Avatar-")()
+}
+
+// PrefixedIdentity returns a Config.IdentityFunc that generates identities
+// like DefaultIdentity's with prefix in place of "Avatar-".
+func PrefixedIdentity(prefix string) func() (string, error) {
+	return func() (string, error) {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return "", fmt.Errorf("generating identity: %w", err)
+		}
+		return prefix + id.String(), nil
+	}
+}
+
+// resolveIdentity picks the participant identity: a fixed Identity wins,
+// then IdentityFunc, then DefaultIdentity.
+func (c *Config) resolveIdentity() error {
+	if c.Identity != "" {
+		return nil
+	}
+	gen := c.IdentityFunc
+	if gen == nil {
+		gen = DefaultIdentity
+	}
+	id, err := gen()
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return errors.New("identity generator returned an empty identity")
+	}
+	c.Identity = id
+	return nil
+}
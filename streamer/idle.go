@@ -0,0 +1,65 @@
+package streamer
+
+import (
+	"io"
+)
+
+// idleGate puts a dropping gate for Config.PauseWhenIdle in front of r,
+// counting its drops in drops.
+func (s *Streamer) idleGate(r io.Reader, unit int, drops *dropCounts) io.Reader {
+	if !s.cfg.PauseWhenIdle {
+		return r
+	}
+	g := newInputGate(r, unit, true, s.ctx.Done()).countAs(drops, DropPaused)
+	s.idleMu.Lock()
+	s.idleGates = append(s.idleGates, g)
+	s.idleMu.Unlock()
+	return g
+}
+
+// armIdle starts acting on participant changes once both tracks are
+// published, pausing straight away if nobody is in the room.
+func (s *Streamer) armIdle() {
+	if !s.cfg.PauseWhenIdle {
+		return
+	}
+	s.idleMu.Lock()
+	s.idleArmed = true
+	s.idleMu.Unlock()
+	s.setIdle(s.participants.ParticipantCount() == 0)
+}
+
+// setIdle pauses or resumes encoding.
+func (s *Streamer) setIdle(idle bool) {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if !s.idleArmed || idle == s.idle || s.ctx.Err() != nil {
+		return
+	}
+	s.idle = idle
+
+	if idle {
+		for _, g := range s.idleGates {
+			g.pause()
+		}
+		s.log.infof("No remote participants, pausing encoding")
+		s.emit(EventEncodingPaused, nil)
+		return
+	}
+
+	for _, g := range s.idleGates {
+		g.resume()
+	}
+	// The encoder would carry on with P-frames referencing frames from
+	// before the pause; a fresh one starts with an IDR instead.
+	if s.videoFeed != nil {
+		s.encMu.Lock()
+		err := s.replaceVideoEncoder(s.videoEncoder)
+		s.encMu.Unlock()
+		if err != nil {
+			s.log.warnf("Restarting video encoder on resume: %v; waiting for the next GOP keyframe", err)
+		}
+	}
+	s.log.infof("Participant joined, resuming encoding")
+	s.emit(EventEncodingResumed, nil)
+}
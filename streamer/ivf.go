@@ -0,0 +1,116 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	ivfFileHeaderSize  = 32
+	ivfFrameHeaderSize = 12
+)
+
+// IVFHeader is the 32-byte file header of an IVF container.
+type IVFHeader struct {
+	FourCC        string
+	Width         uint16
+	Height        uint16
+	TimebaseDenom uint32
+	TimebaseNum   uint32
+	FrameCount    uint32
+}
+
+// MimeType maps the header FourCC to the matching WebRTC codec.
+func (h IVFHeader) MimeType() (string, error) {
+	switch h.FourCC {
+	case "VP80":
+		return webrtc.MimeTypeVP8, nil
+	case "VP90":
+		return webrtc.MimeTypeVP9, nil
+	case "AV01":
+		return webrtc.MimeTypeAV1, nil
+	}
+	return "", fmt.Errorf("unsupported IVF codec %q", h.FourCC)
+}
+
+// IVFReader reads frames and their container timestamps from an IVF stream.
+type IVFReader struct {
+	r      io.Reader
+	Header IVFHeader
+}
+
+func NewIVFReader(r io.Reader) (*IVFReader, error) {
+	var hdr [ivfFileHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading IVF header: %w", err)
+	}
+	if string(hdr[0:4]) != "DKIF" {
+		return nil, errors.New("not an IVF stream: missing DKIF signature")
+	}
+	headerSize := binary.LittleEndian.Uint16(hdr[6:8])
+	h := IVFHeader{
+		FourCC:        string(hdr[8:12]),
+		Width:         binary.LittleEndian.Uint16(hdr[12:14]),
+		Height:        binary.LittleEndian.Uint16(hdr[14:16]),
+		TimebaseDenom: binary.LittleEndian.Uint32(hdr[16:20]),
+		TimebaseNum:   binary.LittleEndian.Uint32(hdr[20:24]),
+		FrameCount:    binary.LittleEndian.Uint32(hdr[24:28]),
+	}
+	if h.TimebaseDenom == 0 || h.TimebaseNum == 0 {
+		return nil, fmt.Errorf("invalid IVF timebase %d/%d", h.TimebaseNum, h.TimebaseDenom)
+	}
+	// Skip any extension bytes beyond the standard header.
+	if extra := int64(headerSize) - ivfFileHeaderSize; extra > 0 {
+		if _, err := io.CopyN(io.Discard, r, extra); err != nil {
+			return nil, fmt.Errorf("reading IVF header: %w", err)
+		}
+	}
+	return &IVFReader{r: r, Header: h}, nil
+}
+
+// ReadFrame returns the next frame payload and its presentation timestamp.
+func (r *IVFReader) ReadFrame() ([]byte, uint64, error) {
+	var hdr [ivfFrameHeaderSize]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("truncated IVF frame header: %w", err)
+		}
+		return nil, 0, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[0:4])
+	pts := binary.LittleEndian.Uint64(hdr[4:12])
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r.r, frame); err != nil {
+		return nil, 0, fmt.Errorf("truncated IVF frame: %w", err)
+	}
+	return frame, pts, nil
+}
+
+// ivfBodyReader reads an IVF stream without its file header, so that the
+// frames of a restarted encoder can be spliced after those of the one it
+// replaced.
+type ivfBodyReader struct {
+	io.ReadCloser
+	skipped bool
+}
+
+func (r *ivfBodyReader) Read(p []byte) (int, error) {
+	if !r.skipped {
+		if _, err := io.CopyN(io.Discard, r.ReadCloser, ivfFileHeaderSize); err != nil {
+			return 0, err
+		}
+		r.skipped = true
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// PTSDuration converts a timestamp delta in container timebase units to a duration.
+func (r *IVFReader) PTSDuration(delta uint64) time.Duration {
+	return time.Duration(delta) * time.Second * time.Duration(r.Header.TimebaseNum) / time.Duration(r.Header.TimebaseDenom)
+}
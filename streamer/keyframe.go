@@ -0,0 +1,206 @@
+package streamer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// keyframeMonitor checks that the encoder emits IDR frames at roughly the
+// cadence it was configured for. Some NVENC builds ignore the requested
+// GOP or -force_key_frames expression, leaving joining viewers with no
+// decodable frame.
+type keyframeMonitor struct {
+	mu       sync.Mutex
+	expected time.Duration
+	started  time.Time
+	last     time.Time
+	count    int
+	overdue  bool
+	log      logger
+}
+
+func newKeyframeMonitor(log logger) *keyframeMonitor {
+	return &keyframeMonitor{log: log}
+}
+
+// setExpected sets the keyframe interval the encoder was configured for.
+func (m *keyframeMonitor) setExpected(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expected = d
+}
+
+// keyframe records an IDR frame.
+func (m *keyframeMonitor) keyframe(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.overdue {
+		m.log.infof("[Video] Keyframe received after %v, encoder is producing keyframes again", now.Sub(m.last))
+		m.overdue = false
+	}
+	m.last = now
+	m.count++
+}
+
+// frame checks, on every frame, whether a keyframe is overdue. It warns
+// once per overdue period when no IDR has been seen for 1.5x the expected
+// interval, and reports true with the time since the last IDR on that
+// frame.
+func (m *keyframeMonitor) frame(now time.Time) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started.IsZero() {
+		m.started = now
+	}
+	since := m.last
+	if since.IsZero() {
+		since = m.started
+	}
+	if m.overdue || m.expected <= 0 || now.Sub(since) < m.expected*3/2 {
+		return 0, false
+	}
+	m.overdue = true
+	if m.last.IsZero() {
+		m.log.warnf("[Video] No keyframe in the first %v, expected one every %v", now.Sub(since), m.expected)
+	} else {
+		m.log.warnf("[Video] No keyframe for %v, expected one every %v; the encoder may be ignoring forced keyframes",
+			now.Sub(since), m.expected)
+	}
+	return now.Sub(since), true
+}
+
+// lastKeyframeAgo reports the time since the most recent IDR frame, or
+// zero if none has been seen yet.
+func (m *keyframeMonitor) lastKeyframeAgo() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last.IsZero() {
+		return 0
+	}
+	return time.Since(m.last)
+}
+
+// DefaultKeyframeBurstInterval is the spacing of the keyframes of
+// Config.KeyframeBurst when Config.KeyframeBurstInterval is zero.
+const DefaultKeyframeBurstInterval = 200 * time.Millisecond
+
+// keyframeBurstExpr is the -force_key_frames expression that forces count
+// keyframes, the first on the first frame and the rest interval apart.
+// Later keyframes come from the GOP alone.
+func keyframeBurstExpr(count int, interval time.Duration) string {
+	return fmt.Sprintf("expr:lt(n_forced,%d)*(isnan(prev_forced_t)+gte(t-prev_forced_t,%g))",
+		count, interval.Seconds())
+}
+
+// KeyframeIntervalArgs are the ffmpeg flags that put a keyframe every
+// interval into video encoded at fps frames per second, as
+// Config.KeyframeInterval does: a GOP of fps × interval frames, and
+// keyframes forced at multiples of interval so the cadence holds in
+// seconds even where the encoder stretches the GOP.
+func KeyframeIntervalArgs(fps int, interval time.Duration) []string {
+	return []string{
+		"-g", strconv.Itoa(keyframeIntervalGOP(fps, interval)),
+		"-force_key_frames", keyframeIntervalExpr(interval),
+	}
+}
+
+// keyframeIntervalGOP is fps × interval in frames, rounded and at least
+// one.
+func keyframeIntervalGOP(fps int, interval time.Duration) int {
+	return max(1, int(math.Round(float64(fps)*interval.Seconds())))
+}
+
+// keyframeIntervalExpr is the -force_key_frames expression that forces a
+// keyframe at every multiple of interval.
+func keyframeIntervalExpr(interval time.Duration) string {
+	return fmt.Sprintf("expr:gte(t,n_forced*%g)", interval.Seconds())
+}
+
+// DefaultKeyframeDebounce is the window within which keyframe requests are
+// coalesced when Config.KeyframeDebounce is zero.
+const DefaultKeyframeDebounce = time.Second
+
+// keyframeScheduler is the single path through which keyframes are
+// requested, whether by a viewer's PLI/FIR, a reconnect or a forced
+// interval. At most one keyframe is forced per window, and a request is
+// also coalesced when the encoder's next GOP keyframe is due within the
+// window.
+//
+// force is nil unless Config.ForceKeyframes lets a request restart the
+// encoder for an IDR; requests are otherwise served by the GOP cadence.
+type keyframeScheduler struct {
+	mu         sync.Mutex
+	window     time.Duration
+	monitor    *keyframeMonitor
+	force      func()
+	lastForced time.Time
+	log        logger
+}
+
+func newKeyframeScheduler(window time.Duration, monitor *keyframeMonitor, log logger) *keyframeScheduler {
+	return &keyframeScheduler{window: window, monitor: monitor, log: log}
+}
+
+// forceVideoKeyframe restarts the video encoder, which opens with an IDR
+// frame, for Config.ForceKeyframes. It runs in the background, as a hot
+// swap waits out its lead.
+func (s *Streamer) forceVideoKeyframe() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if !s.cfg.HotSwapReconfigure {
+			s.restartVideoEncoder("keyframe")
+			return
+		}
+		if err := s.hotSwapVideoEncoder(s.EncoderConfig()); err != nil {
+			s.log.errorf("Forcing keyframe: %v", err)
+			s.reportError(fmt.Errorf("forcing keyframe: %w", err), false)
+		}
+	}()
+}
+
+// Outcomes of a keyframe request.
+const (
+	keyframeForced    = "forced"
+	keyframeCoalesced = "coalesced"
+	keyframeDeferred  = "deferred" // left to the next GOP keyframe
+)
+
+// request asks for a keyframe on behalf of reason and reports what became
+// of it.
+func (k *keyframeScheduler) request(reason string) string {
+	now := time.Now()
+
+	k.monitor.mu.Lock()
+	last, expected := k.monitor.last, k.monitor.expected
+	k.monitor.mu.Unlock()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if !k.lastForced.IsZero() && now.Sub(k.lastForced) < k.window {
+		k.log.debugf("[Video] Keyframe request (%s) coalesced, one was forced %v ago", reason, now.Sub(k.lastForced))
+		return keyframeCoalesced
+	}
+	if !last.IsZero() && now.Sub(last) < k.window {
+		k.log.debugf("[Video] Keyframe request (%s) coalesced, last keyframe was %v ago", reason, now.Sub(last))
+		return keyframeCoalesced
+	}
+	if !last.IsZero() && expected > 0 {
+		if due := last.Add(expected).Sub(now); due < k.window {
+			k.log.debugf("[Video] Keyframe request (%s) coalesced, next GOP keyframe due in %v", reason, max(due, 0))
+			return keyframeCoalesced
+		}
+	}
+	if k.force == nil {
+		k.log.debugf("[Video] Keyframe request (%s) will be served by the next GOP keyframe", reason)
+		return keyframeDeferred
+	}
+	k.lastForced = now
+	k.log.infof("[Video] Forcing keyframe (%s)", reason)
+	k.force()
+	return keyframeForced
+}
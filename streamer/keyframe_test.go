@@ -0,0 +1,33 @@
+package streamer
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeyframeIntervalArgs(t *testing.T) {
+	for _, tt := range []struct {
+		fps      int
+		interval time.Duration
+		gop      string
+		expr     string
+	}{
+		{15, 2 * time.Second, "30", "expr:gte(t,n_forced*2)"},
+		{25, 2 * time.Second, "50", "expr:gte(t,n_forced*2)"},
+		{30, 2 * time.Second, "60", "expr:gte(t,n_forced*2)"},
+		// Fractional GOPs round to the nearest frame, halves up.
+		{15, 1500 * time.Millisecond, "23", "expr:gte(t,n_forced*1.5)"},
+		{25, 500 * time.Millisecond, "13", "expr:gte(t,n_forced*0.5)"},
+		{30, 1010 * time.Millisecond, "30", "expr:gte(t,n_forced*1.01)"},
+		// An interval shorter than a frame still gives a GOP of one.
+		{15, 10 * time.Millisecond, "1", "expr:gte(t,n_forced*0.01)"},
+		{25, 20 * time.Millisecond, "1", "expr:gte(t,n_forced*0.02)"},
+		{30, 33 * time.Millisecond, "1", "expr:gte(t,n_forced*0.033)"},
+	} {
+		got := KeyframeIntervalArgs(tt.fps, tt.interval)
+		if want := []string{"-g", tt.gop, "-force_key_frames", tt.expr}; !slices.Equal(got, want) {
+			t.Errorf("KeyframeIntervalArgs(%d, %v) = %q, want %q", tt.fps, tt.interval, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRoomIdle is returned by Run when the room has stayed empty for
+// LifecyclePolicy.IdleTimeout.
+var ErrRoomIdle = errors.New("room idle")
+
+// lifecycleTick is how often Run checks for an empty room and a stall.
+const lifecycleTick = 500 * time.Millisecond
+
+// LifecyclePolicy tells Run when a session should end or needs help.
+type LifecyclePolicy struct {
+	// IdleTimeout ends the session once the room has had no remote
+	// participants for that long. Time parked does not count. Zero keeps
+	// it running.
+	IdleTimeout time.Duration
+
+	// StallTimeout is how long published video may go without a frame
+	// before it counts as stalled, whether the producer stopped writing or
+	// the encoder hung. Time spent paused for PauseWhenIdle or a reconnect,
+	// or parked, does not count. Zero disables stall detection.
+	StallTimeout time.Duration
+	// RestartOnStall restarts the video encoder once per stall, which
+	// recovers a wedged NVENC session but cannot help a producer that
+	// went quiet.
+	RestartOnStall bool
+	// OnStall is called once per stall with the time since the last frame.
+	OnStall func(since time.Duration)
+}
+
+// Run supervises a started session until it should end: ctx is cancelled
+// (nil is returned), the session's own context ends, e.g. at
+// MaxSessionDuration (its cause is returned), a fatal error such as an
+// encoder exiting is reported (that error is returned), or the room has
+// been empty for IdleTimeout (ErrRoomIdle). Stalls are reported as
+// recoverable errors and EventVideoStalled without ending the session.
+// Run does not stop the session; call Stop afterwards.
+func (s *Streamer) Run(ctx context.Context, policy LifecyclePolicy) error {
+	if s.ctx == nil {
+		return fmt.Errorf("%w: Run before Start", ErrNotRunning)
+	}
+	ticker := time.NewTicker(lifecycleTick)
+	defer ticker.Stop()
+
+	now := time.Now()
+	emptySince := time.Time{}
+	quietSince := now // frames are not expected while paused
+	stalled := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.ctx.Done():
+			return context.Cause(s.ctx)
+		case <-s.failed:
+			return s.failure
+		case now = <-ticker.C:
+		}
+
+		if policy.IdleTimeout > 0 {
+			if s.participants.ParticipantCount() > 0 || s.parked.Load() {
+				emptySince = time.Time{}
+			} else if emptySince.IsZero() {
+				emptySince = now
+			} else if now.Sub(emptySince) >= policy.IdleTimeout {
+				s.log.infof("No remote participants for %v, ending session", policy.IdleTimeout)
+				return ErrRoomIdle
+			}
+		}
+
+		if policy.StallTimeout <= 0 || s.videoTrack == nil {
+			continue
+		}
+		if s.videoPaused() {
+			quietSince, stalled = now, false
+			continue
+		}
+		last := s.stats.lastVideoFrame()
+		if last.Before(quietSince) {
+			last = quietSince
+		}
+		since := now.Sub(last)
+		if since < policy.StallTimeout {
+			if stalled {
+				s.log.infof("[Video] Frames flowing again")
+				stalled = false
+			}
+			continue
+		}
+		if stalled {
+			continue
+		}
+		stalled = true
+		s.log.warnf("[Video] No frame for %v, video has stalled", since.Round(time.Millisecond))
+		s.emit(EventVideoStalled, map[string]any{"since_last_frame": since.String(), "restart": policy.RestartOnStall})
+		s.reportError(fmt.Errorf("video stalled, no frame for %v", since.Round(time.Millisecond)), false)
+		if policy.OnStall != nil {
+			policy.OnStall(since)
+		}
+		if policy.RestartOnStall {
+			s.recoverVideoEncoder("stall")
+		}
+	}
+}
+
+// videoPaused reports whether video is held back on purpose, by
+// PauseWhenIdle, while reconnecting, while parked or until the track is
+// bound under StartupInputDrop.
+func (s *Streamer) videoPaused() bool {
+	s.idleMu.Lock()
+	idle := s.idle
+	s.idleMu.Unlock()
+	return idle || s.parked.Load() || (s.videoGate != nil && s.videoGate.paused()) ||
+		(s.videoStartGate != nil && s.videoStartGate.paused())
+}
+
+// audioPaused is videoPaused for the audio input.
+func (s *Streamer) audioPaused() bool {
+	s.idleMu.Lock()
+	idle := s.idle
+	s.idleMu.Unlock()
+	return idle || s.parked.Load() || (s.audioGate != nil && s.audioGate.paused()) ||
+		(s.audioStartGate != nil && s.audioStartGate.paused())
+}
+
+// restartVideoEncoder replaces the video encoder with a fresh one of the
+// same kind and settings, which opens with an IDR frame. A failure is
+// reported as well as returned.
+func (s *Streamer) restartVideoEncoder(reason string) error {
+	s.encMu.Lock()
+	err := s.replaceVideoEncoder(s.videoEncoder)
+	s.encMu.Unlock()
+	if err != nil {
+		s.log.errorf("Restarting video encoder (%s): %v", reason, err)
+		s.reportError(fmt.Errorf("restarting video encoder: %w", err), false)
+		return err
+	}
+	s.log.infof("Restarted video encoder (%s)", reason)
+	return nil
+}
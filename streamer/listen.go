@@ -0,0 +1,36 @@
+package streamer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixAddrPrefix selects a Unix domain socket in a listen address.
+const unixAddrPrefix = "unix:"
+
+// listenAddr listens on addr for one of the streamer's HTTP servers. An
+// address of the form unix:/path listens on a Unix domain socket, replacing
+// any stale socket file; anything else is a TCP host:port. Closing the
+// listener removes the socket file.
+func listenAddr(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixAddrPrefix); ok {
+		if path == "" {
+			return nil, fmt.Errorf("listen address %q has no socket path", addr)
+		}
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("listening on %s: %w", path, err)
+		}
+		return l, nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	return l, nil
+}
@@ -0,0 +1,32 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// logger logs printf-style messages at a level through a *slog.Logger,
+// slog.Default() when it is nil, so the zero value logs too. Messages are
+// formatted only when their level is enabled, which keeps Debug ones cheap
+// on the per-frame and per-read paths.
+type logger struct {
+	l *slog.Logger
+}
+
+func (l logger) logf(level slog.Level, format string, args ...any) {
+	sl := l.l
+	if sl == nil {
+		sl = slog.Default()
+	}
+	ctx := context.Background()
+	if !sl.Enabled(ctx, level) {
+		return
+	}
+	sl.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (l logger) debugf(format string, args ...any) { l.logf(slog.LevelDebug, format, args...) }
+func (l logger) infof(format string, args ...any)  { l.logf(slog.LevelInfo, format, args...) }
+func (l logger) warnf(format string, args ...any)  { l.logf(slog.LevelWarn, format, args...) }
+func (l logger) errorf(format string, args ...any) { l.logf(slog.LevelError, format, args...) }
@@ -0,0 +1,84 @@
+package streamer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogCategory names a group of high-frequency debug messages that can be
+// sampled independently.
+type LogCategory string
+
+const (
+	LogReads      LogCategory = "reads"       // per-read byte counts
+	LogStartCodes LogCategory = "start_codes" // H264Reader start codes
+)
+
+// LogSampling thins out one category of messages. Every logs one message
+// in N, and PerSecond caps how many are logged in any one second; zero
+// leaves either unlimited. When both are set a message must pass both.
+type LogSampling struct {
+	Every     int
+	PerSecond int
+}
+
+func (c LogSampling) validate() error {
+	if c.Every < 0 || c.PerSecond < 0 {
+		return fmt.Errorf("log sampling %+v must not be negative", c)
+	}
+	return nil
+}
+
+// logSampler applies a LogSampling. A nil sampler lets everything through.
+type logSampler struct {
+	cfg LogSampling
+
+	mu          sync.Mutex
+	seen        uint64
+	windowStart time.Time
+	inWindow    int
+	suppressed  int
+}
+
+func newLogSampler(cfg LogSampling) *logSampler {
+	return &logSampler{cfg: cfg}
+}
+
+// allow reports whether the next message should be logged and how many
+// were suppressed since the last one that was.
+func (l *logSampler) allow() (ok bool, suppressed int) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seen++
+	if l.cfg.Every > 1 && (l.seen-1)%uint64(l.cfg.Every) != 0 {
+		l.suppressed++
+		return false, 0
+	}
+	if l.cfg.PerSecond > 0 {
+		now := time.Now()
+		if now.Sub(l.windowStart) >= time.Second {
+			l.windowStart, l.inWindow = now, 0
+		}
+		if l.inWindow >= l.cfg.PerSecond {
+			l.suppressed++
+			return false, 0
+		}
+		l.inWindow++
+	}
+	suppressed, l.suppressed = l.suppressed, 0
+	return true, suppressed
+}
+
+// sampledSuffix describes suppressed messages for appending to the next
+// logged one.
+func sampledSuffix(suppressed int) string {
+	if suppressed == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d similar suppressed)", suppressed)
+}
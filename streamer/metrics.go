@@ -0,0 +1,182 @@
+package streamer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMetricsNamespace prefixes the metric names when
+// Config.MetricsNamespace is empty.
+const DefaultMetricsNamespace = "rita_streamer"
+
+// metricsContentType is the Prometheus text exposition format, version
+// 0.0.4, which every Prometheus server scrapes.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteMetrics writes HealthStats to w in the Prometheus text format,
+// each name prefixed with Config.MetricsNamespace. The health server's
+// /metrics serves it; a test, or a caller with a server of its own, can
+// call it directly. Being read from the same HealthStats, the metrics
+// always agree with /stats.
+//
+//	<ns>_frames_total{track}                   counter
+//	<ns>_bytes_read_total{track}               counter
+//	<ns>_frame_interval_seconds{track}         summary, _sum and _count
+//	<ns>_frame_interval_min_seconds{track}     gauge
+//	<ns>_frame_interval_max_seconds{track}     gauge
+//	<ns>_dropped_total{track,reason}           counter
+//	<ns>_encoder_queue_depth                   gauge, Config.EncoderBacklog
+//	<ns>_participants                          gauge
+//	<ns>_published                             gauge, 0 or 1
+//	<ns>_connection_state{state}               gauge, 1 for the current one
+//	<ns>_encoder_breaker_open                  gauge, 0 or 1
+//	<ns>_reconnects_total                      counter
+//	<ns>_rejoin_attempts_total                 counter
+//	<ns>_rtp_packets_sent_total{track}         counter
+//	<ns>_rtp_bytes_sent_total{track}           counter
+//	<ns>_rtp_nacks_total{track}                counter
+//	<ns>_rtp_packets_lost_total{track}         counter
+//
+// track is "video" or "audio". The frame intervals are the encode times
+// FrameStats measures, between consecutive frames handed to the track.
+// The RTP counters start over with the connection after a rejoin, which
+// Prometheus takes as a counter reset.
+func (s *Streamer) WriteMetrics(w io.Writer) error {
+	h := s.HealthStats()
+	m := &metricsWriter{w: bufio.NewWriter(w), ns: s.cfg.MetricsNamespace}
+	tracks := []struct {
+		name    string
+		stats   FrameStats
+		dropped map[DropReason]int64
+	}{
+		{"video", h.Video, h.DroppedVideoFrames},
+		{"audio", h.Audio, h.DroppedAudioChunks},
+	}
+
+	m.family("frames_total", "counter", "Frames handed to the track.")
+	for _, t := range tracks {
+		m.sample("frames_total", float64(t.stats.Frames), "track", t.name)
+	}
+	m.family("bytes_read_total", "counter", "Encoded bytes handed to the track.")
+	for _, t := range tracks {
+		m.sample("bytes_read_total", float64(t.stats.BytesRead), "track", t.name)
+	}
+	m.family("frame_interval_seconds", "summary", "Interval between consecutive frames handed to the track.")
+	for _, t := range tracks {
+		sum := t.stats.AvgInterval * time.Duration(t.stats.Frames)
+		m.sample("frame_interval_seconds_sum", sum.Seconds(), "track", t.name)
+		m.sample("frame_interval_seconds_count", float64(t.stats.Frames), "track", t.name)
+	}
+	m.family("frame_interval_min_seconds", "gauge", "Shortest interval between frames so far.")
+	for _, t := range tracks {
+		m.sample("frame_interval_min_seconds", t.stats.MinInterval.Seconds(), "track", t.name)
+	}
+	m.family("frame_interval_max_seconds", "gauge", "Longest interval between frames so far.")
+	for _, t := range tracks {
+		m.sample("frame_interval_max_seconds", t.stats.MaxInterval.Seconds(), "track", t.name)
+	}
+	m.family("dropped_total", "counter", "Media dropped rather than published, in video frames and 20 ms audio chunks.")
+	for _, t := range tracks {
+		for _, reason := range dropReasons {
+			m.sample("dropped_total", float64(t.dropped[reason]), "track", t.name, "reason", string(reason))
+		}
+	}
+	m.family("encoder_queue_depth", "gauge", "Raw frames waiting for the video encoder.")
+	m.sample("encoder_queue_depth", float64(h.Video.QueueDepth))
+
+	m.family("participants", "gauge", "Remote participants in the room.")
+	m.sample("participants", float64(h.Participants))
+	m.family("published", "gauge", "Whether the tracks are published.")
+	m.sample("published", boolMetric(h.Published))
+	m.family("connection_state", "gauge", "The room connection state, 1 for the current one.")
+	m.sample("connection_state", 1, "state", string(h.ConnectionState))
+	m.family("encoder_breaker_open", "gauge", "Whether the encoder restart breaker has given up.")
+	m.sample("encoder_breaker_open", boolMetric(h.EncoderBreakerOpen))
+	m.family("reconnects_total", "counter", "Reconnections to the room made by the SDK.")
+	m.sample("reconnects_total", float64(h.Reconnects))
+	m.family("rejoin_attempts_total", "counter", "Attempts to rejoin the room after the connection was lost.")
+	m.sample("rejoin_attempts_total", float64(h.RejoinAttempts))
+
+	rtp := []struct {
+		name, help string
+		value      func(RTPSendStats) float64
+	}{
+		{"rtp_packets_sent_total", "RTP packets sent on the track.", func(r RTPSendStats) float64 { return float64(r.PacketsSent) }},
+		{"rtp_bytes_sent_total", "RTP payload bytes sent on the track.", func(r RTPSendStats) float64 { return float64(r.BytesSent) }},
+		{"rtp_nacks_total", "NACKs received for the track.", func(r RTPSendStats) float64 { return float64(r.NACKs) }},
+		{"rtp_packets_lost_total", "Packets of the track the SFU reported lost.", func(r RTPSendStats) float64 { return float64(r.PacketsLost) }},
+	}
+	for _, metric := range rtp {
+		m.family(metric.name, "counter", metric.help)
+		for _, t := range tracks {
+			if st, ok := h.RTP[t.name]; ok {
+				m.sample(metric.name, metric.value(st), "track", t.name)
+			}
+		}
+	}
+	return m.flush()
+}
+
+// MetricsHandler serves WriteMetrics, as the health server's /metrics
+// does.
+func (s *Streamer) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		s.WriteMetrics(w)
+	})
+}
+
+// metricsWriter writes metric families in the text format, keeping the
+// first write error.
+type metricsWriter struct {
+	w   *bufio.Writer
+	ns  string
+	err error
+}
+
+func (m *metricsWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+// family starts the family name, of type typ, with its help text.
+func (m *metricsWriter) family(name, typ, help string) {
+	m.printf("# HELP %s_%s %s\n# TYPE %s_%s %s\n", m.ns, name, help, m.ns, name, typ)
+}
+
+// sample writes one sample of name with the label names and values of
+// labels, given in pairs.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", labels[i], labels[i+1])
+	}
+	if b.Len() > 0 {
+		m.printf("%s_%s{%s} %s\n", m.ns, name, b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+		return
+	}
+	m.printf("%s_%s %s\n", m.ns, name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (m *metricsWriter) flush() error {
+	if m.err != nil {
+		return m.err
+	}
+	return m.w.Flush()
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
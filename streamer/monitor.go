@@ -0,0 +1,114 @@
+package streamer
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// startMonitor joins the room purely as a subscriber. With RecordDir set,
+// every subscribed track is written to disk, and with DecodeDir or
+// OnDecodedFrame every subscribed video track is decoded.
+func (s *Streamer) startMonitor() error {
+	if s.cfg.RecordDir != "" {
+		if err := s.validateRecording(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		if s.cfg.RecordContainer != RecordRaw {
+			if err := checkFFmpeg(); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(s.cfg.RecordDir, 0755); err != nil {
+			return fmt.Errorf("creating record directory: %w", err)
+		}
+	}
+	if s.cfg.decodes() {
+		if err := checkFFmpeg(); err != nil {
+			return err
+		}
+	}
+	if s.cfg.DecodeDir != "" {
+		if err := os.MkdirAll(s.cfg.DecodeDir, 0755); err != nil {
+			return fmt.Errorf("creating decode directory: %w", err)
+		}
+	}
+
+	roomCB := &lksdk.RoomCallback{
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnTrackSubscribed: func(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				if s.cfg.OnTrackSubscribed != nil {
+					s.cfg.OnTrackSubscribed(track, publication, rp)
+				}
+				s.consumeTrack(track, publication, rp)
+			},
+			OnTrackSubscriptionFailed: s.trackSubscriptionFailed,
+			OnDataPacket:              s.dataReceived,
+		},
+	}
+	s.participants.Attach(roomCB)
+
+	if err := s.loadCredentials(); err != nil {
+		return err
+	}
+	token, err := subscriberToken(s.cfg)
+	if err != nil {
+		return err
+	}
+	room, err := s.connectRoom(func() (*lksdk.Room, error) {
+		return lksdk.ConnectToRoomWithToken(s.cfg.URL, token, roomCB, lksdk.WithAutoSubscribe(true))
+	})
+	if err != nil {
+		return err
+	}
+	s.room = room
+	s.participants.Sync(room)
+	s.emit(EventConnected, map[string]any{"room": s.cfg.RoomName, "identity": s.cfg.Identity})
+	return nil
+}
+
+// subscriptionFailureReason is the only cause the SDK reports a failed
+// subscription for: the track's media arrived but its publication metadata
+// did not follow within 5s. Tracks the SFU refuses to forward, or whose
+// codec our side does not negotiate, never reach the SDK and are not
+// reported.
+const subscriptionFailureReason = "track metadata did not arrive within 5s of its media"
+
+// trackSubscriptionFailed logs and reports a track that could not be
+// subscribed to.
+func (s *Streamer) trackSubscriptionFailed(sid string, rp *lksdk.RemoteParticipant) {
+	s.log.warnf("Subscription to track %s of %s failed: %s", sid, rp.Identity(), subscriptionFailureReason)
+	s.emit(EventSubscriptionFailed, map[string]any{
+		"track_sid":   sid,
+		"participant": rp.Identity(),
+		"reason":      subscriptionFailureReason,
+	})
+	if s.cfg.OnTrackSubscriptionFailed != nil {
+		s.cfg.OnTrackSubscriptionFailed(sid, rp)
+	}
+}
+
+// subscriberToken mints a token that may subscribe but not publish.
+func subscriberToken(cfg Config) (string, error) {
+	canPublish, canSubscribe := false, true
+	token, err := auth.NewAccessToken(cfg.APIKey, cfg.APISecret).
+		SetIdentity(cfg.Identity).
+		SetName(cfg.ParticipantName).
+		SetValidFor(24 * time.Hour).
+		SetVideoGrant(&auth.VideoGrant{
+			RoomJoin:       true,
+			Room:           cfg.RoomName,
+			CanPublish:     &canPublish,
+			CanPublishData: &canPublish,
+			CanSubscribe:   &canSubscribe,
+		}).
+		ToJWT()
+	if err != nil {
+		return "", fmt.Errorf("creating subscriber token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,154 @@
+package streamer
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// Option sets a field of the Config that NewStreamer builds, in the style
+// of the SDK's ReaderTrackWith options. Options left out keep the same
+// defaults as a zero Config passed to New.
+type Option func(*Config)
+
+// NewStreamer is New with its Config assembled from opts. Later options
+// override earlier ones; WithConfig can supply a base to start from.
+func NewStreamer(opts ...Option) *Streamer {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return New(cfg)
+}
+
+// WithConfig replaces the whole Config, for settings without an option of
+// their own. Options after it apply on top.
+func WithConfig(cfg Config) Option {
+	return func(c *Config) { *c = cfg }
+}
+
+// WithRoom sets the server URL, API credentials and room to join.
+func WithRoom(url, apiKey, apiSecret, roomName string) Option {
+	return func(c *Config) {
+		c.URL, c.APIKey, c.APISecret, c.RoomName = url, apiKey, apiSecret, roomName
+	}
+}
+
+// WithIdentity sets the participant identity and display name. A random
+// identity is generated when it is empty.
+func WithIdentity(identity, name string) Option {
+	return func(c *Config) { c.Identity, c.ParticipantName = identity, name }
+}
+
+// WithParticipantAttributes sets Config.ParticipantAttributes.
+func WithParticipantAttributes(attrs map[string]string) Option {
+	return func(c *Config) { c.ParticipantAttributes = attrs }
+}
+
+// WithParticipantMetadata sets Config.ParticipantMetadata.
+func WithParticipantMetadata(metadata string) Option {
+	return func(c *Config) { c.ParticipantMetadata = metadata }
+}
+
+// WithPipes sets the named pipes raw video and audio are read from.
+func WithPipes(videoPath, audioPath string) Option {
+	return func(c *Config) { c.VideoPipePath, c.AudioPipePath = videoPath, audioPath }
+}
+
+// WithInputs sets Config.VideoInput and Config.AudioInput.
+func WithInputs(video, audio io.ReadCloser) Option {
+	return func(c *Config) { c.VideoInput, c.AudioInput = video, audio }
+}
+
+// WithDimensions takes the frame size from width and height instead of
+// the video pipe's header.
+func WithDimensions(width, height uint32) Option {
+	return func(c *Config) {
+		c.DimensionsFromConfig, c.Width, c.Height = true, width, height
+	}
+}
+
+// WithFPS sets the rate the producer writes raw frames at.
+func WithFPS(fps int) Option {
+	return func(c *Config) { c.FrameRate = fps }
+}
+
+// WithPixelFormat sets the layout of raw video frames.
+func WithPixelFormat(f PixelFormat) Option {
+	return func(c *Config) { c.PixelFormat = f }
+}
+
+// WithTSInput publishes an MPEG-TS file, FIFO or URL instead of raw input.
+func WithTSInput(input string) Option {
+	return func(c *Config) { c.TSInput = input }
+}
+
+// WithEncoder sets the video encoder settings. Fields left zero are taken
+// from the profile, as with Config.VideoEncoder.
+func WithEncoder(settings VideoEncoderSettings) Option {
+	return func(c *Config) { c.VideoEncoder = settings }
+}
+
+// WithProfile selects a named encoder profile such as "low-latency".
+func WithProfile(name string) Option {
+	return func(c *Config) { c.Profile = name }
+}
+
+// WithHardwareRequired fails Start rather than falling back to libx264
+// when NVENC is unavailable.
+func WithHardwareRequired() Option {
+	return func(c *Config) { c.RequireHardware = true }
+}
+
+// WithAudioBitrate sets the Opus bitrate in kbps.
+func WithAudioBitrate(kbps int) Option {
+	return func(c *Config) { c.AudioBitrateKbps = kbps }
+}
+
+// WithAudioDTX sets Config.AudioDTX.
+func WithAudioDTX(enabled bool) Option {
+	return func(c *Config) { c.AudioDTX = enabled }
+}
+
+// WithSources sets the track sources the publications are tagged with.
+func WithSources(video, audio livekit.TrackSource) Option {
+	return func(c *Config) { c.VideoSource, c.AudioSource = video, audio }
+}
+
+// WithConnectTimeout bounds how long Start waits to join the room.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(c *Config) { c.ConnectTimeout = d }
+}
+
+// WithStartupTimeout sets Config.StartupTimeout.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(c *Config) { c.StartupTimeout = d }
+}
+
+// WithLogger sets Config.Logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Config) { c.Logger = l }
+}
+
+// WithErrorHandler sets Config.OnError.
+func WithErrorHandler(fn func(err error, fatal bool)) Option {
+	return func(c *Config) { c.OnError = fn }
+}
+
+// WithEventHandler sets Config.OnEvent.
+func WithEventHandler(fn func(Event)) Option {
+	return func(c *Config) { c.OnEvent = fn }
+}
+
+// WithDataHandler sets Config.OnDataReceived.
+func WithDataHandler(fn func(data []byte, rp *lksdk.RemoteParticipant)) Option {
+	return func(c *Config) { c.OnDataReceived = fn }
+}
+
+// WithKeyframeInterval sets Config.KeyframeInterval.
+func WithKeyframeInterval(d time.Duration) Option {
+	return func(c *Config) { c.KeyframeInterval = d }
+}
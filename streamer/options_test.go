@@ -0,0 +1,28 @@
+package streamer
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewStreamerOptions(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+	s := NewStreamer(
+		WithRoom("wss://example.test", "key", "secret", "room"),
+		WithFPS(30),
+		WithLogger(l),
+	)
+	if s.cfg.Logger != l {
+		t.Error("WithLogger did not set Config.Logger")
+	}
+	if s.cfg.RoomName != "room" || s.cfg.FrameRate != 30 {
+		t.Errorf("room %q at %d fps, want room at 30", s.cfg.RoomName, s.cfg.FrameRate)
+	}
+	s.log.infof("hello %d", 1)
+	if !strings.Contains(buf.String(), "hello 1") {
+		t.Errorf("message not logged through the option's logger: %q", buf.String())
+	}
+}
@@ -0,0 +1,144 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Park leaves the room but keeps the encoders running, for a session that
+// is handed off and will Rejoin shortly. The input is still read and
+// encoded, and the encoded output is discarded, so Rejoin republishes
+// without starting ffmpeg or an NVENC session again.
+//
+// A parked session costs what a published one does, less the network: the
+// encoders' CPU, one NVENC session and its GPU memory, and the producer
+// still writing. A cold start instead pays for a new ffmpeg process and
+// NVENC initialisation, typically a few hundred milliseconds with the
+// warmup frame, plus waiting for the producer again. Park when the gap is
+// expected to be seconds to minutes; Stop for anything longer.
+//
+// While parked, Run neither counts the room as empty nor the video as
+// stalled, and ReplaceVideoTrack, SetTrackMetadata and other calls that
+// need the room fail with ErrNotRunning.
+func (s *Streamer) Park() error {
+	s.parkMu.Lock()
+	defer s.parkMu.Unlock()
+	if s.ctx == nil || s.ctx.Err() != nil || len(s.providers()) == 0 {
+		return fmt.Errorf("%w: nothing published", ErrNotRunning)
+	}
+	if s.cfg.Sink != nil {
+		return fmt.Errorf("%w: writing to a Sink, not in a room", ErrNotRunning)
+	}
+	if s.parked.Load() {
+		return errors.New("already parked")
+	}
+	s.replaceMu.Lock()
+	defer s.replaceMu.Unlock()
+
+	providers := s.providers()
+	for _, p := range providers {
+		p.parked.Store(true)
+	}
+	s.parked.Store(true)
+
+	s.leaveParked(providers, true, DropPaused)
+	s.log.infof("Parked: left room %s, encoders kept running", s.cfg.RoomName)
+	s.emit(EventParked, map[string]any{"room": s.cfg.RoomName})
+	return nil
+}
+
+// Rejoin connects a parked session to room, or to the room it left if
+// room is empty, and publishes the running encoders' tracks again. The
+// room must allow the codecs already in use; Config.RoomMetadataOverrides
+// is not applied, as the encoders keep their settings. Viewers see video
+// from the next keyframe, as with any subscriber joining mid-stream. If
+// the tracks cannot be published the session stays parked.
+func (s *Streamer) Rejoin(room string) error {
+	s.parkMu.Lock()
+	defer s.parkMu.Unlock()
+	if !s.parked.Load() {
+		return fmt.Errorf("%w: not parked", ErrNotRunning)
+	}
+	if s.ctx.Err() != nil {
+		return fmt.Errorf("%w: stopped while parked", ErrNotRunning)
+	}
+	s.replaceMu.Lock()
+	defer s.replaceMu.Unlock()
+
+	left := s.cfg.RoomName
+	if room != "" {
+		s.cfg.RoomName = room
+	}
+	if err := s.connect(); err != nil {
+		s.cfg.RoomName = left
+		return err
+	}
+
+	// The tracks' writers take over from the drains once bound again.
+	close(s.parkStop)
+	s.parkDrains.Wait()
+	providers := s.providers()
+	for _, p := range providers {
+		p.parked.Store(false)
+	}
+	if err := s.publish(); err != nil {
+		for _, p := range providers {
+			p.parked.Store(true)
+		}
+		s.leaveParked(providers, true, DropPaused)
+		return err
+	}
+	s.parked.Store(false)
+	s.armIdle()
+	s.RequestKeyframe("rejoin")
+	s.log.infof("Rejoined room %s", s.cfg.RoomName)
+	s.emit(EventRejoined, map[string]any{"room": s.cfg.RoomName, "from": left})
+	return nil
+}
+
+// leaveParked leaves the room, unless the connection is already gone, and
+// discards the encoders' output in place of the tracks' writers, counting
+// it under reason. Leaving unbinds the tracks, which stops their writers,
+// and closes them, which the parked providers ignore.
+func (s *Streamer) leaveParked(providers []*encodedSampleProvider, disconnect bool, reason DropReason) {
+	room := s.room
+	s.encMu.Lock()
+	s.videoPub = nil
+	s.encMu.Unlock()
+	s.room, s.audioPub = nil, nil
+	if disconnect {
+		room.Disconnect()
+	}
+	s.participants.clear()
+
+	s.parkStop = make(chan struct{})
+	for _, p := range providers {
+		s.parkDrains.Add(1)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.parkDrains.Done()
+			p.discard(s.parkStop, reason)
+		}()
+	}
+}
+
+// providers returns the providers of the tracks there are, the video
+// one first.
+func (s *Streamer) providers() []*encodedSampleProvider {
+	s.encMu.Lock()
+	video := s.videoProvider
+	s.encMu.Unlock()
+	var providers []*encodedSampleProvider
+	for _, p := range []*encodedSampleProvider{video, s.audioProvider} {
+		if p != nil {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Parked reports whether the session is parked.
+func (s *Streamer) Parked() bool {
+	return s.parked.Load()
+}
@@ -0,0 +1,146 @@
+package streamer
+
+import (
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// ParticipantTracker keeps a live view of the remote participants in a room
+// and notifies listeners as they join and leave.
+type ParticipantTracker struct {
+	mu             sync.Mutex
+	participants   map[string]*lksdk.RemoteParticipant
+	changed        chan struct{}
+	onConnected    []func(rp *lksdk.RemoteParticipant, count int)
+	onDisconnected []func(rp *lksdk.RemoteParticipant, count int)
+}
+
+func NewParticipantTracker() *ParticipantTracker {
+	return &ParticipantTracker{
+		participants: make(map[string]*lksdk.RemoteParticipant),
+		changed:      make(chan struct{}),
+	}
+}
+
+// OnParticipantConnected registers f to be called whenever a remote
+// participant joins. count is the number of remote participants after the join.
+func (t *ParticipantTracker) OnParticipantConnected(f func(rp *lksdk.RemoteParticipant, count int)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onConnected = append(t.onConnected, f)
+}
+
+// OnParticipantDisconnected registers f to be called whenever a remote
+// participant leaves. count is the number of remote participants after the leave.
+func (t *ParticipantTracker) OnParticipantDisconnected(f func(rp *lksdk.RemoteParticipant, count int)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onDisconnected = append(t.onDisconnected, f)
+}
+
+// ParticipantCount returns the number of remote participants currently in the room.
+func (t *ParticipantTracker) ParticipantCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.participants)
+}
+
+// Attach wires the tracker into cb, chaining any participant callbacks
+// that are already set.
+func (t *ParticipantTracker) Attach(cb *lksdk.RoomCallback) {
+	prevConnected := cb.OnParticipantConnected
+	prevDisconnected := cb.OnParticipantDisconnected
+
+	cb.OnParticipantConnected = func(rp *lksdk.RemoteParticipant) {
+		t.add(rp)
+		if prevConnected != nil {
+			prevConnected(rp)
+		}
+	}
+	cb.OnParticipantDisconnected = func(rp *lksdk.RemoteParticipant) {
+		t.remove(rp)
+		if prevDisconnected != nil {
+			prevDisconnected(rp)
+		}
+	}
+}
+
+// Sync records the participants that were already in the room when we
+// joined, since the SDK does not fire connect events for them.
+func (t *ParticipantTracker) Sync(room *lksdk.Room) {
+	for _, rp := range room.GetRemoteParticipants() {
+		t.add(rp)
+	}
+}
+
+// WaitIdle blocks until the room has had no remote participants for the
+// given duration.
+func (t *ParticipantTracker) WaitIdle(timeout time.Duration) {
+	for {
+		t.mu.Lock()
+		count, changed := len(t.participants), t.changed
+		t.mu.Unlock()
+
+		if count > 0 {
+			<-changed
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-time.After(timeout):
+			return
+		}
+	}
+}
+
+func (t *ParticipantTracker) add(rp *lksdk.RemoteParticipant) {
+	t.mu.Lock()
+	if _, ok := t.participants[rp.Identity()]; ok {
+		t.mu.Unlock()
+		return
+	}
+	t.participants[rp.Identity()] = rp
+	count := len(t.participants)
+	listeners := t.onConnected
+	t.notifyLocked()
+	t.mu.Unlock()
+
+	for _, f := range listeners {
+		f(rp, count)
+	}
+}
+
+func (t *ParticipantTracker) remove(rp *lksdk.RemoteParticipant) {
+	t.mu.Lock()
+	if _, ok := t.participants[rp.Identity()]; !ok {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.participants, rp.Identity())
+	count := len(t.participants)
+	listeners := t.onDisconnected
+	t.notifyLocked()
+	t.mu.Unlock()
+
+	for _, f := range listeners {
+		f(rp, count)
+	}
+}
+
+// clear forgets every participant without notifying listeners, for a room
+// that has been left.
+func (t *ParticipantTracker) clear() {
+	t.mu.Lock()
+	clear(t.participants)
+	t.notifyLocked()
+	t.mu.Unlock()
+}
+
+// notifyLocked wakes every WaitIdle caller. t.mu must be held.
+func (t *ParticipantTracker) notifyLocked() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
@@ -0,0 +1,123 @@
+package streamer
+
+import "fmt"
+
+// PixelFormat is the layout of raw frames the producer writes to the video
+// pipe, named as ffmpeg names them.
+//
+// Encoders want yuv420p, so any other format is converted by ffmpeg before
+// encoding. Converting RGB costs roughly one extra CPU core per 1080p25
+// stream and moves 2 to 2.7x as many bytes through the pipe as yuv420p,
+// so producers that can emit YUV directly should. nv12, the interleaved
+// chroma layout GPU capture produces, is the same size as yuv420p and is
+// taken natively by the H264 encoders; ffmpeg converts it only for VP8.
+//
+// yuva420p is yuv420p followed by a full-resolution alpha plane. It, rgba
+// and bgra carry alpha, which only Config.AlphaPacking publishes; without
+// it the alpha is dropped.
+type PixelFormat string
+
+const (
+	PixelFormatYUV420P  PixelFormat = "yuv420p"
+	PixelFormatNV12     PixelFormat = "nv12"
+	PixelFormatYUVA420P PixelFormat = "yuva420p"
+	PixelFormatRGB24    PixelFormat = "rgb24"
+	PixelFormatRGBA     PixelFormat = "rgba"
+	PixelFormatBGRA     PixelFormat = "bgra"
+)
+
+func (f PixelFormat) validate() error {
+	if f.HeaderCode() == 0 {
+		return fmt.Errorf("unsupported pixel format %q", f)
+	}
+	return nil
+}
+
+// pixelFormatCodes numbers the formats for the video header's pixel
+// format field, Config.PixelFormatFromHeader, from 1; zero there leaves
+// Config.PixelFormat in effect. The numbers are part of the producer
+// protocol and must not change.
+var pixelFormatCodes = []PixelFormat{
+	1: PixelFormatYUV420P,
+	2: PixelFormatYUVA420P,
+	3: PixelFormatRGBA,
+	4: PixelFormatBGRA,
+	5: PixelFormatNV12,
+	6: PixelFormatRGB24,
+}
+
+// HeaderCode is the number a producer sends for f in the video header's
+// pixel format field: 1 yuv420p, 2 yuva420p, 3 rgba, 4 bgra, 5 nv12 and
+// 6 rgb24. It is zero for an unsupported format.
+func (f PixelFormat) HeaderCode() uint32 {
+	for code, format := range pixelFormatCodes {
+		if format != "" && format == f {
+			return uint32(code)
+		}
+	}
+	return 0
+}
+
+// pixelFormatFromCode returns the format a header's pixel format field
+// names, reporting false for a code that names none.
+func pixelFormatFromCode(code uint32) (PixelFormat, bool) {
+	if code == 0 || code >= uint32(len(pixelFormatCodes)) {
+		return "", false
+	}
+	return pixelFormatCodes[code], true
+}
+
+// frameSize returns the size in bytes of one frame in this format.
+func (f PixelFormat) frameSize(width, height int) int {
+	switch f {
+	case PixelFormatRGBA, PixelFormatBGRA:
+		return width * height * 4
+	case PixelFormatRGB24:
+		return width * height * 3
+	case PixelFormatYUVA420P:
+		return width * height * 5 / 2
+	}
+	return width * height * 3 / 2
+}
+
+// hasAlpha reports whether frames in this format carry an alpha channel.
+func (f PixelFormat) hasAlpha() bool {
+	return f == PixelFormatYUVA420P || f == PixelFormatRGBA || f == PixelFormatBGRA
+}
+
+// needsConversion reports whether the encode must convert frames to
+// yuv420p. nv12 needs no filter: the H264 encoders take it as it is, and
+// ffmpeg converts it for those that do not. RGB would otherwise be
+// encoded as 4:4:4, which WebRTC receivers cannot decode.
+func (f PixelFormat) needsConversion() bool {
+	return f != PixelFormatYUV420P && f != PixelFormatNV12
+}
+
+// blackFrame returns one opaque black frame in this format.
+func (f PixelFormat) blackFrame(width, height int) []byte {
+	frame := make([]byte, f.frameSize(width, height))
+	switch f {
+	case PixelFormatRGBA, PixelFormatBGRA:
+		for i := 3; i < len(frame); i += 4 {
+			frame[i] = 0xff
+		}
+	case PixelFormatRGB24:
+		// Black is all zeros.
+	default:
+		// nv12 interleaves the chroma that yuv420p keeps in two planes;
+		// either way the chroma bytes are all 128.
+		luma := width * height
+		chroma := luma + luma/2
+		for i := range frame {
+			switch {
+			case i < luma:
+				frame[i] = 16
+			case i < chroma:
+				frame[i] = 128
+			default: // yuva420p alpha
+				frame[i] = 0xff
+			}
+		}
+	}
+	return frame
+}
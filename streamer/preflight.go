@@ -0,0 +1,190 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Checks Config.Preflight runs, naming the one a CheckError reports.
+const (
+	CheckConfig       = "config"
+	CheckFFmpeg       = "ffmpeg"
+	CheckVideoEncoder = "video encoder"
+	CheckAudioEncoder = "audio encoder"
+	CheckPipes        = "pipes"
+	CheckConnection   = "connection"
+)
+
+// CheckError is a failed check of Config.Preflight. Err wraps the
+// sentinel Start would have failed with, such as ErrInvalidConfig or
+// ErrEncoderUnavailable.
+type CheckError struct {
+	Check string
+	Err   error
+}
+
+func (e *CheckError) Error() string {
+	return e.Check + ": " + e.Err.Error()
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks c as Start does before starting anything, and that the
+// server, credentials and room a room session needs are set, without
+// running ffmpeg or reaching the network. CredentialsFile is read. The
+// error wraps ErrInvalidConfig.
+func (c Config) Validate() error {
+	return New(c).validateConfig()
+}
+
+func (s *Streamer) validateConfig() error {
+	if err := s.loadCredentials(); err != nil {
+		return err
+	}
+	if s.cfg.Sink == nil {
+		var missing []string
+		for _, field := range []struct{ name, value string }{
+			{"URL", s.cfg.URL}, {"APIKey", s.cfg.APIKey}, {"APISecret", s.cfg.APISecret}, {"RoomName", s.cfg.RoomName},
+		} {
+			if field.value == "" {
+				missing = append(missing, field.name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%w: %s not set", ErrInvalidConfig, strings.Join(missing, ", "))
+		}
+	}
+	if err := s.checkSink(); err != nil {
+		return err
+	}
+	var err error
+	switch {
+	case s.cfg.SubscribeOnly:
+		return nil
+	case s.cfg.TSInput != "":
+		err = s.validateTS()
+	default:
+		err = s.validate()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	return nil
+}
+
+// Preflight checks what a session of c depends on without streaming, so
+// that a deployment finds a broken environment before it goes live
+// rather than in a Start failure: Validate; ffmpeg on PATH, able to
+// encode with the video encoder Start would choose and listing the audio
+// encoder; the directories of the pipes writable; and with connect, the
+// credentials accepted by the server, which is asked to validate a token
+// without the room being joined. Every check runs, and each failed one is
+// returned as a *CheckError, all joined with errors.Join.
+func (c Config) Preflight(ctx context.Context, connect bool) error {
+	s := New(c)
+	s.ctx = ctx
+	var errs []error
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, &CheckError{Check: name, Err: err})
+		}
+	}
+	check(CheckConfig, s.validateConfig())
+
+	encodes := !s.cfg.SubscribeOnly
+	if err := checkFFmpeg(); err != nil {
+		check(CheckFFmpeg, err)
+	} else if encodes {
+		if !s.cfg.DisableVideo && s.cfg.TSInput == "" {
+			check(CheckVideoEncoder, s.selectVideoEncoder())
+		}
+		if !s.cfg.DisableAudio {
+			check(CheckAudioEncoder, checkAudioEncoder())
+		}
+	}
+	if encodes && s.cfg.TSInput == "" && s.cfg.inputSocketAddr() == "" {
+		for _, pipe := range s.pipes() {
+			check(CheckPipes, checkWritableDir(pipe.kind, filepath.Dir(pipe.path)))
+		}
+	}
+	if connect && s.cfg.Sink == nil {
+		check(CheckConnection, s.checkServer(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// checkAudioEncoder checks that ffmpeg lists AudioEncoder.
+func checkAudioEncoder() error {
+	listed, err := ffmpegEncoders()
+	if err != nil {
+		return err
+	}
+	if !listed[AudioEncoder] {
+		return fmt.Errorf("ffmpeg does not list %s", AudioEncoder)
+	}
+	return nil
+}
+
+// checkWritableDir checks that the kind pipe can be created in dir.
+func checkWritableDir(kind, dir string) error {
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return fmt.Errorf("%s pipe directory %s is not writable: %w", kind, dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkServer asks the server at Config.URL to validate a publisher token,
+// as the LiveKit clients' connection test does, within ConnectTimeout.
+// The room is not joined.
+func (s *Streamer) checkServer(ctx context.Context) error {
+	if err := s.cfg.resolveIdentity(); err != nil {
+		return err
+	}
+	if err := applyProxy(s.cfg.Proxy); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectFailed, err)
+	}
+	token, err := publisherToken(s.cfg)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("%w: parsing URL: %w", ErrConnectFailed, err)
+	}
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/rtc/validate"
+	u.RawQuery = url.Values{"access_token": {token}}.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.ConnectTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectFailed, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: server answered %s: %s", ErrConnectFailed, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
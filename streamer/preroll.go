@@ -0,0 +1,94 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// prerollCommand decodes Config.PreRoll in real time into raw media in the
+// format of the live input: video frames in the session's dimensions,
+// pixel format and frame rate, or audio of AudioChannels at AudioSampleRate
+// in AudioSampleFormat.
+func (s *Streamer) prerollCommand(video bool) *exec.Cmd {
+	args := []string{"-hide_banner", "-loglevel", "error", "-re", "-i", s.cfg.PreRoll}
+	if video {
+		args = append(args,
+			"-map", "0:v:0",
+			"-vf", fmt.Sprintf("scale=%d:%d,fps=%d", s.frameWidth, s.frameHeight, s.cfg.FrameRate),
+			"-pix_fmt", string(s.cfg.PixelFormat),
+			"-f", "rawvideo")
+	} else {
+		args = append(args,
+			"-map", "0:a:0",
+			"-ar", strconv.Itoa(s.cfg.AudioSampleRate),
+			"-ac", strconv.Itoa(s.cfg.AudioChannels),
+			"-f", string(s.cfg.AudioSampleFormat))
+	}
+	return exec.CommandContext(s.ctx, "ffmpeg", append(args, "pipe:1")...)
+}
+
+// prerollSource is the output of a pre-roll decoder. Closing it stops the
+// decoder if it is still running.
+type prerollSource struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (p *prerollSource) Close() error {
+	p.cmd.Process.Kill()
+	p.ReadCloser.Close()
+	p.cmd.Wait()
+	return nil
+}
+
+// startPreroll starts decoding the video or audio of Config.PreRoll.
+func (s *Streamer) startPreroll(video bool) (*prerollSource, error) {
+	kind := "audio"
+	if video {
+		kind = "video"
+	}
+	cmd := s.prerollCommand(video)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating pre-roll %s output: %w", kind, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting pre-roll %s ffmpeg: %w", kind, err)
+	}
+	if err := s.prioritize(cmd, "pre-roll "+kind); err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	s.log.infof("Playing pre-roll %s from %s", kind, s.cfg.PreRoll)
+	return &prerollSource{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// audioPreroll hands the audio encoder the pre-roll audio and then the
+// live input. As with video, the live input is not read until the
+// pre-roll has ended.
+type audioPreroll struct {
+	pre  io.ReadCloser
+	live io.Reader
+	log  logger
+}
+
+func (a *audioPreroll) Read(p []byte) (int, error) {
+	if a.pre != nil {
+		n, err := a.pre.Read(p)
+		if !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		a.pre.Close()
+		a.pre = nil
+		a.log.infof("[Audio] Pre-roll ended, playing the live input")
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return a.live.Read(p)
+}
@@ -0,0 +1,72 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Bounds of Config.EncoderNice, as setpriority(2) takes them.
+const (
+	MinEncoderNice = -20
+	MaxEncoderNice = 19
+)
+
+func validateEncoderPriority(nice int, cgroup string) error {
+	if nice < MinEncoderNice || nice > MaxEncoderNice {
+		return fmt.Errorf("encoder nice %d outside %d-%d", nice, MinEncoderNice, MaxEncoderNice)
+	}
+	if cgroup == "" {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(cgroup, "cgroup.procs")); err != nil {
+		return fmt.Errorf("encoder cgroup %s is not a cgroup v2 directory: %w", cgroup, err)
+	}
+	return nil
+}
+
+// prioritize applies Config.EncoderNice and Config.EncoderCgroup to an
+// ffmpeg process just started. Linux keeps a niceness per thread, so each
+// thread the process has so far is reniced; threads started later inherit
+// it, and the cgroup, from their parent. On failure the process is killed
+// and reaped, since it would otherwise run unconstrained.
+func (s *Streamer) prioritize(cmd *exec.Cmd, name string) error {
+	err := s.applyPriority(cmd.Process.Pid)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("%s ffmpeg: %w", name, err)
+	}
+	return nil
+}
+
+func (s *Streamer) applyPriority(pid int) error {
+	if s.cfg.EncoderCgroup != "" {
+		procs := filepath.Join(s.cfg.EncoderCgroup, "cgroup.procs")
+		if err := os.WriteFile(procs, []byte(strconv.Itoa(pid)), 0); err != nil {
+			return fmt.Errorf("moving into cgroup %s: %w", s.cfg.EncoderCgroup, err)
+		}
+	}
+	if s.cfg.EncoderNice == 0 {
+		return nil
+	}
+	tids := []int{pid}
+	if entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid)); err == nil {
+		tids = tids[:0]
+		for _, e := range entries {
+			if tid, err := strconv.Atoi(e.Name()); err == nil {
+				tids = append(tids, tid)
+			}
+		}
+	}
+	for _, tid := range tids {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, s.cfg.EncoderNice); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("setting nice %d: %w", s.cfg.EncoderNice, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package streamer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// InputInfo is what ffprobe reports about a container input.
+type InputInfo struct {
+	VideoCodec string
+	Width      uint32
+	Height     uint32
+	FrameRate  float64 // zero if unknown
+	AudioCodec string  // empty if there is no audio stream
+}
+
+// probeInput runs ffprobe on input and describes its first video and
+// audio streams.
+func probeInput(ctx context.Context, input string) (InputInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "stream=codec_type,codec_name,width,height,avg_frame_rate,r_frame_rate",
+		"-of", "json",
+		input).Output()
+	if err != nil {
+		return InputInfo{}, fmt.Errorf("probing %s: %w", input, err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			CodecType    string `json:"codec_type"`
+			CodecName    string `json:"codec_name"`
+			Width        uint32 `json:"width"`
+			Height       uint32 `json:"height"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			RFrameRate   string `json:"r_frame_rate"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return InputInfo{}, fmt.Errorf("parsing ffprobe output for %s: %w", input, err)
+	}
+
+	var info InputInfo
+	for _, st := range probe.Streams {
+		switch {
+		case st.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec, info.Width, info.Height = st.CodecName, st.Width, st.Height
+			if info.FrameRate = parseFrameRate(st.AvgFrameRate); info.FrameRate == 0 {
+				info.FrameRate = parseFrameRate(st.RFrameRate)
+			}
+		case st.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = st.CodecName
+		}
+	}
+	if info.VideoCodec == "" {
+		return InputInfo{}, fmt.Errorf("%s has no video stream", input)
+	}
+	return info, nil
+}
+
+// parseFrameRate parses ffprobe's "num/den" rates, returning zero for
+// "0/0" and anything malformed.
+func parseFrameRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// autoDetectTS probes Config.TSInput and fills in what the configuration
+// left open: the frame rate and the dimensions the video is published
+// with. It fails early on video that cannot be forwarded as H264. A FIFO
+// is not probed, as ffprobe would consume the data the demuxer needs.
+func (s *Streamer) autoDetectTS() error {
+	if fi, err := os.Stat(s.cfg.TSInput); err == nil && fi.Mode()&os.ModeNamedPipe != 0 {
+		s.log.infof("Not probing %s: it is a FIFO", s.cfg.TSInput)
+		return nil
+	}
+	info, err := probeInput(s.ctx, s.cfg.TSInput)
+	if err != nil {
+		return err
+	}
+	s.log.infof("Detected TS input: video %s %dx%d at %.3g fps, audio %q",
+		info.VideoCodec, info.Width, info.Height, info.FrameRate, info.AudioCodec)
+	if info.VideoCodec != "h264" {
+		return fmt.Errorf("%w: TS video is %s, only h264 can be forwarded", ErrInvalidConfig, info.VideoCodec)
+	}
+	if s.cfg.TSFrameRate == 0 && info.FrameRate > 0 {
+		s.cfg.TSFrameRate = info.FrameRate
+	}
+	s.frameWidth, s.frameHeight = info.Width, info.Height
+	return nil
+}
@@ -0,0 +1,105 @@
+package streamer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VideoEncoderSettings are the ffmpeg encoder knobs a profile controls.
+// Zero values mean "not set": when used as overrides in Config they leave
+// the profile's value in place, and in a resolved set they omit the flag
+// so ffmpeg uses its own default.
+type VideoEncoderSettings struct {
+	Preset      string // -preset
+	Tune        string // -tune
+	H264Profile string // -profile:v
+	BitrateKbps int    // -b:v
+	GOP         int    // -g, in frames
+	BFrames     int    // -bf; WebRTC receivers cannot reorder, so keep this 0
+	// MaxBitrateKbps caps the bitrate (-maxrate), at or above
+	// BitrateKbps, and RateControl picks CBR or VBR; how each encoder
+	// takes them is in rateControlArgs.
+	MaxBitrateKbps int
+	RateControl    RateControl
+}
+
+func (v VideoEncoderSettings) validate() error {
+	if v.GOP <= 0 {
+		return fmt.Errorf("GOP %d must be positive", v.GOP)
+	}
+	if v.BitrateKbps < 0 || v.BFrames < 0 {
+		return fmt.Errorf("bitrate %d kbps and B-frames %d must not be negative", v.BitrateKbps, v.BFrames)
+	}
+	return v.validateRate()
+}
+
+// Named profiles. All of them disable B-frames since WebRTC has no frame
+// reordering, and all target the 25 fps the producer sends.
+//
+//	low-latency  p1 preset, ll tune, baseline, 1.5 Mbps, 1s GOP
+//	balanced     p4 preset, ll tune, main, 2.5 Mbps, 2s GOP
+//	quality      p7 preset, hq tune, main, 4 Mbps, 4s GOP
+//
+// Longer GOPs save bitrate but make joining viewers wait longer for a
+// decodable frame.
+var videoProfiles = map[string]VideoEncoderSettings{
+	"low-latency": {Preset: "p1", Tune: "ll", H264Profile: "baseline", BitrateKbps: 1500, GOP: 25},
+	"balanced":    {Preset: "p4", Tune: "ll", H264Profile: "main", BitrateKbps: 2500, GOP: 50},
+	"quality":     {Preset: "p7", Tune: "hq", H264Profile: "main", BitrateKbps: 4000, GOP: 100},
+}
+
+// defaultVideoSettings are used when no profile is set. They match the
+// flags the streamer has always used and leave the bitrate to ffmpeg.
+var defaultVideoSettings = VideoEncoderSettings{Preset: "p1", Tune: "ll", H264Profile: "baseline", GOP: 25}
+
+// ProfileNames lists the supported profile names.
+func ProfileNames() []string {
+	names := make([]string, 0, len(videoProfiles))
+	for name := range videoProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveVideoSettings expands profile and applies every non-zero field of
+// overrides on top of it, as Start does with Config.Profile and
+// Config.VideoEncoder. The result can be passed to Reconfigure.
+func ResolveVideoSettings(profile string, overrides VideoEncoderSettings) (VideoEncoderSettings, error) {
+	settings := defaultVideoSettings
+	if profile != "" {
+		p, ok := videoProfiles[profile]
+		if !ok {
+			return VideoEncoderSettings{}, fmt.Errorf("unknown encoder profile %q (want one of %s)",
+				profile, strings.Join(ProfileNames(), ", "))
+		}
+		settings = p
+	}
+
+	if overrides.Preset != "" {
+		settings.Preset = overrides.Preset
+	}
+	if overrides.Tune != "" {
+		settings.Tune = overrides.Tune
+	}
+	if overrides.H264Profile != "" {
+		settings.H264Profile = overrides.H264Profile
+	}
+	if overrides.BitrateKbps > 0 {
+		settings.BitrateKbps = overrides.BitrateKbps
+	}
+	if overrides.GOP > 0 {
+		settings.GOP = overrides.GOP
+	}
+	if overrides.BFrames > 0 {
+		settings.BFrames = overrides.BFrames
+	}
+	if overrides.MaxBitrateKbps > 0 {
+		settings.MaxBitrateKbps = overrides.MaxBitrateKbps
+	}
+	if overrides.RateControl != "" {
+		settings.RateControl = overrides.RateControl
+	}
+	return settings, nil
+}
@@ -0,0 +1,281 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+)
+
+// encodedSampleProvider feeds an encoder's output stream to a LocalTrack
+// one NAL unit or Opus page at a time. Unlike the SDK's reader provider it
+// lets the stamper choose each frame's duration, which is what the RTP
+// timestamps are derived from.
+//
+// The SDK advances the RTP timestamp by a sample's duration after sending
+// it, so a frame's RTP timestamp reflects the previous frame's slot. The
+// constant one-frame offset does not affect the pacing.
+type encodedSampleProvider struct {
+	lksdk.BaseSampleProvider
+	closer  io.Closer
+	next    func() (data []byte, isFrame bool, err error)
+	stamper *frameStamper
+	hooks   trackHooks
+
+	// mu serialises reads between the SDK's writer and discard, which
+	// may overlap while a parked track's writer winds down.
+	mu sync.Mutex
+	// seq and pts describe the next frame for onFrame.
+	seq uint64
+	pts time.Duration
+	// parked ignores Close, which the SDK calls on every track when it
+	// leaves the room, so the encoder's output survives Park.
+	parked atomic.Bool
+	// retired ends the samples of a track that has been replaced, so
+	// that none reach the hooks afterwards. It is guarded by mu.
+	retired bool
+}
+
+// FrameInfo describes one frame handed to a published track: an H264
+// slice, a VP8 frame or an Opus page.
+type FrameInfo struct {
+	// Sequence numbers the track's frames from 0. It carries on across
+	// encoder restarts and Reconfigure, but not ReplaceVideoTrack or
+	// RepublishVideo.
+	Sequence uint64
+	// Size is the encoded size in bytes.
+	Size int
+	// Timestamp is the frame's position on the track clock, from the
+	// track's first frame, and Duration how far the frame advances it.
+	Timestamp time.Duration
+	Duration  time.Duration
+}
+
+// trackHooks observe frames as they are handed to a track.
+type trackHooks struct {
+	onFrame    func(FrameInfo)
+	onKeyframe func()
+	// onKeyframeRequest is called when a subscriber sends a PLI or FIR.
+	onKeyframeRequest func(reason string)
+	// onError receives failures that happen after the track is created.
+	onError func(err error)
+	// onBind is called each time the track is bound to a negotiated
+	// sender.
+	onBind func()
+	// onSample receives the size of every sample handed to the track.
+	onSample func(size int)
+	// sei, if set, returns an H264 SEI NAL unit to send ahead of each
+	// picture.
+	sei func() []byte
+	// encrypt, if set, end-to-end encrypts every sample as it is sent.
+	encrypt func(data []byte) ([]byte, error)
+	// skipFrame, if set, reports frames not to send. Their time is
+	// carried by the next frame sent, as its PrevDroppedPackets.
+	skipFrame func(data []byte) bool
+	// onDrop is called for every frame discard drops, with its reason.
+	onDrop func(reason DropReason)
+	// log receives a track writer failure when onError is nil, and an
+	// H264 track's lost start codes.
+	log logger
+}
+
+func (p *encodedSampleProvider) NextSample(ctx context.Context) (media.Sample, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.retired {
+		return media.Sample{}, io.EOF
+	}
+	var (
+		data    []byte
+		isFrame bool
+		err     error
+		skipped uint16
+	)
+	for {
+		if data, isFrame, err = p.next(); err != nil {
+			return media.Sample{}, err
+		}
+		if !isFrame || p.hooks.skipFrame == nil || !p.hooks.skipFrame(data) || skipped == math.MaxUint16 {
+			break
+		}
+		p.pts += p.stamper.advance()
+		skipped++
+	}
+	sample := media.Sample{Data: data, PrevDroppedPackets: skipped}
+	if p.hooks.onSample != nil {
+		p.hooks.onSample(len(data))
+	}
+	if isFrame {
+		sample.Duration = p.stamper.advance()
+		if p.hooks.onFrame != nil {
+			p.hooks.onFrame(FrameInfo{Sequence: p.seq, Size: len(data), Timestamp: p.pts, Duration: sample.Duration})
+		}
+		p.seq++
+		p.pts += sample.Duration
+	}
+	if p.hooks.encrypt != nil {
+		if sample.Data, err = p.hooks.encrypt(data); err != nil {
+			return media.Sample{}, err
+		}
+	}
+	return sample, nil
+}
+
+// retire ends the track's samples once the one being read, if any, has
+// been handed over.
+func (p *encodedSampleProvider) retire() {
+	p.mu.Lock()
+	p.retired = true
+	p.mu.Unlock()
+}
+
+func (p *encodedSampleProvider) Close() error {
+	if p.parked.Load() {
+		return nil
+	}
+	return p.closer.Close()
+}
+
+// discard reads and drops the stream, keyframe hooks included but without
+// stamping or counting frames, until stop is closed or the stream ends,
+// reporting each frame to onDrop under reason. It stands in for the SDK's
+// writer while the track is parked.
+func (p *encodedSampleProvider) discard(stop <-chan struct{}, reason DropReason) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		p.mu.Lock()
+		_, isFrame, err := p.next()
+		p.mu.Unlock()
+		if err != nil {
+			return
+		}
+		if isFrame && p.hooks.onDrop != nil {
+			p.hooks.onDrop(reason)
+		}
+	}
+}
+
+// newEncodedTrack creates a track that publishes r, an H264 Annex-B, VP8
+// IVF or Ogg/Opus stream depending on mime, with override applied to the
+// codec. H264 is split into NAL units by an H264Reader, the one the
+// example uses, logging to hooks.log. The provider feeding it is returned
+// for Park.
+func newEncodedTrack(r io.ReadCloser, mime string, override CodecOverride, stamper *frameStamper, hooks trackHooks) (*lksdk.LocalTrack, *encodedSampleProvider, error) {
+	provider := &encodedSampleProvider{closer: r, stamper: stamper, hooks: hooks}
+	codec := webrtc.RTPCodecCapability{MimeType: mime}
+
+	switch mime {
+	case webrtc.MimeTypeH264:
+		reader := NewH264Reader(r, "Video")
+		reader.log, reader.quiet = hooks.log, true
+		assembler := &h264Assembler{hooks: hooks}
+		var queue []h264Unit
+		provider.next = func() ([]byte, bool, error) {
+			for len(queue) == 0 {
+				nal, err := reader.NextNAL()
+				if err != nil {
+					return nil, false, err
+				}
+				queue = assembler.units(nal)
+			}
+			u := queue[0]
+			queue = queue[1:]
+			if u.keyframe && hooks.onKeyframe != nil {
+				hooks.onKeyframe()
+			}
+			return u.data, u.isFrame, nil
+		}
+		codec.ClockRate = 90000
+	case webrtc.MimeTypeVP8:
+		// The IVF header is read with the first frame, as the encoder
+		// only writes it once it has input.
+		var reader *IVFReader
+		provider.next = func() ([]byte, bool, error) {
+			if reader == nil {
+				var err error
+				if reader, err = NewIVFReader(r); err != nil {
+					return nil, false, err
+				}
+			}
+			frame, _, err := reader.ReadFrame()
+			if err != nil {
+				return nil, false, err
+			}
+			// Bit 0 of the VP8 frame tag is clear on keyframes.
+			if len(frame) > 0 && frame[0]&0x01 == 0 && hooks.onKeyframe != nil {
+				hooks.onKeyframe()
+			}
+			return frame, true, nil
+		}
+		codec.ClockRate = 90000
+	case webrtc.MimeTypeOpus:
+		reader, _, err := oggreader.NewWith(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		provider.next = func() ([]byte, bool, error) {
+			for {
+				page, _, err := reader.ParseNextPage()
+				if err != nil {
+					return nil, false, err
+				}
+				// The header pages carry no audio. Past the first they
+				// open the stream of a restarted encoder.
+				if bytes.HasPrefix(page, []byte("OpusTags")) || bytes.HasPrefix(page, []byte("OpusHead")) {
+					continue
+				}
+				return page, true, nil
+			}
+		}
+		codec.ClockRate = 48000
+		codec.Channels = 2
+	default:
+		return nil, nil, fmt.Errorf("unsupported encoded track type %s", mime)
+	}
+
+	override.apply(&codec)
+
+	var opts []lksdk.LocalTrackOptions
+	if hooks.onKeyframeRequest != nil {
+		opts = append(opts, lksdk.WithRTCPHandler(func(pkt rtcp.Packet) {
+			switch pkt.(type) {
+			case *rtcp.PictureLossIndication:
+				hooks.onKeyframeRequest("PLI")
+			case *rtcp.FullIntraRequest:
+				hooks.onKeyframeRequest("FIR")
+			}
+		}))
+	}
+	track, err := lksdk.NewLocalTrack(codec, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	track.OnBind(func() {
+		if hooks.onBind != nil {
+			hooks.onBind()
+		}
+		if err := track.StartWrite(provider, nil); err != nil {
+			err = fmt.Errorf("starting %s track writer: %w", mime, err)
+			if hooks.onError == nil {
+				hooks.log.errorf("%v", err)
+				return
+			}
+			hooks.onError(err)
+		}
+	})
+	return track, provider, nil
+}
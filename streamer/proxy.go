@@ -0,0 +1,52 @@
+package streamer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// applyProxy routes LiveKit signalling through proxy. An empty proxy keeps
+// the standard behaviour of honouring HTTP_PROXY, HTTPS_PROXY and NO_PROXY,
+// which both the signalling WebSocket and the SDK's HTTP requests already
+// do. "direct" disables proxying. Any other value is an http, https or
+// socks5 proxy URL.
+//
+// The SDK dials through gorilla/websocket's default dialer and Go's default
+// HTTP transport, so an explicit proxy applies to the whole process.
+//
+// Only signalling is proxied. WebRTC media travels over UDP or TCP ICE
+// candidates that cannot traverse an HTTP or SOCKS proxy; behind a proxy
+// that blocks all other egress, media only flows if the LiveKit server or
+// its TURN relay is reachable directly, for example TURN over TLS on 443.
+func applyProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	fn := http.ProxyFromEnvironment
+	if proxy == "direct" {
+		fn = nil
+	} else {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("parsing proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported proxy scheme %q (want http, https or socks5)", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy URL %q has no host", proxy)
+		}
+		fn = http.ProxyURL(u)
+	}
+
+	websocket.DefaultDialer.Proxy = fn
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.Proxy = fn
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package streamer
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxPublishDelay bounds Config.VideoPublishDelay,
+// Config.AudioPublishDelay and Config.SyncStartTimeout, which hold up
+// Start.
+const MaxPublishDelay = 30 * time.Second
+
+func validatePublishDelay(kind string, d time.Duration) error {
+	if d < 0 || d > MaxPublishDelay {
+		return fmt.Errorf("%s publish delay %v outside 0-%v", kind, d, MaxPublishDelay)
+	}
+	return nil
+}
+
+// publishStaggered publishes the tracks once their publish delays have
+// passed, counted from when both are ready, after Config.SyncStartTimeout
+// when set, and the earlier one first.
+// Until its turn, a track's encoded output is read and dropped so the
+// track still opens on live media rather than an encoder backlog, and a
+// delayed raw video track is given a fresh encoder so it opens with an
+// IDR frame instead of waiting out the GOP.
+func (s *Streamer) publishStaggered() error {
+	s.startup.set(StartupFirstFrame)
+	if err := s.awaitFirstFrames(); err != nil {
+		return err
+	}
+	s.startup.set(StartupPublishing)
+	audioDelay, videoDelay := s.cfg.AudioPublishDelay, s.cfg.VideoPublishDelay
+	if audioDelay == 0 && videoDelay == 0 {
+		return s.publish()
+	}
+	type step struct {
+		kind       string
+		at         time.Duration
+		provider   *encodedSampleProvider
+		publish    func() error
+		stop, done chan struct{} // of the drain while waiting
+	}
+	steps := []*step{
+		{kind: "audio", at: audioDelay, provider: s.audioProvider, publish: s.publishAudio},
+		{kind: "video", at: videoDelay, provider: s.videoProvider, publish: s.publishVideo},
+	}
+	if videoDelay < audioDelay {
+		steps[0], steps[1] = steps[1], steps[0]
+	}
+	for _, st := range steps {
+		if st.at == 0 || st.provider == nil {
+			continue
+		}
+		st.stop, st.done = make(chan struct{}), make(chan struct{})
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer close(st.done)
+			st.provider.discard(st.stop, DropStartup)
+		}()
+	}
+	ready := time.Now()
+	for _, st := range steps {
+		if st.stop != nil {
+			select {
+			case <-time.After(time.Until(ready.Add(st.at))):
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			}
+			close(st.stop)
+			<-st.done
+			if st.kind == "video" && s.videoFeed != nil {
+				s.restartVideoEncoder("publish delay")
+			}
+			s.log.infof("Publishing %s %v after the tracks were ready", st.kind, st.at)
+		}
+		if err := st.publish(); err != nil {
+			return err
+		}
+	}
+	s.logICETransport()
+	return nil
+}
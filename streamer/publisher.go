@@ -0,0 +1,291 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// Publisher publishes media the caller has encoded itself, such as the
+// output of ffmpeg processes it runs, into a room it has already joined:
+// an H264 Annex-B stream as the video track and an Ogg Opus stream as the
+// audio track. It has none of Streamer's raw pipeline, encoder management
+// or supervision, only the tracks and the frame timing Stats reports.
+//
+// More video tracks, such as other camera angles each encoded by a process
+// of its own, are published next to the first with PublishVideoTrack.
+type Publisher struct {
+	room  *lksdk.Room
+	opts  PublisherOptions
+	stats *statsCollector
+
+	mu sync.Mutex
+	// video times each video track by name, the VideoTrackName one with
+	// stats, which also times the audio.
+	video   map[string]*statsCollector
+	pubs    []*lksdk.LocalTrackPublication
+	readers []io.Closer
+	closed  bool
+	// writers are the goroutines handing samples to opts.Sink.
+	writers sync.WaitGroup
+}
+
+// PublisherOptions configure a Publisher. Zero fields take the defaults
+// of the Config fields of the same name.
+type PublisherOptions struct {
+	// FrameRate is the video's frame rate, which paces the track.
+	FrameRate int
+	// VideoSource and AudioSource tell subscribers what the tracks carry.
+	VideoSource livekit.TrackSource
+	AudioSource livekit.TrackSource
+	// StatsSmoothing is the weight of each frame interval in
+	// Stats.SmoothedVideoInterval.
+	StatsSmoothing float64
+	// Logger receives the frame timing messages, as Config.Logger does.
+	Logger *slog.Logger
+	// Sink, if set, is given the tracks' samples instead of the room, as
+	// Config.Sink is, and room may be nil. The samples are not paced.
+	Sink Sink
+}
+
+// NewPublisher returns a Publisher for room, which the caller connects
+// before publishing and disconnects after Close.
+func NewPublisher(room *lksdk.Room, opts PublisherOptions) *Publisher {
+	if opts.FrameRate == 0 {
+		opts.FrameRate = DefaultFrameRate
+	}
+	if opts.VideoSource == livekit.TrackSource_UNKNOWN {
+		opts.VideoSource = livekit.TrackSource_CAMERA
+	}
+	if opts.AudioSource == livekit.TrackSource_UNKNOWN {
+		opts.AudioSource = livekit.TrackSource_MICROPHONE
+	}
+	if opts.StatsSmoothing == 0 {
+		opts.StatsSmoothing = DefaultStatsSmoothing
+	}
+	return &Publisher{
+		room:  room,
+		opts:  opts,
+		stats: newStatsCollector(opts.StatsSmoothing, logger{opts.Logger}),
+		video: make(map[string]*statsCollector),
+	}
+}
+
+// PublishVideo publishes r, an H264 Annex-B stream of width by height
+// frames, as the video track. The Publisher owns r from then on and
+// closes it in Close.
+func (p *Publisher) PublishVideo(r io.ReadCloser, width, height int) error {
+	return p.PublishVideoTrack(VideoTrackName, r, width, height)
+}
+
+// PublishVideoTrack is PublishVideo for a video track named name, which
+// may be called again with other names to publish more video tracks, each
+// timed on its own and reported by VideoTrackStats. Stats and VideoStats
+// cover the one named VideoTrackName.
+func (p *Publisher) PublishVideoTrack(name string, r io.ReadCloser, width, height int) error {
+	if name == "" || name == AudioTrackName {
+		r.Close()
+		return fmt.Errorf("invalid video track name %q", name)
+	}
+	stats := p.stats
+	if name != VideoTrackName {
+		stats = newStatsCollector(p.opts.StatsSmoothing, logger{p.opts.Logger})
+	}
+	p.mu.Lock()
+	_, taken := p.video[name]
+	if !taken {
+		p.video[name] = stats
+	}
+	p.mu.Unlock()
+	if taken {
+		r.Close()
+		return fmt.Errorf("video track %q is already published", name)
+	}
+
+	frameDuration := time.Second / time.Duration(p.opts.FrameRate)
+	stats.setPace(frameDuration, DefaultDriftWarning)
+	if p.opts.Sink != nil {
+		return p.publishToSink(name, &countingReader{r, stats.videoSample}, webrtc.MimeTypeH264, frameDuration,
+			func() { stats.videoFrame(time.Now()) })
+	}
+	track, err := lksdk.NewLocalReaderTrack(&countingReader{r, stats.videoSample}, webrtc.MimeTypeH264,
+		lksdk.ReaderTrackWithFrameDuration(frameDuration),
+		lksdk.ReaderTrackWithOnWriteComplete(func() { stats.videoFrame(time.Now()) }),
+	)
+	if err != nil {
+		r.Close()
+		return fmt.Errorf("creating video track %s: %w", name, err)
+	}
+	return p.publish(track, r, &lksdk.TrackPublicationOptions{
+		Name:        name,
+		Source:      p.opts.VideoSource,
+		VideoWidth:  width,
+		VideoHeight: height,
+	})
+}
+
+// PublishAudio publishes r, an Ogg Opus stream in 20 ms pages, as the
+// audio track. The Publisher owns r from then on and closes it in Close.
+func (p *Publisher) PublishAudio(r io.ReadCloser) error {
+	if p.opts.Sink != nil {
+		return p.publishToSink(AudioTrackName, &countingReader{r, p.stats.audioSample}, webrtc.MimeTypeOpus,
+			20*time.Millisecond, func() { p.stats.audioFrame(time.Now()) })
+	}
+	track, err := lksdk.NewLocalReaderTrack(&countingReader{r, p.stats.audioSample}, webrtc.MimeTypeOpus,
+		lksdk.ReaderTrackWithFrameDuration(20*time.Millisecond),
+		lksdk.ReaderTrackWithOnWriteComplete(func() { p.stats.audioFrame(time.Now()) }),
+	)
+	if err != nil {
+		r.Close()
+		return fmt.Errorf("creating audio track: %w", err)
+	}
+	return p.publish(track, r, &lksdk.TrackPublicationOptions{
+		Name:   AudioTrackName,
+		Source: p.opts.AudioSource,
+	})
+}
+
+func (p *Publisher) publish(track *lksdk.LocalTrack, r io.Closer, opts *lksdk.TrackPublicationOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		r.Close()
+		return errors.New("publisher is closed")
+	}
+	p.readers = append(p.readers, r)
+	pub, err := p.room.LocalParticipant.PublishTrack(track, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrPublishFailed, opts.Name, err)
+	}
+	p.pubs = append(p.pubs, pub)
+	return nil
+}
+
+// publishToSink hands the samples of r, a stream of mime, to opts.Sink as
+// the track named name, calling onFrame for each frame.
+func (p *Publisher) publishToSink(name string, r io.ReadCloser, mime string, frameDuration time.Duration, onFrame func()) error {
+	stamper := newFrameStamper(ClockMonotonic, systemClock{}, frameDuration, time.Time{})
+	hooks := trackHooks{onFrame: func(FrameInfo) { onFrame() }, log: logger{p.opts.Logger}}
+	_, provider, err := newEncodedTrack(r, mime, CodecOverride{}, stamper, hooks)
+	if err != nil {
+		r.Close()
+		return fmt.Errorf("creating track %s: %w", name, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		r.Close()
+		return errors.New("publisher is closed")
+	}
+	p.readers = append(p.readers, r)
+	p.writers.Add(1)
+	go func() {
+		defer p.writers.Done()
+		for {
+			sample, err := provider.NextSample(context.Background())
+			if err != nil {
+				return
+			}
+			if err := p.opts.Sink.WriteSample(name, sample); err != nil {
+				logger{p.opts.Logger}.errorf("Writing %s track to the sink: %v", name, err)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stats returns the frame counts and video timing so far. The fields
+// about encoders, drops and the session are left zero.
+func (p *Publisher) Stats() Stats {
+	var st Stats
+	p.stats.fill(&st)
+	return st
+}
+
+// VideoStats returns the frame timing of the video track so far, counting
+// the bytes read from its stream. It is safe to call from any goroutine.
+func (p *Publisher) VideoStats() FrameStats {
+	return p.stats.videoStats()
+}
+
+// VideoTrackStats is VideoStats for the video track published as name,
+// and false if there is none.
+func (p *Publisher) VideoTrackStats(name string) (FrameStats, bool) {
+	p.mu.Lock()
+	stats, ok := p.video[name]
+	p.mu.Unlock()
+	if !ok {
+		return FrameStats{}, false
+	}
+	return stats.videoStats(), true
+}
+
+// VideoTrackNames returns the names of the video tracks published so far,
+// sorted.
+func (p *Publisher) VideoTrackNames() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Sorted(maps.Keys(p.video))
+}
+
+// AudioStats is VideoStats for the audio track.
+func (p *Publisher) AudioStats() FrameStats {
+	return p.stats.audioStats()
+}
+
+// countingReader reports the size of every read to add.
+type countingReader struct {
+	io.ReadCloser
+	add func(n int)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.add(n)
+	}
+	return n, err
+}
+
+// Close unpublishes every track, closes their readers and prints the final
+// stats. Closing an encoder's output pipe makes it fail at its next write,
+// so a caller that wants its last packets published stops the encoder, and
+// lets the tracks drain, first. With a Sink it waits for the tracks'
+// writers and closes the Sink. It is safe to call more than once.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	for _, pub := range p.pubs {
+		p.room.LocalParticipant.UnpublishTrack(pub.SID())
+	}
+	var errs []error
+	for _, r := range p.readers {
+		errs = append(errs, r.Close())
+	}
+	if p.opts.Sink != nil {
+		p.writers.Wait()
+		errs = append(errs, p.opts.Sink.Close())
+	}
+	p.stats.printFinal()
+	for _, name := range slices.Sorted(maps.Keys(p.video)) {
+		if name != VideoTrackName {
+			p.video[name].printVideoFinal("Video " + name)
+		}
+	}
+	return errors.Join(errs...)
+}
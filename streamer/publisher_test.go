@@ -0,0 +1,58 @@
+package streamer
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+)
+
+// testH264Stream is an Annex-B stream of n pictures, an IDR slice with
+// its parameter sets every gop of them and a non-IDR slice for the rest.
+func testH264Stream(n, gop int) []byte {
+	var out []byte
+	for i := range n {
+		slice := byte(0x41)
+		if i%gop == 0 {
+			out = append(out, 0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xce)
+			slice = 0x65
+		}
+		out = append(out, 0, 0, 0, 1, slice, 0x80)
+		out = strconv.AppendInt(out, int64(i), 10)
+	}
+	return out
+}
+
+func TestPublisherSink(t *testing.T) {
+	sink := &NullSink{}
+	p := NewPublisher(nil, PublisherOptions{FrameRate: 30, Sink: sink, Logger: slog.New(slog.DiscardHandler)})
+	stream := testH264Stream(12, 5)
+	if err := p.PublishVideo(io.NopCloser(bytes.NewReader(stream)), 64, 48); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PublishVideo(io.NopCloser(bytes.NewReader(stream)), 64, 48); err == nil {
+		t.Error("second PublishVideo as the same track succeeded")
+	}
+	// Close waits for the whole stream to reach the sink.
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := sink.Counts(VideoTrackName)
+	// Each IDR slice is preceded by an SPS and a PPS sample.
+	if counts.Frames != 12 || counts.Samples != 12+2*3 {
+		t.Errorf("sink got %d samples, %d frames, want 18 and 12", counts.Samples, counts.Frames)
+	}
+	// The stats count the intervals between frames.
+	st := p.VideoStats()
+	if st.Frames != 11 || st.BytesRead != int64(len(stream)) {
+		t.Errorf("VideoStats = %d frames, %d bytes, want 11 and %d", st.Frames, st.BytesRead, len(stream))
+	}
+	if err := p.PublishVideoTrack("side", io.NopCloser(bytes.NewReader(stream)), 64, 48); err == nil {
+		t.Error("PublishVideoTrack after Close succeeded")
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
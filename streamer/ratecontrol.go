@@ -0,0 +1,113 @@
+package streamer
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RateControl is the video encoder's rate control mode, for
+// VideoEncoderSettings.RateControl. Empty leaves it to the encoder, which
+// for all of them is VBR around BitrateKbps, or constant quality without one.
+type RateControl string
+
+const (
+	// RateControlCBR holds the bitrate at BitrateKbps, padding easy scenes,
+	// for links that cannot absorb bursts. It needs BitrateKbps.
+	RateControlCBR RateControl = "cbr"
+	// RateControlVBR lets the bitrate vary around BitrateKbps, up to
+	// MaxBitrateKbps if set.
+	RateControlVBR RateControl = "vbr"
+)
+
+func (rc RateControl) validate() error {
+	switch rc {
+	case "", RateControlCBR, RateControlVBR:
+		return nil
+	}
+	return fmt.Errorf("unknown rate control %q (want cbr or vbr)", string(rc))
+}
+
+// validateRate checks the bitrate settings against each other.
+func (v VideoEncoderSettings) validateRate() error {
+	if err := v.RateControl.validate(); err != nil {
+		return err
+	}
+	if v.MaxBitrateKbps < 0 {
+		return fmt.Errorf("max bitrate %d kbps must not be negative", v.MaxBitrateKbps)
+	}
+	if v.MaxBitrateKbps > 0 && v.MaxBitrateKbps < v.BitrateKbps {
+		return fmt.Errorf("max bitrate %d kbps is below the target bitrate %d kbps", v.MaxBitrateKbps, v.BitrateKbps)
+	}
+	if v.RateControl == RateControlCBR {
+		if v.BitrateKbps == 0 {
+			return fmt.Errorf("%s rate control needs a target bitrate", RateControlCBR)
+		}
+		if v.MaxBitrateKbps != 0 && v.MaxBitrateKbps != v.BitrateKbps {
+			return fmt.Errorf("%s rate control holds the bitrate at the target %d kbps; max bitrate %d kbps would differ",
+				RateControlCBR, v.BitrateKbps, v.MaxBitrateKbps)
+		}
+	}
+	return nil
+}
+
+// rateControlArgs translates the bitrate settings into p.Encoder's flags,
+// the -bufsize one included. The encoders do not share them:
+//
+//   - NVENC, and the default branch generally, takes the mode itself as
+//     -rc cbr or -rc vbr, with -maxrate capping VBR.
+//   - libx264 has no mode flag. CBR is -minrate and -maxrate pinned to
+//     -b:v with nal-hrd=cbr so the stream signals it, and -maxrate alone
+//     caps VBR. Either way its VBV needs a buffer, which NVENC does not:
+//     half a second of the cap, small enough to keep the latency, large
+//     enough that each keyframe still fits.
+//   - QSV and VideoToolbox choose CBR from -maxrate equal to -b:v, and VP8
+//     from -minrate and -maxrate both equal to it; they also take -maxrate
+//     as the VBR cap. VideoToolbox needs -constant_bit_rate as well.
+//
+// With no bitrate settings every encoder keeps its defaults and the buffer
+// is disabled, as it always was.
+func rateControlArgs(p videoEncoderParams) []string {
+	v := p.Settings
+	bufsize := "0"
+	var args []string
+	if v.BitrateKbps > 0 {
+		args = append(args, "-b:v", kbpsArg(v.BitrateKbps))
+	}
+	maxrate := v.MaxBitrateKbps
+	if v.RateControl == RateControlCBR {
+		maxrate = v.BitrateKbps
+	}
+	cbr := v.RateControl == RateControlCBR
+	switch p.Encoder {
+	case SoftwareVideoEncoder:
+		if cbr {
+			args = append(args, "-minrate", kbpsArg(maxrate), "-x264-params", "nal-hrd=cbr")
+		}
+		if maxrate > 0 {
+			args = append(args, "-maxrate", kbpsArg(maxrate))
+			bufsize = kbpsArg(max(maxrate/2, 1))
+		}
+	case QSVVideoEncoder, VideoToolboxVideoEncoder, VP8VideoEncoder:
+		if cbr && p.Encoder == VP8VideoEncoder {
+			args = append(args, "-minrate", kbpsArg(maxrate))
+		}
+		if cbr && p.Encoder == VideoToolboxVideoEncoder {
+			args = append(args, "-constant_bit_rate", "1")
+		}
+		if maxrate > 0 {
+			args = append(args, "-maxrate", kbpsArg(maxrate))
+		}
+	default:
+		if v.RateControl != "" {
+			args = append(args, "-rc", string(v.RateControl))
+		}
+		if maxrate > 0 {
+			args = append(args, "-maxrate", kbpsArg(maxrate))
+		}
+	}
+	return append(args, "-bufsize", bufsize)
+}
+
+func kbpsArg(kbps int) string {
+	return strconv.Itoa(kbps) + "k"
+}
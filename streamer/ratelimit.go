@@ -0,0 +1,46 @@
+package streamer
+
+import (
+	"io"
+	"time"
+)
+
+// frameRateLimiter passes raw frames through no faster than one per
+// interval, so a producer that dumps frames faster than real time cannot
+// race the encoder ahead and build up latency. Frames are never dropped;
+// the producer is simply back-pressured through the pipe.
+type frameRateLimiter struct {
+	r         io.Reader
+	frameSize int
+	interval  time.Duration
+
+	next      time.Time
+	remaining int
+}
+
+func newFrameRateLimiter(r io.Reader, frameSize int, interval time.Duration) *frameRateLimiter {
+	return &frameRateLimiter{r: r, frameSize: frameSize, interval: interval}
+}
+
+func (l *frameRateLimiter) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		now := time.Now()
+		if l.next.IsZero() {
+			l.next = now
+		}
+		if wait := l.next.Sub(now); wait > 0 {
+			time.Sleep(wait)
+		} else if -wait > l.interval {
+			// A producer that paused must not bank credit for a burst.
+			l.next = now
+		}
+		l.next = l.next.Add(l.interval)
+		l.remaining = l.frameSize
+	}
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= n
+	return n, err
+}
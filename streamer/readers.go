@@ -0,0 +1,78 @@
+package streamer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// DebugReader wraps an io.Reader and logs when data is read, at Debug. It
+// is silent until SetSampling enables its LogReads messages.
+type DebugReader struct {
+	reader  io.ReadCloser
+	name    string
+	sampler *logSampler
+	log     logger
+	ctx     context.Context
+}
+
+func NewDebugReader(r io.ReadCloser, name string) *DebugReader {
+	return &DebugReader{reader: r, name: name}
+}
+
+// SetSampling logs reads, thinned out by s. Call it before the first Read.
+func (d *DebugReader) SetSampling(s LogSampling) {
+	d.sampler = newLogSampler(s)
+}
+
+// SetLogger logs the reads at Debug through l rather than through
+// slog.Default(). Call it before the first Read.
+func (d *DebugReader) SetLogger(l *slog.Logger) {
+	d.log = logger{l}
+}
+
+// SetContext ends the stream once ctx is done: a Read blocked on the
+// source, and every one after, returns io.EOF, so a track reading it stops
+// at once rather than when the encoder's pipe closes. Call it before the
+// first Read.
+func (d *DebugReader) SetContext(ctx context.Context) {
+	d.ctx = ctx
+	cancelReads(ctx, d.reader)
+}
+
+func (d *DebugReader) Read(p []byte) (n int, err error) {
+	if canceled(d.ctx) {
+		return 0, io.EOF
+	}
+	n, err = d.reader.Read(p)
+	if err != nil && canceled(d.ctx) {
+		err = io.EOF
+	}
+	if n > 0 && d.sampler != nil {
+		if ok, suppressed := d.sampler.allow(); ok {
+			d.log.debugf("[%s] Read %d bytes%s", d.name, n, sampledSuffix(suppressed))
+		}
+	}
+	return n, err
+}
+
+func (d *DebugReader) Close() error {
+	return d.reader.Close()
+}
+
+// cancelReads interrupts reads of r once ctx is done: with a read deadline
+// in the past where r supports one, as pipes do, or else by closing it.
+func cancelReads(ctx context.Context, r io.Closer) {
+	context.AfterFunc(ctx, func() {
+		if d, ok := r.(interface{ SetReadDeadline(time.Time) error }); ok && d.SetReadDeadline(time.Now()) == nil {
+			return
+		}
+		r.Close()
+	})
+}
+
+// canceled reports whether ctx, which may be nil, is done.
+func canceled(ctx context.Context) bool {
+	return ctx != nil && ctx.Err() != nil
+}
@@ -0,0 +1,79 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// contextReader is DebugReader or H264Reader.
+type contextReader interface {
+	io.Reader
+	SetContext(ctx context.Context)
+}
+
+// testCancelMidRead cancels r's context while a Read is blocked on a
+// source that never sends, and checks the Read, and the one after it,
+// return io.EOF promptly.
+func testCancelMidRead(t *testing.T, r contextReader) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	r.SetContext(ctx)
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 64))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-read:
+		t.Fatalf("Read returned %v before the cancel", err)
+	default:
+	}
+	cancel()
+	select {
+	case err := <-read:
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("cancelled Read = %v, want io.EOF", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read still blocked 1s after the cancel")
+	}
+	if _, err := r.Read(make([]byte, 64)); !errors.Is(err, io.EOF) {
+		t.Errorf("Read after the cancel = %v, want io.EOF", err)
+	}
+}
+
+func TestReadersCancelMidRead(t *testing.T) {
+	// An io.Pipe has no read deadline, so the cancel closes it; an
+	// os.Pipe, like the encoders' stdout, is given a past deadline.
+	sources := map[string]func(t *testing.T) io.ReadCloser{
+		"io.Pipe": func(t *testing.T) io.ReadCloser {
+			pr, pw := io.Pipe()
+			t.Cleanup(func() { pw.Close() })
+			return pr
+		},
+		"os.Pipe": func(t *testing.T) io.ReadCloser {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pr.Close(); pw.Close() })
+			return pr
+		},
+	}
+	for name, source := range sources {
+		t.Run("DebugReader/"+name, func(t *testing.T) {
+			testCancelMidRead(t, NewDebugReader(source(t), "test"))
+		})
+		t.Run("H264Reader/"+name, func(t *testing.T) {
+			h := NewH264Reader(source(t), "test")
+			h.SetLogger(slog.New(slog.DiscardHandler))
+			testCancelMidRead(t, h)
+		})
+	}
+}
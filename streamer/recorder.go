@@ -0,0 +1,451 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// RecordContainer is the file format recordings are written in.
+type RecordContainer string
+
+const (
+	// RecordRaw writes each track as it arrives: H264 as Annex-B, VP8,
+	// VP9 and AV1 as IVF and Opus as Ogg. No ffmpeg is involved.
+	RecordRaw RecordContainer = "raw"
+	// RecordMP4 is only playable once ffmpeg has written the index at the
+	// end; an interrupted recording is lost.
+	RecordMP4 RecordContainer = "mp4"
+	// RecordFragmentedMP4 writes self-contained fragments from each
+	// keyframe on, so a recording cut short by a crash or kill stays
+	// playable up to its last fragment.
+	RecordFragmentedMP4 RecordContainer = "fmp4"
+	RecordMKV           RecordContainer = "mkv"
+	RecordWebM          RecordContainer = "webm"
+)
+
+func (c RecordContainer) validate() error {
+	switch c {
+	case RecordRaw, RecordMP4, RecordFragmentedMP4, RecordMKV, RecordWebM:
+		return nil
+	}
+	return fmt.Errorf("unknown record container %q", c)
+}
+
+// ext is the file extension of recordings in c, which must not be
+// RecordRaw.
+func (c RecordContainer) ext() string {
+	if c == RecordFragmentedMP4 {
+		return ".mp4"
+	}
+	return "." + string(c)
+}
+
+// muxerArgs are the ffmpeg output options that select c.
+func (c RecordContainer) muxerArgs() []string {
+	switch c {
+	case RecordMP4:
+		return []string{"-f", "mp4"}
+	case RecordFragmentedMP4:
+		return []string{"-f", "mp4", "-movflags", "+frag_keyframe+empty_moov+default_base_moof"}
+	case RecordWebM:
+		return []string{"-f", "webm"}
+	}
+	return []string{"-f", "matroska"}
+}
+
+// supports reports whether c can hold the codec mime. Matroska takes
+// anything that is recorded; WebM is limited to VP8, VP9, AV1 and Opus,
+// and MP4 has no standard mapping for VP8.
+func (c RecordContainer) supports(mime string) bool {
+	switch c {
+	case RecordWebM:
+		return !strings.EqualFold(mime, webrtc.MimeTypeH264)
+	case RecordMP4, RecordFragmentedMP4:
+		return !strings.EqualFold(mime, webrtc.MimeTypeVP8)
+	}
+	return true
+}
+
+// RecordMuxing decides whether a participant's tracks are recorded to
+// separate files or muxed into one.
+type RecordMuxing string
+
+const (
+	RecordSeparate RecordMuxing = "separate"
+	// RecordMuxed writes a participant's first video and audio track into
+	// one file. The muxer starts with the first subscribed track and
+	// includes the tracks published at that moment; tracks published
+	// later are not recorded. Each input starts at its first packet, so
+	// tracks that begin at different times are offset by the difference.
+	RecordMuxed RecordMuxing = "muxed"
+)
+
+// validateRecording checks the recorder settings.
+func (s *Streamer) validateRecording() error {
+	if err := s.cfg.RecordContainer.validate(); err != nil {
+		return err
+	}
+	switch s.cfg.RecordMuxing {
+	case RecordSeparate:
+	case RecordMuxed:
+		if s.cfg.RecordContainer == RecordRaw {
+			return fmt.Errorf("muxed recording needs a container other than %q", RecordRaw)
+		}
+	default:
+		return fmt.Errorf("unknown record muxing %q", s.cfg.RecordMuxing)
+	}
+	return nil
+}
+
+// rtpWriter is implemented by the pion media writers.
+type rtpWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// newTrackRecorder opens a file in dir for the codec of track. H264 is
+// written as Annex-B, VP8/VP9/AV1 as IVF and Opus as Ogg.
+func newTrackRecorder(dir string, track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) (rtpWriter, string, error) {
+	mime := track.Codec().MimeType
+	base := filepath.Join(dir, fmt.Sprintf("%s-%s", rp.Identity(), publication.SID()))
+
+	switch {
+	case strings.EqualFold(mime, webrtc.MimeTypeH264):
+		w, err := h264writer.New(base + ".h264")
+		return w, base + ".h264", err
+	case strings.EqualFold(mime, webrtc.MimeTypeVP8),
+		strings.EqualFold(mime, webrtc.MimeTypeVP9),
+		strings.EqualFold(mime, webrtc.MimeTypeAV1):
+		w, err := ivfwriter.New(base+".ivf", ivfwriter.WithCodec(mime))
+		return w, base + ".ivf", err
+	case strings.EqualFold(mime, webrtc.MimeTypeOpus):
+		w, err := oggwriter.New(base+".ogg", 48000, 2)
+		return w, base + ".ogg", err
+	}
+	return nil, "", fmt.Errorf("cannot record codec %s", mime)
+}
+
+// newStreamWriter writes the same formats as newTrackRecorder to w, for
+// feeding an ffmpeg muxer.
+func newStreamWriter(w io.Writer, mime string) (rtpWriter, error) {
+	switch {
+	case strings.EqualFold(mime, webrtc.MimeTypeH264):
+		return h264writer.NewWith(w), nil
+	case strings.EqualFold(mime, webrtc.MimeTypeVP8),
+		strings.EqualFold(mime, webrtc.MimeTypeVP9),
+		strings.EqualFold(mime, webrtc.MimeTypeAV1):
+		return ivfwriter.NewWith(w, ivfwriter.WithCodec(mime))
+	case strings.EqualFold(mime, webrtc.MimeTypeOpus):
+		return oggwriter.NewWith(w, 48000, 2)
+	}
+	return nil, fmt.Errorf("cannot record codec %s", mime)
+}
+
+// muxerInputArgs are the ffmpeg options that read a newStreamWriter stream
+// of codec mime from input. Annex-B carries no timestamps, so H264 is
+// stamped with the time each frame reaches ffmpeg.
+func muxerInputArgs(mime, input string) []string {
+	switch {
+	case strings.EqualFold(mime, webrtc.MimeTypeH264):
+		return []string{"-use_wallclock_as_timestamps", "1", "-f", "h264", "-i", input}
+	case strings.EqualFold(mime, webrtc.MimeTypeOpus):
+		return []string{"-f", "ogg", "-i", input}
+	}
+	return []string{"-f", "ivf", "-i", input}
+}
+
+// muxerCommand builds the ffmpeg process that copies inputs, each a
+// muxerInputArgs list, into path without re-encoding.
+func muxerCommand(container RecordContainer, path string, inputs ...[]string) *exec.Cmd {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	for _, in := range inputs {
+		args = append(args, in...)
+	}
+	for i := range inputs {
+		args = append(args, "-map", fmt.Sprintf("%d", i))
+	}
+	args = append(args, "-c", "copy")
+	args = append(args, container.muxerArgs()...)
+	args = append(args, "-y", path)
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// muxedTrackWriter feeds one track into its own ffmpeg muxer. Closing it
+// ends the input and waits for ffmpeg to finish the file.
+type muxedTrackWriter struct {
+	rtpWriter
+	stdin io.Closer
+	cmd   *exec.Cmd
+}
+
+func (w *muxedTrackWriter) Close() error {
+	w.rtpWriter.Close()
+	w.stdin.Close()
+	return w.cmd.Wait()
+}
+
+// newContainerRecorder records track into its own file in container,
+// through ffmpeg.
+func newContainerRecorder(dir string, container RecordContainer, track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) (rtpWriter, string, error) {
+	mime := track.Codec().MimeType
+	if !container.supports(mime) {
+		return nil, "", fmt.Errorf("cannot record codec %s in %s", mime, container)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s%s", rp.Identity(), publication.SID(), container.ext()))
+	cmd := muxerCommand(container, path, muxerInputArgs(mime, "pipe:0"))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	w, err := newStreamWriter(stdin, mime)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("starting muxer: %w", err)
+	}
+	return &muxedTrackWriter{rtpWriter: w, stdin: stdin, cmd: cmd}, path, nil
+}
+
+// participantRecording is the single ffmpeg muxer of a participant with
+// RecordMuxed. Each input is a pipe, passed to ffmpeg as an extra file,
+// that the participant's track of that kind takes on subscription.
+type participantRecording struct {
+	path  string
+	cmd   *exec.Cmd
+	mu    sync.Mutex
+	mimes map[lksdk.TrackKind]string
+	pipes map[lksdk.TrackKind]*os.File // write ends not yet taken by a track
+}
+
+// take hands the input of kind to a track, once.
+func (r *participantRecording) take(kind lksdk.TrackKind) (*os.File, string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pipes[kind]
+	delete(r.pipes, kind)
+	return p, r.mimes[kind], ok
+}
+
+// closeUntaken ends the inputs no track took, so that ffmpeg can finish
+// the file once the tracks that did end.
+func (r *participantRecording) closeUntaken() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for kind, p := range r.pipes {
+		p.Close()
+		delete(r.pipes, kind)
+	}
+}
+
+// participantRecording returns the muxer of rp, starting it for the first
+// video and audio publication rp has. track is the track being subscribed,
+// whose codec is known for certain.
+func (s *Streamer) participantRecording(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) (*participantRecording, error) {
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	if rec, ok := s.recordings[rp.SID()]; ok {
+		return rec, nil
+	}
+
+	rec := &participantRecording{
+		path:  filepath.Join(s.cfg.RecordDir, fmt.Sprintf("%s-%s%s", rp.Identity(), rp.SID(), s.cfg.RecordContainer.ext())),
+		mimes: map[lksdk.TrackKind]string{publication.Kind(): track.Codec().MimeType},
+		pipes: make(map[lksdk.TrackKind]*os.File),
+	}
+	for _, pub := range rp.TrackPublications() {
+		kind := pub.Kind()
+		if _, ok := rec.mimes[kind]; ok || (kind != lksdk.TrackKindVideo && kind != lksdk.TrackKindAudio) {
+			continue
+		}
+		if mime := pub.MimeType(); mime != "" {
+			rec.mimes[kind] = mime
+		}
+	}
+
+	for _, mime := range rec.mimes {
+		if !s.cfg.RecordContainer.supports(mime) {
+			return nil, fmt.Errorf("cannot record codec %s in %s", mime, s.cfg.RecordContainer)
+		}
+	}
+
+	var inputs [][]string
+	var readers []*os.File
+	for _, kind := range []lksdk.TrackKind{lksdk.TrackKindVideo, lksdk.TrackKindAudio} {
+		mime, ok := rec.mimes[kind]
+		if !ok {
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			rec.closeUntaken()
+			return nil, err
+		}
+		defer r.Close()
+		readers = append(readers, r)
+		rec.pipes[kind] = w
+		// ExtraFiles start at descriptor 3.
+		inputs = append(inputs, muxerInputArgs(mime, fmt.Sprintf("pipe:%d", 2+len(readers))))
+	}
+	rec.cmd = muxerCommand(s.cfg.RecordContainer, rec.path, inputs...)
+	rec.cmd.ExtraFiles = readers
+	if err := rec.cmd.Start(); err != nil {
+		rec.closeUntaken()
+		return nil, fmt.Errorf("starting muxer: %w", err)
+	}
+	s.log.infof("Recording %s to %s", rp.Identity(), rec.path)
+	s.recordings[rp.SID()] = rec
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		exited := make(chan error, 1)
+		go func() { exited <- rec.cmd.Wait() }()
+		var err error
+		select {
+		case err = <-exited:
+		case <-s.ctx.Done():
+			rec.closeUntaken()
+			err = <-exited
+		}
+		s.recordingsMu.Lock()
+		delete(s.recordings, rp.SID())
+		s.recordingsMu.Unlock()
+		if err != nil {
+			s.log.errorf("Muxing %s failed: %v", rec.path, err)
+			s.reportError(fmt.Errorf("recording %s: %w", rec.path, err), false)
+			return
+		}
+		s.log.infof("Finished recording %s", rec.path)
+	}()
+	return rec, nil
+}
+
+// newMuxedRecorder attaches track to the recording of its participant.
+func (s *Streamer) newMuxedRecorder(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) (rtpWriter, string, error) {
+	rec, err := s.participantRecording(track, publication, rp)
+	if err != nil {
+		return nil, "", err
+	}
+	p, mime, ok := rec.take(publication.Kind())
+	if !ok {
+		return nil, "", fmt.Errorf("%s is already recording a %s track or started without one", rec.path, publication.Kind())
+	}
+	if !strings.EqualFold(mime, track.Codec().MimeType) {
+		p.Close()
+		return nil, "", fmt.Errorf("track codec %s differs from the %s the muxer was started for", track.Codec().MimeType, mime)
+	}
+	w, err := newStreamWriter(p, mime)
+	if err != nil {
+		p.Close()
+		return nil, "", err
+	}
+	return &muxedInputWriter{rtpWriter: w, pipe: p, rec: rec}, rec.path, nil
+}
+
+// muxedInputWriter feeds one track into a participantRecording. When the
+// first track ends, inputs still waiting for theirs are closed too: the
+// participant is most likely gone, and ffmpeg cannot finish otherwise.
+type muxedInputWriter struct {
+	rtpWriter
+	pipe *os.File
+	rec  *participantRecording
+}
+
+func (w *muxedInputWriter) Close() error {
+	w.rtpWriter.Close()
+	w.rec.closeUntaken()
+	return w.pipe.Close()
+}
+
+// newRecorder opens the recording of track in Config.RecordDir.
+func (s *Streamer) newRecorder(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) (rtpWriter, string, error) {
+	switch {
+	case s.cfg.RecordMuxing == RecordMuxed:
+		return s.newMuxedRecorder(track, publication, rp)
+	case s.cfg.RecordContainer != RecordRaw:
+		return newContainerRecorder(s.cfg.RecordDir, s.cfg.RecordContainer, track, publication, rp)
+	}
+	return newTrackRecorder(s.cfg.RecordDir, track, publication, rp)
+}
+
+// trackSink is a recorder or decoder of a subscribed track.
+type trackSink struct {
+	w    rtpWriter
+	verb string // what it does, for messages
+	path string
+}
+
+// consumeTrack hands every RTP packet of track to its recorder, with
+// Config.RecordDir, and its decoder, with Config.DecodeDir or
+// OnDecodedFrame, until the track ends. A track can only be read once, so
+// both are fed from the one read loop; either failing leaves the other
+// running.
+func (s *Streamer) consumeTrack(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+	var sinks []trackSink
+	if s.cfg.RecordDir != "" {
+		if w, path, err := s.newRecorder(track, publication, rp); err != nil {
+			s.log.warnf("Not recording track %s from %s: %v", publication.SID(), rp.Identity(), err)
+			s.reportError(fmt.Errorf("recording track %s: %w", publication.SID(), err), false)
+		} else {
+			s.log.infof("Recording track %s from %s to %s", publication.SID(), rp.Identity(), path)
+			sinks = append(sinks, trackSink{w: w, verb: "Recording", path: path})
+		}
+	}
+	if s.cfg.decodes() && track.Kind() == webrtc.RTPCodecTypeVideo {
+		if w, path, err := s.newTrackDecoder(track, publication, rp); err != nil {
+			s.log.warnf("Not decoding track %s from %s: %v", publication.SID(), rp.Identity(), err)
+			s.reportError(fmt.Errorf("decoding track %s: %w", publication.SID(), err), false)
+		} else {
+			if path == "" {
+				path = "track " + publication.SID()
+			}
+			s.log.infof("Decoding track %s from %s to %s", publication.SID(), rp.Identity(), path)
+			sinks = append(sinks, trackSink{w: w, verb: "Decoding", path: path})
+		}
+	}
+	if len(sinks) == 0 {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			for _, sink := range sinks {
+				sink.w.Close()
+			}
+		}()
+		for len(sinks) > 0 {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			for i := 0; i < len(sinks); i++ {
+				sink := sinks[i]
+				if err := sink.w.WriteRTP(pkt); err != nil {
+					s.log.errorf("%s %s failed: %v", sink.verb, sink.path, err)
+					s.reportError(fmt.Errorf("%s %s: %w", strings.ToLower(sink.verb), sink.path, err), false)
+					sink.w.Close()
+					sinks = slices.Delete(sinks, i, i+1)
+					i--
+				}
+			}
+		}
+	}()
+}
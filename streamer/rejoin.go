@@ -0,0 +1,84 @@
+package streamer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	// DefaultRejoinBackoff is the wait before the first rejoin when
+	// Config.RejoinBackoff is zero.
+	DefaultRejoinBackoff = time.Second
+	// MaxRejoinBackoff caps the doubling wait between rejoins.
+	MaxRejoinBackoff = 30 * time.Second
+)
+
+// roomDisconnected handles the connection being lost for good, after the
+// SDK's own reconnection, for Config.MaxRejoinAttempts. It parks the
+// encoders before returning, so the SDK closing the tracks afterwards
+// leaves them running, and rejoins in the background. A disconnection
+// that rejoining cannot undo ends the session at once.
+func (s *Streamer) roomDisconnected(reason lksdk.DisconnectionReason) {
+	if s.cfg.MaxRejoinAttempts == 0 || s.ctx.Err() != nil {
+		return
+	}
+	switch reason {
+	case lksdk.DuplicateIdentity, lksdk.ParticipantRemoved, lksdk.RoomClosed:
+		s.reportError(fmt.Errorf("%w: %s", ErrDisconnected, reason), true)
+		return
+	}
+	providers := s.providers()
+	if len(providers) == 0 {
+		return
+	}
+	for _, p := range providers {
+		p.parked.Store(true)
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.rejoinAfterDisconnect(providers, reason)
+	}()
+}
+
+// rejoinAfterDisconnect parks the session without leaving the room, which
+// is gone, and rejoins it with backoff until an attempt succeeds, the
+// session is stopped or resumed by Rejoin, or the attempts run out.
+func (s *Streamer) rejoinAfterDisconnect(providers []*encodedSampleProvider, reason lksdk.DisconnectionReason) {
+	s.parkMu.Lock()
+	if s.parked.Load() {
+		// Park got there first and its Rejoin will publish again.
+		s.parkMu.Unlock()
+		return
+	}
+	s.replaceMu.Lock()
+	s.parked.Store(true)
+	s.leaveParked(providers, false, DropReconnect)
+	s.replaceMu.Unlock()
+	s.parkMu.Unlock()
+	s.log.warnf("Disconnected from room %s (%s), encoders kept running, rejoining", s.cfg.RoomName, reason)
+	s.emit(EventDisconnected, map[string]any{"room": s.cfg.RoomName, "reason": string(reason)})
+
+	var err error
+	delay := s.cfg.RejoinBackoff
+	for attempt := 1; attempt <= s.cfg.MaxRejoinAttempts; attempt++ {
+		// Half the delay is fixed and half random, so streamers that lost
+		// the same server do not all come back at once.
+		wait := delay/2 + rand.N(delay/2+1)
+		select {
+		case <-time.After(wait):
+		case <-s.ctx.Done():
+			return
+		}
+		s.rejoinAttempts.Add(1)
+		if err = s.Rejoin(""); err == nil || !s.parked.Load() {
+			return
+		}
+		s.log.warnf("Rejoin attempt %d/%d failed: %v", attempt, s.cfg.MaxRejoinAttempts, err)
+		delay = min(delay*2, MaxRejoinBackoff)
+	}
+	s.reportError(fmt.Errorf("%w: rejoining room %s failed %d times: %w", ErrDisconnected, s.cfg.RoomName, s.cfg.MaxRejoinAttempts, err), true)
+}
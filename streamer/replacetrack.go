@@ -0,0 +1,212 @@
+package streamer
+
+import (
+	"fmt"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// DefaultSwitchTimeout is how long ReplaceVideoTrack keeps both tracks
+// published waiting for a subscriber when VideoTrackConfig.SwitchTimeout
+// is zero.
+const DefaultSwitchTimeout = 5 * time.Second
+
+// VideoTrackConfig describes the track ReplaceVideoTrack publishes.
+type VideoTrackConfig struct {
+	// Codec is webrtc.MimeTypeH264 or webrtc.MimeTypeVP8. Empty keeps the
+	// current codec.
+	Codec string
+	// Encoder is the encode of the new track. The zero value keeps the
+	// current settings and crop, with the current encoder if the codec is
+	// unchanged, VP8VideoEncoder for VP8, and NVENC if usable, else
+	// libx264, for H264.
+	Encoder EncoderConfig
+	// SwitchTimeout bounds the overlap in which both tracks are published.
+	// Zero uses DefaultSwitchTimeout.
+	SwitchTimeout time.Duration
+}
+
+// ReplaceVideoTrack publishes a new video track, fed by its own encoder,
+// and unpublishes the current one once a subscriber has subscribed to the
+// new track or SwitchTimeout has passed. Unlike Reconfigure, this can
+// change the codec, at the cost of every subscriber renegotiating. src,
+// unless nil, becomes the video source as the new track is published, as
+// with SwitchVideoSource; both tracks show it during the overlap.
+//
+// During the overlap the participant has two video publications with the
+// same name and source. Clients that render every video track, such as a
+// loop over all publications, briefly show both; clients that pick one
+// track per source keep the old one until its TrackUnpublished event and
+// should then switch to the remaining one. To avoid a gap, clients should
+// prefer the newest publication of a source as soon as it is subscribed.
+// Encoding twice during the overlap costs a second encoder's CPU or NVENC
+// session.
+func (s *Streamer) ReplaceVideoTrack(src FrameSource, cfg VideoTrackConfig) error {
+	if s.videoFeed == nil || s.room == nil || s.ctx.Err() != nil {
+		return fmt.Errorf("%w: no video pipeline", ErrNotRunning)
+	}
+	s.replaceMu.Lock()
+	defer s.replaceMu.Unlock()
+	if s.parked.Load() {
+		return fmt.Errorf("%w: parked", ErrNotRunning)
+	}
+
+	codec, enc, err := s.resolveVideoTrackConfig(cfg)
+	if err != nil {
+		return err
+	}
+	timeout := cfg.SwitchTimeout
+	if timeout == 0 {
+		timeout = DefaultSwitchTimeout
+	}
+
+	cmd, stdin, stdout, err := s.startVideoEncoder(enc, true, 0)
+	if err != nil {
+		return err
+	}
+	// Until it takes over, the new encoder exiting is this call's failure
+	// rather than the session's.
+	s.retired.Store(cmd, true)
+	exited := s.watchProcess("video", cmd)
+	out := newSpliceReader(stdout)
+	track, provider, err := s.newVideoTrack(s.encodedVideoReader(out), codec, s.cfg.frameInterval())
+	if err != nil {
+		stdin.Close()
+		out.Close()
+		cmd.Process.Kill()
+		return fmt.Errorf("creating video track: %w", err)
+	}
+	var pub *lksdk.LocalTrackPublication
+	abort := func() {
+		s.videoFeed.untee()
+		if pub != nil {
+			s.room.LocalParticipant.UnpublishTrack(pub.SID())
+		}
+		out.Close()
+		cmd.Process.Kill()
+	}
+
+	s.videoFeed.tee(stdin)
+	if src != nil {
+		s.SwitchVideoSource(src)
+	}
+	subscribed := make(chan struct{})
+	s.subWaiters.Store(webrtc.TrackLocal(track), subscribed)
+	defer s.subWaiters.Delete(webrtc.TrackLocal(track))
+
+	width, height := s.encodedSize(enc.Crop)
+	pub, err = s.room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{
+		Name:        VideoTrackName,
+		Source:      s.cfg.VideoSource,
+		VideoWidth:  int(width),
+		VideoHeight: int(height),
+	})
+	if err != nil {
+		abort()
+		return fmt.Errorf("%w: video: %w", ErrPublishFailed, err)
+	}
+	s.log.infof("Published replacement video track %s (%s), waiting up to %v for subscribers", pub.SID(), codec, timeout)
+
+	tookOver := false
+	if s.participants.ParticipantCount() > 0 {
+		select {
+		case <-subscribed:
+			tookOver = true
+		case <-time.After(timeout):
+			s.log.warnf("No subscriber took video track %s within %v, replacing anyway", pub.SID(), timeout)
+		case <-exited:
+			abort()
+			return fmt.Errorf("replacement video encoder exited before taking over")
+		case <-s.ctx.Done():
+			abort()
+			return fmt.Errorf("%w: stopped while replacing the video track", ErrNotRunning)
+		}
+	}
+
+	s.encMu.Lock()
+	oldCmd, oldExited, oldPub := s.videoCmd, s.videoExited, s.videoPub
+	s.retired.Store(oldCmd, true)
+	s.retired.Delete(cmd)
+	s.videoCmd, s.videoExited = cmd, exited
+	s.videoOut, s.videoTrack, s.videoPub = out, track, pub
+	s.videoProvider = provider
+	s.videoEncoder, s.hardwareEncoding = enc.Encoder, isHardwareEncoder(enc.Encoder)
+	s.videoSettings, s.crop, s.videoCodec = enc.Settings, enc.Crop, codec
+	s.videoFeed.promote()
+	s.keyframes.setExpected(time.Duration(enc.Settings.GOP) * s.cfg.frameInterval())
+	s.encMu.Unlock()
+
+	// Unpublishing closes the old track's reader; the old encoder's input
+	// is closed on the next frame, so it drains and exits.
+	if err := s.room.LocalParticipant.UnpublishTrack(oldPub.SID()); err != nil {
+		s.log.warnf("Unpublishing video track %s: %v", oldPub.SID(), err)
+	}
+	s.reapRetired(oldCmd, oldExited)
+
+	s.log.infof("Replaced video track %s with %s (%s)", oldPub.SID(), pub.SID(), codec)
+	s.emit(EventTrackReplaced, map[string]any{
+		"from":       oldPub.SID(),
+		"to":         pub.SID(),
+		"codec":      codec,
+		"encoder":    enc.Encoder,
+		"subscribed": tookOver,
+	})
+	return nil
+}
+
+// resolveVideoTrackConfig fills in and checks the codec and encode of a
+// replacement track.
+func (s *Streamer) resolveVideoTrackConfig(cfg VideoTrackConfig) (string, EncoderConfig, error) {
+	cur, curCodec := s.EncoderConfig(), s.VideoCodec()
+	codec := cfg.Codec
+	if codec == "" {
+		codec = curCodec
+	}
+	if s.cfg.e2ee() && codec != webrtc.MimeTypeVP8 {
+		return "", EncoderConfig{}, fmt.Errorf("%w: end-to-end encrypted video must stay %s", ErrInvalidConfig, webrtc.MimeTypeVP8)
+	}
+	enc := cfg.Encoder
+	if enc == (EncoderConfig{}) {
+		enc = cur
+		switch {
+		case codec == curCodec:
+		case codec == webrtc.MimeTypeVP8:
+			enc.Encoder = VP8VideoEncoder
+		case probeVideoEncoder(s.ctx, s.cfg.H264Encoder) == nil:
+			enc.Encoder = s.cfg.H264Encoder
+		default:
+			enc.Encoder = SoftwareVideoEncoder
+		}
+	}
+
+	if err := checkVideoEncoder(codec, enc.Encoder); err != nil {
+		return "", EncoderConfig{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if err := enc.Settings.validate(); err != nil {
+		return "", EncoderConfig{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if !enc.Crop.IsZero() {
+		if err := enc.Crop.validate(s.frameWidth, s.frameHeight); err != nil {
+			return "", EncoderConfig{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	if enc.Encoder != cur.Encoder {
+		if err := probeVideoEncoder(s.ctx, enc.Encoder); err != nil {
+			return "", EncoderConfig{}, fmt.Errorf("%w: %w", ErrEncoderUnavailable, err)
+		}
+	}
+	return codec, enc, nil
+}
+
+// localTrackSubscribed wakes a ReplaceVideoTrack waiting for the first
+// subscriber of its new track.
+func (s *Streamer) localTrackSubscribed(pub *lksdk.LocalTrackPublication, _ *lksdk.LocalParticipant) {
+	if ch, ok := s.subWaiters.LoadAndDelete(pub.TrackLocal()); ok {
+		close(ch.(chan struct{}))
+	}
+	if s.cfg.ForceKeyframes && pub.Kind() == lksdk.TrackKindVideo {
+		s.RequestKeyframe("subscribed")
+	}
+}
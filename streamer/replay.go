@@ -0,0 +1,130 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// NewReplayTrack creates a track that publishes a recorded encoded stream
+// as-is, without re-encoding. IVF files (VP8/VP9/AV1) are paced by their
+// container timestamps; raw Annex-B H264 files carry no timestamps and are
+// paced at frameDuration. Failures after the track is bound are logged
+// through log, or slog.Default() if it is nil.
+//
+// It is for library use: neither cmd/streamer nor the examples publish
+// recordings with it.
+func NewReplayTrack(path string, frameDuration time.Duration, onWriteComplete func(), log *slog.Logger) (*lksdk.LocalTrack, error) {
+	if IsAnnexBPath(path) {
+		f, err := OpenAnnexBFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return lksdk.NewLocalReaderTrack(f, webrtc.MimeTypeH264,
+			lksdk.ReaderTrackWithFrameDuration(frameDuration),
+			lksdk.ReaderTrackWithOnWriteComplete(onWriteComplete),
+		)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ivf":
+		provider, err := newIVFSampleProvider(f, frameDuration)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		mime, err := provider.reader.Header.MimeType()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		track, err := lksdk.NewLocalTrack(webrtc.RTPCodecCapability{MimeType: mime, ClockRate: 90000})
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		track.OnBind(func() {
+			if err := track.StartWrite(provider, onWriteComplete); err != nil {
+				logger{log}.errorf("[Replay] Could not start writing %s: %v", path, err)
+			}
+		})
+		return track, nil
+	}
+
+	f.Close()
+	return nil, fmt.Errorf("unsupported replay file %s: expected .ivf or .h264", path)
+}
+
+// IsAnnexBPath reports whether path has the extension of a raw H264
+// Annex-B file, .h264 or .264.
+func IsAnnexBPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".h264", ".264":
+		return true
+	}
+	return false
+}
+
+// ivfSampleProvider yields IVF frames with durations derived from the
+// container timestamps so the original frame timing is preserved.
+type ivfSampleProvider struct {
+	lksdk.BaseSampleProvider
+	file            io.ReadCloser
+	reader          *IVFReader
+	defaultDuration time.Duration
+
+	pending []byte
+	lastPTS uint64
+}
+
+func newIVFSampleProvider(f io.ReadCloser, defaultDuration time.Duration) (*ivfSampleProvider, error) {
+	reader, err := NewIVFReader(f)
+	if err != nil {
+		return nil, err
+	}
+	p := &ivfSampleProvider{file: f, reader: reader, defaultDuration: defaultDuration}
+	if p.pending, p.lastPTS, err = reader.ReadFrame(); err != nil {
+		return nil, fmt.Errorf("reading first IVF frame: %w", err)
+	}
+	return p, nil
+}
+
+// NextSample returns the pending frame with a duration equal to the gap to
+// the following frame's timestamp. The last frame uses the default duration.
+func (p *ivfSampleProvider) NextSample(ctx context.Context) (media.Sample, error) {
+	if p.pending == nil {
+		return media.Sample{}, io.EOF
+	}
+	sample := media.Sample{Data: p.pending, Duration: p.defaultDuration}
+
+	next, pts, err := p.reader.ReadFrame()
+	switch {
+	case err == io.EOF:
+		p.pending = nil
+	case err != nil:
+		return media.Sample{}, err
+	default:
+		if pts > p.lastPTS {
+			sample.Duration = p.reader.PTSDuration(pts - p.lastPTS)
+		}
+		p.pending, p.lastPTS = next, pts
+	}
+	return sample, nil
+}
+
+func (p *ivfSampleProvider) Close() error {
+	return p.file.Close()
+}
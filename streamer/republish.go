@@ -0,0 +1,152 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// RepublishVideo replaces the video input with r, frames of w by h in the
+// session's pixel format, for a producer that comes back at another
+// resolution: the video track is unpublished and its ffmpeg stopped, and a
+// new encoder started on r is published as a fresh track of the new size
+// that subscribers renegotiate for. The audio track and the connection
+// are left alone. r carries no width/height header, only the sidecar
+// headers of Config.FrameHeaders if that is set, and as with
+// Config.VideoInput its Close must end a pending Read. Once the new encoder
+// has started the streamer owns r, and closes the input it replaces,
+// including a source switched in with SwitchVideoSource.
+//
+// Frames of the old input still in flight are not mixed into the new
+// track: a frame being read as the input is replaced is dropped, and what
+// the old encoder has yet to put out is discarded with its track. The
+// video stats and drop counts then start over, the audio ones carrying
+// on. The crop is kept if it fits the new frame and cleared otherwise.
+//
+// Until the new encoder has started nothing is changed, so an error leaves
+// the current track publishing and r with the caller. A track that cannot
+// be created or published after the old one is gone instead fails the
+// session, as it would at Start.
+func (s *Streamer) RepublishVideo(r io.ReadCloser, w, h int) error {
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("%w: video size %dx%d must be positive", ErrInvalidConfig, w, h)
+	}
+	width, height := uint32(w), uint32(h)
+	if err := ValidateDimensions(width, height, s.cfg.MinDimension, s.cfg.MaxDimension); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if s.videoFeed == nil || s.room == nil || s.ctx.Err() != nil {
+		return fmt.Errorf("%w: no video pipeline", ErrNotRunning)
+	}
+	if s.socket != nil {
+		return fmt.Errorf("%w: the video comes from the input socket", ErrInvalidConfig)
+	}
+	s.replaceMu.Lock()
+	defer s.replaceMu.Unlock()
+	if s.parked.Load() {
+		return fmt.Errorf("%w: parked", ErrNotRunning)
+	}
+
+	s.encMu.Lock()
+	fromWidth, fromHeight := s.videoSize()
+	prevWidth, prevHeight, prevCrop, prevFallback := s.frameWidth, s.frameHeight, s.crop, s.fallbackImage
+	s.frameWidth, s.frameHeight = width, height
+	if !s.crop.IsZero() && s.crop.validate(width, height) != nil {
+		s.crop = CropRect{}
+	}
+	cmd, stdin, stdout, err := s.startRepublishedEncoder()
+	if err != nil {
+		s.frameWidth, s.frameHeight, s.crop, s.fallbackImage = prevWidth, prevHeight, prevCrop, prevFallback
+		s.encMu.Unlock()
+		return err
+	}
+	if s.crop != prevCrop {
+		s.log.infof("Video crop %s does not fit %dx%d frames, cleared", prevCrop, width, height)
+	}
+	oldCmd, oldExited, oldPub, oldProvider := s.videoCmd, s.videoExited, s.videoPub, s.videoProvider
+	s.retired.Store(oldCmd, true)
+	s.videoCmd, s.videoExited = cmd, s.watchProcess("video", cmd)
+	toWidth, toHeight := s.videoSize()
+	s.encMu.Unlock()
+
+	// The old track hands over no more frames, so none of them count
+	// towards the new track's stats.
+	oldProvider.retire()
+	if err := s.room.LocalParticipant.UnpublishTrack(oldPub.SID()); err != nil {
+		s.log.warnf("Unpublishing video track %s: %v", oldPub.SID(), err)
+	}
+
+	s.encMu.Lock()
+	oldRaw, oldSwitcher := s.rawVideo, s.switcher
+	s.rawVideo = r
+	input := s.videoInput()
+	s.encMu.Unlock()
+	s.videoFeed.replaceInput(input, s.frameSize(), stdin)
+	oldSwitcher.close()
+	oldRaw.Close()
+	s.reapRetired(oldCmd, oldExited)
+	if s.videoQueue != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.videoQueue.run()
+		}()
+	}
+	s.stats.resetVideo()
+	s.videoDrops.reset()
+	s.inputSeq.reset()
+
+	out := newSpliceReader(stdout)
+	track, provider, err := s.newVideoTrack(s.encodedVideoReader(out), s.VideoCodec(), s.cfg.frameInterval())
+	if err != nil {
+		out.Close()
+		err = fmt.Errorf("creating video track: %w", err)
+		s.reportError(err, true)
+		return err
+	}
+	s.encMu.Lock()
+	s.videoOut, s.videoTrack, s.videoProvider, s.videoPub = out, track, provider, nil
+	s.encMu.Unlock()
+	if err := s.publishVideo(); err != nil {
+		s.reportError(err, true)
+		return err
+	}
+	s.encMu.Lock()
+	pub := s.videoPub
+	s.encMu.Unlock()
+
+	s.log.infof("Republished video as track %s at %dx%d, replacing %s", pub.SID(), width, height, oldPub.SID())
+	s.emit(EventVideoRepublished, map[string]any{
+		"from": oldPub.SID(),
+		"to":   pub.SID(),
+		"size": fmt.Sprintf("%dx%d", width, height),
+	})
+	// OnResolutionChanged runs with encMu released, so that it may call
+	// back into the Streamer.
+	if toWidth != fromWidth || toHeight != fromHeight {
+		s.emit(EventResolutionChanged, map[string]any{
+			"from": fmt.Sprintf("%dx%d", fromWidth, fromHeight),
+			"to":   fmt.Sprintf("%dx%d", toWidth, toHeight),
+		})
+		if s.cfg.OnResolutionChanged != nil {
+			s.cfg.OnResolutionChanged(toWidth, toHeight)
+		}
+	}
+	return nil
+}
+
+// startRepublishedEncoder checks the frame size RepublishVideo set,
+// decodes Config.FallbackImage at it and starts the video encoder on it.
+// encMu must be held.
+func (s *Streamer) startRepublishedEncoder() (cmd *exec.Cmd, stdin, stdout *os.File, err error) {
+	if err := s.checkFrameLayout(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if s.cfg.FallbackImage != "" {
+		if s.fallbackImage, err = s.decodeFallbackImage(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return s.startVideoEncoder(EncoderConfig{Encoder: s.videoEncoder, Settings: s.videoSettings, Crop: s.crop}, true, 0)
+}
@@ -0,0 +1,59 @@
+package streamer
+
+import (
+	"fmt"
+
+	lkinterceptor "github.com/livekit/mediatransportutil/pkg/interceptor"
+	sdkinterceptor "github.com/livekit/server-sdk-go/v2/pkg/interceptor"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/interceptor/pkg/report"
+	"github.com/pion/interceptor/pkg/twcc"
+)
+
+// customInterceptors reports whether the connection needs interceptors
+// other than the SDK's defaults.
+func (c *Config) customInterceptors() bool {
+	return c.OnRTPSent != nil || c.DisableVideoRTX
+}
+
+// interceptors returns the SDK's default interceptors, which
+// lksdk.WithInterceptors replaces as a whole, adjusted for the config: the
+// NACK responder, which answers the SFU's NACKs with retransmissions on
+// the RTX stream, is left out under Config.DisableVideoRTX, and
+// Config.OnRTPSent is hooked in. Only video negotiates NACK, so audio is
+// never retransmitted either way. The SDK's RTT interceptor is left out:
+// it only tunes the NACKs generated for subscribed tracks.
+func (s *Streamer) interceptors() ([]interceptor.Factory, error) {
+	var list []interceptor.Factory
+	list = append(list, &sdkinterceptor.NackGeneratorInterceptorFactory{})
+	if s.cfg.DisableVideoRTX {
+		s.log.warnf("[Video] Retransmission disabled: the video has no FEC, so packet loss on the way to the SFU is repaired only by the next GOP keyframe")
+	} else {
+		responder, err := nack.NewResponderInterceptor()
+		if err != nil {
+			return nil, fmt.Errorf("creating NACK responder: %w", err)
+		}
+		list = append(list, responder)
+	}
+	receiverReports, err := report.NewReceiverInterceptor()
+	if err != nil {
+		return nil, fmt.Errorf("creating RTCP receiver reports: %w", err)
+	}
+	senderReports, err := report.NewSenderInterceptor()
+	if err != nil {
+		return nil, fmt.Errorf("creating RTCP sender reports: %w", err)
+	}
+	twccSender, err := twcc.NewSenderInterceptor()
+	if err != nil {
+		return nil, fmt.Errorf("creating transport-wide congestion control: %w", err)
+	}
+	list = append(list, receiverReports, senderReports, twccSender,
+		sdkinterceptor.NewLimitSizeInterceptorFactory(),
+		// Answer the SFU's XR requests so it can measure the RTT.
+		lkinterceptor.NewRTTFromXRFactory(func(uint32) {}))
+	if s.cfg.OnRTPSent != nil {
+		list = append(list, &rtpSentFactory{onSent: s.cfg.OnRTPSent})
+	}
+	return list, nil
+}
@@ -0,0 +1,90 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// roomCodecsTimeout bounds the room service lookup of the allowed codecs.
+const roomCodecsTimeout = 5 * time.Second
+
+// roomCodecs returns the MIME types the room allows publishing. The SDK
+// keeps the join response to itself, so they are read through the room
+// service, which needs the API key's roomList grant. An empty list means
+// the room does not restrict codecs.
+func (s *Streamer) roomCodecs() ([]string, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, roomCodecsTimeout)
+	defer cancel()
+	client := lksdk.NewRoomServiceClient(s.cfg.URL, s.cfg.APIKey, s.cfg.APISecret)
+	res, err := client.ListRooms(ctx, &livekit.ListRoomsRequest{Names: []string{s.cfg.RoomName}})
+	if err != nil {
+		return nil, err
+	}
+	var mimes []string
+	for _, room := range res.GetRooms() {
+		if room.Name != s.cfg.RoomName {
+			continue
+		}
+		for _, c := range room.GetEnabledCodecs() {
+			mimes = append(mimes, c.GetMime())
+		}
+	}
+	return mimes, nil
+}
+
+func codecAllowed(allowed []string, mime string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(a, mime) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRoomCodecs fails with ErrCodecNotAllowed when the room does not
+// allow the codecs the streamer would publish, rather than letting the
+// publication fail later without saying why.
+//
+// Opus is the only audio codec, so audio cannot adapt. Video adapts only
+// with Config.AdaptCodec: if the room allows VP8 but not H264, the session
+// encodes VP8 with VP8VideoEncoder. There is no second choice to make, as
+// those are the only codecs the streamer can encode. passthrough, for
+// TSInput, whose H264 is published as demuxed, rules adaptation out, as
+// does Config.RequireHardware, since VP8 is always software encoded.
+//
+// If the allowed codecs cannot be read they are assumed unrestricted.
+func (s *Streamer) checkRoomCodecs(passthrough bool) error {
+	allowed, err := s.roomCodecs()
+	if err != nil {
+		s.log.warnf("Could not read the codecs room %s allows, assuming any: %v", s.cfg.RoomName, err)
+		return nil
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	list := strings.Join(allowed, ", ")
+	if !codecAllowed(allowed, webrtc.MimeTypeOpus) && !s.cfg.DisableAudio {
+		return fmt.Errorf("%w: audio is %s, room %s allows %s", ErrCodecNotAllowed, webrtc.MimeTypeOpus, s.cfg.RoomName, list)
+	}
+	codec := s.VideoCodec()
+	if codecAllowed(allowed, codec) || s.cfg.DisableVideo {
+		return nil
+	}
+	if !s.cfg.AdaptCodec || passthrough || s.cfg.RequireHardware || !codecAllowed(allowed, webrtc.MimeTypeVP8) {
+		return fmt.Errorf("%w: video is %s, room %s allows %s", ErrCodecNotAllowed, codec, s.cfg.RoomName, list)
+	}
+	if err := probeVideoEncoder(s.ctx, VP8VideoEncoder); err != nil {
+		return fmt.Errorf("%w: room %s needs %s: %w", ErrEncoderUnavailable, s.cfg.RoomName, webrtc.MimeTypeVP8, err)
+	}
+	s.encMu.Lock()
+	s.videoCodec, s.videoEncoder, s.hardwareEncoding = webrtc.MimeTypeVP8, VP8VideoEncoder, false
+	s.encMu.Unlock()
+	s.log.infof("Room %s allows %s but not %s; publishing %s with %s", s.cfg.RoomName, list, codec, webrtc.MimeTypeVP8, VP8VideoEncoder)
+	return nil
+}
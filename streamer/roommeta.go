@@ -0,0 +1,91 @@
+package streamer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// roomOverrides are the session settings Config.RoomMetadataOverrides
+// reads from the room metadata. Each field replaces the Config field of
+// the same meaning.
+type roomOverrides struct {
+	Profile          *string `json:"profile"`            // Config.Profile
+	VideoBitrateKbps *int    `json:"video_bitrate_kbps"` // Config.VideoEncoder.BitrateKbps
+	GOP              *int    `json:"gop"`                // Config.VideoEncoder.GOP
+	AudioBitrateKbps *int    `json:"audio_bitrate_kbps"` // Config.AudioBitrateKbps
+	Width            *uint32 `json:"width"`              // Config.Width
+	Height           *uint32 `json:"height"`             // Config.Height
+}
+
+// roomOverrideFields are the metadata keys roomOverrides recognises.
+var roomOverrideFields = map[string]bool{
+	"profile": true, "video_bitrate_kbps": true, "gop": true,
+	"audio_bitrate_kbps": true, "width": true, "height": true,
+}
+
+// applyRoomMetadata merges the settings in the room metadata, a JSON
+// object, into the config and validates the result. Metadata that is empty
+// or not a JSON object is left alone, as the room may use it for something
+// else, and so are keys the streamer does not recognise. A recognised key
+// with an invalid value fails the session, since the orchestrator asked
+// for a setting that cannot be honoured.
+func (s *Streamer) applyRoomMetadata() error {
+	metadata := strings.TrimSpace(s.room.Metadata())
+	if metadata == "" {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(metadata), &fields); err != nil {
+		s.log.warnf("Room metadata is not a JSON object, ignoring it: %v", err)
+		return nil
+	}
+	for key := range fields {
+		if !roomOverrideFields[key] {
+			s.log.warnf("Ignoring unknown room metadata field %q", key)
+		}
+	}
+	var o roomOverrides
+	if err := json.Unmarshal([]byte(metadata), &o); err != nil {
+		return fmt.Errorf("%w: room metadata: %w", ErrInvalidConfig, err)
+	}
+
+	var applied []string
+	if o.Profile != nil {
+		s.cfg.Profile = *o.Profile
+		applied = append(applied, "profile="+*o.Profile)
+	}
+	if o.VideoBitrateKbps != nil {
+		s.cfg.VideoEncoder.BitrateKbps = *o.VideoBitrateKbps
+		applied = append(applied, fmt.Sprintf("video_bitrate_kbps=%d", *o.VideoBitrateKbps))
+	}
+	if o.GOP != nil {
+		s.cfg.VideoEncoder.GOP = *o.GOP
+		applied = append(applied, fmt.Sprintf("gop=%d", *o.GOP))
+	}
+	if o.AudioBitrateKbps != nil {
+		s.cfg.AudioBitrateKbps = *o.AudioBitrateKbps
+		applied = append(applied, fmt.Sprintf("audio_bitrate_kbps=%d", *o.AudioBitrateKbps))
+	}
+	if o.Width != nil || o.Height != nil {
+		if !s.cfg.DimensionsFromConfig {
+			s.log.warnf("Ignoring room metadata width and height: the producer's header sets the dimensions")
+		} else {
+			if o.Width != nil {
+				s.cfg.Width = *o.Width
+			}
+			if o.Height != nil {
+				s.cfg.Height = *o.Height
+			}
+			applied = append(applied, fmt.Sprintf("dimensions=%dx%d", s.cfg.Width, s.cfg.Height))
+		}
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	if err := s.validate(); err != nil {
+		return fmt.Errorf("%w: room metadata: %w", ErrInvalidConfig, err)
+	}
+	s.log.infof("Applied room metadata settings: %s", strings.Join(applied, ", "))
+	return nil
+}
@@ -0,0 +1,123 @@
+package streamer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// WebRTCStats is a getStats() dump of both peer connections to the SFU.
+type WebRTCStats struct {
+	CapturedAt time.Time          `json:"captured_at"`
+	Identity   string             `json:"identity"`
+	RoomName   string             `json:"room_name"`
+	Publisher  webrtc.StatsReport `json:"publisher,omitempty"`
+	Subscriber webrtc.StatsReport `json:"subscriber,omitempty"`
+	// Codecs are the NegotiatedCodecs of the published tracks.
+	Codecs map[string]webrtc.RTPCodecParameters `json:"codecs,omitempty"`
+}
+
+// WebRTCStats collects the current WebRTC stats, including ICE candidate
+// pairs and transports, of the publisher and subscriber connections.
+func (s *Streamer) WebRTCStats() (WebRTCStats, error) {
+	if s.room == nil {
+		return WebRTCStats{}, fmt.Errorf("%w: not connected to a room", ErrNotRunning)
+	}
+	st := WebRTCStats{
+		CapturedAt: time.Now(),
+		Identity:   s.cfg.Identity,
+		RoomName:   s.cfg.RoomName,
+	}
+	lp := s.room.LocalParticipant
+	if pc := lp.GetPublisherPeerConnection(); pc != nil {
+		st.Publisher = pc.GetStats()
+	}
+	if pc := lp.GetSubscriberPeerConnection(); pc != nil {
+		st.Subscriber = pc.GetStats()
+	}
+	st.Codecs, _ = s.NegotiatedCodecs()
+	return st, nil
+}
+
+// DumpWebRTCStats writes WebRTCStats to w as indented JSON.
+func (s *Streamer) DumpWebRTCStats(w io.Writer) error {
+	st, err := s.WebRTCStats()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
+
+// NegotiatedCodecs returns the RTP codec negotiated with the SFU for each
+// published track, keyed by publication name ("video", "audio"). For H264
+// the SDPFmtpLine carries the profile-level-id and packetization-mode in
+// effect. Tracks still being negotiated are left out.
+func (s *Streamer) NegotiatedCodecs() (map[string]webrtc.RTPCodecParameters, error) {
+	if s.room == nil {
+		return nil, fmt.Errorf("%w: not connected to a room", ErrNotRunning)
+	}
+	pc := s.room.LocalParticipant.GetPublisherPeerConnection()
+	if pc == nil {
+		return nil, fmt.Errorf("%w: no publisher connection", ErrNotRunning)
+	}
+	codecs := make(map[string]webrtc.RTPCodecParameters)
+	for _, t := range []struct {
+		name  string
+		track *lksdk.LocalTrack
+	}{{"video", s.videoTrack}, {"audio", s.audioTrack}} {
+		if t.track == nil {
+			continue
+		}
+		if codec, ok := negotiatedCodec(pc, t.track); ok {
+			codecs[t.name] = codec
+		}
+	}
+	return codecs, nil
+}
+
+// negotiatedCodec finds track's sender on pc and returns the first of its
+// negotiated codecs with the track's MIME type, which is the one the track
+// binds to.
+func negotiatedCodec(pc *webrtc.PeerConnection, track *lksdk.LocalTrack) (webrtc.RTPCodecParameters, bool) {
+	mime := track.Codec().MimeType
+	for _, tr := range pc.GetTransceivers() {
+		sender := tr.Sender()
+		if sender == nil || sender.Track() != webrtc.TrackLocal(track) {
+			continue
+		}
+		for _, codec := range sender.GetParameters().Codecs {
+			if strings.EqualFold(codec.MimeType, mime) {
+				return codec, true
+			}
+		}
+	}
+	return webrtc.RTPCodecParameters{}, false
+}
+
+// logNegotiatedCodec logs the codec track was bound with. It runs off the
+// bind callback, which the SDK calls while negotiation is in progress.
+func (s *Streamer) logNegotiatedCodec(name string, track *lksdk.LocalTrack) {
+	go func() {
+		if s.room == nil {
+			return
+		}
+		pc := s.room.LocalParticipant.GetPublisherPeerConnection()
+		if pc == nil {
+			return
+		}
+		codec, ok := negotiatedCodec(pc, track)
+		if !ok {
+			s.log.warnf("[%s] Track bound but no negotiated codec found", name)
+			return
+		}
+		s.log.infof("[%s] Negotiated codec %s pt=%d clock=%d fmtp=%q",
+			name, codec.MimeType, codec.PayloadType, codec.ClockRate, codec.SDPFmtpLine)
+	}()
+}
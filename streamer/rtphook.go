@@ -0,0 +1,56 @@
+package streamer
+
+import (
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// SentRTPPacket describes one outbound RTP packet as it was handed to the
+// transport.
+type SentRTPPacket struct {
+	SSRC           uint32
+	PayloadType    uint8
+	MimeType       string
+	SequenceNumber uint16
+	Timestamp      uint32
+	Marker         bool
+	PayloadSize    int
+	SentAt         time.Time
+}
+
+// rtpSentFactory installs rtpSentInterceptor on the publisher connection.
+type rtpSentFactory struct {
+	onSent func(SentRTPPacket)
+}
+
+func (f *rtpSentFactory) NewInterceptor(id string) (interceptor.Interceptor, error) {
+	return &rtpSentInterceptor{onSent: f.onSent}, nil
+}
+
+// rtpSentInterceptor reports every RTP packet written on a local stream.
+type rtpSentInterceptor struct {
+	interceptor.NoOp
+	onSent func(SentRTPPacket)
+}
+
+func (i *rtpSentInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	mime := info.MimeType
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		n, err := writer.Write(header, payload, attributes)
+		if err == nil {
+			i.onSent(SentRTPPacket{
+				SSRC:           header.SSRC,
+				PayloadType:    header.PayloadType,
+				MimeType:       mime,
+				SequenceNumber: header.SequenceNumber,
+				Timestamp:      header.Timestamp,
+				Marker:         header.Marker,
+				PayloadSize:    len(payload),
+				SentAt:         time.Now(),
+			})
+		}
+		return n, err
+	})
+}
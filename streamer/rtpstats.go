@@ -0,0 +1,148 @@
+package streamer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// rtpStatsInterval is how often the publisher connection's RTP stats are
+// sampled.
+const rtpStatsInterval = 2 * time.Second
+
+// RTPSendStats is what went out over the wire on one published track, as
+// the publisher connection counts it, and what the SFU reported losing of
+// it in RTCP receiver reports. Unlike the frame timing, which shows how
+// the encoder keeps pace, it shows whether the network drops what is sent.
+// The totals are since the connection was made, the window counts over
+// the last Config.BitrateWindow.
+type RTPSendStats struct {
+	PacketsSent uint64 `json:"packets_sent"`
+	BytesSent   uint64 `json:"bytes_sent"`
+	NACKs       uint64 `json:"nacks"`
+	PacketsLost int64  `json:"packets_lost"`
+
+	WindowPacketsSent uint64 `json:"window_packets_sent"`
+	WindowNACKs       uint64 `json:"window_nacks"`
+	WindowPacketsLost int64  `json:"window_packets_lost"`
+	// LossPercent is WindowPacketsLost out of WindowPacketsSent.
+	LossPercent float64 `json:"loss_percent"`
+}
+
+// rtpCounters are the cumulative counts of one track at one sample.
+type rtpCounters struct {
+	at      time.Time
+	packets uint64
+	bytes   uint64
+	nacks   uint64
+	lost    int64
+}
+
+// rtpStatsWindow keeps the samples of each track, by kind, over a sliding
+// window, for RTPStats to read from any goroutine.
+type rtpStatsWindow struct {
+	mu      sync.Mutex
+	samples map[string][]rtpCounters // oldest first
+}
+
+// add records counts sampled at now and drops samples that fell out of
+// window, keeping the newest one beyond it as the window's start. Counts
+// that went down belong to a new connection, after a rejoin, whose samples
+// start afresh.
+func (w *rtpStatsWindow) add(now time.Time, window time.Duration, counts map[string]rtpCounters) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.samples == nil {
+		w.samples = make(map[string][]rtpCounters)
+	}
+	for kind, c := range counts {
+		c.at = now
+		samples := w.samples[kind]
+		if n := len(samples); n > 0 && (c.packets < samples[n-1].packets || c.nacks < samples[n-1].nacks) {
+			samples = nil
+		}
+		samples = append(samples, c)
+		i := 0
+		for i+1 < len(samples) && now.Sub(samples[i+1].at) >= window {
+			i++
+		}
+		w.samples[kind] = samples[i:]
+	}
+}
+
+// stats returns the latest totals and the window counts of each track.
+func (w *rtpStatsWindow) stats() map[string]RTPSendStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make(map[string]RTPSendStats, len(w.samples))
+	for kind, samples := range w.samples {
+		first, last := samples[0], samples[len(samples)-1]
+		st := RTPSendStats{
+			PacketsSent:       last.packets,
+			BytesSent:         last.bytes,
+			NACKs:             last.nacks,
+			PacketsLost:       last.lost,
+			WindowPacketsSent: last.packets - first.packets,
+			WindowNACKs:       last.nacks - first.nacks,
+			WindowPacketsLost: last.lost - first.lost,
+		}
+		if st.WindowPacketsSent > 0 {
+			st.LossPercent = 100 * float64(st.WindowPacketsLost) / float64(st.WindowPacketsSent)
+		}
+		out[kind] = st
+	}
+	return out
+}
+
+// rtpCounts sums the outbound and remote-inbound RTP stats of report by
+// kind, "video" or "audio", over the SSRCs of each.
+func rtpCounts(report webrtc.StatsReport) map[string]rtpCounters {
+	counts := make(map[string]rtpCounters)
+	for _, st := range report {
+		switch st := st.(type) {
+		case webrtc.OutboundRTPStreamStats:
+			c := counts[st.Kind]
+			c.packets += uint64(st.PacketsSent)
+			c.bytes += st.BytesSent
+			c.nacks += uint64(st.NACKCount)
+			counts[st.Kind] = c
+		case webrtc.RemoteInboundRTPStreamStats:
+			c := counts[st.Kind]
+			c.lost += int64(st.PacketsLost)
+			counts[st.Kind] = c
+		}
+	}
+	return counts
+}
+
+// sampleRTPStats samples the publisher connection's RTP stats every
+// rtpStatsInterval until shutdown. Nothing is sampled while there is no
+// connection, parked or before joining.
+func (s *Streamer) sampleRTPStats() {
+	ticker := time.NewTicker(rtpStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			room := s.room
+			if room == nil {
+				continue
+			}
+			pc := room.LocalParticipant.GetPublisherPeerConnection()
+			if pc == nil {
+				continue
+			}
+			s.rtpStats.add(now, s.cfg.BitrateWindow, rtpCounts(pc.GetStats()))
+		}
+	}
+}
+
+// RTPStats returns the RTP send stats of each published track, keyed
+// "video" and "audio", as last sampled. It is safe to call from any
+// goroutine.
+func (s *Streamer) RTPStats() map[string]RTPSendStats {
+	return s.rtpStats.stats()
+}
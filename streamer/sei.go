@@ -0,0 +1,119 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// With Config.TimecodeSEI set, every H264 picture is preceded by a
+// user_data_unregistered SEI message (payload type 5) carrying a
+// timecode. The NAL unit is, before emulation-prevention bytes are added:
+//
+//	nal header  0x06
+//	type        0x05
+//	size        0x20 (32)
+//	uuid        [16]byte TimecodeSEIUUID
+//	seq         uint64   big-endian, increments by one per picture from 0
+//	timestamp   int64    big-endian, wall-clock Unix time in nanoseconds
+//	                     when the picture was handed to the track
+//	trailing    0x80
+//
+// Receivers should match on the UUID and ignore other SEI messages, and
+// can use ParseTimecodeSEI on a NAL unit without its start code.
+var TimecodeSEIUUID = [16]byte{
+	0x62, 0x4f, 0xb2, 0xdb, 0x7b, 0xdb, 0x44, 0x16,
+	0xba, 0x69, 0xcf, 0x5d, 0x1a, 0x92, 0x8f, 0x34,
+}
+
+const (
+	naluTypeSEI               = 6
+	seiUserDataUnregistered   = 5
+	timecodeSEIPayloadSize    = 32
+	timecodeSEIUnescapedBytes = 3 + timecodeSEIPayloadSize + 1
+)
+
+// TimecodeSEI is the timecode carried before one picture.
+type TimecodeSEI struct {
+	Seq  uint64
+	Time time.Time
+}
+
+// Marshal encodes t as an SEI NAL unit, without a start code.
+func (t TimecodeSEI) Marshal() []byte {
+	b := make([]byte, timecodeSEIUnescapedBytes)
+	b[0], b[1], b[2] = naluTypeSEI, seiUserDataUnregistered, timecodeSEIPayloadSize
+	copy(b[3:], TimecodeSEIUUID[:])
+	binary.BigEndian.PutUint64(b[19:], t.Seq)
+	binary.BigEndian.PutUint64(b[27:], uint64(t.Time.UnixNano()))
+	b[35] = 0x80
+	return append(b[:1:1], escapeRBSP(b[1:])...)
+}
+
+// ParseTimecodeSEI decodes nal, a NAL unit without its start code, and
+// reports false unless it is a timecode SEI.
+func ParseTimecodeSEI(nal []byte) (TimecodeSEI, bool) {
+	if len(nal) == 0 || nal[0]&0x1f != naluTypeSEI {
+		return TimecodeSEI{}, false
+	}
+	b := unescapeRBSP(nal[1:])
+	if len(b) < timecodeSEIUnescapedBytes-1 || b[0] != seiUserDataUnregistered ||
+		b[1] != timecodeSEIPayloadSize || !bytes.Equal(b[2:18], TimecodeSEIUUID[:]) {
+		return TimecodeSEI{}, false
+	}
+	return TimecodeSEI{
+		Seq:  binary.BigEndian.Uint64(b[18:]),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(b[26:]))),
+	}, true
+}
+
+// escapeRBSP inserts an emulation-prevention byte wherever two zero bytes
+// are followed by a byte of 3 or less, so the payload cannot mimic a start
+// code.
+func escapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b)+len(b)/2)
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// unescapeRBSP removes the bytes escapeRBSP inserts.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// timecodeSource numbers the pictures it is asked for, starting at 0.
+type timecodeSource struct {
+	seq uint64
+}
+
+func (t *timecodeSource) next() []byte {
+	sei := TimecodeSEI{Seq: t.seq, Time: time.Now()}
+	t.seq++
+	return sei.Marshal()
+}
@@ -0,0 +1,61 @@
+package streamer
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// testSession is a Streamer publishing to a NullSink on the fake ffmpeg,
+// with its log kept.
+type testSession struct {
+	*Streamer
+	sink *NullSink
+	log  *syncBuffer
+}
+
+// startTestSession starts a session of cfg on a NullSink, with video from
+// a test pattern of pattern unless cfg has a VideoInput, and audio
+// disabled unless cfg has an AudioInput. It is stopped when t ends.
+func startTestSession(t *testing.T, cfg Config, pattern TestPatternConfig) *testSession {
+	t.Helper()
+	ts := &testSession{sink: &NullSink{}, log: &syncBuffer{}}
+	cfg.Sink = ts.sink
+	cfg.Logger = slog.New(slog.NewTextHandler(ts.log, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if cfg.H264Encoder == "" {
+		cfg.H264Encoder = SoftwareVideoEncoder
+	}
+	if cfg.VideoInput == nil && !cfg.DisableVideo {
+		r, err := NewTestPattern(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.VideoInput = r
+	}
+	if cfg.AudioInput == nil {
+		cfg.DisableAudio = true
+	}
+	ts.Streamer = New(cfg)
+	if err := ts.Start(t.Context()); err != nil {
+		t.Fatalf("Start: %v\n%s", err, ts.log)
+	}
+	t.Cleanup(ts.Stop)
+	return ts
+}
+
+// waitFrames waits for the sink to have n frames of track.
+func (ts *testSession) waitFrames(t *testing.T, track string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for ts.sink.Counts(track).Frames < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d %s frames after 10s\n%s", ts.sink.Counts(track).Frames, n, track, ts.log)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSessionNullSink(t *testing.T) {
+	ts := startTestSession(t, Config{}, TestPatternConfig{Width: 64, Height: 48, FrameRate: 50})
+	ts.waitFrames(t, VideoTrackName, 10)
+}
@@ -0,0 +1,67 @@
+package streamer
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds Stop when Config.ShutdownTimeout is zero.
+// It leaves room for the encoders' own SIGTERM grace period, the room
+// disconnect and the stats webhook.
+const DefaultShutdownTimeout = 15 * time.Second
+
+// DefaultEncoderStopTimeout is how long an encoder gets to flush and exit
+// after SIGTERM when Config.EncoderStopTimeout is zero.
+const DefaultEncoderStopTimeout = 3 * time.Second
+
+// shutdownPhase records which part of the teardown is running, so a stuck
+// one can be named when the watchdog fires.
+type shutdownPhase struct {
+	mu    sync.Mutex
+	phase string
+}
+
+func (p *shutdownPhase) set(phase string) {
+	p.mu.Lock()
+	p.phase = phase
+	p.mu.Unlock()
+}
+
+func (p *shutdownPhase) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.phase
+}
+
+// shutdownTimedOut runs when Stop has taken longer than
+// Config.ShutdownTimeout. It kills any encoder still running and, with
+// Config.ExitOnShutdownTimeout, exits the process.
+func (s *Streamer) shutdownTimedOut() {
+	s.log.errorf("Shutdown did not finish within %v, stuck %s; killing encoders",
+		s.cfg.ShutdownTimeout, s.teardown.get())
+
+	s.audioMu.Lock()
+	cmds := []*exec.Cmd{s.audioCmd}
+	s.audioMu.Unlock()
+	// Whatever is stuck may hold encMu, so do not wait for it.
+	if s.encMu.TryLock() {
+		cmds = append(cmds, s.videoCmd)
+		s.encMu.Unlock()
+	}
+	s.retired.Range(func(cmd, _ any) bool {
+		cmds = append(cmds, cmd.(*exec.Cmd))
+		return true
+	})
+	for _, cmd := range cmds {
+		if cmd != nil && cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+	}
+
+	if s.cfg.ExitOnShutdownTimeout {
+		s.log.errorf("Exiting without completing shutdown")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,229 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Per-frame sidecar headers let a producer attach a sequence number and
+// capture timestamp to each raw video frame. With Config.FrameHeaders set,
+// every frame on the video input, after the width/height header, is
+// preceded by a FrameHeaderSize-byte header, all fields little-endian:
+//
+//	magic     [4]byte  "RFRM"
+//	version   uint16   FrameHeaderVersion
+//	reserved  uint16   zero
+//	seq       uint64   increments by one per frame
+//	timestamp int64    capture time in nanoseconds, any fixed epoch
+//	length    uint32   size of the frame that follows
+//
+// The capture timestamps set the spacing of the published video samples.
+const (
+	FrameHeaderMagic   = "RFRM"
+	FrameHeaderVersion = 1
+	FrameHeaderSize    = 28
+)
+
+// FrameHeader is the sidecar header preceding one raw frame.
+type FrameHeader struct {
+	Seq       uint64
+	Timestamp time.Duration
+	Length    uint32
+}
+
+// Marshal encodes h in the FrameHeaderVersion wire format.
+func (h FrameHeader) Marshal() []byte {
+	b := make([]byte, FrameHeaderSize)
+	copy(b, FrameHeaderMagic)
+	binary.LittleEndian.PutUint16(b[4:], FrameHeaderVersion)
+	binary.LittleEndian.PutUint64(b[8:], h.Seq)
+	binary.LittleEndian.PutUint64(b[16:], uint64(h.Timestamp))
+	binary.LittleEndian.PutUint32(b[24:], h.Length)
+	return b
+}
+
+// ParseFrameHeader decodes a header, rejecting unknown magic or versions.
+func ParseFrameHeader(b []byte) (FrameHeader, error) {
+	if len(b) < FrameHeaderSize {
+		return FrameHeader{}, fmt.Errorf("frame header is %d bytes, want %d", len(b), FrameHeaderSize)
+	}
+	if string(b[:4]) != FrameHeaderMagic {
+		return FrameHeader{}, fmt.Errorf("bad frame header magic %q", b[:4])
+	}
+	if v := binary.LittleEndian.Uint16(b[4:]); v != FrameHeaderVersion {
+		return FrameHeader{}, fmt.Errorf("unsupported frame header version %d", v)
+	}
+	return FrameHeader{
+		Seq:       binary.LittleEndian.Uint64(b[8:]),
+		Timestamp: time.Duration(binary.LittleEndian.Uint64(b[16:])),
+		Length:    binary.LittleEndian.Uint32(b[24:]),
+	}, nil
+}
+
+// captureQueueDepth is how many capture timestamps may wait for their
+// frame to come out of the encoder.
+const captureQueueDepth = 256
+
+// frameHeaderReader strips sidecar headers from the raw video stream and
+// queues each frame's capture timestamp for the video stamper. Frames go
+// through the encoder in order, so the n-th encoded frame takes the n-th
+// timestamp.
+type frameHeaderReader struct {
+	r         io.Reader
+	frameSize int
+	captured  chan time.Duration
+
+	remaining int
+	seq       uint64
+	started   bool
+	log       logger
+
+	// onAnomaly, if set, is called when a frame's sequence number is not
+	// one past prev, the highest seen so far: seq > prev+1 after missing
+	// frames, seq == prev for a duplicate and seq < prev for a late frame.
+	onAnomaly func(prev, seq uint64)
+}
+
+func newFrameHeaderReader(r io.Reader, frameSize int, log logger) *frameHeaderReader {
+	return &frameHeaderReader{
+		r:         r,
+		frameSize: frameSize,
+		captured:  make(chan time.Duration, captureQueueDepth),
+		log:       log,
+	}
+}
+
+func (h *frameHeaderReader) Read(p []byte) (int, error) {
+	if h.remaining == 0 {
+		if err := h.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > h.remaining {
+		p = p[:h.remaining]
+	}
+	n, err := h.r.Read(p)
+	h.remaining -= n
+	return n, err
+}
+
+func (h *frameHeaderReader) readHeader() error {
+	var b [FrameHeaderSize]byte
+	if _, err := io.ReadFull(h.r, b[:]); err != nil {
+		return err
+	}
+	hdr, err := ParseFrameHeader(b[:])
+	if err != nil {
+		h.log.errorf("[Video] %v", err)
+		return err
+	}
+	if int(hdr.Length) != h.frameSize {
+		err := fmt.Errorf("frame %d is %d bytes, want %d", hdr.Seq, hdr.Length, h.frameSize)
+		h.log.errorf("[Video] %v", err)
+		return err
+	}
+	if h.started && hdr.Seq != h.seq+1 {
+		h.log.warnf("[Video] Frame sequence jumped from %d to %d", h.seq, hdr.Seq)
+		if h.onAnomaly != nil {
+			h.onAnomaly(h.seq, hdr.Seq)
+		}
+	}
+	if !h.started || hdr.Seq > h.seq {
+		h.seq, h.started = hdr.Seq, true
+	}
+	h.remaining = int(hdr.Length)
+
+	select {
+	case h.captured <- hdr.Timestamp:
+	default:
+		h.log.warnf("[Video] Capture timestamp queue full, dropping timestamp of frame %d", hdr.Seq)
+	}
+	return nil
+}
+
+// DefaultInputAnomalyThreshold is how many sequence anomalies a minute of
+// input may show before a warning is logged, when
+// Config.InputAnomalyThreshold is zero.
+const DefaultInputAnomalyThreshold = 10
+
+// inputAnomalyWindow is the period Config.InputAnomalyThreshold counts over.
+const inputAnomalyWindow = time.Minute
+
+// inputSeqStats counts the anomalies in the sidecar sequence numbers of
+// the video input. The counters are only written by the video input.
+type inputSeqStats struct {
+	missing, duplicate, outOfOrder atomic.Int64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	inWindow    int64
+	gated       int64 // gate drops already accounted for
+}
+
+// reset clears the counters and the anomaly window.
+func (st *inputSeqStats) reset() {
+	st.missing.Store(0)
+	st.duplicate.Store(0)
+	st.outOfOrder.Store(0)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.windowStart, st.inWindow, st.gated = time.Time{}, 0, 0
+}
+
+// inputSeqAnomaly classifies a frame whose sequence number seq does not
+// follow prev, the highest seen so far. Frames the gates dropped while
+// reconnecting or paused also show up as a gap; only the rest were lost by
+// the producer.
+func (s *Streamer) inputSeqAnomaly(prev, seq uint64) {
+	st := &s.inputSeq
+	var n int64
+	switch {
+	case seq > prev:
+		dropped := s.videoDrops.load(DropReconnect) + s.videoDrops.load(DropPaused)
+		n = int64(seq-prev-1) - (dropped - st.gated)
+		st.gated = dropped
+		if n <= 0 {
+			return
+		}
+		st.missing.Add(n)
+		s.videoDrops.add(DropBackpressure, n)
+		s.reportError(fmt.Errorf("producer dropped %d video frame(s) between %d and %d", n, prev, seq), false)
+	case seq == prev:
+		n = 1
+		st.duplicate.Add(1)
+	default:
+		// A late frame fills a gap counted as missing.
+		n = 1
+		st.outOfOrder.Add(1)
+		if st.missing.Add(-1) < 0 {
+			st.missing.Add(1)
+		} else {
+			s.videoDrops.add(DropBackpressure, -1)
+		}
+	}
+
+	threshold := int64(s.cfg.InputAnomalyThreshold)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	if now.Sub(st.windowStart) >= inputAnomalyWindow {
+		st.windowStart, st.inWindow = now, 0
+	}
+	before := st.inWindow
+	st.inWindow += n
+	if before <= threshold && st.inWindow > threshold {
+		s.log.warnf("[Video] %d input sequence anomalies in the last %v (%d missing, %d duplicate, %d out of order in total); the producer is not delivering frames in order",
+			st.inWindow, inputAnomalyWindow, st.missing.Load(), st.duplicate.Load(), st.outOfOrder.Load())
+	}
+}
+
+// fillInputSeq adds the input sequence anomaly counters to st.
+func (s *Streamer) fillInputSeq(st *Stats) {
+	st.InputFramesMissing = s.inputSeq.missing.Load()
+	st.InputFramesDuplicate = s.inputSeq.duplicate.Load()
+	st.InputFramesOutOfOrder = s.inputSeq.outOfOrder.Load()
+}
@@ -0,0 +1,153 @@
+package streamer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// Sink receives the encoded samples of the tracks in place of a room, for
+// Config.Sink: H264 or VP8 video and Opus audio, as they would be handed to
+// the published tracks.
+type Sink interface {
+	// WriteSample is given every sample of the track named track,
+	// VideoTrackName or AudioTrackName, in order, from one goroutine per
+	// track. An error ends the session as a failed track does.
+	WriteSample(track string, sample media.Sample) error
+	// Close is called once Stop has stopped the writers.
+	Close() error
+}
+
+// SinkCounts is what a NullSink or RecordingSink has received on one track.
+type SinkCounts struct {
+	Samples int
+	// Frames counts the samples that advance the track clock: pictures
+	// and Opus pages, not parameter sets or SEI.
+	Frames int
+	Bytes  int64
+}
+
+// NullSink is a Sink that counts what it is given and drops it. The zero
+// value is ready to use.
+type NullSink struct {
+	mu     sync.Mutex
+	counts map[string]SinkCounts
+}
+
+func (n *NullSink) WriteSample(track string, sample media.Sample) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.counts == nil {
+		n.counts = make(map[string]SinkCounts)
+	}
+	c := n.counts[track]
+	c.Samples++
+	if sample.Duration > 0 {
+		c.Frames++
+	}
+	c.Bytes += int64(len(sample.Data))
+	n.counts[track] = c
+	return nil
+}
+
+// Counts returns what track has received so far. It is safe to call from
+// any goroutine.
+func (n *NullSink) Counts(track string) SinkCounts {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.counts[track]
+}
+
+func (n *NullSink) Close() error {
+	return nil
+}
+
+// RecordingSink is a NullSink that also writes each track to a file in a
+// directory, named after the track with a .samples extension: every sample
+// as its length, a little-endian uint32, followed by its data.
+type RecordingSink struct {
+	NullSink
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewRecordingSink returns a RecordingSink writing to dir, which must
+// exist. The files are created with a track's first sample.
+func NewRecordingSink(dir string) *RecordingSink {
+	return &RecordingSink{dir: dir, files: make(map[string]*os.File)}
+}
+
+func (r *RecordingSink) WriteSample(track string, sample media.Sample) error {
+	r.mu.Lock()
+	f, ok := r.files[track]
+	if !ok {
+		var err error
+		if f, err = os.Create(filepath.Join(r.dir, track+".samples")); err != nil {
+			r.mu.Unlock()
+			return fmt.Errorf("creating %s recording: %w", track, err)
+		}
+		r.files[track] = f
+	}
+	r.mu.Unlock()
+	b := binary.LittleEndian.AppendUint32(make([]byte, 0, 4+len(sample.Data)), uint32(len(sample.Data)))
+	if _, err := f.Write(append(b, sample.Data...)); err != nil {
+		return fmt.Errorf("recording %s: %w", track, err)
+	}
+	return r.NullSink.WriteSample(track, sample)
+}
+
+// Path returns the file track is recorded to.
+func (r *RecordingSink) Path(track string) string {
+	return filepath.Join(r.dir, track+".samples")
+}
+
+// Close closes the files.
+func (r *RecordingSink) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var first error
+	for _, f := range r.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// publishToSink starts handing the samples of provider, the track named
+// name, to Config.Sink, standing in for the SDK's track writer once the
+// track is bound. Samples are handed over as soon as the encoder produces
+// them, without the writer's pacing, which the producer provides anyway.
+// running is set while the writer runs.
+func (s *Streamer) publishToSink(name string, provider *encodedSampleProvider, running *atomic.Bool) {
+	running.Store(true)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer running.Store(false)
+		defer provider.Close()
+		if provider.hooks.onBind != nil {
+			provider.hooks.onBind()
+		}
+		for {
+			sample, err := provider.NextSample(s.ctx)
+			if err != nil {
+				// The stream ends at shutdown, or with the encoder,
+				// whose exit is reported on its own.
+				return
+			}
+			if err := s.cfg.Sink.WriteSample(name, sample); err != nil {
+				s.trackError(fmt.Errorf("%w: %s: %w", ErrPublishFailed, name, err))
+				return
+			}
+		}
+	}()
+	s.emit(EventPublished, map[string]any{"track": name, "sink": fmt.Sprintf("%T", s.cfg.Sink)})
+}
@@ -0,0 +1,57 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+func TestRecordingSink(t *testing.T) {
+	r := NewRecordingSink(t.TempDir())
+	samples := []media.Sample{
+		{Data: []byte{0x67, 0x42}},
+		{Data: []byte{0x65, 0x88, 0x84}, Duration: 40 * time.Millisecond},
+		{Data: []byte{0x41, 0x9a}, Duration: 40 * time.Millisecond},
+	}
+	for _, s := range samples {
+		if err := r.WriteSample(VideoTrackName, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.WriteSample(AudioTrackName, media.Sample{Data: []byte("OggS"), Duration: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parameter sets are samples but not frames.
+	if got, want := r.Counts(VideoTrackName), (SinkCounts{Samples: 3, Frames: 2, Bytes: 7}); got != want {
+		t.Errorf("video counts %+v, want %+v", got, want)
+	}
+	if got, want := r.Counts(AudioTrackName), (SinkCounts{Samples: 1, Frames: 1, Bytes: 4}); got != want {
+		t.Errorf("audio counts %+v, want %+v", got, want)
+	}
+
+	data, err := os.ReadFile(r.Path(VideoTrackName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range samples {
+		if len(data) < 4 {
+			t.Fatalf("recording ends before sample %d", i)
+		}
+		n := binary.LittleEndian.Uint32(data)
+		if data = data[4:]; int(n) > len(data) || !bytes.Equal(data[:n], s.Data) {
+			t.Fatalf("sample %d recorded as % x, want % x", i, data[:min(int(n), len(data))], s.Data)
+		}
+		data = data[n:]
+	}
+	if len(data) != 0 {
+		t.Errorf("%d bytes after the last sample", len(data))
+	}
+}
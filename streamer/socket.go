@@ -0,0 +1,348 @@
+package streamer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message types on the input socket. Every message is a one-byte type, a
+// little-endian uint32 payload length and the payload. Video and audio
+// payloads carry the same bytes the producer would write to the FIFOs,
+// including the width/height header at the start of the video stream;
+// they need not align with frame boundaries. Control payloads are opaque
+// to the streamer and are handed to Config.OnSocketControl, and the
+// streamer may send control messages back with SendControl.
+const (
+	SocketMessageVideo   byte = 'V'
+	SocketMessageAudio   byte = 'A'
+	SocketMessageControl byte = 'C'
+)
+
+// maxSocketMessage bounds a single payload so a corrupt length cannot make
+// the streamer allocate without limit.
+const maxSocketMessage = 16 << 20
+
+// socketQueueDepth is how many video or audio messages may wait for their
+// encoder. The two streams share one connection, so one stream must be
+// able to run ahead while the other's consumer is not yet reading, as
+// before the encoders have started.
+const socketQueueDepth = 256
+
+// socketInput accepts a single producer at a time on a Unix domain or TCP
+// socket and splits its stream into video, audio and control messages.
+type socketInput struct {
+	addr     string
+	listener net.Listener
+	video    socketStream
+	audio    socketStream
+	log      logger
+
+	writeMu sync.Mutex
+	conn    net.Conn
+
+	// alignMu guards the streams' alignment state, which the demuxer and
+	// align share.
+	alignMu sync.Mutex
+	header  []byte
+}
+
+// socketStream carries one medium into its chunkReader. Once aligned to a
+// unit, whole frames or samples, it only passes on whole units, holding
+// back the rest until they complete, so a connection that drops part way
+// through one does not leave the stream misaligned for the next.
+type socketStream struct {
+	out  *chunkReader
+	unit int
+	// pushed counts the bytes passed on in this connection, offset of
+	// them the header ahead of the first unit.
+	pushed, offset int
+	held           []byte
+	// expect is what is left of the header a reconnected producer must
+	// repeat, which is checked and dropped.
+	expect []byte
+}
+
+// listenSocket listens on addr, a host:port or unix:/path as for
+// listenAddr.
+func listenSocket(addr string, log logger) (*socketInput, error) {
+	l, err := listenAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &socketInput{
+		addr:     addr,
+		listener: l,
+		video:    socketStream{out: newChunkReader(socketQueueDepth)},
+		audio:    socketStream{out: newChunkReader(socketQueueDepth)},
+		log:      log,
+	}, nil
+}
+
+// accept waits for the producer to connect. timeout bounds the wait; zero
+// waits until ctx is done.
+func (in *socketInput) accept(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// Closing the listener is the only way to interrupt Accept, so a
+	// deadline is used where the listener supports one, leaving it open
+	// for the next connection.
+	dl, ok := in.listener.(interface{ SetDeadline(time.Time) error })
+	var stop func() bool
+	if ok {
+		stop = context.AfterFunc(ctx, func() { dl.SetDeadline(time.Unix(1, 0)) })
+	} else {
+		stop = context.AfterFunc(ctx, func() { in.listener.Close() })
+	}
+	conn, err := in.listener.Accept()
+	stop()
+	if ok {
+		dl.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for producer to connect to %s: %w", in.addr, producerWaitError(ctx))
+		}
+		return fmt.Errorf("accepting on %s: %w", in.addr, err)
+	}
+	in.writeMu.Lock()
+	in.conn = conn
+	in.writeMu.Unlock()
+	return nil
+}
+
+// align makes the streams pass on only whole video units, a frame and any
+// sidecar header, and audio samples from here on, and has a reconnected
+// producer repeat header, the video header the session started with. The
+// first header must already have been read.
+func (in *socketInput) align(videoUnit, audioUnit int, header []byte) {
+	in.alignMu.Lock()
+	defer in.alignMu.Unlock()
+	in.header = header
+	in.video.unit, in.video.offset = videoUnit, len(header)
+	in.audio.unit = audioUnit
+}
+
+// serve demuxes connections until one ends, and with reaccept waits for
+// the producer to connect again, for up to timeout, and carries on. The
+// media streams end with the error that ended the last connection.
+func (in *socketInput) serve(ctx context.Context, timeout time.Duration, reaccept bool, onControl func([]byte)) {
+	for {
+		err := in.demux(onControl)
+		in.writeMu.Lock()
+		in.conn.Close()
+		in.writeMu.Unlock()
+		if ctx.Err() != nil || !reaccept {
+			in.end(err)
+			return
+		}
+		if err := in.resync(); err != nil {
+			in.end(err)
+			return
+		}
+		in.log.warnf("Producer disconnected from %s (%v), waiting for it to reconnect", in.addr, err)
+		if err := in.accept(ctx, timeout); err != nil {
+			in.log.errorf("Producer did not reconnect: %v", err)
+			in.end(err)
+			return
+		}
+		in.log.infof("Producer reconnected on %s", in.addr)
+	}
+}
+
+// resync drops what a connection left of an incomplete unit, padding one
+// already partly passed on with zeros, and expects the next connection to
+// repeat the header.
+func (in *socketInput) resync() error {
+	in.alignMu.Lock()
+	if in.video.unit == 0 {
+		in.alignMu.Unlock()
+		return errors.New("producer disconnected before sending the video header")
+	}
+	var pads [2][]byte
+	for i, st := range []*socketStream{&in.video, &in.audio} {
+		if pos := (st.pushed - st.offset) % st.unit; pos != 0 {
+			pads[i] = make([]byte, st.unit-pos)
+		}
+		if len(st.held) > 0 || pads[i] != nil {
+			in.log.warnf("Socket input: dropped %d bytes of an incomplete unit of %d and padded %d", len(st.held), st.unit, len(pads[i]))
+		}
+		st.pushed, st.offset, st.held = 0, 0, nil
+	}
+	in.video.expect = in.header
+	in.alignMu.Unlock()
+	for i, st := range []*socketStream{&in.video, &in.audio} {
+		if pads[i] != nil {
+			st.out.push(pads[i])
+		}
+	}
+	return nil
+}
+
+// push passes p on to st's reader, checking and dropping any repeated
+// header and holding back an incomplete unit.
+func (in *socketInput) push(st *socketStream, p []byte) error {
+	in.alignMu.Lock()
+	if len(st.expect) > 0 {
+		n := min(len(p), len(st.expect))
+		if !bytes.Equal(p[:n], st.expect[:n]) {
+			in.alignMu.Unlock()
+			return errors.New("reconnected producer sent a video header different from the session's")
+		}
+		st.expect, p = st.expect[n:], p[n:]
+	}
+	if st.unit > 0 {
+		st.held = append(st.held, p...)
+		pos := (st.pushed - st.offset) % st.unit
+		n := max(0, len(st.held)-(pos+len(st.held))%st.unit)
+		p, st.held = st.held[:n:n], st.held[n:]
+		st.held = append([]byte(nil), st.held...)
+	}
+	st.pushed += len(p)
+	in.alignMu.Unlock()
+	if len(p) > 0 {
+		st.out.push(p)
+	}
+	return nil
+}
+
+// end ends both media streams with err.
+func (in *socketInput) end(err error) {
+	in.video.out.end(err)
+	in.audio.out.end(err)
+}
+
+// demux reads messages until the connection fails, returning the error,
+// io.EOF for a connection the producer closed.
+func (in *socketInput) demux(onControl func([]byte)) error {
+	r := bufio.NewReader(in.conn)
+	err := func() error {
+		var hdr [5]byte
+		for {
+			if _, err := io.ReadFull(r, hdr[:]); err != nil {
+				return err
+			}
+			n := binary.LittleEndian.Uint32(hdr[1:])
+			if n > maxSocketMessage {
+				return fmt.Errorf("socket message of %d bytes exceeds %d", n, maxSocketMessage)
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return err
+			}
+			switch hdr[0] {
+			case SocketMessageVideo:
+				if err := in.push(&in.video, payload); err != nil {
+					return err
+				}
+			case SocketMessageAudio:
+				if err := in.push(&in.audio, payload); err != nil {
+					return err
+				}
+			case SocketMessageControl:
+				if onControl != nil {
+					onControl(payload)
+				}
+			default:
+				in.log.warnf("Ignoring socket message of unknown type %q", hdr[0])
+			}
+		}
+	}()
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		err = io.EOF
+	}
+	return err
+}
+
+// send writes a control message to the producer.
+func (in *socketInput) send(payload []byte) error {
+	if len(payload) > maxSocketMessage {
+		return fmt.Errorf("control message of %d bytes exceeds %d", len(payload), maxSocketMessage)
+	}
+	in.writeMu.Lock()
+	defer in.writeMu.Unlock()
+	if in.conn == nil {
+		return fmt.Errorf("%w: no producer connected", ErrNotRunning)
+	}
+	msg := make([]byte, 5+len(payload))
+	msg[0] = SocketMessageControl
+	binary.LittleEndian.PutUint32(msg[1:], uint32(len(payload)))
+	copy(msg[5:], payload)
+	_, err := in.conn.Write(msg)
+	return err
+}
+
+// Close closes the connection and listener, which removes a Unix socket
+// file.
+func (in *socketInput) Close() error {
+	in.writeMu.Lock()
+	defer in.writeMu.Unlock()
+	if in.conn != nil {
+		in.conn.Close()
+	}
+	err := in.listener.Close()
+	in.end(io.EOF)
+	return err
+}
+
+// chunkReader is an io.ReadCloser over a queue of byte slices.
+type chunkReader struct {
+	chunks  chan []byte
+	done    chan struct{}
+	endOnce sync.Once
+	err     error
+	cur     []byte
+}
+
+func newChunkReader(depth int) *chunkReader {
+	return &chunkReader{chunks: make(chan []byte, depth), done: make(chan struct{})}
+}
+
+// push queues p, blocking while the queue is full.
+func (c *chunkReader) push(p []byte) {
+	select {
+	case c.chunks <- p:
+	case <-c.done:
+	}
+}
+
+// end makes Read return err once the queued chunks are consumed.
+func (c *chunkReader) end(err error) {
+	c.endOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.cur) == 0 {
+		select {
+		case c.cur = <-c.chunks:
+		case <-c.done:
+			// Drain what was queued before the stream ended.
+			select {
+			case c.cur = <-c.chunks:
+			default:
+				return 0, c.err
+			}
+		}
+	}
+	n := copy(p, c.cur)
+	c.cur = c.cur[n:]
+	return n, nil
+}
+
+func (c *chunkReader) Close() error {
+	c.end(io.EOF)
+	return nil
+}
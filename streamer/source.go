@@ -0,0 +1,276 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FrameSource supplies raw video frames in the session's pixel format and
+// dimensions, with no width/height header.
+type FrameSource interface {
+	io.Reader
+}
+
+// FileSourceConfig describes a file of raw frames for
+// NewFileFrameSourceWith.
+type FileSourceConfig struct {
+	// FrameSize is the size of one frame, used to check that the file
+	// holds whole frames.
+	FrameSize int
+	// Loop restarts the file at EOF.
+	Loop bool
+	// ReadAhead is how many frames a goroutine of its own reads from the
+	// file ahead of the pacing, so slow or stuttering storage is absorbed
+	// by the buffer instead of delaying frames and jittering the pacing.
+	// It costs ReadAhead times FrameSize of memory, about 3 MB a frame at
+	// 1080p. Zero, the default, reads each frame when it is due. It is for
+	// file sources only; the live input from the pipes is never read
+	// ahead, as buffering real-time input only adds latency.
+	ReadAhead int
+}
+
+// fileFrameSource plays a file of raw frames at 25 fps, optionally looping.
+type fileFrameSource struct {
+	f        *os.File
+	r        io.Reader
+	prefetch *prefetcher // nil without read-ahead
+}
+
+// NewFileFrameSource opens a file of raw frames, such as one recorded from
+// the video pipe with its header stripped, for use with SwitchVideoSource.
+// The file is paced to 25 fps; with loop set it restarts at EOF. frameSize
+// is the size of one frame, used to check that the file holds whole frames.
+// NewFileFrameSourceWith adds read-ahead.
+func NewFileFrameSource(path string, frameSize int, loop bool) (FrameSource, error) {
+	return NewFileFrameSourceWith(path, FileSourceConfig{FrameSize: frameSize, Loop: loop})
+}
+
+// NewFileFrameSourceWith is NewFileFrameSource with the settings of cfg.
+func NewFileFrameSourceWith(path string, cfg FileSourceConfig) (FrameSource, error) {
+	if cfg.ReadAhead < 0 {
+		return nil, fmt.Errorf("%w: read-ahead of %d frames must not be negative", ErrInvalidConfig, cfg.ReadAhead)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if cfg.FrameSize <= 0 || info.Size() == 0 || info.Size()%int64(cfg.FrameSize) != 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s is %d bytes, not a whole number of %d-byte frames", path, info.Size(), cfg.FrameSize)
+	}
+	src := &fileFrameSource{f: f}
+	var r io.Reader = &loopingFile{f: f, loop: cfg.Loop}
+	if cfg.ReadAhead > 0 {
+		src.prefetch = newPrefetcher(r, cfg.FrameSize, cfg.ReadAhead)
+		r = src.prefetch
+	}
+	src.r = newFrameRateLimiter(r, cfg.FrameSize, 40*time.Millisecond)
+	return src, nil
+}
+
+func (s *fileFrameSource) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *fileFrameSource) Close() error {
+	if s.prefetch != nil {
+		s.prefetch.close()
+	}
+	return s.f.Close()
+}
+
+// loopingFile reads f, starting over at EOF when loop is set.
+type loopingFile struct {
+	f    *os.File
+	loop bool
+}
+
+func (l *loopingFile) Read(p []byte) (int, error) {
+	n, err := l.f.Read(p)
+	if errors.Is(err, io.EOF) && l.loop {
+		if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+			return n, err
+		}
+		return n, nil
+	}
+	return n, err
+}
+
+// prefetcher reads whole frames from r on a goroutine of its own, up to
+// depth frames ahead of its reader.
+type prefetcher struct {
+	frames   chan []byte
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error  // why reading stopped, set before frames is closed
+	cur      []byte // the rest of the frame being read
+}
+
+func newPrefetcher(r io.Reader, frameSize, depth int) *prefetcher {
+	p := &prefetcher{frames: make(chan []byte, depth), stop: make(chan struct{})}
+	go p.run(r, frameSize)
+	return p
+}
+
+func (p *prefetcher) run(r io.Reader, frameSize int) {
+	defer close(p.frames)
+	for {
+		frame := make([]byte, frameSize)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			p.err = err
+			return
+		}
+		select {
+		case p.frames <- frame:
+		case <-p.stop:
+			p.err = io.ErrClosedPipe
+			return
+		}
+	}
+}
+
+func (p *prefetcher) Read(b []byte) (int, error) {
+	if len(p.cur) == 0 {
+		frame, ok := <-p.frames
+		if !ok {
+			return 0, p.err
+		}
+		p.cur = frame
+	}
+	n := copy(b, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
+
+// close stops reading ahead.
+func (p *prefetcher) close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// sourceSwitcher feeds the encoder from one FrameSource at a time and
+// swaps sources only between frames, so the encoder never sees a frame
+// spliced from two sources. The live input is not read while another
+// source is selected; a producer behind it is back-pressured. A source
+// other than the live input that reaches EOF hands back to the live input.
+type sourceSwitcher struct {
+	live      io.Reader
+	frameSize int
+	onSwitch  func()
+	log       logger
+
+	mu        sync.Mutex
+	cur       io.Reader
+	next      io.Reader
+	remaining int
+}
+
+func newSourceSwitcher(live io.Reader, frameSize int, onSwitch func(), log logger) *sourceSwitcher {
+	return &sourceSwitcher{live: live, cur: live, frameSize: frameSize, onSwitch: onSwitch, log: log}
+}
+
+// switchTo makes r the source from the next frame boundary.
+func (w *sourceSwitcher) switchTo(r io.Reader) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.next = r
+}
+
+// startWith makes r the source before the first frame, without the switch
+// callback. The live input takes over when r ends.
+func (w *sourceSwitcher) startWith(r io.Reader) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cur = r
+}
+
+func (w *sourceSwitcher) Read(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.remaining == 0 && w.next != nil {
+		w.swapLocked(w.next)
+	}
+	if w.remaining == 0 {
+		w.remaining = w.frameSize
+	}
+	r := w.cur
+	if len(p) > w.remaining {
+		p = p[:w.remaining]
+	}
+	w.mu.Unlock()
+
+	n, err := r.Read(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.remaining -= n
+	if errors.Is(err, io.EOF) && r != w.live && w.cur == r {
+		if w.remaining != w.frameSize {
+			w.log.warnf("[Video] Switched-in source ended mid-frame")
+		}
+		w.remaining = 0
+		w.swapLocked(w.live)
+		err = nil
+	}
+	return n, err
+}
+
+// swapLocked makes r current, closing the source it replaces unless that
+// is the live input.
+func (w *sourceSwitcher) swapLocked(r io.Reader) {
+	if c, ok := w.cur.(io.Closer); ok && w.cur != w.live && w.cur != r {
+		c.Close()
+	}
+	w.cur, w.next = r, nil
+	if w.onSwitch != nil {
+		w.onSwitch()
+	}
+}
+
+// close closes the sources other than the live input, whose own close
+// ends the switcher's input.
+func (w *sourceSwitcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, r := range []io.Reader{w.cur, w.next} {
+		if c, ok := r.(io.Closer); ok && r != w.live {
+			c.Close()
+		}
+	}
+	w.next = nil
+}
+
+// SwitchVideoSource replaces the raw video input with src from the next
+// frame boundary, keeping the encoder, track and connection running. A nil
+// src switches back to the video pipe, as does src reaching EOF. The frames
+// must match the session's dimensions and pixel format. The streamer owns
+// src from here on and closes it, if it is an io.Closer, once it has been
+// switched away from. A keyframe is requested at the switch so
+// that viewers joining afterwards get a clean picture of the new source.
+func (s *Streamer) SwitchVideoSource(src FrameSource) error {
+	s.encMu.Lock()
+	switcher, live := s.switcher, s.liveVideo
+	s.encMu.Unlock()
+	if switcher == nil {
+		return fmt.Errorf("%w: no video pipeline", ErrNotRunning)
+	}
+	var r io.Reader = src
+	if src == nil {
+		r = live
+	}
+	switcher.switchTo(r)
+	return nil
+}
+
+func (s *Streamer) onSourceSwitch() {
+	s.log.infof("[Video] Switched video source")
+	s.emit(EventSourceSwitched, nil)
+	s.RequestKeyframe("source switch")
+}
@@ -0,0 +1,56 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// throttledReader is endless storage that stalls for stall on every
+// every-th read, as slow disks do.
+type throttledReader struct {
+	every int
+	stall time.Duration
+	reads int
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if r.reads++; r.reads%r.every == 0 {
+		time.Sleep(r.stall)
+	}
+	return len(p), nil
+}
+
+// BenchmarkFileSourceReadAhead paces frames from throttled storage as a
+// file source does, with and without read-ahead, and reports how late the
+// longest gap between two frames was: the interval plus a stall without
+// read-ahead, about the interval with enough of it.
+func BenchmarkFileSourceReadAhead(b *testing.B) {
+	const frameSize, interval = 64 << 10, 2 * time.Millisecond
+	for _, depth := range []int{0, 8} {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			var r io.Reader = &throttledReader{every: 8, stall: 5 * time.Millisecond}
+			if depth > 0 {
+				p := newPrefetcher(r, frameSize, depth)
+				defer p.close()
+				r = p
+			}
+			r = newFrameRateLimiter(r, frameSize, interval)
+			frame := make([]byte, frameSize)
+			var maxGap time.Duration
+			b.SetBytes(frameSize)
+			b.ResetTimer()
+			prev := time.Now()
+			for range b.N {
+				if _, err := io.ReadFull(r, frame); err != nil {
+					b.Fatal(err)
+				}
+				now := time.Now()
+				maxGap = max(maxGap, now.Sub(prev))
+				prev = now
+			}
+			b.ReportMetric(float64(maxGap)/float64(time.Millisecond), "max-gap-ms")
+		})
+	}
+}
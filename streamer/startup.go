@@ -0,0 +1,52 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+)
+
+// StartupInputPolicy decides what happens to raw input that arrives after
+// the producer's header but before the track it feeds is bound, while the
+// tracks are published and negotiated.
+//
+// Buffer, the default, leaves it to queue up in the encoder and the pipes,
+// so no frame is lost but the track opens on media that is as old as the
+// negotiation took, and plays that much behind until the producer is next
+// held up. Drop reads and discards whole frames until the track is bound,
+// so the track opens on live media with an IDR frame, and whatever the
+// producer sent during the negotiation is gone.
+type StartupInputPolicy string
+
+const (
+	StartupInputBuffer StartupInputPolicy = "buffer" // the default
+	StartupInputDrop   StartupInputPolicy = "drop"
+)
+
+func (p StartupInputPolicy) validate() error {
+	switch p {
+	case StartupInputBuffer, StartupInputDrop:
+		return nil
+	}
+	return fmt.Errorf("unknown startup input policy %q (want buffer or drop)", string(p))
+}
+
+// startupGate puts a paused dropping gate for StartupInputDrop in front of
+// r, counting its drops in drops, and returns nil for the gate under
+// StartupInputBuffer.
+func (s *Streamer) startupGate(r io.Reader, unit int, drops *dropCounts) (io.Reader, *inputGate) {
+	if s.cfg.StartupInputPolicy != StartupInputDrop {
+		return r, nil
+	}
+	g := newInputGate(r, unit, true, s.ctx.Done()).countAs(drops, DropStartup)
+	g.pause()
+	return g, g
+}
+
+// openStartupGate lets input through g once its track is first bound.
+func openStartupGate(g *inputGate, kind, units string, log logger) {
+	if g == nil || !g.paused() {
+		return
+	}
+	g.resume()
+	log.infof("[%s] Track bound, dropped %d %s that arrived before it", kind, g.dropped.Load(), units)
+}
@@ -0,0 +1,68 @@
+//go:build streamertest
+
+package streamer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartupInputPolicy(t *testing.T) {
+	const frameSize, frames = 16, 20
+	for _, tt := range []struct {
+		name   string
+		policy StartupInputPolicy
+		bind   time.Duration
+		// min and max bound the pictures that reach the track.
+		min, max int
+	}{
+		{"buffer fast connect", StartupInputBuffer, 0, frames, frames},
+		{"buffer slow connect", StartupInputBuffer, 150 * time.Millisecond, frames, frames},
+		// A fast bind may race the first frame.
+		{"drop fast connect", StartupInputDrop, 0, frames - 1, frames},
+		// The frames written in the first 150ms are gone.
+		{"drop slow connect", StartupInputDrop, 150 * time.Millisecond, 1, frames - 10},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHarness(HarnessConfig{FrameSize: frameSize, StartupInputPolicy: tt.policy, BindDelay: tt.bind})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The producer writes a frame every 10ms from the start,
+			// whether or not the track is bound yet.
+			start := time.Now()
+			frame := make([]byte, frameSize)
+			for range frames {
+				time.Sleep(10 * time.Millisecond)
+				if _, err := h.Write(frame); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wrote := time.Since(start)
+			if err := h.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var pictures []HarnessSample
+			for _, s := range h.Samples() {
+				if s.Frame >= 0 {
+					pictures = append(pictures, s)
+				}
+			}
+			if n := len(pictures); n < tt.min || n > tt.max {
+				t.Errorf("%d of %d frames reached the track, want %d to %d", n, frames, tt.min, tt.max)
+			}
+			if len(pictures) > 0 && !pictures[0].Keyframe {
+				t.Error("the track does not open on a keyframe")
+			}
+			// Buffering holds the producer back until the track is bound;
+			// dropping never does.
+			if tt.policy == StartupInputDrop && wrote > frames*10*time.Millisecond+100*time.Millisecond {
+				t.Errorf("writing took %v with the input dropped", wrote)
+			}
+			if tt.policy == StartupInputBuffer && wrote < tt.bind {
+				t.Errorf("writing took %v, less than the %v bind", wrote, tt.bind)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StartupStage is the part of Start's bring-up in progress. HealthStats
+// reports it while Start runs, and a Config.StartupTimeout failure names
+// the one that was pending, so that a stuck start points at what to fix.
+type StartupStage string
+
+const (
+	// StartupPreparing checks the session's settings, ffmpeg and the
+	// video encoder.
+	StartupPreparing StartupStage = "preparing"
+	// StartupConnecting joins the room.
+	StartupConnecting StartupStage = "connecting"
+	// StartupOpeningPipes waits for the producer to open the pipes or
+	// connect to the input socket.
+	StartupOpeningPipes StartupStage = "opening_pipes"
+	// StartupReadingHeader waits for the width/height header the producer
+	// sends ahead of the first video frame.
+	StartupReadingHeader StartupStage = "reading_header"
+	// StartupStartingEncoders starts ffmpeg, and with Config.Warmup waits
+	// for its first output.
+	StartupStartingEncoders StartupStage = "starting_encoders"
+	// StartupFirstFrame waits for the encoders' first frames, under
+	// Config.SyncStartTimeout.
+	StartupFirstFrame StartupStage = "first_frame"
+	// StartupPublishing publishes the tracks, through any publish delay,
+	// waiting for the server to acknowledge each.
+	StartupPublishing StartupStage = "publishing"
+	// StartupVerifying checks the published tracks for
+	// Config.VerifyPublish.
+	StartupVerifying StartupStage = "verifying"
+	// StartupDone is set once Start has succeeded.
+	StartupDone StartupStage = "done"
+)
+
+// hint says what a start stuck in st is waiting on.
+func (st StartupStage) hint() string {
+	switch st {
+	case StartupPreparing:
+		return "ffmpeg did not answer the encoder checks"
+	case StartupConnecting:
+		return "the server did not accept the connection; check the URL, the credentials and the network path to it"
+	case StartupOpeningPipes:
+		return "the producer has not opened the pipes or connected to the input socket"
+	case StartupReadingHeader:
+		return "the producer opened the video input but sent no complete header"
+	case StartupStartingEncoders:
+		return "ffmpeg did not start or produced no output"
+	case StartupFirstFrame:
+		return "an encoder produced no frame"
+	case StartupPublishing:
+		return "the server did not acknowledge the tracks"
+	case StartupVerifying:
+		return "the published tracks carried no media to the verifier"
+	}
+	return string(st)
+}
+
+// startupProgress records the StartupStage Start is in.
+type startupProgress struct {
+	mu    sync.Mutex
+	stage StartupStage
+}
+
+func (p *startupProgress) set(stage StartupStage) {
+	p.mu.Lock()
+	p.stage = stage
+	p.mu.Unlock()
+}
+
+func (p *startupProgress) get() StartupStage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stage
+}
+
+// armStartupTimeout bounds the bring-up, up to endStartup, to
+// Config.StartupTimeout. When it elapses first, the pending stage is
+// logged and the session's context cancelled with an ErrStartupTimeout
+// cause: the stage then fails as it does when Start's context is
+// cancelled, and the header read, which cannot be cancelled, is held to
+// the deadline by headerTimeout.
+func (s *Streamer) armStartupTimeout() {
+	d := s.cfg.StartupTimeout
+	if d <= 0 {
+		return
+	}
+	ctx, cancelStartup := context.WithCancelCause(s.ctx)
+	cancel := s.cancel
+	s.ctx, s.cancel = ctx, func() {
+		s.startupTimer.Stop()
+		cancelStartup(context.Canceled)
+		cancel()
+	}
+	s.startupDeadline = time.Now().Add(d)
+	s.startupTimer = time.AfterFunc(d, func() {
+		stage := s.startup.get()
+		s.log.errorf("Startup did not finish within %v, stuck %s: %s", d, stage, stage.hint())
+		cancelStartup(fmt.Errorf("%w after %v while %s", ErrStartupTimeout, d, stage))
+	})
+}
+
+// endStartup disarms the startup timeout once Start has succeeded, and
+// fails if it fired first.
+func (s *Streamer) endStartup() error {
+	if s.startupTimer != nil && !s.startupTimer.Stop() {
+		return context.Cause(s.ctx)
+	}
+	s.startup.set(StartupDone)
+	return nil
+}
+
+// startupError is err, a stage's failure, wrapped in ErrStartupTimeout
+// naming the stage when the stage failed for the startup deadline having
+// passed, which it may notice just ahead of the timer.
+func (s *Streamer) startupError(err error) error {
+	if s.startupDeadline.IsZero() || time.Now().Before(s.startupDeadline) {
+		return err
+	}
+	return fmt.Errorf("%w after %v while %s: %w", ErrStartupTimeout, s.cfg.StartupTimeout, s.startup.get(), err)
+}
+
+// headerTimeout is Config.HeaderTimeout, cut short by the startup
+// deadline.
+func (s *Streamer) headerTimeout() time.Duration {
+	timeout := s.cfg.HeaderTimeout
+	if s.startupDeadline.IsZero() {
+		return timeout
+	}
+	if left := time.Until(s.startupDeadline); left < timeout {
+		// readVideoHeader takes zero as no deadline at all.
+		return max(left, time.Nanosecond)
+	}
+	return timeout
+}
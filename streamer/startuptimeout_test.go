@@ -0,0 +1,73 @@
+package streamer
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startupTestTimeout leaves time for the encoder checks, which run the
+// fake ffmpeg.
+const startupTestTimeout = 500 * time.Millisecond
+
+// startTimingOut starts a session of cfg on a NullSink with a
+// StartupTimeout of startupTestTimeout, and checks it fails promptly with
+// ErrStartupTimeout naming stage.
+func startTimingOut(t *testing.T, cfg Config, stage StartupStage) {
+	t.Helper()
+	var log syncBuffer
+	cfg.Sink = &NullSink{}
+	cfg.Logger = slog.New(slog.NewTextHandler(&log, nil))
+	cfg.H264Encoder = SoftwareVideoEncoder
+	cfg.DisableAudio = true
+	cfg.StartupTimeout = startupTestTimeout
+	s := New(cfg)
+	start := time.Now()
+	err := s.Start(t.Context())
+	elapsed := time.Since(start)
+	s.Stop()
+	if !errors.Is(err, ErrStartupTimeout) || !strings.Contains(err.Error(), "while "+string(stage)) {
+		t.Fatalf("Start = %v, want ErrStartupTimeout while %s\n%s", err, stage, log.String())
+	}
+	if elapsed > 2*startupTestTimeout {
+		t.Errorf("Start failed after %v, want about %v", elapsed, startupTestTimeout)
+	}
+	if want := "stuck " + string(stage) + ": " + stage.hint(); !strings.Contains(log.String(), want) {
+		t.Errorf("log does not contain %q:\n%s", want, log.String())
+	}
+}
+
+func TestStartupTimeoutOpeningPipes(t *testing.T) {
+	// No producer opens the FIFO.
+	dir := t.TempDir()
+	startTimingOut(t, Config{
+		VideoPipePath: filepath.Join(dir, "video"),
+		AudioPipePath: filepath.Join(dir, "audio"),
+	}, StartupOpeningPipes)
+}
+
+func TestStartupTimeoutReadingHeader(t *testing.T) {
+	// The producer is connected but sends nothing, and the header read
+	// is held to the startup deadline well within HeaderTimeout.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pw.Close() })
+	startTimingOut(t, Config{VideoInput: pr, HeaderTimeout: time.Minute}, StartupReadingHeader)
+}
+
+func TestStartupTimeoutAfterHeader(t *testing.T) {
+	// The header and frames arrive, but the encoder puts nothing out, so
+	// the warmup waits for its first output.
+	setFakeFFmpeg(t, "stall")
+	r, err := NewTestPattern(TestPatternConfig{Width: 64, Height: 48, FrameRate: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTimingOut(t, Config{VideoInput: r, Warmup: true}, StartupStartingEncoders)
+}
@@ -0,0 +1,441 @@
+package streamer
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats summarises a streaming session.
+type Stats struct {
+	Identity        string        `json:"identity"`
+	RoomName        string        `json:"room_name"`
+	StartedAt       time.Time     `json:"started_at"`
+	SessionDuration time.Duration `json:"session_duration_ns"`
+
+	VideoFrames      int           `json:"video_frames"`
+	AvgVideoInterval time.Duration `json:"avg_video_interval_ns"`
+	MinVideoInterval time.Duration `json:"min_video_interval_ns"`
+	MaxVideoInterval time.Duration `json:"max_video_interval_ns"`
+	// SmoothedVideoInterval is an exponentially weighted moving average
+	// of the frame interval, and SmoothedVideoFPS the rate it implies.
+	SmoothedVideoInterval time.Duration `json:"smoothed_video_interval_ns"`
+	SmoothedVideoFPS      float64       `json:"smoothed_video_fps"`
+	VideoBytesRead        int64         `json:"video_bytes_read"`
+	LastKeyframeAgo       time.Duration `json:"last_keyframe_ago_ns"`
+	// VideoEncoderOutputAgo is how long ago the video encoder last
+	// produced output, zero for TSInput, and AudioEncoderOutputAgo the
+	// same for the audio encoder.
+	VideoEncoderOutputAgo time.Duration `json:"video_encoder_output_ago_ns"`
+	AudioEncoderOutputAgo time.Duration `json:"audio_encoder_output_ago_ns"`
+	AudioFrames           int           `json:"audio_frames"`
+	AudioBytesRead        int64         `json:"audio_bytes_read"`
+	RemoteParticipants    int           `json:"remote_participants"`
+
+	// VideoDrift is the wall-clock time the published frames took minus
+	// the time they cover at the frame rate. It grows while the encoder
+	// cannot sustain the rate and is negative when the input runs ahead.
+	// Pauses of more than a second between frames, as while idle or
+	// reconnecting, are left out.
+	VideoDrift time.Duration `json:"video_drift_ns"`
+
+	// Media dropped rather than published, in video frames and 20 ms
+	// audio chunks, for each DropReason, every reason present.
+	DroppedVideoFrames map[DropReason]int64 `json:"dropped_video_frames"`
+	DroppedAudioChunks map[DropReason]int64 `json:"dropped_audio_chunks"`
+
+	// Filler published by Config.GapFill while the input had a gap, in
+	// frames and 20 ms chunks of silence.
+	GapFilledVideoFrames int64 `json:"gap_filled_video_frames"`
+	GapFilledAudioChunks int64 `json:"gap_filled_audio_chunks"`
+
+	// Sequence anomalies in the video input, from the sidecar headers of
+	// Config.FrameHeaders and always zero without them: frames the
+	// producer skipped, sent twice, or sent after a later one. Frames
+	// dropped while reconnecting or paused are not counted as missing;
+	// those that are make up DropBackpressure.
+	InputFramesMissing    int64 `json:"input_frames_missing"`
+	InputFramesDuplicate  int64 `json:"input_frames_duplicate"`
+	InputFramesOutOfOrder int64 `json:"input_frames_out_of_order"`
+
+	// VideoEncoder is the ffmpeg encoder in use and HardwareEncoding
+	// whether it is GPU-accelerated.
+	VideoEncoder     string `json:"video_encoder"`
+	HardwareEncoding bool   `json:"hardware_encoding"`
+
+	// EncoderRestarts counts the encoder restarts made to recover from
+	// stalls, and EncoderBreakerOpen whether the restart breaker has
+	// given up on the encoders; see Config.EncoderRestartLimit.
+	EncoderRestarts    int  `json:"encoder_restarts"`
+	EncoderBreakerOpen bool `json:"encoder_breaker_open"`
+
+	// KeyframeInterval is the video GOP in effect, which AdaptiveGOP
+	// varies; zero for TSInput.
+	KeyframeInterval time.Duration `json:"keyframe_interval_ns"`
+
+	// The bitrate sent on each track over the last Config.BitrateWindow,
+	// counting the encoded media without RTP overhead. Nothing feeds the
+	// SFU's bandwidth estimate back into ffmpeg, so the encoder never
+	// backs off under network pressure: a rate under the configured
+	// target is its own rate control, as on static content. A rate that
+	// meets the target while viewers see poor quality points past the
+	// publisher, at the SFU's downlink to them.
+	VideoBitrateKbps float64 `json:"video_bitrate_kbps"`
+	AudioBitrateKbps float64 `json:"audio_bitrate_kbps"`
+
+	// Encoder utilisation over the last sample interval. CPU is a
+	// percentage of one core. The GPU fields are only set when built with
+	// the nvml tag.
+	VideoEncoderCPUPercent   float64 `json:"video_encoder_cpu_percent"`
+	AudioEncoderCPUPercent   float64 `json:"audio_encoder_cpu_percent"`
+	VideoEncoderGPUPercent   float64 `json:"video_encoder_gpu_percent,omitempty"`
+	VideoEncoderNVENCPercent float64 `json:"video_encoder_nvenc_percent,omitempty"`
+}
+
+// Snapshot returns a copy of the current session stats. It is safe to call
+// from any goroutine while the pipeline is running.
+func (s *Streamer) Snapshot() Stats {
+	st := Stats{
+		Identity:           s.cfg.Identity,
+		RoomName:           s.cfg.RoomName,
+		StartedAt:          s.startedAt,
+		LastKeyframeAgo:    s.LastKeyframeAgo(),
+		RemoteParticipants: s.participants.ParticipantCount(),
+	}
+	s.encMu.Lock()
+	st.VideoEncoder, st.HardwareEncoding = s.videoEncoder, s.hardwareEncoding
+	if s.videoFeed != nil {
+		st.KeyframeInterval = time.Duration(s.videoSettings.GOP) * s.cfg.frameInterval()
+	}
+	s.encMu.Unlock()
+	if !s.startedAt.IsZero() {
+		st.SessionDuration = time.Since(s.startedAt)
+	}
+	if s.videoFeed != nil && !s.startedAt.IsZero() {
+		st.VideoEncoderOutputAgo = s.videoOutput.since(time.Now(), s.startedAt)
+	}
+	if s.audioFeed != nil && !s.startedAt.IsZero() {
+		st.AudioEncoderOutputAgo = s.audioOutput.since(time.Now(), s.startedAt)
+	}
+	s.stats.fill(&st)
+	s.usage.fill(&st)
+	s.fillDropped(&st)
+	s.fillGapFilled(&st)
+	s.breaker.fill(&st)
+	st.VideoBitrateKbps, st.AudioBitrateKbps = s.videoBitrate.kbps(), s.audioBitrate.kbps()
+	s.fillInputSeq(&st)
+	return st
+}
+
+// FrameStats is the frame timing of one track, as VideoStats and
+// AudioStats report it. The intervals are between consecutive frames
+// handed to the track, so Frames counts those after the first.
+type FrameStats struct {
+	Frames      int           `json:"frames"`
+	AvgInterval time.Duration `json:"avg_interval_ns"`
+	MinInterval time.Duration `json:"min_interval_ns"`
+	MaxInterval time.Duration `json:"max_interval_ns"`
+	// BytesRead is the encoded media handed to the track, parameter sets
+	// and headers included.
+	BytesRead int64 `json:"bytes_read"`
+	// QueueDepth is how many raw frames wait for the video encoder, and
+	// QueueDropped how many were dropped for falling behind, under
+	// Config.EncoderBacklog; zero without it and for audio.
+	QueueDepth   int   `json:"queue_depth,omitempty"`
+	QueueDropped int64 `json:"queue_dropped,omitempty"`
+}
+
+// frameIntervals accumulates the interval between consecutive frame
+// writes.
+type frameIntervals struct {
+	frameCount      int
+	lastFrameTime   time.Time
+	totalEncodeTime time.Duration
+	maxEncodeTime   time.Duration
+	minEncodeTime   time.Duration
+}
+
+// record counts a frame written at now and returns the interval since the
+// one before, with ok false for the first frame.
+func (f *frameIntervals) record(now time.Time) (interval time.Duration, ok bool) {
+	prev := f.lastFrameTime
+	f.lastFrameTime = now
+	if prev.IsZero() {
+		return 0, false
+	}
+	interval = now.Sub(prev)
+	f.totalEncodeTime += interval
+	f.frameCount++
+	if f.frameCount == 1 || interval > f.maxEncodeTime {
+		f.maxEncodeTime = interval
+	}
+	if f.frameCount == 1 || interval < f.minEncodeTime {
+		f.minEncodeTime = interval
+	}
+	return interval, true
+}
+
+// restart makes the next frame start a new run, so that the gap before
+// it, as while an encoder was stalled, is not counted as an interval.
+func (f *frameIntervals) restart() {
+	f.lastFrameTime = time.Time{}
+}
+
+func (f *frameIntervals) stats(bytes int64) FrameStats {
+	st := FrameStats{Frames: f.frameCount, BytesRead: bytes}
+	if f.frameCount > 0 {
+		st.AvgInterval = f.totalEncodeTime / time.Duration(f.frameCount)
+		st.MinInterval, st.MaxInterval = f.minEncodeTime, f.maxEncodeTime
+	}
+	return st
+}
+
+// trackTiming accumulates the video frame intervals, smoothed and against
+// the frame rate.
+type trackTiming struct {
+	frameIntervals
+	startTime time.Time
+
+	// ewmaInterval is the smoothed interval in nanoseconds.
+	ewmaInterval float64
+	alpha        float64
+
+	// Drift against frameDuration: driftBase is carried over from earlier
+	// runs of frames, and the current run started driftFrames frames ago
+	// at driftStart.
+	frameDuration time.Duration
+	driftWarning  time.Duration
+	driftBase     time.Duration
+	driftStart    time.Time
+	driftFrames   int
+	driftWarned   bool
+}
+
+// driftPauseGap is the frame interval beyond which the input is taken to
+// have paused, so the gap is not counted as drift.
+const driftPauseGap = time.Second
+
+// DefaultDriftWarning is how far the video may fall behind real time
+// before a warning is logged, when Config.DriftWarning is zero.
+const DefaultDriftWarning = 2 * time.Second
+
+// drift is how far the current frame at now is behind real time.
+func (t *trackTiming) drift(now time.Time) time.Duration {
+	return t.driftBase + now.Sub(t.driftStart) - time.Duration(t.driftFrames)*t.frameDuration
+}
+
+// statsCollector holds the counters updated from the track writer
+// goroutines. All fields are guarded by mu.
+type statsCollector struct {
+	mu         sync.Mutex
+	video      trackTiming
+	videoBytes int64
+	audio      frameIntervals
+	audioBytes int64
+	log        logger
+}
+
+// DefaultStatsSmoothing is the EWMA weight given to each new frame interval
+// when Config.StatsSmoothing is zero. At 25 fps it averages over roughly
+// the last second.
+const DefaultStatsSmoothing = 0.05
+
+func newStatsCollector(alpha float64, log logger) *statsCollector {
+	return &statsCollector{video: trackTiming{alpha: alpha}, log: log}
+}
+
+// setPace sets the frame duration drift is measured against and the drift
+// that warrants a warning.
+func (c *statsCollector) setPace(frameDuration, warning time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.video.frameDuration, c.video.driftWarning = frameDuration, warning
+}
+
+// videoFrame records a video frame written at now. behind is set when the
+// drift first exceeds the warning threshold, and again only after it has
+// recovered to half of it.
+func (c *statsCollector) videoFrame(now time.Time) (drift time.Duration, behind bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &c.video
+	encodeTime, ok := t.record(now)
+	if !ok && !t.startTime.IsZero() {
+		// The first frame of a restarted encoder.
+		t.driftStart, t.driftFrames = now, 0
+	} else if !ok {
+		t.startTime = now
+		t.driftStart = now
+		c.log.infof("[Video] First frame received at %v (time since start: %v, bytes read: %d)",
+			now, now.Sub(t.startTime), c.videoBytes)
+	} else {
+		if t.frameCount == 1 {
+			t.ewmaInterval = float64(encodeTime)
+		} else {
+			t.ewmaInterval += t.alpha * (float64(encodeTime) - t.ewmaInterval)
+		}
+		if encodeTime > driftPauseGap {
+			t.driftBase = t.drift(now.Add(-encodeTime))
+			t.driftStart, t.driftFrames = now, 0
+		} else {
+			t.driftFrames++
+		}
+
+		// Print stats every 100 frames
+		if t.frameCount%100 == 0 {
+			avgEncodeTime := t.totalEncodeTime / time.Duration(t.frameCount)
+			c.log.debugf("[Video] Frame %d - Encode time: %v (avg: %v, min: %v, max: %v, total bytes: %d)",
+				t.frameCount, encodeTime, avgEncodeTime, t.minEncodeTime, t.maxEncodeTime, c.videoBytes)
+		}
+	}
+
+	if t.frameDuration == 0 {
+		return 0, false
+	}
+	drift = t.drift(now)
+	switch {
+	case !t.driftWarned && drift > t.driftWarning:
+		t.driftWarned, behind = true, true
+	case t.driftWarned && drift < t.driftWarning/2:
+		t.driftWarned = false
+	}
+	return drift, behind
+}
+
+// lastVideoFrame is when the last video frame was written, zero before
+// the first.
+func (c *statsCollector) lastVideoFrame() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.video.lastFrameTime
+}
+
+func (c *statsCollector) audioFrame(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.audio.record(now); !ok && c.audio.frameCount == 0 {
+		c.log.infof("[Audio] First frame received at %v (delay from video start: %v, bytes read: %d)",
+			now, now.Sub(c.video.startTime), c.audioBytes)
+	} else if c.audio.frameCount%500 == 0 {
+		c.log.debugf("[Audio] Processed %d frames (time since start: %v, total bytes: %d)",
+			c.audio.frameCount, now.Sub(c.video.startTime), c.audioBytes)
+	}
+}
+
+// videoRestarted and audioRestarted leave the time a stalled encoder
+// took out of the frame intervals once it has been restarted, and the
+// video drift carries on from where the last frame left it.
+func (c *statsCollector) videoRestarted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &c.video
+	if !t.lastFrameTime.IsZero() {
+		t.driftBase = t.drift(t.lastFrameTime)
+	}
+	t.restart()
+}
+
+func (c *statsCollector) audioRestarted() {
+	c.mu.Lock()
+	c.audio.restart()
+	c.mu.Unlock()
+}
+
+// resetVideo starts the video counters over, for a republished track.
+func (c *statsCollector) resetVideo() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &c.video
+	c.video = trackTiming{alpha: t.alpha, frameDuration: t.frameDuration, driftWarning: t.driftWarning}
+	c.videoBytes = 0
+}
+
+// videoSample and audioSample count n bytes handed to a track.
+func (c *statsCollector) videoSample(n int) {
+	c.mu.Lock()
+	c.videoBytes += int64(n)
+	c.mu.Unlock()
+}
+
+func (c *statsCollector) audioSample(n int) {
+	c.mu.Lock()
+	c.audioBytes += int64(n)
+	c.mu.Unlock()
+}
+
+func (c *statsCollector) videoStats() FrameStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.video.stats(c.videoBytes)
+}
+
+func (c *statsCollector) audioStats() FrameStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.audio.stats(c.audioBytes)
+}
+
+// VideoStats returns the frame timing of the video track so far. It is
+// safe to call from any goroutine, such as an HTTP handler, while the
+// track writer updates it, and is cheaper than Snapshot.
+func (s *Streamer) VideoStats() FrameStats {
+	st := s.stats.videoStats()
+	if q := s.videoQueue; q != nil {
+		st.QueueDepth, st.QueueDropped = q.depth(), q.dropped.Load()
+	}
+	return st
+}
+
+// AudioStats is VideoStats for the audio track.
+func (s *Streamer) AudioStats() FrameStats {
+	return s.stats.audioStats()
+}
+
+func (c *statsCollector) fill(st *Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &c.video
+	st.VideoFrames = t.frameCount
+	st.VideoBytesRead = c.videoBytes
+	st.AudioFrames = c.audio.frameCount
+	st.AudioBytesRead = c.audioBytes
+	if t.frameCount > 0 {
+		st.AvgVideoInterval = t.totalEncodeTime / time.Duration(t.frameCount)
+		st.MinVideoInterval = t.minEncodeTime
+		st.MaxVideoInterval = t.maxEncodeTime
+		st.SmoothedVideoInterval = time.Duration(t.ewmaInterval)
+		if t.frameDuration > 0 {
+			st.VideoDrift = t.drift(t.lastFrameTime)
+		}
+		if t.ewmaInterval > 0 {
+			st.SmoothedVideoFPS = float64(time.Second) / t.ewmaInterval
+		}
+	}
+}
+
+func (c *statsCollector) printFinal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.printVideoFinalLocked("Video")
+	c.log.infof("[Final Stats] Audio - Total frames: %d", c.audio.frameCount)
+}
+
+// printVideoFinal prints the final video stats alone, under label, for a
+// collector that times a video track and no audio.
+func (c *statsCollector) printVideoFinal(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.printVideoFinalLocked(label)
+}
+
+func (c *statsCollector) printVideoFinalLocked(label string) {
+	t := &c.video
+	if t.frameCount > 0 {
+		avgEncodeTime := t.totalEncodeTime / time.Duration(t.frameCount)
+		c.log.infof("[Final Stats] %s - Total frames: %d, Avg encode time: %v, Min: %v, Max: %v",
+			label, t.frameCount, avgEncodeTime, t.minEncodeTime, t.maxEncodeTime)
+	}
+}
@@ -0,0 +1,48 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFrameStatsConcurrent updates the stats as the track writers do while
+// reading them from another goroutine, for the race detector.
+func TestFrameStatsConcurrent(t *testing.T) {
+	s := New(Config{})
+	const frames = 2000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		now := time.Now()
+		for range frames {
+			now = now.Add(time.Millisecond)
+			s.stats.videoSample(100)
+			s.stats.videoFrame(now)
+			s.stats.audioSample(10)
+			s.stats.audioFrame(now)
+		}
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		video := s.VideoStats()
+		if video.Frames > 0 && video.BytesRead < int64(video.Frames)*100 {
+			t.Fatalf("%d frames with only %d bytes read", video.Frames, video.BytesRead)
+		}
+		s.AudioStats()
+	}
+
+	video := s.VideoStats()
+	if video.Frames != frames-1 || video.BytesRead != frames*100 {
+		t.Errorf("VideoStats = %d intervals, %d bytes, want %d and %d", video.Frames, video.BytesRead, frames-1, frames*100)
+	}
+	if video.MinInterval != time.Millisecond || video.MaxInterval != time.Millisecond {
+		t.Errorf("intervals %v to %v, want 1ms", video.MinInterval, video.MaxInterval)
+	}
+	if audio := s.AudioStats(); audio.BytesRead != frames*10 {
+		t.Errorf("AudioStats read %d bytes, want %d", audio.BytesRead, frames*10)
+	}
+}
@@ -0,0 +1,34 @@
+package streamer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// NewStatsFile returns an OnShutdown hook that writes the final stats as a
+// single JSON object, followed by a newline, to path, or to stdout if path
+// is "-". A file is written under a temporary name and renamed into place,
+// so a pipeline picking it up never sees it half written.
+func NewStatsFile(path string) func(Stats) error {
+	return func(st Stats) error {
+		body, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		body = append(body, '\n')
+		if path == "-" {
+			_, err := os.Stdout.Write(body)
+			return err
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, body, 0o644); err != nil {
+			return fmt.Errorf("writing stats to %s: %w", path, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("writing stats to %s: %w", path, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package streamer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// stderrTailLines is how many of the last lines of an encoder's stderr
+// are quoted when it exits.
+const stderrTailLines = 10
+
+// stderrTail passes an ffmpeg process's stderr on to w and keeps its last
+// lines to explain an unexpected exit.
+type stderrTail struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.w.Write(p)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexAny(t.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(t.partial[:i])); line != "" {
+			t.lines = append(t.lines, line)
+			if len(t.lines) > stderrTailLines {
+				t.lines = t.lines[1:]
+			}
+		}
+		t.partial = t.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// String returns the kept lines, and any unterminated one, joined by
+// " | ", or "" if ffmpeg wrote nothing.
+func (t *stderrTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := t.lines
+	if last := strings.TrimSpace(string(t.partial)); last != "" {
+		lines = append(lines[:len(lines):len(lines)], last)
+	}
+	return strings.Join(lines, " | ")
+}
+
+// encoderCommand builds an ffmpeg process logging only errors, to the
+// streamer's stderr and to a stderrTail that watchProcess quotes if it
+// exits unexpectedly.
+func encoderCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("ffmpeg", append([]string{"-hide_banner", "-loglevel", "error"}, args...)...)
+	cmd.Stderr = &stderrTail{w: os.Stderr}
+	return cmd
+}
@@ -0,0 +1,1471 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+// Streamer reads raw video and audio from named pipes, encodes them with
+// ffmpeg and publishes the result to a LiveKit room.
+//
+// Start brings the pipeline up and returns once both tracks are published.
+// From then on the pipeline runs in background goroutines: one per ffmpeg
+// process waiting for it to exit, and one waiting for the session context
+// to end. Asynchronous failures are delivered on Errors. Stop tears
+// everything down and returns only after all of those goroutines have
+// exited, at which point Errors is closed.
+type Streamer struct {
+	cfg          Config
+	log          logger
+	participants *ParticipantTracker
+
+	// encMu guards videoSettings, videoEncoder, videoCodec, crop,
+	// hardwareEncoding, videoCmd and videoExited, and once the session
+	// runs the video input and publication that RepublishVideo replaces:
+	// rawVideo, switcher and videoPub.
+	encMu              sync.Mutex
+	videoSettings      VideoEncoderSettings
+	videoEncoder       string
+	videoCodec         string // MIME type of videoTrack
+	crop               CropRect
+	hardwareEncoding   bool
+	videoFeed          *videoFeeder
+	videoQueue         *frameQueue    // Config.EncoderBacklog, ahead of videoFeed
+	breaker            restartBreaker // stall recovery restarts
+	videoOut           *spliceReader
+	audioMu            sync.Mutex // guards audioCmd, audioExited
+	audioFeed          *videoFeeder
+	audioOut           *spliceReader
+	retired            sync.Map // *exec.Cmd replaced by Reconfigure
+	encoderSlots       sync.Map // *exec.Cmd holding a SetEncoderLimit slot
+	replaceMu          sync.Mutex
+	subWaiters         sync.Map // webrtc.TrackLocal -> chan struct{}
+	clock              Clock
+	clockOrigin        time.Time // the session start ClockSession stamps from
+	room               *lksdk.Room
+	rawVideo, rawAudio io.ReadCloser
+	videoGate          *inputGate // holds back raw input while reconnecting
+	audioGate          *inputGate
+	videoStartGate     *inputGate // drops raw input until the track is bound
+	audioStartGate     *inputGate
+	videoDrops         dropCounts // media dropped, by reason, for Stats
+	audioDrops         dropCounts
+	videoFill          *gapFiller // Config.GapFill
+	audioFill          *gapFiller
+	idleGates          []*inputGate // drop raw input while the room is empty
+	idleMu             sync.Mutex   // guards idleGates, idle, idleArmed
+	idle, idleArmed    bool
+	socket             *socketInput
+	captureTimes       <-chan time.Duration
+	inputSeq           inputSeqStats
+	fallbackImage      []byte // Config.FallbackImage as a raw frame
+	liveVideo          io.Reader
+	switcher           *sourceSwitcher
+	videoCmd, audioCmd *exec.Cmd
+	frameWidth         uint32
+	frameHeight        uint32
+	videoTrack         *lksdk.LocalTrack
+	audioTrack         *lksdk.LocalTrack
+	videoProvider      *encodedSampleProvider // feeds videoTrack
+	audioProvider      *encodedSampleProvider
+	parkMu             sync.Mutex // serialises Park and Rejoin
+	parked             atomic.Bool
+	reconnects         atomic.Int64 // SDK reconnections, for HealthStats
+	rejoinAttempts     atomic.Int64
+	parkStop           chan struct{} // closed to end the parked drains
+	parkDrains         sync.WaitGroup
+	videoPub, audioPub *lksdk.LocalTrackPublication
+	videoExited        chan struct{}
+	audioExited        chan struct{}
+	createdFIFOs       []string
+	recordings         map[string]*participantRecording // by participant SID
+	recordingsMu       sync.Mutex
+	keyframes          *keyframeMonitor
+	keyframeRequests   *keyframeScheduler
+	videoOutput        outputWatch
+	audioOutput        outputWatch
+	joinRate           *joinRate // for Config.AdaptiveGOP
+	stats              *statsCollector
+	events             *eventLog
+	health             *http.Server
+	usage              *usageSampler
+	videoBitrate       bitrateMeter // sent on the tracks
+	audioBitrate       bitrateMeter
+	rtpStats           rtpStatsWindow // sampled from the publisher connection
+	sinkVideo          atomic.Bool    // writing to Config.Sink
+	sinkAudio          atomic.Bool
+	startedAt          time.Time
+	credentialsLoaded  bool // Config.CredentialsFile has been applied
+
+	ctx          context.Context
+	readCtx      context.Context // of the encoded output readers, done once the encoders are stopped
+	stopReads    context.CancelFunc
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	errs         chan error
+	shutdownOnce sync.Once
+	teardown     shutdownPhase
+	startup      startupProgress
+	stopOnce     sync.Once
+	stopped      chan struct{}
+	failOnce     sync.Once
+	failed       chan struct{} // closed on the first fatal error
+	failure      error
+
+	// startupDeadline and startupTimer are Config.StartupTimeout's, unset
+	// without one.
+	startupDeadline time.Time
+	startupTimer    *time.Timer
+}
+
+func New(cfg Config) *Streamer {
+	cfg.setDefaults()
+	keyframes := newKeyframeMonitor(logger{cfg.Logger})
+	s := &Streamer{
+		cfg:              cfg,
+		log:              logger{cfg.Logger},
+		participants:     NewParticipantTracker(),
+		keyframes:        keyframes,
+		keyframeRequests: newKeyframeScheduler(cfg.KeyframeDebounce, keyframes, logger{cfg.Logger}),
+		stats:            newStatsCollector(cfg.StatsSmoothing, logger{cfg.Logger}),
+		usage:            newUsageSampler(),
+		errs:             make(chan error, 16),
+		stopped:          make(chan struct{}),
+		failed:           make(chan struct{}),
+		videoCodec:       webrtc.MimeTypeH264,
+		recordings:       make(map[string]*participantRecording),
+	}
+	s.participants.OnParticipantConnected(func(rp *lksdk.RemoteParticipant, count int) {
+		s.emit(EventParticipantJoined, map[string]any{"participant": rp.Identity(), "count": count})
+	})
+	s.participants.OnParticipantDisconnected(func(rp *lksdk.RemoteParticipant, count int) {
+		s.emit(EventParticipantLeft, map[string]any{"participant": rp.Identity(), "count": count})
+	})
+	if cfg.AdaptiveGOP.enabled() {
+		s.joinRate = newJoinRate()
+		s.participants.OnParticipantConnected(func(_ *lksdk.RemoteParticipant, _ int) {
+			s.joinRate.join(time.Now())
+		})
+	}
+	if cfg.PauseWhenIdle {
+		s.participants.OnParticipantConnected(func(_ *lksdk.RemoteParticipant, _ int) {
+			s.setIdle(false)
+		})
+		s.participants.OnParticipantDisconnected(func(_ *lksdk.RemoteParticipant, count int) {
+			s.setIdle(count == 0)
+		})
+	}
+	return s
+}
+
+// Participants returns the tracker for remote participants in the room.
+// Listeners should be registered before Start.
+func (s *Streamer) Participants() *ParticipantTracker {
+	return s.participants
+}
+
+// Errors delivers failures that happen after Start has returned, both
+// fatal and recoverable; use Config.OnError to tell them apart. It is
+// closed once Stop has finished tearing the pipeline down.
+func (s *Streamer) Errors() <-chan error {
+	return s.errs
+}
+
+// Start opens the pipes, connects to the room and publishes both tracks.
+// It blocks until the producer has connected to the pipes. Cancelling ctx
+// after Start returns stops the pipeline, just like calling Stop.
+func (s *Streamer) Start(ctx context.Context) error {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	if d := s.cfg.MaxSessionDuration; d > 0 {
+		var cancelTimeout context.CancelFunc
+		s.ctx, cancelTimeout = context.WithTimeoutCause(s.ctx, d, ErrMaxSessionDuration)
+		cancel := s.cancel
+		s.cancel = func() {
+			cancelTimeout()
+			cancel()
+		}
+	}
+	s.startedAt = time.Now()
+	s.readCtx, s.stopReads = context.WithCancel(context.Background())
+	s.startup.set(StartupPreparing)
+	s.armStartupTimeout()
+
+	if s.cfg.EventLogPath != "" {
+		events, err := openEventLog(s.cfg.EventLogPath, s.log)
+		if err != nil {
+			s.Stop()
+			return err
+		}
+		s.events = events
+	}
+	if s.cfg.HealthAddr != "" {
+		if err := s.startHealthServer(); err != nil {
+			s.Stop()
+			return err
+		}
+	}
+	if err := s.start(); err != nil {
+		s.Stop()
+		return s.startupError(err)
+	}
+	if s.cfg.VerifyPublish && !s.cfg.SubscribeOnly {
+		s.startup.set(StartupVerifying)
+		if err := s.verifyPublish(); err != nil {
+			s.Stop()
+			return s.startupError(err)
+		}
+	}
+	if err := s.endStartup(); err != nil {
+		s.Stop()
+		return err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-s.ctx.Done()
+		if errors.Is(context.Cause(s.ctx), ErrMaxSessionDuration) {
+			s.log.infof("Maximum session duration of %v reached, stopping", s.cfg.MaxSessionDuration)
+			s.emit(EventMaxDuration, map[string]any{"max_session_duration": s.cfg.MaxSessionDuration.String()})
+			if s.cfg.OnMaxDurationReached != nil {
+				s.cfg.OnMaxDurationReached()
+			}
+		}
+		s.shutdown()
+	}()
+	return nil
+}
+
+// ErrMaxSessionDuration is the context cause when a session is stopped for
+// reaching Config.MaxSessionDuration.
+var ErrMaxSessionDuration = errors.New("maximum session duration reached")
+
+// Stop tears down the pipeline and blocks until every background goroutine
+// has exited. It is safe to call more than once. If the teardown takes
+// longer than Config.ShutdownTimeout, the encoders are killed and Stop
+// returns, or the process exits with Config.ExitOnShutdownTimeout, leaving
+// whatever is stuck behind.
+func (s *Streamer) Stop() {
+	s.stopOnce.Do(func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.stop()
+		}()
+		select {
+		case <-done:
+		case <-time.After(s.cfg.ShutdownTimeout):
+			s.shutdownTimedOut()
+		}
+		close(s.stopped)
+	})
+	<-s.stopped
+}
+
+func (s *Streamer) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.shutdown()
+	s.teardown.set("waiting for background goroutines")
+	s.wg.Wait()
+	if s.cfg.Sink != nil {
+		if err := s.cfg.Sink.Close(); err != nil {
+			s.log.warnf("Closing sink: %v", err)
+		}
+	}
+	s.stats.printFinal()
+	s.emit(EventShutdown, map[string]any{"session_duration": time.Since(s.startedAt).String()})
+	if s.events != nil {
+		s.events.Close()
+	}
+	s.teardown.set("running shutdown hooks")
+	s.runShutdownHooks()
+	close(s.errs)
+}
+
+func (s *Streamer) start() error {
+	if err := s.cfg.resolveIdentity(); err != nil {
+		return err
+	}
+	if err := s.checkSink(); err != nil {
+		return err
+	}
+	if s.cfg.SubscribeOnly {
+		s.startup.set(StartupConnecting)
+		return s.startMonitor()
+	}
+	if s.cfg.TSInput != "" {
+		return s.startTS()
+	}
+
+	if err := s.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if err := checkFFmpeg(); err != nil {
+		return err
+	}
+	if !s.cfg.DisableVideo {
+		if err := s.selectVideoEncoder(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if s.clock, err = newClock(s.cfg.ClockSource, s.cfg.NTPServer); err != nil {
+		return err
+	}
+	s.clockOrigin = s.clock.Now()
+	if s.cfg.ClockSource != "" && s.cfg.ClockSource != ClockMonotonic {
+		s.log.infof("Pacing frames by the %s clock", s.cfg.ClockSource)
+	}
+	// Join the room first so an unreachable server fails fast instead of
+	// after the producer has been waited for.
+	if s.cfg.Sink != nil {
+		s.log.infof("Writing the tracks to %T instead of a room", s.cfg.Sink)
+	} else {
+		s.startup.set(StartupConnecting)
+		if err := s.connect(); err != nil {
+			return err
+		}
+		if s.cfg.RoomMetadataOverrides {
+			if err := s.applyRoomMetadata(); err != nil {
+				return err
+			}
+		}
+		if err := s.checkRoomCodecs(false); err != nil {
+			return err
+		}
+	}
+	s.startup.set(StartupOpeningPipes)
+	if err := s.openPipes(); err != nil {
+		return err
+	}
+	s.startup.set(StartupReadingHeader)
+	if err := s.readHeader(); err != nil {
+		return err
+	}
+	s.startup.set(StartupStartingEncoders)
+	if err := s.startEncoders(); err != nil {
+		return err
+	}
+	if s.cfg.ForceKeyframes && s.videoFeed != nil {
+		s.keyframeRequests.force = s.forceVideoKeyframe
+	}
+	if err := s.publishStaggered(); err != nil {
+		return err
+	}
+	s.armIdle()
+	if s.cfg.AdaptiveGOP.enabled() && s.videoFeed != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.adaptGOP()
+		}()
+	}
+	return nil
+}
+
+// checkSink rejects a Config.Sink with the modes that need a room.
+func (s *Streamer) checkSink() error {
+	if s.cfg.Sink != nil && (s.cfg.SubscribeOnly || s.cfg.TSInput != "") {
+		return fmt.Errorf("%w: Sink takes the raw pipeline's tracks; SubscribeOnly and TSInput need a room", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// validate checks the raw-input settings before anything is started.
+func (s *Streamer) validate() error {
+	var err error
+	if s.videoSettings, err = ResolveVideoSettings(s.cfg.Profile, s.cfg.VideoEncoder); err != nil {
+		return err
+	}
+	if err := s.videoSettings.validate(); err != nil {
+		return err
+	}
+	if s.cfg.StatsSmoothing < 0 || s.cfg.StatsSmoothing > 1 {
+		return fmt.Errorf("stats smoothing %v outside (0, 1]", s.cfg.StatsSmoothing)
+	}
+	if err := s.cfg.PixelFormat.validate(); err != nil {
+		return err
+	}
+	if err := checkVideoEncoder(webrtc.MimeTypeH264, s.cfg.H264Encoder); err != nil {
+		return err
+	}
+	if err := s.cfg.VideoCodec.validate(); err != nil {
+		return err
+	}
+	if s.cfg.RequireHardware && s.cfg.VideoCodec == VideoCodecVP8 {
+		return fmt.Errorf("RequireHardware needs H264; %s is not hardware encoded", webrtc.MimeTypeVP8)
+	}
+	if s.cfg.RequireHardware && !isHardwareEncoder(s.cfg.H264Encoder) {
+		return fmt.Errorf("RequireHardware needs a hardware H264 encoder, not %s", s.cfg.H264Encoder)
+	}
+	if s.cfg.InputSocketPath != "" && s.cfg.InputSocketAddr != "" {
+		return errors.New("set one of InputSocketPath and InputSocketAddr")
+	}
+	if s.cfg.Sink != nil && (s.cfg.PauseWhenIdle || s.cfg.VerifyPublish) {
+		return errors.New("PauseWhenIdle and VerifyPublish need a room, not a Sink")
+	}
+	if s.cfg.DisableVideo && s.cfg.DisableAudio {
+		return errors.New("DisableVideo and DisableAudio leave nothing to publish")
+	}
+	if (s.cfg.DisableVideo || s.cfg.DisableAudio) && s.cfg.inputSocketAddr() != "" {
+		return errors.New("streaming a single track needs the pipes; the input socket carries both")
+	}
+	if (s.cfg.VideoInput != nil || s.cfg.AudioInput != nil) && s.cfg.inputSocketAddr() != "" {
+		return errors.New("VideoInput and AudioInput replace the pipes, not the input socket")
+	}
+	if s.cfg.DimensionsFromConfig && s.cfg.FrameRateFromHeader {
+		return errors.New("FrameRateFromHeader needs the video header, which DimensionsFromConfig skips")
+	}
+	if s.cfg.DimensionsFromConfig && s.cfg.PixelFormatFromHeader {
+		return errors.New("PixelFormatFromHeader needs the video header, which DimensionsFromConfig skips")
+	}
+	if s.cfg.DimensionsFromConfig {
+		if s.cfg.Width == 0 || s.cfg.Height == 0 {
+			return errors.New("DimensionsFromConfig requires Width and Height")
+		}
+		if err := ValidateDimensions(s.cfg.Width, s.cfg.Height, s.cfg.MinDimension, s.cfg.MaxDimension); err != nil {
+			return err
+		}
+	}
+	if s.cfg.OutputWidth != 0 || s.cfg.OutputHeight != 0 {
+		if err := ValidateDimensions(s.cfg.OutputWidth, s.cfg.OutputHeight, s.cfg.MinDimension, s.cfg.MaxDimension); err != nil {
+			return fmt.Errorf("output size: %w", err)
+		}
+	}
+	if err := validateFilter("video", s.cfg.VideoFilter); err != nil {
+		return err
+	}
+	if s.cfg.FallbackImage != "" {
+		if strings.HasPrefix(s.cfg.FallbackImage, "-") {
+			return fmt.Errorf("fallback image %q looks like a command-line flag", s.cfg.FallbackImage)
+		}
+		if _, err := os.Stat(s.cfg.FallbackImage); err != nil {
+			return fmt.Errorf("fallback image: %w", err)
+		}
+	}
+	if s.cfg.EncoderRestartLimit < 0 {
+		return fmt.Errorf("encoder restart limit %d must not be negative", s.cfg.EncoderRestartLimit)
+	}
+	if s.cfg.EncoderRestartWindow < 0 {
+		return fmt.Errorf("encoder restart window %v must not be negative", s.cfg.EncoderRestartWindow)
+	}
+	if s.cfg.EncoderStopTimeout < 0 || s.cfg.EncoderStopTimeout >= s.cfg.ShutdownTimeout {
+		return fmt.Errorf("encoder stop timeout %v must be positive and below the shutdown timeout %v",
+			s.cfg.EncoderStopTimeout, s.cfg.ShutdownTimeout)
+	}
+	if s.cfg.MaxRejoinAttempts < 0 || s.cfg.RejoinBackoff < 0 {
+		return fmt.Errorf("rejoin attempts %d and backoff %v must not be negative", s.cfg.MaxRejoinAttempts, s.cfg.RejoinBackoff)
+	}
+	if s.cfg.HotSwapLead < 0 {
+		return fmt.Errorf("hot swap lead %v must not be negative", s.cfg.HotSwapLead)
+	}
+	if s.cfg.EncoderStallTimeout < 0 {
+		return fmt.Errorf("encoder stall timeout %v must not be negative", s.cfg.EncoderStallTimeout)
+	}
+	if s.cfg.StartupTimeout < 0 {
+		return fmt.Errorf("startup timeout %v must not be negative", s.cfg.StartupTimeout)
+	}
+	if s.cfg.EncoderBacklog < 0 {
+		return fmt.Errorf("encoder backlog %d must not be negative", s.cfg.EncoderBacklog)
+	}
+	if s.cfg.EncoderBacklog > 0 && s.cfg.FrameHeaders {
+		return errors.New("an encoder backlog cannot be combined with frame headers; a dropped frame would pass its capture timestamp on to the next")
+	}
+	if err := s.cfg.GapFill.validate(); err != nil {
+		return err
+	}
+	if err := s.cfg.validateE2EE(); err != nil {
+		return err
+	}
+	if s.cfg.decodes() {
+		return errors.New("decoding subscribed tracks needs subscribe-only mode")
+	}
+	if s.cfg.GapFill != GapFillOff && s.cfg.FrameHeaders {
+		// The n-th encoded frame takes the n-th capture timestamp, which
+		// filler frames would shift.
+		return errors.New("gap fill cannot be combined with frame headers")
+	}
+	if err := s.cfg.AlphaPacking.validate(s.cfg.PixelFormat); err != nil {
+		return err
+	}
+	if err := validateEncoderPriority(s.cfg.EncoderNice, s.cfg.EncoderCgroup); err != nil {
+		return err
+	}
+	if err := validatePublishDelay("audio", s.cfg.AudioPublishDelay); err != nil {
+		return err
+	}
+	if err := validatePublishDelay("video", s.cfg.VideoPublishDelay); err != nil {
+		return err
+	}
+	if s.cfg.SyncStartTimeout < 0 || s.cfg.SyncStartTimeout > MaxPublishDelay {
+		return fmt.Errorf("sync start timeout %v outside 0-%v", s.cfg.SyncStartTimeout, MaxPublishDelay)
+	}
+	if s.cfg.GapFillAfter < 0 {
+		return fmt.Errorf("gap fill delay %v must not be negative", s.cfg.GapFillAfter)
+	}
+	if s.cfg.FallbackAfter < 0 {
+		return fmt.Errorf("fallback delay %v must not be negative", s.cfg.FallbackAfter)
+	}
+	if s.cfg.PreRoll != "" {
+		if strings.HasPrefix(s.cfg.PreRoll, "-") {
+			return fmt.Errorf("pre-roll %q looks like a command-line flag", s.cfg.PreRoll)
+		}
+		if _, err := os.Stat(s.cfg.PreRoll); err != nil {
+			return fmt.Errorf("pre-roll: %w", err)
+		}
+	}
+	for category, sampling := range s.cfg.LogSampling {
+		if err := sampling.validate(); err != nil {
+			return fmt.Errorf("%s: %w", category, err)
+		}
+	}
+	if err := s.cfg.ReconnectInputPolicy.validate(); err != nil {
+		return err
+	}
+	if s.cfg.ReconnectBuffer < 0 {
+		return fmt.Errorf("reconnect buffer %v must not be negative", s.cfg.ReconnectBuffer)
+	}
+	if s.cfg.ReconnectBuffer > 0 && s.cfg.ReconnectInputPolicy != ReconnectInputDrop {
+		return fmt.Errorf("reconnect buffer needs the %s reconnect input policy", ReconnectInputDrop)
+	}
+	if err := s.cfg.StartupInputPolicy.validate(); err != nil {
+		return err
+	}
+	if s.cfg.FrameRate < 0 || s.cfg.FrameRate > 240 {
+		return fmt.Errorf("frame rate %d must be between 1 and 240", s.cfg.FrameRate)
+	}
+	if s.cfg.KeyframeBurst < 0 || s.cfg.KeyframeBurstInterval < 0 {
+		return fmt.Errorf("keyframe burst %d every %v must not be negative", s.cfg.KeyframeBurst, s.cfg.KeyframeBurstInterval)
+	}
+	if s.cfg.KeyframeInterval < 0 {
+		return fmt.Errorf("keyframe interval %v must not be negative", s.cfg.KeyframeInterval)
+	}
+	if s.cfg.KeyframeInterval > 0 && s.cfg.AdaptiveGOP.enabled() {
+		return errors.New("set one of KeyframeInterval and AdaptiveGOP")
+	}
+	if s.cfg.InputAnomalyThreshold < 0 {
+		return fmt.Errorf("input anomaly threshold %d must not be negative", s.cfg.InputAnomalyThreshold)
+	}
+	if s.cfg.EncoderThreads < 0 {
+		return fmt.Errorf("encoder threads %d must not be negative", s.cfg.EncoderThreads)
+	}
+	if err := validateAudioBitrate(s.cfg.AudioBitrateKbps); err != nil {
+		return err
+	}
+	if err := s.cfg.AudioResampler.validate(s.cfg.AudioResamplePrecision); err != nil {
+		return err
+	}
+	if err := s.cfg.AdaptiveGOP.validate(); err != nil {
+		return err
+	}
+	if err := s.cfg.OpusApplication.validate(); err != nil {
+		return err
+	}
+	if err := validateAudioFEC(s.cfg.AudioFECPacketLoss, s.cfg.OpusApplication); err != nil {
+		return err
+	}
+	if err := s.cfg.AudioSampleFormat.validate(); err != nil {
+		return err
+	}
+	if err := validateAudioSampleRate(s.cfg.AudioSampleRate); err != nil {
+		return err
+	}
+	if err := validateAudioChannels(s.cfg.AudioChannels); err != nil {
+		return err
+	}
+	if err := validateFilter("audio", s.cfg.AudioFilter); err != nil {
+		return err
+	}
+	if err := s.cfg.VideoCodecOverride.validate(s.cfg.VideoCodec.mimeType()); err != nil {
+		return err
+	}
+	if err := s.cfg.AudioCodecOverride.validate(webrtc.MimeTypeOpus); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Streamer) openPipes() error {
+	if s.cfg.inputSocketAddr() != "" {
+		return s.openSocket()
+	}
+
+	if !s.cfg.DisableVideo && s.cfg.VideoInput != nil {
+		s.rawVideo = s.cfg.VideoInput
+	}
+	if !s.cfg.DisableAudio && s.cfg.AudioInput != nil {
+		s.rawAudio = s.cfg.AudioInput
+	}
+	pipes := s.pipes()
+	if len(pipes) == 0 {
+		return nil
+	}
+	paths := make([]string, len(pipes))
+	for i, pipe := range pipes {
+		paths[i] = pipe.path
+		reused, err := createFIFO(pipe.path)
+		if err != nil {
+			return fmt.Errorf("creating %s pipe: %w", pipe.kind, err)
+		}
+		s.createdFIFOs = append(s.createdFIFOs, pipe.path)
+		if reused {
+			s.log.infof("Reusing existing %s pipe at %s", pipe.kind, pipe.path)
+		} else {
+			s.log.infof("Created %s pipe at %s", pipe.kind, pipe.path)
+		}
+	}
+
+	// Open named pipes for reading raw data. They are opened at once so
+	// the producer may open them in either order.
+	files, err := openFIFOs(s.ctx, s.cfg.PipeOpenTimeout, paths...)
+	if err != nil {
+		return err
+	}
+	for i, pipe := range pipes {
+		if pipe.kind == "video" {
+			s.rawVideo = files[i]
+		} else {
+			s.rawAudio = files[i]
+		}
+	}
+
+	s.log.infof("Pipes opened successfully, waiting for sender...")
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.checkFIFOWriters()
+	}()
+	return nil
+}
+
+// openSocket waits for the producer on the input socket and splits its
+// stream into the raw video and audio inputs.
+func (s *Streamer) openSocket() error {
+	addr := s.cfg.inputSocketAddr()
+	in, err := listenSocket(addr, s.log)
+	if err != nil {
+		return err
+	}
+	s.socket = in
+	s.log.infof("Listening for producer on %s", addr)
+
+	if err := in.accept(s.ctx, s.cfg.PipeOpenTimeout); err != nil {
+		return err
+	}
+	s.rawVideo, s.rawAudio = in.video.out, in.audio.out
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		in.serve(s.ctx, s.cfg.PipeOpenTimeout, s.cfg.InputSocketReaccept, s.cfg.OnSocketControl)
+	}()
+	s.log.infof("Producer connected on %s", addr)
+	return nil
+}
+
+// SendControl sends a control message to the producer connected to the
+// input socket.
+func (s *Streamer) SendControl(payload []byte) error {
+	if s.socket == nil {
+		return errors.New("no input socket configured")
+	}
+	return s.socket.send(payload)
+}
+
+// readHeader reads the frame dimensions, and with FrameRateFromHeader the
+// frame rate, the producer sends ahead of the first video frame and rejects
+// ones ffmpeg could not sensibly encode. With DimensionsFromConfig it uses
+// the already validated configured ones. With DisableVideo there is none.
+func (s *Streamer) readHeader() error {
+	if s.cfg.DisableVideo {
+		return nil
+	}
+	if s.cfg.DimensionsFromConfig {
+		s.log.infof("Using configured video dimensions: %dx%d", s.cfg.Width, s.cfg.Height)
+		s.frameWidth, s.frameHeight = s.cfg.Width, s.cfg.Height
+		if err := s.checkFrameLayout(); err != nil {
+			return err
+		}
+		s.alignSocket(nil)
+		return nil
+	}
+	fields := s.cfg.headerFields()
+	h, err := readVideoHeader(s.rawVideo, s.headerTimeout(), fields)
+	if err != nil {
+		return err
+	}
+	s.log.infof("Received video dimensions: %dx%d", h.Width, h.Height)
+	if h.ByteOrder != nil {
+		s.log.infof("Video header is marked %s", h.ByteOrder)
+	}
+	if err := ValidateDimensions(h.Width, h.Height, s.cfg.MinDimension, s.cfg.MaxDimension); err != nil {
+		return fmt.Errorf("%w: %w (%s)", ErrBadHeader, err, h.dump(fields, s.cfg.MinDimension, s.cfg.MaxDimension))
+	}
+	if h.FrameRate > 240 {
+		return fmt.Errorf("%w: frame rate %d must be between 1 and 240 (%s)", ErrBadHeader, h.FrameRate,
+			h.dump(fields, s.cfg.MinDimension, s.cfg.MaxDimension))
+	}
+	if h.FrameRate != 0 {
+		s.log.infof("Received video frame rate: %d fps", h.FrameRate)
+		s.cfg.FrameRate = int(h.FrameRate)
+	}
+	if h.PixelFormat != 0 {
+		format, ok := pixelFormatFromCode(h.PixelFormat)
+		if !ok {
+			return fmt.Errorf("%w: unknown pixel format code %d (%s)", ErrBadHeader, h.PixelFormat,
+				h.dump(fields, s.cfg.MinDimension, s.cfg.MaxDimension))
+		}
+		if err := s.cfg.AlphaPacking.validate(format); err != nil {
+			return fmt.Errorf("%w: %w", ErrBadHeader, err)
+		}
+		s.log.infof("Received video pixel format: %s", format)
+		s.cfg.PixelFormat = format
+	}
+	s.frameWidth, s.frameHeight = h.Width, h.Height
+	if err := s.checkFrameLayout(); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadHeader, err)
+	}
+	s.alignSocket(h.encode(fields))
+	return nil
+}
+
+// alignSocket has the input socket, with InputSocketReaccept, keep the
+// streams on frame and sample boundaries across connections, a
+// reconnecting producer sending header again first.
+func (s *Streamer) alignSocket(header []byte) {
+	if s.socket == nil || !s.cfg.InputSocketReaccept {
+		return
+	}
+	unit := s.frameSize()
+	if s.cfg.FrameHeaders {
+		unit += FrameHeaderSize
+	}
+	s.socket.align(unit, s.cfg.AudioChannels*s.cfg.AudioSampleFormat.sampleSize(), header)
+}
+
+func (s *Streamer) connect() error {
+	if err := s.loadCredentials(); err != nil {
+		return err
+	}
+	roomCB := &lksdk.RoomCallback{
+		OnReconnecting: func() {
+			s.reconnects.Add(1)
+			s.pauseInput()
+			s.emit(EventReconnecting, nil)
+		},
+		OnReconnected: func() {
+			s.resumeInput()
+			s.emit(EventReconnected, nil)
+		},
+		OnDisconnectedWithReason: s.roomDisconnected,
+		OnLocalTrackSubscribed:   s.localTrackSubscribed,
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnTrackSubscribed:         s.cfg.OnTrackSubscribed,
+			OnTrackSubscriptionFailed: s.trackSubscriptionFailed,
+			OnDataPacket:              s.dataReceived,
+		},
+	}
+	s.participants.Attach(roomCB)
+
+	policy := webrtc.ICETransportPolicyAll
+	if s.cfg.ForceRelay {
+		policy = webrtc.ICETransportPolicyRelay
+	}
+	token, err := publisherToken(s.cfg)
+	if err != nil {
+		return err
+	}
+	var interceptors []interceptor.Factory
+	if s.cfg.customInterceptors() {
+		if interceptors, err = s.interceptors(); err != nil {
+			return err
+		}
+	}
+	dial := func(policy webrtc.ICETransportPolicy) (*lksdk.Room, error) {
+		s.log.infof("ICE transport policy: %s", policy)
+		opts := []lksdk.ConnectOption{lksdk.WithICETransportPolicy(policy)}
+		if interceptors != nil {
+			opts = append(opts, lksdk.WithInterceptors(interceptors))
+		}
+		return s.connectRoom(func() (*lksdk.Room, error) {
+			return lksdk.ConnectToRoomWithToken(s.cfg.URL, token, roomCB, opts...)
+		})
+	}
+	room, err := dial(policy)
+	if err != nil && errors.Is(err, ErrICETimeout) && s.cfg.RelayFallback && policy != webrtc.ICETransportPolicyRelay {
+		s.log.warnf("No direct ICE connection (%v), retrying through TURN relays", err)
+		room, err = dial(webrtc.ICETransportPolicyRelay)
+	}
+	if err != nil {
+		return err
+	}
+	s.room = room
+	s.participants.Sync(room)
+	s.emit(EventConnected, map[string]any{"room": s.cfg.RoomName, "identity": s.cfg.Identity})
+	return nil
+}
+
+func (s *Streamer) startEncoders() error {
+	var preVideo, preAudio *prerollSource
+	if s.cfg.PreRoll != "" {
+		var err error
+		if !s.cfg.DisableVideo {
+			if preVideo, err = s.startPreroll(true); err != nil {
+				return err
+			}
+		}
+		if !s.cfg.DisableAudio {
+			if preAudio, err = s.startPreroll(false); err != nil {
+				if preVideo != nil {
+					preVideo.Close()
+				}
+				return err
+			}
+		}
+	}
+	var video, audio io.ReadCloser
+	if !s.cfg.DisableVideo {
+		if err := s.startVideoPipeline(preVideo); err != nil {
+			return err
+		}
+		video = s.encodedVideoReader(s.videoOut)
+	}
+	if !s.cfg.DisableAudio {
+		audioPipe, err := s.startAudioEncoder(preAudio)
+		if err != nil {
+			return err
+		}
+		audio = s.debugReader(s.audioOutput.reader(audioPipe), "Audio")
+	}
+	s.sampleUsage()
+	return s.createTracks(video, audio, s.cfg.frameInterval())
+}
+
+// startVideoPipeline starts the video encoder and the feeder that hands it
+// the raw input, with pre, if not nil, played first.
+func (s *Streamer) startVideoPipeline(pre *prerollSource) error {
+	if s.cfg.KeyframeInterval > 0 {
+		s.encMu.Lock()
+		s.videoSettings.GOP = keyframeIntervalGOP(s.cfg.FrameRate, s.cfg.KeyframeInterval)
+		s.encMu.Unlock()
+		s.log.infof("Keyframe every %v: GOP of %d frames at %d fps", s.cfg.KeyframeInterval, s.videoSettings.GOP, s.cfg.FrameRate)
+	}
+	s.keyframes.setExpected(time.Duration(s.videoSettings.GOP) * s.cfg.frameInterval())
+	if s.cfg.FallbackImage != "" {
+		var err error
+		if s.fallbackImage, err = s.decodeFallbackImage(); err != nil {
+			return err
+		}
+	}
+	// Raw video is fed to the encoder frame by frame and its output read
+	// through a splice so SetEncoder can replace the process mid-session.
+	videoCmd, videoStdin, videoStdout, err := s.startVideoEncoder(s.EncoderConfig(), false, 0)
+	if err != nil {
+		return err
+	}
+	s.encMu.Lock()
+	s.videoCmd = videoCmd
+	s.videoExited = s.watchProcess("video", videoCmd)
+	s.encMu.Unlock()
+	var videoOut io.ReadCloser = videoStdout
+	if s.cfg.Warmup {
+		if videoOut, err = s.warmUpEncoder(videoStdin, videoStdout); err != nil {
+			videoStdin.Close()
+			videoStdout.Close()
+			return err
+		}
+	}
+	input := s.videoInput()
+	if pre != nil {
+		// The live input takes over when the pre-roll ends, at which point
+		// the switcher requests a keyframe.
+		s.switcher.startWith(pre)
+	}
+	s.videoFeed = newVideoFeeder(input, s.frameSize(), videoStdin)
+	s.videoOutput.input = s.videoFeed.frames.Load
+	s.videoOut = newSpliceReader(videoOut)
+	if s.videoQueue != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.videoQueue.run()
+		}()
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.videoFeed.run()
+	}()
+	if s.cfg.EncoderStallTimeout > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.watchEncoderOutput("Video", &s.videoOutput, s.videoFeed, s.recoverVideoEncoder)
+		}()
+	}
+	return nil
+}
+
+// startAudioEncoder starts the Opus encoder on the raw audio input, with
+// pre, if not nil, played first, and returns its Ogg output. As with
+// video, the input is fed to it chunk by chunk and its output read
+// through a splice, so a stalled encoder can be replaced.
+func (s *Streamer) startAudioEncoder(pre *prerollSource) (io.ReadCloser, error) {
+	audioParams := s.audioEncoderParams()
+	layout := "mono"
+	if audioParams.Channels == 2 {
+		layout = "stereo"
+	}
+	if audioParams.resamples() {
+		s.log.infof("[Audio] Resampling %d Hz %s input to %d Hz with %s", audioParams.SampleRate, layout, audioOutputRate, audioParams.Resampler)
+	} else {
+		s.log.infof("[Audio] Input is %s at %d Hz, encoding without resampling", layout, audioParams.SampleRate)
+	}
+	// 20 ms of input
+	chunk := s.cfg.AudioSampleFormat.chunkSize(s.cfg.AudioSampleRate, s.cfg.AudioChannels)
+	var audioIn io.Reader
+	audioIn, s.audioStartGate = s.startupGate(s.rawAudio, chunk, &s.audioDrops)
+	s.audioGate = newInputGate(audioIn, chunk, s.cfg.ReconnectInputPolicy == ReconnectInputDrop, s.ctx.Done()).
+		countAs(&s.audioDrops, DropReconnect).
+		keepLatest(unitsIn(s.cfg.ReconnectBuffer, 20*time.Millisecond))
+	audioIn = s.gapFillAudio(s.idleGate(s.audioGate, chunk, &s.audioDrops))
+	if pre != nil {
+		audioIn = &audioPreroll{pre: pre, live: audioIn, log: s.log}
+	}
+	cmd, stdin, stdout, err := s.startAudioProcess(audioParams)
+	if err != nil {
+		return nil, err
+	}
+	s.audioMu.Lock()
+	s.audioCmd = cmd
+	s.audioExited = s.watchProcess("audio", cmd)
+	s.audioMu.Unlock()
+	s.audioFeed = newVideoFeeder(audioIn, chunk, stdin)
+	s.audioOutput.input = s.audioFeed.frames.Load
+	s.audioOut = newSpliceReader(&oggPageReader{r: stdout})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.audioFeed.run()
+	}()
+	if s.cfg.EncoderStallTimeout > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.watchEncoderOutput("Audio", &s.audioOutput, s.audioFeed, s.recoverAudioEncoder)
+		}()
+	}
+	return s.audioOut, nil
+}
+
+// audioEncoderParams describes the audio encode of the session.
+func (s *Streamer) audioEncoderParams() audioEncoderParams {
+	return audioEncoderParams{
+		SampleRate:  s.cfg.AudioSampleRate,
+		Channels:    s.cfg.AudioChannels,
+		BitrateKbps: s.cfg.AudioBitrateKbps,
+		CBR:         s.cfg.AudioCBR,
+		Application: s.cfg.OpusApplication,
+		Filter:      s.cfg.AudioFilter,
+		Resampler:   s.cfg.AudioResampler,
+		Precision:   s.cfg.AudioResamplePrecision,
+		Format:      s.cfg.AudioSampleFormat,
+		PacketLoss:  s.cfg.AudioFECPacketLoss,
+		DTX:         s.cfg.AudioDTX,
+	}
+}
+
+// encodedVideoReader wraps an encoder's output with the output watch, the
+// optional checksum logging and the debug reader.
+func (s *Streamer) encodedVideoReader(r io.ReadCloser) io.ReadCloser {
+	r = s.videoOutput.reader(r)
+	if s.cfg.FrameChecksums {
+		c := NewNALChecksumReader(r, "Video")
+		c.SetLogger(s.cfg.Logger)
+		r = c
+	}
+	return s.debugReader(r, "Video")
+}
+
+// createTracks wraps the encoded video and Ogg/Opus streams in tracks,
+// leaving out the track of a nil stream.
+func (s *Streamer) createTracks(video, audio io.ReadCloser, videoFrameDuration time.Duration) error {
+	if video != nil {
+		s.stats.setPace(videoFrameDuration, s.cfg.DriftWarning)
+		var err error
+		s.videoTrack, s.videoProvider, err = s.newVideoTrack(video, s.VideoCodec(), videoFrameDuration)
+		if err != nil {
+			return fmt.Errorf("creating video track: %w", err)
+		}
+	}
+	if audio != nil {
+		if err := s.createAudioTrack(audio); err != nil {
+			return err
+		}
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.measureBitrate()
+	}()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.sampleRTPStats()
+	}()
+	return nil
+}
+
+// createAudioTrack wraps the Ogg/Opus stream in the audio track.
+func (s *Streamer) createAudioTrack(audio io.ReadCloser) error {
+	encrypt, err := s.frameEncryptor(webrtc.MimeTypeOpus)
+	if err != nil {
+		return fmt.Errorf("creating audio track: %w", err)
+	}
+	var skip func([]byte) bool
+	if s.cfg.AudioDTX {
+		skip = opusDTXFrame
+	}
+	// Create audio track with timing callback
+	s.audioTrack, s.audioProvider, err = newEncodedTrack(audio, webrtc.MimeTypeOpus, s.cfg.AudioCodecOverride,
+		newFrameStamper(s.cfg.ClockSource, s.clock, 20*time.Millisecond, s.clockOrigin), // 50fps = 20ms per frame
+		trackHooks{
+			onFrame:   s.onAudioFrame,
+			skipFrame: skip,
+			onError:   s.trackError,
+			onSample:  s.audioSample,
+			encrypt:   encrypt,
+			onDrop:    func(reason DropReason) { s.audioDrops.add(reason, 1) },
+			log:       s.log,
+			onBind: func() {
+				s.logNegotiatedCodec("Audio", s.audioTrack)
+				openStartupGate(s.audioStartGate, "Audio", "chunks", s.log)
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("creating audio track: %w", err)
+	}
+	return nil
+}
+
+// newVideoTrack creates a video track of codec mime from r, with the
+// frame timing and keyframe hooks.
+func (s *Streamer) newVideoTrack(r io.ReadCloser, mime string, frameDuration time.Duration) (*lksdk.LocalTrack, *encodedSampleProvider, error) {
+	var track *lksdk.LocalTrack
+	stamper := newFrameStamper(s.cfg.ClockSource, s.clock, frameDuration, s.clockOrigin)
+	stamper.captured = s.captureTimes
+	hooks := trackHooks{
+		onFrame:           s.onVideoFrame,
+		onKeyframe:        s.onVideoKeyframe,
+		onKeyframeRequest: s.RequestKeyframe,
+		onError:           s.trackError,
+		onSample:          s.videoSample,
+		onDrop:            func(reason DropReason) { s.videoDrops.add(reason, 1) },
+		log:               s.log,
+		onBind: func() {
+			s.logNegotiatedCodec("Video", track)
+			openStartupGate(s.videoStartGate, "Video", "frames", s.log)
+		},
+	}
+	if s.cfg.TimecodeSEI && mime == webrtc.MimeTypeH264 {
+		hooks.sei = (&timecodeSource{}).next
+	}
+	var err error
+	if hooks.encrypt, err = s.frameEncryptor(mime); err != nil {
+		return nil, nil, err
+	}
+	track, provider, err := newEncodedTrack(r, mime, s.cfg.VideoCodecOverride, stamper, hooks)
+	return track, provider, err
+}
+
+// sampleUsage samples the encoders' resource usage until shutdown.
+func (s *Streamer) sampleUsage() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.usage.run(s.ctx.Done(), s.cfg.UsageSampleInterval, s.videoPID, s.audioPID)
+	}()
+}
+
+// videoPID is the process ID of the current video encoder, or 0 with
+// DisableVideo.
+func (s *Streamer) videoPID() int {
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	if s.videoCmd == nil {
+		return 0
+	}
+	return s.videoCmd.Process.Pid
+}
+
+// audioPID is videoPID for the audio encoder.
+func (s *Streamer) audioPID() int {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+	if s.audioCmd == nil {
+		return 0
+	}
+	return s.audioCmd.Process.Pid
+}
+
+// videoInput wraps the raw video pipe with the source switcher and the
+// optional input stages.
+func (s *Streamer) videoInput() io.Reader {
+	unit := s.frameSize()
+	if s.cfg.FrameHeaders {
+		unit += FrameHeaderSize
+	}
+	var raw io.Reader = s.rawVideo
+	if s.cfg.CheckFrameAlignment {
+		raw = newAlignmentChecker(raw, unit, s.cfg.frameInterval()/2, s.log)
+	}
+	raw, s.videoStartGate = s.startupGate(raw, unit, &s.videoDrops)
+	s.videoGate = newInputGate(raw, unit, s.cfg.ReconnectInputPolicy == ReconnectInputDrop, s.ctx.Done()).
+		countAs(&s.videoDrops, DropReconnect).
+		keepLatest(unitsIn(s.cfg.ReconnectBuffer, s.cfg.frameInterval()))
+	r := s.idleGate(s.videoGate, unit, &s.videoDrops)
+	if s.cfg.FrameHeaders {
+		h := newFrameHeaderReader(r, s.frameSize(), s.log)
+		h.onAnomaly = s.inputSeqAnomaly
+		s.captureTimes = h.captured
+		r = h
+	}
+	s.liveVideo = r
+	s.switcher = newSourceSwitcher(r, s.frameSize(), s.onSourceSwitch, s.log)
+	r = s.switcher
+	if s.fallbackImage != nil {
+		r = newFallbackReader(r, s.frameSize(), s.fallbackImage, s.cfg.FallbackAfter, s.cfg.frameInterval(), s.videoPaused, s.fallbackChanged)
+	}
+	r = s.gapFillVideo(r)
+	if s.cfg.LimitInputRate {
+		r = newFrameRateLimiter(r, s.frameSize(), s.cfg.frameInterval())
+	}
+	if s.cfg.FrameChecksums {
+		c := NewRawChecksumReader(r, "Video", s.frameSize())
+		c.SetLogger(s.cfg.Logger)
+		r = c
+	}
+	if s.cfg.EncoderBacklog > 0 {
+		s.videoQueue = newFrameQueue(r, s.frameSize(), s.cfg.EncoderBacklog, func() {
+			s.videoDrops.add(DropEncoderBacklog, 1)
+		})
+		r = s.videoQueue
+	}
+	return r
+}
+
+// debugReader wraps r in a DebugReader that logs reads when
+// Config.LogSampling has a LogReads entry.
+func (s *Streamer) debugReader(r io.ReadCloser, name string) *DebugReader {
+	d := NewDebugReader(r, name)
+	d.SetLogger(s.cfg.Logger)
+	d.SetContext(s.readCtx)
+	if sampling, ok := s.cfg.LogSampling[LogReads]; ok {
+		d.SetSampling(sampling)
+	}
+	return d
+}
+
+// frameSize is the size in bytes of one raw input frame.
+func (s *Streamer) frameSize() int {
+	return s.cfg.PixelFormat.frameSize(int(s.frameWidth), int(s.frameHeight))
+}
+
+func (s *Streamer) publish() error {
+	if err := s.publishAudio(); err != nil {
+		return err
+	}
+	if err := s.publishVideo(); err != nil {
+		return err
+	}
+	s.logICETransport()
+	return nil
+}
+
+// publishAudio publishes the audio track, if there is one, as does
+// publishVideo the video track.
+func (s *Streamer) publishAudio() error {
+	if s.audioTrack == nil {
+		return nil
+	}
+	if s.cfg.Sink != nil {
+		s.publishToSink(AudioTrackName, s.audioProvider, &s.sinkAudio)
+		return nil
+	}
+	var err error
+	if s.audioPub, err = s.room.LocalParticipant.PublishTrack(s.audioTrack, &lksdk.TrackPublicationOptions{
+		Name:       AudioTrackName,
+		Source:     s.cfg.AudioSource,
+		Stereo:     s.cfg.AudioChannels == 2,
+		Encryption: s.cfg.encryption(),
+	}); err != nil {
+		return fmt.Errorf("%w: audio: %w", ErrPublishFailed, err)
+	}
+	s.emit(EventPublished, map[string]any{"track": s.audioPub.Name(), "sid": s.audioPub.SID()})
+	return nil
+}
+
+func (s *Streamer) publishVideo() error {
+	if s.videoTrack == nil {
+		return nil
+	}
+	if s.cfg.Sink != nil {
+		s.publishToSink(VideoTrackName, s.videoProvider, &s.sinkVideo)
+		return nil
+	}
+	width, height := s.VideoSize()
+	pub, err := s.room.LocalParticipant.PublishTrack(s.videoTrack, &lksdk.TrackPublicationOptions{
+		Name:        VideoTrackName,
+		Source:      s.cfg.VideoSource,
+		VideoWidth:  int(width),
+		VideoHeight: int(height),
+		Encryption:  s.cfg.encryption(),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: video: %w", ErrPublishFailed, err)
+	}
+	s.encMu.Lock()
+	s.videoPub = pub
+	s.encMu.Unlock()
+	s.emit(EventPublished, map[string]any{"track": pub.Name(), "sid": pub.SID()})
+	return nil
+}
+
+// watchProcess reports an encoder that exits while the session is still
+// running. The returned channel is closed once the process has been reaped.
+func (s *Streamer) watchProcess(name string, cmd *exec.Cmd) chan struct{} {
+	exited := make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := cmd.Wait()
+		if _, ok := s.encoderSlots.LoadAndDelete(cmd); ok {
+			encoderSlots.release()
+		}
+		close(exited)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if _, ok := s.retired.Load(cmd); ok {
+			s.log.infof("Previous %s encoder exited", name)
+			return
+		}
+		if err == nil {
+			err = errors.New("exited unexpectedly")
+		}
+		if tail, ok := cmd.Stderr.(*stderrTail); ok {
+			if last := tail.String(); last != "" {
+				err = fmt.Errorf("%w; stderr: %s", err, last)
+			}
+		}
+		s.reportError(fmt.Errorf("%w: %s ffmpeg: %w", ErrEncoderExited, name, err), true)
+	}()
+	return exited
+}
+
+// reportError passes err to Config.OnError and delivers it on the error
+// channel without blocking the pipeline. fatal errors leave the stream
+// unable to continue; the rest are worth logging but need no action.
+func (s *Streamer) reportError(err error, fatal bool) {
+	if fatal {
+		s.failOnce.Do(func() {
+			s.failure = err
+			close(s.failed)
+		})
+	}
+	s.emit(EventError, map[string]any{"error": err.Error(), "fatal": fatal})
+	if s.cfg.OnError != nil {
+		s.cfg.OnError(err, fatal)
+	}
+	select {
+	case s.errs <- err:
+	default:
+		s.log.errorf("Dropping streamer error, channel full: %v", err)
+	}
+}
+
+// trackError reports a track failure unless the streamer is stopping. A
+// track that cannot write is not published, so it is fatal.
+func (s *Streamer) trackError(err error) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.reportError(err, true)
+}
+
+// shutdown releases everything start acquired.
+func (s *Streamer) shutdown() {
+	s.shutdownOnce.Do(s.release)
+}
+
+// release tears the pipeline down from the input side so that nothing
+// writes into a pipe whose reader has gone. Closing the raw inputs gives
+// the encoders EOF on stdin; they are then asked to exit and reaped while
+// the tracks are still draining their stdout, since a track that stopped
+// reading first is what makes ffmpeg fail with "Broken pipe". Only then
+// are the tracks unpublished, the room left and the FIFOs removed.
+func (s *Streamer) release() {
+	s.teardown.set("stopping health server")
+	s.stopHealthServer()
+	s.teardown.set("closing inputs")
+	if s.socket != nil {
+		s.socket.Close()
+	}
+	s.encMu.Lock()
+	rawVideo := s.rawVideo
+	s.encMu.Unlock()
+	if rawVideo != nil {
+		rawVideo.Close()
+	}
+	if s.rawAudio != nil {
+		s.rawAudio.Close()
+	}
+
+	s.encMu.Lock()
+	videoCmd, videoExited := s.videoCmd, s.videoExited
+	s.encMu.Unlock()
+	s.audioMu.Lock()
+	audioCmd, audioExited := s.audioCmd, s.audioExited
+	s.audioMu.Unlock()
+
+	s.teardown.set("stopping encoders")
+	var wg sync.WaitGroup
+	for _, enc := range []struct {
+		cmd    *exec.Cmd
+		exited chan struct{}
+	}{{videoCmd, videoExited}, {audioCmd, audioExited}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopEncoder(enc.cmd, enc.exited, s.cfg.EncoderStopTimeout)
+		}()
+	}
+	wg.Wait()
+	// A track still blocked reading what the encoders left, on a pipe some
+	// process they started holds open, stops now instead.
+	if s.stopReads != nil {
+		s.stopReads()
+	}
+
+	if s.room != nil {
+		s.teardown.set("unpublishing tracks")
+		s.encMu.Lock()
+		videoPub := s.videoPub
+		s.encMu.Unlock()
+		for _, pub := range []*lksdk.LocalTrackPublication{videoPub, s.audioPub} {
+			if pub != nil {
+				s.room.LocalParticipant.UnpublishTrack(pub.SID())
+			}
+		}
+		s.teardown.set("disconnecting from room")
+		s.room.Disconnect()
+	}
+
+	for _, path := range s.createdFIFOs {
+		os.Remove(path)
+	}
+}
+
+// stopEncoder sends cmd SIGTERM and waits for exited, killing the process
+// if it does not exit within timeout.
+func stopEncoder(cmd *exec.Cmd, exited chan struct{}, timeout time.Duration) {
+	if cmd == nil || cmd.Process == nil || exited == nil {
+		return
+	}
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// LastKeyframeAgo reports how long ago the encoder produced its last IDR
+// frame, or zero if it has not produced one yet.
+func (s *Streamer) LastKeyframeAgo() time.Duration {
+	return s.keyframes.lastKeyframeAgo()
+}
+
+// RequestKeyframe asks for a video keyframe, for example after the caller
+// has reconnected. Requests within Config.KeyframeDebounce of each other or
+// of a GOP keyframe are coalesced, and the rest left to the next GOP
+// keyframe unless Config.ForceKeyframes is set.
+func (s *Streamer) RequestKeyframe(reason string) {
+	outcome := s.keyframeRequests.request(reason)
+	s.emit(EventKeyframeRequested, map[string]any{"reason": reason, "outcome": outcome})
+}
+
+func (s *Streamer) onVideoKeyframe() {
+	s.keyframes.keyframe(time.Now())
+}
+
+func (s *Streamer) onVideoFrame(info FrameInfo) {
+	now := time.Now()
+	if since, overdue := s.keyframes.frame(now); overdue {
+		s.emit(EventKeyframeOverdue, map[string]any{"since_last_keyframe": since.String()})
+		s.reportError(fmt.Errorf("no video keyframe for %v", since.Round(time.Millisecond)), false)
+	}
+	if drift, behind := s.stats.videoFrame(now); behind {
+		s.log.warnf("[Video] Video is %v behind real time; the encoder is not sustaining the frame rate", drift.Round(time.Millisecond))
+		s.emit(EventVideoBehind, map[string]any{"drift": drift.String()})
+	}
+	if s.cfg.OnVideoFrame != nil {
+		s.cfg.OnVideoFrame(info)
+	}
+}
+
+func (s *Streamer) videoSample(size int) {
+	s.videoBitrate.add(size)
+	s.stats.videoSample(size)
+}
+
+func (s *Streamer) audioSample(size int) {
+	s.audioBitrate.add(size)
+	s.stats.audioSample(size)
+}
+
+func (s *Streamer) onAudioFrame(info FrameInfo) {
+	s.stats.audioFrame(time.Now())
+	if s.cfg.OnAudioFrame != nil {
+		s.cfg.OnAudioFrame(info)
+	}
+}
+
+// runShutdownHooks hands the final stats to the configured hooks. Failures
+// are logged, since the session is already over.
+func (s *Streamer) runShutdownHooks() {
+	st := s.Snapshot()
+	if s.cfg.OnShutdown != nil {
+		if err := s.cfg.OnShutdown(st); err != nil {
+			s.log.errorf("Shutdown hook failed: %v", err)
+		}
+	}
+	if s.cfg.StatsWebhookURL != "" {
+		if err := NewStatsWebhook(s.cfg.StatsWebhookURL, 5*time.Second)(st); err != nil {
+			s.log.errorf("Stats webhook failed: %v", err)
+		}
+	}
+	if s.cfg.StatsPath != "" {
+		if err := NewStatsFile(s.cfg.StatsPath)(st); err != nil {
+			s.log.errorf("Writing final stats failed: %v", err)
+		}
+	}
+}
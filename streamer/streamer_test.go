@@ -0,0 +1,96 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReleaseWithoutBrokenPipe(t *testing.T) {
+	s := New(Config{})
+	s.ctx, s.cancel = context.WithCancel(t.Context())
+	// The producer keeps its ends of the pipes open, so the encoders see
+	// no EOF and are stopped with SIGTERM, flushing as they exit.
+	videoIn, videoProducer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer videoProducer.Close()
+	audioIn, audioProducer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audioProducer.Close()
+	s.rawVideo, s.rawAudio = videoIn, audioIn
+
+	s.videoCmd = videoEncoderCommand(videoEncoderParams{
+		Width: 64, Height: 48, PixelFormat: PixelFormatYUV420P, Encoder: SoftwareVideoEncoder, Settings: defaultVideoSettings,
+	})
+	s.audioCmd = audioEncoderCommand(audioEncoderParams{BitrateKbps: 32, Application: OpusVoIP})
+	var stderr syncBuffer
+	s.videoCmd.Stdin, s.videoCmd.Stderr = videoIn, &stderr
+	s.audioCmd.Stdin, s.audioCmd.Stderr = audioIn, &stderr
+	// The track drains the encoder's output until it ends.
+	videoOut, err := s.videoCmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.audioCmd.StdoutPipe(); err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan []byte, 1)
+	go func() {
+		out, _ := io.ReadAll(videoOut)
+		drained <- out
+	}()
+	if err := s.videoCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s.videoExited = s.watchProcess("video", s.videoCmd)
+	if err := s.audioCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s.audioExited = s.watchProcess("audio", s.audioCmd)
+	if _, err := videoProducer.Write(make([]byte, PixelFormatYUV420P.frameSize(64, 48)*3)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	s.cancel()
+	s.shutdown()
+	s.wg.Wait()
+	// The encoder was stopped while its output was still read, so what it
+	// flushed on the way out reached the track.
+	if out := <-drained; !bytes.HasSuffix(out, fakeEndOfStream) {
+		t.Errorf("encoder output % x does not end with its flush", out)
+	}
+	if s.videoCmd.ProcessState == nil {
+		t.Error("release returned before the video encoder exited")
+	}
+	if strings.Contains(stderr.String(), "Broken pipe") {
+		t.Errorf("encoder stderr after release: %s", stderr.String())
+	}
+}
@@ -0,0 +1,90 @@
+package streamer
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// awaitFirstFrames waits, for up to Config.SyncStartTimeout, until both
+// encoders have produced a frame, so that the tracks are published
+// together on media that is already there instead of the audio track
+// opening behind the video by however much later its encoder got going.
+// With a single track there is nothing to line up.
+func (s *Streamer) awaitFirstFrames() error {
+	if s.cfg.SyncStartTimeout == 0 || s.videoProvider == nil || s.audioProvider == nil {
+		return nil
+	}
+	start := time.Now()
+	tracks := []struct {
+		kind  string
+		ready <-chan struct{}
+	}{
+		{"video", s.videoProvider.readAhead(&s.wg)},
+		{"audio", s.audioProvider.readAhead(&s.wg)},
+	}
+	timeout := time.NewTimer(s.cfg.SyncStartTimeout)
+	defer timeout.Stop()
+	for i, t := range tracks {
+		select {
+		case <-t.ready:
+		case <-timeout.C:
+			var missing []string
+			for _, t := range tracks[i:] {
+				select {
+				case <-t.ready:
+				default:
+					missing = append(missing, t.kind)
+				}
+			}
+			s.log.warnf("No first %s frame within %v, publishing without waiting for it",
+				strings.Join(missing, " or "), s.cfg.SyncStartTimeout)
+			return nil
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+	s.log.infof("First video and audio frames ready after %v, publishing both", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// readUnit is one result of encodedSampleProvider.next.
+type readUnit struct {
+	data    []byte
+	isFrame bool
+	err     error
+}
+
+// readAhead reads the stream up to and including its first frame in the
+// background, and closes the returned channel once that frame is in or
+// the stream has ended. What it read is returned by the next calls to
+// next, so nothing is lost; the writer of a track published meanwhile
+// waits for it.
+func (p *encodedSampleProvider) readAhead(wg *sync.WaitGroup) <-chan struct{} {
+	ready := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ready)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		var held []readUnit
+		for {
+			data, isFrame, err := p.next()
+			held = append(held, readUnit{data, isFrame, err})
+			if isFrame || err != nil {
+				break
+			}
+		}
+		next := p.next
+		p.next = func() ([]byte, bool, error) {
+			if len(held) == 0 {
+				return next()
+			}
+			u := held[0]
+			held = held[1:]
+			return u.data, u.isFrame, u.err
+		}
+	}()
+	return ready
+}
@@ -0,0 +1,129 @@
+package streamer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// TestPatternConfig describes the video NewTestPattern generates.
+type TestPatternConfig struct {
+	// Width and Height are the frame size, both even.
+	Width, Height int
+	// Frames is how many frames are generated before the reader returns
+	// io.EOF, which ends the input as a producer closing its pipe does.
+	// Zero generates them until the reader is closed.
+	Frames int
+	// FrameRate paces the frames at that rate, as a producer writing in
+	// real time does. Zero hands them out as fast as they are read, which
+	// the encoder then sets the pace of.
+	FrameRate int
+	// NoHeader leaves out the width/height header, for
+	// Config.DimensionsFromConfig or SwitchVideoSource.
+	NoHeader bool
+}
+
+// NewTestPattern returns a producer of yuv420p video for Config.VideoInput,
+// so a test or an integration can run the encode and publish path without
+// a camera or a producer process: the width/height header the video pipe
+// starts with, then frames of a colour gradient that scrolls a little with
+// each frame. The frames are the same on every run. Paired with a NullSink
+// it checks what flows through; a session of
+// TestPatternConfig{Width: 640, Height: 360, Frames: 50, FrameRate: 25}
+// with DisableAudio should leave NullSink.Counts(VideoTrackName).Frames at
+// 50 once stopped, give or take a frame still in the encoder.
+//
+// The header is the plain one, without Config.FrameRateFromHeader or
+// Config.PixelFormatFromHeader. A session still encodes with ffmpeg; to
+// leave it out too, copy a pattern with NoHeader into a Harness.
+func NewTestPattern(cfg TestPatternConfig) (io.ReadCloser, error) {
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width%2 != 0 || cfg.Height%2 != 0 {
+		return nil, fmt.Errorf("%w: test pattern size %dx%d must be positive and even", ErrInvalidConfig, cfg.Width, cfg.Height)
+	}
+	if cfg.Frames < 0 || cfg.FrameRate < 0 {
+		return nil, fmt.Errorf("%w: test pattern frames %d and frame rate %d must not be negative", ErrInvalidConfig, cfg.Frames, cfg.FrameRate)
+	}
+	p := &testPattern{cfg: cfg, frame: make([]byte, PixelFormatYUV420P.frameSize(cfg.Width, cfg.Height))}
+	if !cfg.NoHeader {
+		p.header = VideoHeader{Width: uint32(cfg.Width), Height: uint32(cfg.Height)}.encode(headerFields{})
+	}
+	p.frames = patternFrames{p}
+	if cfg.FrameRate > 0 {
+		p.frames = newFrameRateLimiter(p.frames, len(p.frame), time.Second/time.Duration(cfg.FrameRate))
+	}
+	return p, nil
+}
+
+// testPattern is NewTestPattern's reader.
+type testPattern struct {
+	cfg    TestPatternConfig
+	header []byte    // the unread rest of the header
+	frames io.Reader // the frames, paced or not
+	frame  []byte
+	cur    []byte // the unread rest of frame
+	n      int    // frames drawn
+	closed atomic.Bool
+}
+
+func (p *testPattern) Read(b []byte) (int, error) {
+	if len(p.header) > 0 {
+		n := copy(b, p.header)
+		p.header = p.header[n:]
+		return n, nil
+	}
+	return p.frames.Read(b)
+}
+
+// readFrames reads the frames, drawing each as it is reached.
+func (p *testPattern) readFrames(b []byte) (int, error) {
+	if p.closed.Load() {
+		return 0, os.ErrClosed
+	}
+	if len(p.cur) == 0 {
+		if p.cfg.Frames > 0 && p.n == p.cfg.Frames {
+			return 0, io.EOF
+		}
+		p.draw()
+		p.cur = p.frame
+	}
+	n := copy(b, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
+
+// draw fills frame with the next frame: luma rising left to right and
+// chroma top to bottom, both shifted by the frame number.
+func (p *testPattern) draw() {
+	w, h := p.cfg.Width, p.cfg.Height
+	shift := 4 * p.n
+	y := p.frame[:w*h]
+	for row := range h {
+		for col := range w {
+			y[row*w+col] = byte(col*256/w + shift)
+		}
+	}
+	cw, ch := w/2, h/2
+	u, v := p.frame[w*h:w*h+cw*ch], p.frame[w*h+cw*ch:]
+	for row := range ch {
+		for col := range cw {
+			u[row*cw+col] = byte(row*256/ch + shift)
+			v[row*cw+col] = byte(255 - col*256/cw - shift)
+		}
+	}
+	p.n++
+}
+
+// Close ends the pattern; later reads fail.
+func (p *testPattern) Close() error {
+	p.closed.Store(true)
+	return nil
+}
+
+// patternFrames reads a testPattern's frames for the rate limiter.
+type patternFrames struct{ p *testPattern }
+
+func (f patternFrames) Read(b []byte) (int, error) {
+	return f.p.readFrames(b)
+}
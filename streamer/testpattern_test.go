@@ -0,0 +1,60 @@
+package streamer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTestPattern(t *testing.T) {
+	cfg := TestPatternConfig{Width: 16, Height: 8, Frames: 3}
+	read := func() []byte {
+		r, err := NewTestPattern(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	data := read()
+	header := VideoHeader{Width: 16, Height: 8}.encode(headerFields{})
+	frameSize := PixelFormatYUV420P.frameSize(16, 8)
+	if !bytes.HasPrefix(data, header) || len(data) != len(header)+3*frameSize {
+		t.Fatalf("read %d bytes, want the header and 3 frames of %d", len(data), frameSize)
+	}
+	frames := data[len(header):]
+	if bytes.Equal(frames[:frameSize], frames[frameSize:2*frameSize]) {
+		t.Error("the first two frames are the same")
+	}
+	if !bytes.Equal(read(), data) {
+		t.Error("a second pattern of the same config differs")
+	}
+
+	for _, bad := range []TestPatternConfig{{Width: 15, Height: 8}, {Width: 16}, {Width: 16, Height: 8, Frames: -1}} {
+		if _, err := NewTestPattern(bad); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("NewTestPattern(%+v) = %v, want ErrInvalidConfig", bad, err)
+		}
+	}
+}
+
+func TestTestPatternSession(t *testing.T) {
+	// 25 frames at 50 fps, half a second of video, reach the sink in
+	// about that long after the header.
+	start := time.Now()
+	ts := startTestSession(t, Config{}, TestPatternConfig{Width: 64, Height: 48, Frames: 25, FrameRate: 50})
+	ts.waitFrames(t, VideoTrackName, 24)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("24 frames after %v, want the pattern's pace of about 480ms", elapsed)
+	}
+	ts.Stop()
+	// The last frame may still have been in the encoder.
+	if n := ts.sink.Counts(VideoTrackName).Frames; n != 24 && n != 25 {
+		t.Errorf("sink got %d frames, want 25, give or take one", n)
+	}
+}
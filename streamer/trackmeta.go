@@ -0,0 +1,85 @@
+package streamer
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+)
+
+// Track names of the publications, as clients see them.
+const (
+	VideoTrackName = "video"
+	AudioTrackName = "audio"
+)
+
+// TrackMetadataAttribute is the participant attribute carrying the
+// metadata of the track named track. LiveKit tracks have no metadata of
+// their own, so Config.VideoTrackMetadata, Config.AudioTrackMetadata and
+// SetTrackMetadata publish it as attributes of the streamer's participant,
+// which clients read alongside its track publications and are notified of
+// when they change. The attribute follows the track name, so it survives
+// ReplaceVideoTrack.
+func TrackMetadataAttribute(track string) string {
+	return "track_metadata." + track
+}
+
+// joinAttributes returns the participant attributes to join with: the
+// configured ones plus the track metadata and alpha packing.
+func (c *Config) joinAttributes() map[string]string {
+	if c.VideoTrackMetadata == "" && c.AudioTrackMetadata == "" && c.AlphaPacking == AlphaPackingOff {
+		return c.ParticipantAttributes
+	}
+	attrs := maps.Clone(c.ParticipantAttributes)
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	if c.VideoTrackMetadata != "" {
+		attrs[TrackMetadataAttribute(VideoTrackName)] = c.VideoTrackMetadata
+	}
+	if c.AudioTrackMetadata != "" {
+		attrs[TrackMetadataAttribute(AudioTrackName)] = c.AudioTrackMetadata
+	}
+	if c.AlphaPacking != AlphaPackingOff {
+		attrs[AlphaPackingAttribute] = string(c.AlphaPacking)
+	}
+	return attrs
+}
+
+// publisherToken mints the streamer's own token. It is what the SDK would
+// mint from the same ConnectInfo, plus the canUpdateOwnMetadata grant that
+// SetTrackMetadata needs.
+func publisherToken(cfg Config) (string, error) {
+	canUpdate := true
+	token, err := auth.NewAccessToken(cfg.APIKey, cfg.APISecret).
+		SetIdentity(cfg.Identity).
+		SetName(cfg.ParticipantName).
+		SetMetadata(cfg.ParticipantMetadata).
+		SetAttributes(cfg.joinAttributes()).
+		SetValidFor(24 * time.Hour).
+		SetVideoGrant(&auth.VideoGrant{
+			RoomJoin:             true,
+			Room:                 cfg.RoomName,
+			CanUpdateOwnMetadata: &canUpdate,
+		}).
+		ToJWT()
+	if err != nil {
+		return "", fmt.Errorf("creating publisher token: %w", err)
+	}
+	return token, nil
+}
+
+// SetTrackMetadata replaces the metadata of the video or audio track,
+// named VideoTrackName or AudioTrackName; empty metadata removes it. The
+// update is sent to the server without waiting for it to be applied.
+func (s *Streamer) SetTrackMetadata(track, metadata string) error {
+	if s.room == nil {
+		return fmt.Errorf("%w: not connected", ErrNotRunning)
+	}
+	if track != VideoTrackName && track != AudioTrackName {
+		return fmt.Errorf("unknown track %q (want %s or %s)", track, VideoTrackName, AudioTrackName)
+	}
+	s.room.LocalParticipant.SetAttributes(map[string]string{TrackMetadataAttribute(track): metadata})
+	return nil
+}
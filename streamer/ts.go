@@ -0,0 +1,189 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// DefaultTSFrameRate is the frame rate assumed for TS video when
+// Config.TSFrameRate is zero.
+const DefaultTSFrameRate = 25
+
+// tsDemuxCommand builds the ffmpeg process that splits an MPEG-TS input
+// into H264 Annex-B on stdout and Ogg/Opus on fd 3. The video is copied
+// as-is; only the audio is transcoded, since AAC cannot be sent over
+// WebRTC.
+func tsDemuxCommand(input string, audio audioEncoderParams) *exec.Cmd {
+	args := []string{
+		"-fflags", "nobuffer",
+		"-i", input,
+		"-map", "0:v:0",
+		"-c:v", "copy",
+		"-bsf:v", "h264_mp4toannexb",
+		"-f", "h264",
+		"pipe:1",
+		"-map", "0:a:0",
+	}
+	if audio.Filter != "" {
+		args = append(args, "-af", audio.Filter)
+	}
+	args = append(args,
+		"-c:a", AudioEncoder,
+		"-ar", "48000")
+	args = append(args, opusArgs(audio)...)
+	args = append(args,
+		"-page_duration", "20000",
+		"-f", "ogg",
+		"pipe:3")
+	return encoderCommand(args...)
+}
+
+// startTS publishes the MPEG-TS input named by Config.TSInput. The TS must
+// carry H264 video, which is forwarded without re-encoding; its first audio
+// stream may be in any codec ffmpeg decodes (AAC, MP2, AC-3, ...) and is
+// transcoded to Opus. The pipes, header and raw video encoder are unused.
+func (s *Streamer) startTS() error {
+	if err := s.validateTS(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if err := checkFFmpeg(); err != nil {
+		return err
+	}
+	if s.cfg.AutoDetectInput {
+		if err := s.autoDetectTS(); err != nil {
+			return err
+		}
+	}
+	if s.cfg.TSFrameRate == 0 {
+		s.cfg.TSFrameRate = DefaultTSFrameRate
+	}
+	var err error
+	if s.clock, err = newClock(s.cfg.ClockSource, s.cfg.NTPServer); err != nil {
+		return err
+	}
+	s.clockOrigin = s.clock.Now()
+	s.startup.set(StartupConnecting)
+	if err := s.connect(); err != nil {
+		return err
+	}
+	if err := s.checkRoomCodecs(true); err != nil {
+		return err
+	}
+	s.startup.set(StartupStartingEncoders)
+
+	s.videoCmd = tsDemuxCommand(s.cfg.TSInput, audioEncoderParams{
+		BitrateKbps: s.cfg.AudioBitrateKbps,
+		CBR:         s.cfg.AudioCBR,
+		Application: s.cfg.OpusApplication,
+		Filter:      s.cfg.AudioFilter,
+		PacketLoss:  s.cfg.AudioFECPacketLoss,
+		DTX:         s.cfg.AudioDTX,
+	})
+	videoPipe, err := s.videoCmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("creating TS video output: %w", err)
+	}
+	audioPipe, audioWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating TS audio output: %w", err)
+	}
+	s.videoCmd.ExtraFiles = []*os.File{audioWriter}
+
+	if err := s.videoCmd.Start(); err != nil {
+		audioPipe.Close()
+		audioWriter.Close()
+		return fmt.Errorf("starting TS ffmpeg: %w", err)
+	}
+	// The child holds its own copy; closing ours lets the reader see EOF.
+	audioWriter.Close()
+	if err := s.prioritize(s.videoCmd, "TS"); err != nil {
+		audioPipe.Close()
+		return err
+	}
+	s.videoExited = s.watchProcess("TS", s.videoCmd)
+	s.log.infof("Demuxing MPEG-TS from %s", s.cfg.TSInput)
+
+	frameDuration := time.Duration(float64(time.Second) / s.cfg.TSFrameRate)
+	if err := s.createTracks(s.debugReader(videoPipe, "Video"), s.debugReader(audioPipe, "Audio"), frameDuration); err != nil {
+		audioPipe.Close()
+		return err
+	}
+	return s.publishStaggered()
+}
+
+// validateTS checks the MPEG-TS input settings before anything is started.
+func (s *Streamer) validateTS() error {
+	if strings.HasPrefix(s.cfg.TSInput, "-") {
+		return fmt.Errorf("TS input %q looks like a command-line flag", s.cfg.TSInput)
+	}
+	if s.cfg.PreRoll != "" {
+		return fmt.Errorf("pre-roll %s needs raw input; TS input is not re-encoded", s.cfg.PreRoll)
+	}
+	if s.cfg.DisableVideo || s.cfg.DisableAudio {
+		return errors.New("streaming a single track needs raw input; TS input is demuxed into both")
+	}
+	if s.cfg.AlphaPacking != AlphaPackingOff {
+		return fmt.Errorf("alpha packing %s needs raw input; TS input is not re-encoded", s.cfg.AlphaPacking)
+	}
+	if s.cfg.VideoCodec != VideoCodecH264 {
+		return fmt.Errorf("video codec %s needs raw input; TS input is published as H264", s.cfg.VideoCodec)
+	}
+	if s.cfg.OutputWidth != 0 || s.cfg.OutputHeight != 0 {
+		return errors.New("an output size needs raw input; TS input is not re-encoded")
+	}
+	if s.cfg.ForceKeyframes {
+		return errors.New("forced keyframes need raw input; TS input is not re-encoded")
+	}
+	if s.cfg.FrameRateFromHeader || s.cfg.PixelFormatFromHeader {
+		return errors.New("FrameRateFromHeader and PixelFormatFromHeader need raw input; TS input has no video header")
+	}
+	if s.cfg.GapFill != GapFillOff {
+		return fmt.Errorf("gap fill %s needs raw input; TS input is not re-encoded", s.cfg.GapFill)
+	}
+	if s.cfg.EncoderBacklog != 0 {
+		return errors.New("an encoder backlog needs raw input; TS input is not re-encoded")
+	}
+	if s.cfg.VideoInput != nil || s.cfg.AudioInput != nil {
+		return errors.New("VideoInput and AudioInput are raw input; TS input is read by ffmpeg")
+	}
+	if s.cfg.StartupInputPolicy == StartupInputDrop {
+		return errors.New("startup input drop needs raw input; TS input is read by ffmpeg")
+	}
+	if s.cfg.decodes() {
+		return errors.New("decoding subscribed tracks needs subscribe-only mode")
+	}
+	if s.cfg.e2ee() {
+		return fmt.Errorf("end-to-end encryption needs raw input to encode %s; TS input is not re-encoded", webrtc.MimeTypeVP8)
+	}
+	if s.cfg.FallbackImage != "" {
+		return fmt.Errorf("fallback image %s needs raw input; TS input is not re-encoded", s.cfg.FallbackImage)
+	}
+	if s.cfg.TSFrameRate < 0 {
+		return fmt.Errorf("TS frame rate %v must be positive", s.cfg.TSFrameRate)
+	}
+	if err := validateAudioBitrate(s.cfg.AudioBitrateKbps); err != nil {
+		return err
+	}
+	if err := s.cfg.OpusApplication.validate(); err != nil {
+		return err
+	}
+	if err := validateAudioFEC(s.cfg.AudioFECPacketLoss, s.cfg.OpusApplication); err != nil {
+		return err
+	}
+	if err := validateFilter("audio", s.cfg.AudioFilter); err != nil {
+		return err
+	}
+	if err := s.cfg.VideoCodecOverride.validate(webrtc.MimeTypeH264); err != nil {
+		return err
+	}
+	if err := s.cfg.AudioCodecOverride.validate(webrtc.MimeTypeOpus); err != nil {
+		return err
+	}
+	return nil
+}
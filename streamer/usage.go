@@ -0,0 +1,147 @@
+package streamer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultUsageSampleInterval is how often the encoders' CPU and GPU usage
+// is sampled when Config.UsageSampleInterval is zero.
+const DefaultUsageSampleInterval = 5 * time.Second
+
+// clockTicks is USER_HZ, the unit of utime/stime in /proc/<pid>/stat. It is
+// 100 on every Linux architecture we deploy to.
+const clockTicks = 100
+
+// processUsage is the utilisation of one encoder over the last sample
+// interval. CPU is a percentage of one core, so a process using two full
+// cores reports 200.
+type processUsage struct {
+	CPUPercent   float64
+	GPUPercent   float64
+	NVENCPercent float64
+	GPUSampled   bool
+}
+
+// gpuProcessUsage is one process's share of the GPU's streaming
+// multiprocessors and of its NVENC engine, in percent.
+type gpuProcessUsage struct {
+	SM      float64
+	Encoder float64
+}
+
+// usageSampler periodically samples the CPU time of the ffmpeg children via
+// /proc and, when built with the nvml tag, their GPU utilisation.
+type usageSampler struct {
+	mu    sync.Mutex
+	video processUsage
+	audio processUsage
+}
+
+func newUsageSampler() *usageSampler {
+	return &usageSampler{}
+}
+
+// run samples the two encoders every interval until done is closed. Either
+// encoder may be replaced mid-session, so the PIDs are looked up on every
+// sample.
+func (u *usageSampler) run(done <-chan struct{}, interval time.Duration, videoPID, audioPID func() int) {
+	video := &cpuTracker{pid: videoPID()}
+	audio := &cpuTracker{pid: audioPID()}
+	video.sample(time.Now())
+	audio.sample(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if pid := videoPID(); pid != video.pid {
+				video = &cpuTracker{pid: pid}
+			}
+			if pid := audioPID(); pid != audio.pid {
+				audio = &cpuTracker{pid: pid}
+			}
+			v := processUsage{CPUPercent: video.sample(now)}
+			a := processUsage{CPUPercent: audio.sample(now)}
+			if gpu, ok := gpuUsage(video.pid); ok {
+				v.GPUPercent, v.NVENCPercent, v.GPUSampled = gpu.SM, gpu.Encoder, true
+			}
+
+			u.mu.Lock()
+			u.video, u.audio = v, a
+			u.mu.Unlock()
+		}
+	}
+}
+
+func (u *usageSampler) fill(st *Stats) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	st.VideoEncoderCPUPercent = u.video.CPUPercent
+	st.AudioEncoderCPUPercent = u.audio.CPUPercent
+	if u.video.GPUSampled {
+		st.VideoEncoderGPUPercent = u.video.GPUPercent
+		st.VideoEncoderNVENCPercent = u.video.NVENCPercent
+	}
+}
+
+// cpuTracker turns cumulative CPU time into a utilisation percentage.
+type cpuTracker struct {
+	pid      int
+	lastCPU  time.Duration
+	lastWall time.Time
+}
+
+// sample returns the CPU utilisation since the previous call, or zero on
+// the first call or when the process cannot be read.
+func (c *cpuTracker) sample(now time.Time) float64 {
+	cpu, err := processCPUTime(c.pid)
+	if err != nil {
+		return 0
+	}
+	var percent float64
+	if !c.lastWall.IsZero() {
+		if wall := now.Sub(c.lastWall); wall > 0 {
+			percent = 100 * float64(cpu-c.lastCPU) / float64(wall)
+		}
+	}
+	c.lastCPU, c.lastWall = cpu, now
+	return percent
+}
+
+// processCPUTime reads the user plus system CPU time of pid from
+// /proc/<pid>/stat.
+func processCPUTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name is parenthesised and may contain spaces, so the
+	// fields are counted from the closing parenthesis.
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := bytes.Fields(data[end+1:])
+	// utime and stime are fields 14 and 15 of the full line; after the
+	// command name the state is field 3, so they sit at index 11 and 12.
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("short /proc/%d/stat", pid)
+	}
+	utime, err := strconv.ParseInt(string(fields[11]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(string(fields[12]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
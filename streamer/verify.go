@@ -0,0 +1,107 @@
+package streamer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v4"
+)
+
+// verifyTimeout bounds how long verifyPublish waits for RTP on every track
+// once it has joined.
+const verifyTimeout = 15 * time.Second
+
+// verifyPublish joins the room as a hidden subscriber, subscribes to our
+// own tracks and waits for an RTP packet on each, then leaves.
+func (s *Streamer) verifyPublish() error {
+	start := time.Now()
+	received := make(chan string, 2)
+	roomCB := &lksdk.RoomCallback{
+		ParticipantCallback: lksdk.ParticipantCallback{
+			OnTrackSubscribed: func(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+				if rp.Identity() != s.cfg.Identity {
+					return
+				}
+				go func() {
+					track.SetReadDeadline(time.Now().Add(verifyTimeout))
+					if _, _, err := track.ReadRTP(); err == nil {
+						received <- publication.Name()
+					}
+				}()
+			},
+		},
+	}
+
+	token, err := verifierToken(s.cfg)
+	if err != nil {
+		return err
+	}
+	room, err := s.connectRoom(func() (*lksdk.Room, error) {
+		return lksdk.ConnectToRoomWithToken(s.cfg.URL, token, roomCB, lksdk.WithAutoSubscribe(false))
+	})
+	if err != nil {
+		return fmt.Errorf("joining as publish verifier: %w", err)
+	}
+	defer room.Disconnect()
+
+	self := room.GetParticipantByIdentity(s.cfg.Identity)
+	if self == nil {
+		return fmt.Errorf("%w: verifier does not see %s in the room", ErrPublishFailed, s.cfg.Identity)
+	}
+	pending := make(map[string]bool)
+	for _, pub := range self.TrackPublications() {
+		if rpub, ok := pub.(*lksdk.RemoteTrackPublication); ok {
+			pending[rpub.Name()] = true
+			if err := rpub.SetSubscribed(true); err != nil {
+				return fmt.Errorf("%w: verifier subscribing to %s: %w", ErrPublishFailed, rpub.Name(), err)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return fmt.Errorf("%w: verifier sees no tracks from %s", ErrPublishFailed, s.cfg.Identity)
+	}
+
+	timeout := time.After(verifyTimeout)
+	for len(pending) > 0 {
+		select {
+		case name := <-received:
+			delete(pending, name)
+		case <-timeout:
+			var missing []string
+			for name := range pending {
+				missing = append(missing, name)
+			}
+			return fmt.Errorf("%w: no RTP received on %s within %v", ErrPublishFailed, strings.Join(missing, ", "), verifyTimeout)
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+	s.log.infof("Publish verified: media received on every track after %v", time.Since(start))
+	return nil
+}
+
+// verifierToken mints a token for a hidden, subscribe-only participant, so
+// other clients never see the verifier join.
+func verifierToken(cfg Config) (string, error) {
+	canPublish, canSubscribe := false, true
+	token, err := auth.NewAccessToken(cfg.APIKey, cfg.APISecret).
+		SetIdentity(cfg.Identity + "-verify").
+		SetName(cfg.ParticipantName + " (verify)").
+		SetValidFor(time.Hour).
+		SetVideoGrant(&auth.VideoGrant{
+			RoomJoin:       true,
+			Room:           cfg.RoomName,
+			CanPublish:     &canPublish,
+			CanPublishData: &canPublish,
+			CanSubscribe:   &canSubscribe,
+			Hidden:         true,
+		}).
+		ToJWT()
+	if err != nil {
+		return "", fmt.Errorf("creating verifier token: %w", err)
+	}
+	return token, nil
+}
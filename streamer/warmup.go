@@ -0,0 +1,76 @@
+package streamer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// warmupTimeout bounds how long warmUpEncoder waits for the encoder's
+// first output.
+const warmupTimeout = 10 * time.Second
+
+// warmUpEncoder feeds black frames to a freshly started video encoder at
+// the configured frame rate until it produces output, so NVENC has created
+// its session and emitted the stream's first IDR before real frames
+// arrive. The output read while waiting is not discarded: the returned
+// reader replays it ahead of the rest of stdout, so the published stream
+// opens with those few black frames and stays decodable.
+func (s *Streamer) warmUpEncoder(stdin io.Writer, stdout io.ReadCloser) (io.ReadCloser, error) {
+	start := time.Now()
+	frame := s.cfg.PixelFormat.blackFrame(int(s.frameWidth), int(s.frameHeight))
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	output := make(chan result, 1)
+	go func() {
+		buf := make([]byte, 64*1024)
+		n, err := stdout.Read(buf)
+		output <- result{buf[:n], err}
+	}()
+
+	stop := make(chan struct{})
+	fed := make(chan int, 1)
+	go func() {
+		frames := 0
+		defer func() { fed <- frames }()
+		ticker := time.NewTicker(s.cfg.frameInterval())
+		defer ticker.Stop()
+		for {
+			if _, err := stdin.Write(frame); err != nil {
+				return
+			}
+			frames++
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var res result
+	select {
+	case res = <-output:
+	case <-time.After(warmupTimeout):
+		res.err = errors.New("no output")
+	case <-s.ctx.Done():
+		res.err = s.ctx.Err()
+	}
+	close(stop)
+	if res.err != nil {
+		// The caller closes the encoder pipes, which releases both goroutines.
+		return nil, fmt.Errorf("warming up video encoder: %w", res.err)
+	}
+	frames := <-fed
+	s.log.infof("[Video] Encoder warmed up in %v after %d black frame(s)", time.Since(start), frames)
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(res.data), stdout), stdout}, nil
+}
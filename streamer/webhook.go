@@ -0,0 +1,38 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NewStatsWebhook returns an OnShutdown hook that POSTs the final stats as
+// JSON to url.
+func NewStatsWebhook(url string, timeout time.Duration) func(Stats) error {
+	client := &http.Client{Timeout: timeout}
+	return func(st Stats) error {
+		body, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("posting stats to %s: %w", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("posting stats to %s: %s", url, resp.Status)
+		}
+		return nil
+	}
+}